@@ -0,0 +1,51 @@
+// Package adminserver runs the http server for operators (metrics), separate from the public API.
+package adminserver
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/metrics"
+)
+
+// Server _
+type Server struct {
+	server http.Server
+}
+
+// NewServer _
+func NewServer() *Server {
+	s := &Server{}
+	s.server = http.Server{
+		Addr:    config.AdminServerAddress,
+		Handler: s.Router(),
+	}
+	return s
+}
+
+// Run starts admin http server.
+func (s *Server) Run() {
+	logger.Log.Info("Admin server starts", zap.String("addr", config.AdminServerAddress))
+
+	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
+		// listener start or stop errors
+		logger.Log.Panic("Admin Server ListenAndServe", zap.String("err", err.Error()))
+	}
+}
+
+// Stop stops admin http server.
+func (s *Server) Stop(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// Router sets the routes.
+func (s *Server) Router() chi.Router {
+	r := chi.NewRouter()
+	r.Method(http.MethodGet, "/metrics", metrics.Handler())
+	return r
+}
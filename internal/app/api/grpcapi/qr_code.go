@@ -0,0 +1,18 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/zasuchilas/shortener/internal/app/converter"
+	desc "github.com/zasuchilas/shortener/pkg/shortenergrpcv1"
+)
+
+// QRCode _
+func (i *Implementation) QRCode(ctx context.Context, in *desc.QRCodeRequest) (*desc.QRCodeResponse, error) {
+	out, err := i.shortenerService.QRCode(ctx, in.ShortUrl, converter.ToQROptionsFromGRPC(in))
+	if err != nil {
+		return nil, userURLErrorStatus(err)
+	}
+
+	return converter.ToGRPCFromQRCode(out), nil
+}
@@ -7,6 +7,7 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"github.com/zasuchilas/shortener/internal/app/model"
 	"github.com/zasuchilas/shortener/internal/app/repository"
 	desc "github.com/zasuchilas/shortener/pkg/shortenergrpcv1"
 )
@@ -14,7 +15,11 @@ import (
 // ReadURL _
 func (i *Implementation) ReadURL(ctx context.Context, in *desc.ReadURLRequest) (*desc.ReadURLResponse, error) {
 
-	origURL, err := i.shortenerService.ReadURL(ctx, in.ShortUrl)
+	origURL, err := i.shortenerService.ReadURL(ctx, model.OpenURLIn{
+		ShortURL: in.ShortUrl,
+		Path:     in.Path,
+		Query:    in.Query,
+	})
 	if err != nil {
 		if errors.Is(err, repository.ErrGone) {
 			return nil, status.Errorf(codes.DataLoss, "%s is gone.", in.ShortUrl)
@@ -2,6 +2,9 @@ package grpcapi
 
 import (
 	"context"
+	"errors"
+
+	"github.com/zasuchilas/shortener/internal/app/model"
 	desc "github.com/zasuchilas/shortener/pkg/shortenergrpcv1"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -12,8 +15,11 @@ func (i *Implementation) Shorten(ctx context.Context, in *desc.ShortenRequest) (
 
 	userID := int64(1)
 
-	readyURL, conflict, err := i.shortenerService.WriteURL(ctx, in.Url, userID)
+	readyURL, conflict, err := i.shortenerService.WriteURL(ctx, in.Url, in.Domain, userID)
 	if err != nil {
+		if errors.Is(err, model.ErrBadRequest) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
@@ -2,8 +2,11 @@ package grpcapi
 
 import (
 	"context"
+	"errors"
+
 	"github.com/zasuchilas/shortener/internal/app/converter"
 	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/model"
 	desc "github.com/zasuchilas/shortener/pkg/shortenergrpcv1"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
@@ -15,9 +18,13 @@ func (i *Implementation) ShortenBatch(ctx context.Context, in *desc.ShortenBatch
 
 	userID := int64(1)
 
-	out, err := i.shortenerService.ShortenBatch(ctx, converter.ToShortenBatchInFromGRPC(in), userID)
+	out, err := i.shortenerService.ShortenBatch(ctx, converter.ToShortenBatchInFromGRPC(in), in.Domain, userID)
 	if err != nil {
 		logger.Log.Debug("shorten batch", zap.Error(err))
+		var batchErr *model.BatchError
+		if errors.As(err, &batchErr) {
+			return nil, converter.ToGRPCStatusFromBatchError(batchErr).Err()
+		}
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
@@ -0,0 +1,87 @@
+package grpcapi
+
+import (
+	"errors"
+	"io"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/zasuchilas/shortener/internal/app/converter"
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/service"
+	desc "github.com/zasuchilas/shortener/pkg/shortenergrpcv1"
+)
+
+// ShortenStreamMaxItems is the maximum number of items in one ShortenStream (all the results are in one response).
+const ShortenStreamMaxItems = 50000
+
+// ShortenStream shortens the URLs of the client stream in chunks (a chunk is one storage transaction).
+//
+// The next messages are received only after the chunk is written, so the flow control of the stream
+// holds the client back while the storage is busy. If the client cancels the stream, the written chunks are kept.
+func (i *Implementation) ShortenStream(stream desc.ShortenerV1_ShortenStreamServer) error {
+	userID := int64(1)
+	ctx := stream.Context()
+
+	res := &desc.ShortenStreamResponse{}
+	chunk := make([]model.ShortenBatchIn, 0, service.ShortenChunkSize)
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		out, err := i.shortenerService.ShortenChunk(ctx, chunk, userID)
+		if err != nil {
+			logger.FromContext(ctx).Error("shorten stream chunk", zap.Int("written", len(res.Items)), zap.Error(err))
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return status.FromContextError(ctxErr).Err()
+			}
+			return status.Errorf(codes.Internal, "%d items are written, the next chunk has failed: %s", len(res.Items), err)
+		}
+		for _, item := range out {
+			if item.Error != "" {
+				res.Failed++
+			} else {
+				res.Shortened++
+			}
+			res.Items = append(res.Items, converter.ToGRPCFromShortenItemOut(item))
+		}
+		chunk = chunk[:0]
+		return nil
+	}
+
+	for received := 0; ; {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// the stream is canceled or broken, the written chunks are kept
+			return err
+		}
+
+		received += len(in.Items)
+		if received > ShortenStreamMaxItems {
+			return status.Errorf(codes.InvalidArgument,
+				"more than %d items in the stream (%d items are written)", ShortenStreamMaxItems, len(res.Items))
+		}
+		for _, item := range in.Items {
+			chunk = append(chunk, model.ShortenBatchIn{
+				CorrelationID: item.CorrelationId,
+				OriginalURL:   item.OriginalUrl,
+			})
+			if len(chunk) == service.ShortenChunkSize {
+				if err = flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(res)
+}
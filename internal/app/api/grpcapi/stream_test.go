@@ -0,0 +1,130 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+	"github.com/zasuchilas/shortener/internal/app/secure"
+	"github.com/zasuchilas/shortener/internal/app/service/shortener"
+	desc "github.com/zasuchilas/shortener/pkg/shortenergrpcv1"
+)
+
+// newTestClient starts the gRPC server with RAM storage on the in-memory listener.
+//
+// The hosts are not resolved (example.com is allowed without the network).
+func newTestClient(t *testing.T) desc.ShortenerV1Client {
+	config.AllowPrivateNetworks = true
+	t.Cleanup(func() { config.AllowPrivateNetworks = false })
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	service := shortener.NewService(repository.NewDBMaps(), secure.New("supersecretkey", "", ""))
+	desc.RegisterShortenerV1Server(server, NewImplementation(service))
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return desc.NewShortenerV1Client(conn)
+}
+
+func TestShortenStream(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	stream, err := client.ShortenStream(ctx)
+	require.NoError(t, err)
+	const total = 250
+	for i := 0; i < total; i += 10 {
+		msg := &desc.ShortenStreamRequest{}
+		for j := i; j < i+10; j++ {
+			origURL := fmt.Sprintf("https://example.com/%d", j)
+			if j%50 == 7 {
+				origURL = "javascript:alert(1)"
+			}
+			msg.Items = append(msg.Items, &desc.ShortenBatchRequest_Item{CorrelationId: fmt.Sprint(j), OriginalUrl: origURL})
+		}
+		require.NoError(t, stream.Send(msg))
+	}
+	res, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(total-5), res.Shortened)
+	assert.Equal(t, int32(5), res.Failed)
+	require.Len(t, res.Items, total)
+	for i, item := range res.Items {
+		assert.Equal(t, fmt.Sprint(i), item.CorrelationId)
+		if i%50 == 7 {
+			assert.NotEmpty(t, item.Error)
+			assert.Empty(t, item.ShortUrl)
+		} else {
+			assert.Empty(t, item.Error)
+			assert.NotEmpty(t, item.ShortUrl)
+		}
+	}
+
+	// the exported pages have all the written URLs
+	export, err := client.StreamUserURLs(ctx, &desc.UserURLsRequest{Limit: 100})
+	require.NoError(t, err)
+	pages, urls := 0, 0
+	for {
+		page, e := export.Recv()
+		if e != nil {
+			break
+		}
+		pages++
+		urls += len(page.UserUrls)
+		assert.Equal(t, urls < total-5, page.NextCursor != "")
+	}
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, total-5, urls)
+}
+
+func TestStreamUserURLs_cancel(t *testing.T) {
+	client := newTestClient(t)
+
+	// the export is larger than the flow control window, so the server waits for the client
+	stream, err := client.ShortenStream(context.Background())
+	require.NoError(t, err)
+	for i := 0; i < 2000; i++ {
+		item := &desc.ShortenBatchRequest_Item{OriginalUrl: fmt.Sprintf("https://example.com/%d", i)}
+		require.NoError(t, stream.Send(&desc.ShortenStreamRequest{Items: []*desc.ShortenBatchRequest_Item{item}}))
+	}
+	_, err = stream.CloseAndRecv()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	export, err := client.StreamUserURLs(ctx, &desc.UserURLsRequest{Limit: 1})
+	require.NoError(t, err)
+	_, err = export.Recv()
+	require.NoError(t, err)
+
+	cancel()
+	for err == nil {
+		_, err = export.Recv()
+	}
+	assert.Equal(t, codes.Canceled, status.Code(err))
+
+	// the wrong request is rejected before the stream starts
+	export, err = client.StreamUserURLs(context.Background(), &desc.UserURLsRequest{Sort: "title"})
+	require.NoError(t, err)
+	_, err = export.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,72 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/zasuchilas/shortener/internal/app/converter"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	desc "github.com/zasuchilas/shortener/pkg/shortenergrpcv1"
+)
+
+// UpdateURL _
+func (i *Implementation) UpdateURL(ctx context.Context, in *desc.UpdateURLRequest) (*desc.UpdateURLResponse, error) {
+	userID := int64(1)
+
+	out, err := i.shortenerService.UpdateURL(ctx, in.ShortUrl, in.OriginalUrl, userID)
+	if err != nil {
+		return nil, userURLErrorStatus(err)
+	}
+
+	return converter.ToGRPCFromUpdatedURL(out), nil
+}
+
+// URLRevisions _
+func (i *Implementation) URLRevisions(ctx context.Context, in *desc.URLRevisionsRequest) (*desc.URLRevisionsResponse, error) {
+	userID := int64(1)
+
+	out, err := i.shortenerService.URLRevisions(ctx, in.ShortUrl, userID)
+	if err != nil {
+		return nil, userURLErrorStatus(err)
+	}
+
+	return converter.ToGRPCFromURLRevisions(out), nil
+}
+
+// URLOptions _
+func (i *Implementation) URLOptions(ctx context.Context, in *desc.URLOptionsRequest) (*desc.URLOptionsResponse, error) {
+	userID := int64(1)
+
+	opts, err := converter.ToURLOptionsFromGRPC(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	out, err := i.shortenerService.UpdateURLOptions(ctx, in.ShortUrl, opts, userID)
+	if err != nil {
+		return nil, userURLErrorStatus(err)
+	}
+
+	return converter.ToGRPCFromURLOptions(out), nil
+}
+
+// userURLErrorStatus returns the gRPC status of the user short URL error.
+func userURLErrorStatus(err error) error {
+	switch {
+	case errors.Is(err, model.ErrBadRequest):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, model.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, model.ErrGone):
+		return status.Error(codes.DataLoss, err.Error())
+	case errors.Is(err, model.ErrForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, model.ErrConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
@@ -0,0 +1,68 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/zasuchilas/shortener/internal/app/converter"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	desc "github.com/zasuchilas/shortener/pkg/shortenergrpcv1"
+)
+
+// UserURLs _
+func (i *Implementation) UserURLs(ctx context.Context, in *desc.UserURLsRequest) (*desc.UserURLsResponse, error) {
+	userID := int64(1)
+
+	q, err := converter.ToUserURLsQueryFromGRPC(in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	out, err := i.shortenerService.UserURLs(ctx, userID, q)
+	if err != nil {
+		if errors.Is(err, model.ErrNoContent) {
+			return &desc.UserURLsResponse{}, nil
+		}
+		return nil, userURLErrorStatus(err)
+	}
+
+	return converter.ToGRPCFromUserURLs(out), nil
+}
+
+// StreamUserURLs sends the pages of the user URLs one by one (the limit of the request is the page size).
+//
+// The next page is read only after the previous one is sent, so the flow control of the stream
+// holds the reading back while the client is slow. Every page has the cursor to resume the export.
+func (i *Implementation) StreamUserURLs(in *desc.UserURLsRequest, stream desc.ShortenerV1_StreamUserURLsServer) error {
+	userID := int64(1)
+	ctx := stream.Context()
+
+	q, err := converter.ToUserURLsQueryFromGRPC(in)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+
+		out, err := i.shortenerService.UserURLs(ctx, userID, q)
+		if err != nil {
+			if errors.Is(err, model.ErrNoContent) {
+				return nil
+			}
+			return userURLErrorStatus(err)
+		}
+		if err = stream.Send(converter.ToGRPCFromUserURLs(out)); err != nil {
+			return err
+		}
+		if out.NextCursor == "" {
+			return nil
+		}
+		q.Cursor = out.NextCursor
+	}
+}
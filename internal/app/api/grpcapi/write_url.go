@@ -2,10 +2,12 @@ package grpcapi
 
 import (
 	"context"
+	"errors"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"github.com/zasuchilas/shortener/internal/app/model"
 	desc "github.com/zasuchilas/shortener/pkg/shortenergrpcv1"
 )
 
@@ -14,8 +16,11 @@ func (i *Implementation) WriteURL(ctx context.Context, in *desc.WriteURLRequest)
 
 	userID := int64(1)
 
-	readyURL, conflict, err := i.shortenerService.WriteURL(ctx, in.RawUrl, userID)
+	readyURL, conflict, err := i.shortenerService.WriteURL(ctx, in.RawUrl, in.Domain, userID)
 	if err != nil {
+		if errors.Is(err, model.ErrBadRequest) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
@@ -0,0 +1,46 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/converter"
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/pkg/shortenerhttpv1"
+)
+
+// HealthzHandler is the handler for GET /healthz (liveness).
+//
+// The process is alive if it is able to respond, the dependencies are not checked.
+func (i *Implementation) HealthzHandler(w http.ResponseWriter, _ *http.Request) {
+	writeHealth(w, http.StatusOK, shortenerhttpv1.HealthResponse{Status: model.HealthStatusOK})
+}
+
+// ReadyzHandler is the handler for GET /readyz (readiness).
+//
+// Returns 503 Service Unavailable if any of the checks has failed.
+func (i *Implementation) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	report := i.shortenerService.Health(r.Context())
+
+	status := http.StatusOK
+	if report.Status != model.HealthStatusOK {
+		logger.Log.Info("the service is not ready", zap.Any("checks", report.Checks))
+		status = http.StatusServiceUnavailable
+	}
+
+	writeHealth(w, status, converter.ToHTTPFromHealthReport(report))
+}
+
+func writeHealth(w http.ResponseWriter, status int, resp shortenerhttpv1.HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(resp); err != nil {
+		logger.Log.Debug("error encoding response", zap.String("error", err.Error()))
+	}
+}
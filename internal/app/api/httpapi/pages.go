@@ -0,0 +1,90 @@
+package httpapi
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/model"
+)
+
+// pageData is the data of the preview and interstitial pages.
+type pageData struct {
+	*model.OpenedURL
+	Destination string // the destination link (the URLs without a scheme are made absolute)
+}
+
+// pageFuncs are the functions of the page templates.
+var pageFuncs = template.FuncMap{
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return "unknown"
+		}
+		return t.UTC().Format("2 Jan 2006 15:04 MST")
+	},
+}
+
+// previewPage is the link preview page (the short URL with the "+" suffix or the link with the preview option).
+var previewPage = template.Must(template.New("preview").Funcs(pageFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>{{if .Title}}{{.Title}}{{else}}Link preview{{end}}</title>
+</head>
+<body>
+<h1>{{if .Title}}{{.Title}}{{else}}Link preview{{end}}</h1>
+<p>The short link <b>{{.ShortURL}}</b> leads to:</p>
+<p><a href="{{.Destination}}" rel="noopener noreferrer nofollow">{{.OrigURL}}</a></p>
+{{if .Flagged}}<p><b>Warning:</b> the destination is flagged by the safety checks, be careful.</p>
+{{end}}<ul>
+<li>Created: {{date .Created}}</li>
+<li>Clicks: {{.Clicks}}</li>
+</ul>
+<p><a href="{{.Destination}}" rel="noopener noreferrer nofollow">Continue to the destination</a></p>
+</body>
+</html>
+`))
+
+// interstitialPage is the "you are leaving" page for the flagged destinations.
+var interstitialPage = template.Must(template.New("interstitial").Funcs(pageFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>You are leaving</title>
+</head>
+<body>
+<h1>You are leaving</h1>
+<p>The short link <b>{{.ShortURL}}</b> leads to the destination flagged by the safety checks:</p>
+<p><b>{{.OrigURL}}</b></p>
+<p>Continue only if you trust this site.</p>
+<p><a href="{{.Destination}}" rel="noopener noreferrer nofollow">Continue to the destination</a></p>
+</body>
+</html>
+`))
+
+// writePage renders the page of the opened short URL.
+func writePage(w http.ResponseWriter, page *template.Template, opened *model.OpenedURL) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(http.StatusOK)
+
+	data := pageData{OpenedURL: opened, Destination: absoluteURL(opened.OrigURL)}
+	if err := page.Execute(w, data); err != nil {
+		logger.Log.Debug("error rendering page", zap.String("page", page.Name()), zap.String("error", err.Error()))
+	}
+}
+
+// absoluteURL adds the http scheme to the URL without a scheme (ya.ru/path), so the link is not relative.
+func absoluteURL(origURL string) string {
+	if u, err := url.Parse(origURL); err == nil && u.Scheme != "" {
+		return origURL
+	}
+	return "http://" + origURL
+}
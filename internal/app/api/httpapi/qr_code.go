@@ -0,0 +1,58 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/pkg/qrcode"
+)
+
+// QRCodeHandler is the handler for GET /api/qr/{shortURL}.
+//
+// Query parameters: format (png or svg), size (pixels), level (L, M, Q or H), margin (modules).
+func (i *Implementation) QRCodeHandler(w http.ResponseWriter, r *http.Request) {
+
+	opts, err := qrOptionsFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out, err := i.shortenerService.QRCode(r.Context(), shortURLParam(r), opts)
+	if err != nil {
+		http.Error(w, err.Error(), userURLErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", out.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(out.Data)))
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(out.Data); err != nil {
+		logger.Log.Debug("error writing response", zap.String("error", err.Error()))
+	}
+}
+
+// qrOptionsFromQuery parses the QR code options from the query parameters.
+func qrOptionsFromQuery(r *http.Request) (opts model.QROptions, err error) {
+	query := r.URL.Query()
+
+	opts.Format = query.Get("format")
+	opts.Level = query.Get("level")
+	opts.Margin = qrcode.DefaultMargin
+	if v := query.Get("size"); v != "" {
+		if opts.Size, err = strconv.Atoi(v); err != nil {
+			return opts, err
+		}
+	}
+	if v := query.Get("margin"); v != "" {
+		if opts.Margin, err = strconv.Atoi(v); err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, nil
+}
@@ -3,28 +3,82 @@ package httpapi
 import (
 	"errors"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
 
-	"github.com/zasuchilas/shortener/internal/app/repository"
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/model"
 )
 
-// ReadURLHandler is the handler for GET /{shortURL}.
+// ReadURLHandler is the handler for GET and HEAD /{shortURL} and /{shortURL}/extra/path.
+//
+// The visitor is redirected, or the preview page (/{shortURL}+ or the link with the preview option)
+// or the "you are leaving" page (the flagged destination) is shown.
+// The extra path and the query are passed to the destination by the link options.
 func (i *Implementation) ReadURLHandler(w http.ResponseWriter, r *http.Request) {
 
-	shortURL := chi.URLParam(r, "shortURL")
+	in := model.OpenURLIn{
+		ShortURL: chi.URLParam(r, "shortURL"),
+		Head:     r.Method == http.MethodHead,
+		Query:    r.URL.RawQuery,
+		Host:     r.Host,
+	}
+	// the escaped path is used, so the encoded slashes and the other escapes are forwarded as they are
+	if first, rest, found := strings.Cut(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/"); found {
+		in.Path = "/" + rest
+		if in.ShortURL == "" {
+			in.ShortURL, _ = url.PathUnescape(first)
+		}
+	}
 
-	origURL, err := i.shortenerService.ReadURL(r.Context(), shortURL)
+	opened, err := i.shortenerService.OpenURL(r.Context(), in)
 	if err != nil {
-		if errors.Is(err, repository.ErrGone) {
-			http.Error(w, err.Error(), http.StatusGone)
-			return
+		switch {
+		case errors.Is(err, model.ErrNotFound):
+			http.Error(w, "the short URL is not found", http.StatusNotFound)
+		case errors.Is(err, model.ErrBadRequest):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, model.ErrGone):
+			http.Error(w, "the short URL is deleted or expired", http.StatusGone)
+		default:
+			logger.FromContext(r.Context()).Error("opening short URL", zap.String("shortURL", in.ShortURL), zap.Error(err))
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	switch opened.Mode {
+	case model.OpenPreview:
+		writePage(w, previewPage, opened)
+	case model.OpenInterstitial:
+		writePage(w, interstitialPage, opened)
+	default:
+		setRedirectCacheHeaders(w, opened)
+		w.Header().Set("Location", opened.OrigURL)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(opened.Code)
+		if _, err = w.Write([]byte(opened.OrigURL + "\n")); err != nil {
+			logger.Log.Debug("error writing response", zap.String("error", err.Error()))
 		}
-		http.Error(w, err.Error(), http.StatusBadRequest) // according to the assignment, so, but postgresql may give an internal error
+	}
+}
+
+// setRedirectCacheHeaders sets Cache-Control and Expires of the redirect.
+//
+// The redirect that must not be cached is already expired.
+func setRedirectCacheHeaders(w http.ResponseWriter, opened *model.OpenedURL) {
+	now := time.Now()
+	if opened.CacheMaxAge <= 0 {
+		w.Header().Set("Cache-Control", "private, no-cache")
+		w.Header().Set("Expires", now.UTC().Format(http.TimeFormat))
 		return
 	}
 
-	w.Header().Set("Location", origURL)
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(http.StatusTemporaryRedirect)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(opened.CacheMaxAge.Seconds())))
+	w.Header().Set("Expires", now.Add(opened.CacheMaxAge).UTC().Format(http.TimeFormat))
 }
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 
 	"github.com/zasuchilas/shortener/internal/app/logger"
@@ -48,3 +49,13 @@ func GetUserID(r *http.Request) (userID int64, err error) {
 
 	return userID, nil
 }
+
+// shortURLParam returns the short URL of the path, the domain query parameter chooses the domain of the short URL
+// (the short URL of the path may also be domain/code).
+func shortURLParam(r *http.Request) string {
+	shortURL := chi.URLParam(r, "shortURL")
+	if domain := r.URL.Query().Get("domain"); domain != "" {
+		return domain + "/" + shortURL
+	}
+	return shortURL
+}
@@ -1,13 +1,17 @@
 package httpapi
 
 import (
+	"encoding/base64"
 	"encoding/json"
-	"github.com/zasuchilas/shortener/internal/app/converter"
+	"errors"
 	"net/http"
 
 	"go.uber.org/zap"
 
+	"github.com/zasuchilas/shortener/internal/app/converter"
 	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/pkg/qrcode"
 	"github.com/zasuchilas/shortener/pkg/shortenerhttpv1"
 )
 
@@ -30,8 +34,12 @@ func (i *Implementation) ShortenHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	readyURL, conflict, err := i.shortenerService.WriteURL(r.Context(), req.URL, userID)
+	readyURL, conflict, err := i.shortenerService.WriteURL(r.Context(), req.URL, req.Domain, userID)
 	if err != nil {
+		if errors.Is(err, model.ErrBadRequest) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -45,6 +53,14 @@ func (i *Implementation) ShortenHandler(w http.ResponseWriter, r *http.Request)
 
 	enc := json.NewEncoder(w)
 	resp := converter.ToHTTPShortenFromURL(readyURL)
+	if req.QR {
+		qr, er := i.shortenerService.ReadyURLQRCode(r.Context(), readyURL, model.QROptions{Margin: qrcode.DefaultMargin})
+		if er != nil {
+			logger.Log.Error("rendering the QR code", zap.Error(er))
+		} else {
+			resp.QR = base64.StdEncoding.EncodeToString(qr.Data)
+		}
+	}
 	if err = enc.Encode(resp); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
@@ -2,16 +2,23 @@ package httpapi
 
 import (
 	"encoding/json"
+	"errors"
+	"mime"
 	"net/http"
 
 	"go.uber.org/zap"
 
 	"github.com/zasuchilas/shortener/internal/app/converter"
 	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/model"
 	"github.com/zasuchilas/shortener/pkg/shortenerhttpv1"
 )
 
 // ShortenBatchHandler is the handler for POST /api/shorten/batch.
+//
+// The JSON array is shortened as a whole (a wrong item fails the batch), the domain query parameter chooses
+// the domain of the short URLs.
+// The NDJSON and CSV uploads are processed in chunks with the streamed results (see shortenUpload).
 func (i *Implementation) ShortenBatchHandler(w http.ResponseWriter, r *http.Request) {
 
 	// getting userID from context
@@ -21,19 +28,39 @@ func (i *Implementation) ShortenBatchHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case shortenerhttpv1.ContentTypeNDJSON:
+		i.shortenUpload(w, r, userID, newNDJSONUpload(r.Body), newNDJSONResults(w))
+		return
+	case shortenerhttpv1.ContentTypeCSV:
+		i.shortenUpload(w, r, userID, newCSVUpload(r.Body), newCSVResults(w))
+		return
+	}
+
 	// decoding request
 	var req []shortenerhttpv1.ShortenBatchRequestItem
 	dec := json.NewDecoder(r.Body)
 	if err = dec.Decode(&req); err != nil {
 		logger.Log.Debug("cannot decode request JSON body", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		http.Error(w, "cannot decode request JSON body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	out, err := i.shortenerService.ShortenBatch(r.Context(), converter.ToShortenBatchInFromHTTP(req), userID)
+	out, err := i.shortenerService.ShortenBatch(r.Context(), converter.ToShortenBatchInFromHTTP(req), r.URL.Query().Get("domain"), userID)
 	if err != nil {
 		logger.Log.Debug("shorten batch", zap.Error(err))
+		var batchErr *model.BatchError
+		if errors.As(err, &batchErr) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			if err = json.NewEncoder(w).Encode(converter.ToHTTPFromBatchError(batchErr)); err != nil {
+				logger.Log.Debug("error encoding response", zap.String("error", err.Error()))
+			}
+			return
+		}
 		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	// encoding response
@@ -0,0 +1,183 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/converter"
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/service"
+	"github.com/zasuchilas/shortener/pkg/shortenerhttpv1"
+)
+
+// ShortenJobResultsPage is the number of the job results read from the storage at once.
+const ShortenJobResultsPage = 1000
+
+// ShortenJobHandler is the handler for POST /api/jobs/shorten.
+//
+// The upload is saved as the job and the response is 202 Accepted without waiting for the shortening,
+// the Location header is the address of the job progress.
+func (i *Implementation) ShortenJobHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := GetUserID(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var lines []model.ShortenJobLine
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case shortenerhttpv1.ContentTypeNDJSON:
+		lines, err = readShortenJobLines(newNDJSONUpload(r.Body))
+	case shortenerhttpv1.ContentTypeCSV:
+		lines, err = readShortenJobLines(newCSVUpload(r.Body))
+	default:
+		var req []shortenerhttpv1.ShortenBatchRequestItem
+		if err = json.NewDecoder(r.Body).Decode(&req); err == nil {
+			lines = converter.ToShortenJobLinesFromHTTP(req)
+		}
+	}
+	if err != nil {
+		logger.Log.Debug("cannot read the job upload", zap.Error(err))
+		http.Error(w, "cannot read the job upload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out, err := i.shortenerService.SubmitShortenJob(r.Context(), lines, userID)
+	if err != nil {
+		http.Error(w, err.Error(), userURLErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/jobs/"+strconv.FormatInt(out.ID, 10))
+	w.WriteHeader(http.StatusAccepted)
+
+	enc := json.NewEncoder(w)
+	if err = enc.Encode(converter.ToHTTPFromShortenJob(out)); err != nil {
+		logger.Log.Debug("error encoding response", zap.String("error", err.Error()))
+	}
+}
+
+// ShortenJobStatusHandler is the handler for GET /api/jobs/{id}.
+func (i *Implementation) ShortenJobStatusHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := GetUserID(r)
+	if err != nil {
+		logger.Log.Debug("getting userID from ctx", zap.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "wrong job id", http.StatusBadRequest)
+		return
+	}
+
+	out, err := i.shortenerService.ShortenJob(r.Context(), id, userID)
+	if err != nil {
+		http.Error(w, err.Error(), userURLErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	if err = enc.Encode(converter.ToHTTPFromShortenJob(out)); err != nil {
+		logger.Log.Debug("error encoding response", zap.String("error", err.Error()))
+	}
+}
+
+// ShortenJobResultHandler is the handler for GET /api/jobs/{id}/result.
+//
+// The results of the finished job are written page by page as NDJSON or CSV (if text/csv is accepted),
+// the response is 409 Conflict until the job is finished.
+func (i *Implementation) ShortenJobResultHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := GetUserID(r)
+	if err != nil {
+		logger.Log.Debug("getting userID from ctx", zap.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "wrong job id", http.StatusBadRequest)
+		return
+	}
+
+	// the first page is read before the response is started, so the errors get their statuses
+	page, err := i.shortenerService.ShortenJobResults(r.Context(), id, userID, 0, ShortenJobResultsPage)
+	if err != nil {
+		http.Error(w, err.Error(), userURLErrorStatus(err))
+		return
+	}
+
+	var results uploadResults = newNDJSONResults(w)
+	if strings.Contains(r.Header.Get("Accept"), shortenerhttpv1.ContentTypeCSV) {
+		results = newCSVResults(w)
+	}
+	w.Header().Set("Content-Type", results.contentType())
+	w.WriteHeader(http.StatusOK)
+
+	for from := 0; ; {
+		if err = results.write(converter.ToHTTPFromShortenJobLines(page)); err != nil {
+			logger.Log.Debug("error writing response", zap.String("error", err.Error()))
+			return
+		}
+		if len(page) < ShortenJobResultsPage {
+			return
+		}
+
+		from += len(page)
+		page, err = i.shortenerService.ShortenJobResults(r.Context(), id, userID, from, ShortenJobResultsPage)
+		if err != nil {
+			// the response is started, so the error is the last result
+			logger.FromContext(r.Context()).Debug("reading job results", zap.Error(err))
+			_ = results.write([]shortenerhttpv1.ShortenUploadResultItem{{Error: err.Error()}})
+			return
+		}
+	}
+}
+
+// readShortenJobLines reads all the lines of the upload (the lines that can't be decoded have the errors).
+func readShortenJobLines(reader uploadReader) ([]model.ShortenJobLine, error) {
+	lines := make([]model.ShortenJobLine, 0)
+	for {
+		l, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// the rest of the large upload is not read
+		if len(lines) == service.ShortenJobMaxLines {
+			return nil, errors.New("the upload has more than " + strconv.Itoa(service.ShortenJobMaxLines) + " lines")
+		}
+
+		line := model.ShortenJobLine{
+			Line:          l.line,
+			CorrelationID: l.item.CorrelationID,
+			OriginalURL:   l.item.OriginalURL,
+		}
+		if l.err != nil {
+			line.Error = l.err.Error()
+		}
+		lines = append(lines, line)
+	}
+}
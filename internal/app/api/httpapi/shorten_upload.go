@@ -0,0 +1,276 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/service"
+	"github.com/zasuchilas/shortener/pkg/shortenerhttpv1"
+)
+
+// UploadMaxLineSize is the maximum size of the NDJSON line or the CSV row of the upload.
+const UploadMaxLineSize = 64 * 1024
+
+// uploadLine is the line of the upload, the line that can't be decoded has the error.
+type uploadLine struct {
+	line int
+	item model.ShortenBatchIn
+	err  error
+}
+
+// uploadReader reads the lines of the upload one by one (io.EOF at the end).
+//
+// The error of the reader stops the upload, the errors of the lines do not.
+type uploadReader interface {
+	next() (uploadLine, error)
+}
+
+// uploadResults writes the results of the upload lines.
+type uploadResults interface {
+	contentType() string
+	write(items []shortenerhttpv1.ShortenUploadResultItem) error
+}
+
+// shortenUpload shortens the upload lines in chunks (a chunk is one storage transaction)
+// and streams the results of every chunk as soon as it is written.
+//
+// The response is 200 OK with the result of every line, the lines that can't be decoded or shortened
+// get the errors and do not fail the others. If the upload can't be read or the storage fails before
+// the first chunk is written, the response is 400 or 500, later the error is the last result.
+func (i *Implementation) shortenUpload(w http.ResponseWriter, r *http.Request, userID int64,
+	reader uploadReader, results uploadResults) {
+
+	ctx := r.Context()
+	// the results are written while the upload is read (HTTP/1 consumes the body before the response otherwise)
+	_ = http.NewResponseController(w).EnableFullDuplex()
+	started := false
+	fail := func(status int, err error) {
+		logger.FromContext(ctx).Debug("shorten upload", zap.Bool("started", started), zap.Error(err))
+		if !started {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if e := results.write([]shortenerhttpv1.ShortenUploadResultItem{{Error: err.Error()}}); e != nil {
+			logger.Log.Debug("error writing response", zap.Error(e))
+		}
+	}
+
+	chunk := make([]uploadLine, 0, service.ShortenChunkSize)
+	flush := func() error {
+		items := make([]model.ShortenBatchIn, 0, len(chunk))
+		for _, l := range chunk {
+			if l.err == nil {
+				items = append(items, l.item)
+			}
+		}
+		out, err := i.shortenerService.ShortenChunk(ctx, items, userID)
+		if err != nil {
+			return err
+		}
+
+		res := make([]shortenerhttpv1.ShortenUploadResultItem, len(chunk))
+		for j, l := range chunk {
+			res[j] = shortenerhttpv1.ShortenUploadResultItem{
+				Line:          l.line,
+				CorrelationID: l.item.CorrelationID,
+			}
+			if l.err != nil {
+				res[j].Error = l.err.Error()
+				continue
+			}
+			res[j].ShortURL, res[j].Error = out[0].ShortURL, out[0].Error
+			out = out[1:]
+		}
+
+		if !started {
+			started = true
+			w.Header().Set("Content-Type", results.contentType())
+			w.WriteHeader(http.StatusOK)
+		}
+		if err = results.write(res); err != nil {
+			return err
+		}
+		// the results are sent to the client without waiting for the end of the upload
+		_ = http.NewResponseController(w).Flush()
+
+		chunk = chunk[:0]
+		return nil
+	}
+
+	for {
+		l, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if len(chunk) > 0 && flush() != nil {
+				// the error of the storage is less important than the error of the upload
+				chunk = chunk[:0]
+			}
+			fail(http.StatusBadRequest, err)
+			return
+		}
+
+		chunk = append(chunk, l)
+		if len(chunk) == service.ShortenChunkSize {
+			if err = flush(); err != nil {
+				fail(http.StatusInternalServerError, err)
+				return
+			}
+		}
+	}
+	if len(chunk) > 0 || !started {
+		if err := flush(); err != nil {
+			fail(http.StatusInternalServerError, err)
+		}
+	}
+}
+
+// ndjsonUpload reads the ShortenBatchRequestItem lines, the empty lines are skipped.
+type ndjsonUpload struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONUpload(r io.Reader) *ndjsonUpload {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), UploadMaxLineSize)
+	return &ndjsonUpload{scanner: scanner}
+}
+
+func (u *ndjsonUpload) next() (uploadLine, error) {
+	for u.scanner.Scan() {
+		u.line++
+		data := strings.TrimSpace(u.scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		var req shortenerhttpv1.ShortenBatchRequestItem
+		if err := json.Unmarshal([]byte(data), &req); err != nil {
+			return uploadLine{line: u.line, err: err}, nil
+		}
+		return uploadLine{
+			line: u.line,
+			item: model.ShortenBatchIn{CorrelationID: req.CorrelationID, OriginalURL: req.OriginalURL},
+		}, nil
+	}
+	if err := u.scanner.Err(); err != nil {
+		return uploadLine{}, errors.Join(errors.New("reading the line "+strconv.Itoa(u.line+1)), err)
+	}
+	return uploadLine{}, io.EOF
+}
+
+// ndjsonResults writes the results as the NDJSON lines.
+type ndjsonResults struct {
+	enc *json.Encoder
+}
+
+func newNDJSONResults(w io.Writer) *ndjsonResults {
+	return &ndjsonResults{enc: json.NewEncoder(w)}
+}
+
+func (r *ndjsonResults) contentType() string {
+	return shortenerhttpv1.ContentTypeNDJSON
+}
+
+func (r *ndjsonResults) write(items []shortenerhttpv1.ShortenUploadResultItem) error {
+	for _, item := range items {
+		if err := r.enc.Encode(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvUploadHeader and csvResultsHeader are the header rows of the CSV upload and results.
+var (
+	csvUploadHeader  = []string{"correlation_id", "original_url"}
+	csvResultsHeader = []string{"line", "correlation_id", "short_url", "error"}
+)
+
+// csvUpload reads the correlation_id,original_url rows (the header row is skipped).
+type csvUpload struct {
+	reader *csv.Reader
+}
+
+func newCSVUpload(r io.Reader) *csvUpload {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	return &csvUpload{reader: reader}
+}
+
+func (u *csvUpload) next() (uploadLine, error) {
+	for {
+		record, err := u.reader.Read()
+		if err != nil {
+			// the broken quotes can't be skipped reliably, so they stop the upload
+			return uploadLine{}, err
+		}
+
+		line, _ := u.reader.FieldPos(0)
+		size := 0
+		for _, field := range record {
+			size += len(field)
+		}
+		if size > UploadMaxLineSize {
+			return uploadLine{}, errors.New("the CSV row " + strconv.Itoa(line) + " is longer than " +
+				strconv.Itoa(UploadMaxLineSize) + " bytes")
+		}
+		if line == 1 && len(record) == 2 && strings.EqualFold(strings.TrimSpace(record[0]), csvUploadHeader[0]) {
+			continue
+		}
+		if len(record) != 2 {
+			return uploadLine{line: line, err: errors.New("expected 2 columns: " + strings.Join(csvUploadHeader, ","))}, nil
+		}
+		return uploadLine{
+			line: line,
+			item: model.ShortenBatchIn{CorrelationID: record[0], OriginalURL: record[1]},
+		}, nil
+	}
+}
+
+// csvResults writes the results as the CSV rows with the header.
+type csvResults struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func newCSVResults(w io.Writer) *csvResults {
+	return &csvResults{w: csv.NewWriter(w)}
+}
+
+func (r *csvResults) contentType() string {
+	return shortenerhttpv1.ContentTypeCSV + "; charset=utf-8"
+}
+
+func (r *csvResults) write(items []shortenerhttpv1.ShortenUploadResultItem) error {
+	if !r.headerWritten {
+		r.headerWritten = true
+		if err := r.w.Write(csvResultsHeader); err != nil {
+			return err
+		}
+	}
+	for _, item := range items {
+		line := ""
+		if item.Line > 0 {
+			line = strconv.Itoa(item.Line)
+		}
+		if err := r.w.Write([]string{line, item.CorrelationID, item.ShortURL, item.Error}); err != nil {
+			return err
+		}
+	}
+	r.w.Flush()
+	return r.w.Error()
+}
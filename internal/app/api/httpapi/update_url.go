@@ -0,0 +1,131 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/converter"
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/pkg/shortenerhttpv1"
+)
+
+// UpdateURLHandler is the handler for PATCH /api/user/urls/{shortURL}.
+func (i *Implementation) UpdateURLHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := GetUserID(r)
+	if err != nil {
+		logger.Log.Debug("getting userID from ctx", zap.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// decoding request
+	var req shortenerhttpv1.UpdateURLRequest
+	dec := json.NewDecoder(r.Body)
+	if err = dec.Decode(&req); err != nil {
+		logger.Log.Debug("cannot decode request JSON body", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	out, err := i.shortenerService.UpdateURL(r.Context(), shortURLParam(r), req.URL, userID)
+	if err != nil {
+		http.Error(w, err.Error(), userURLErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	if err = enc.Encode(converter.ToHTTPFromUpdatedURL(out)); err != nil {
+		logger.Log.Debug("error encoding response", zap.String("error", err.Error()))
+	}
+}
+
+// URLRevisionsHandler is the handler for GET /api/user/urls/{shortURL}/revisions.
+func (i *Implementation) URLRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := GetUserID(r)
+	if err != nil {
+		logger.Log.Debug("getting userID from ctx", zap.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	out, err := i.shortenerService.URLRevisions(r.Context(), shortURLParam(r), userID)
+	if err != nil {
+		http.Error(w, err.Error(), userURLErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	if err = enc.Encode(converter.ToHTTPFromURLRevisions(out)); err != nil {
+		logger.Log.Debug("error encoding response", zap.String("error", err.Error()))
+	}
+}
+
+// URLOptionsHandler is the handler for PATCH /api/user/urls/{shortURL}/options.
+func (i *Implementation) URLOptionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := GetUserID(r)
+	if err != nil {
+		logger.Log.Debug("getting userID from ctx", zap.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// decoding request
+	var req shortenerhttpv1.URLOptionsRequest
+	dec := json.NewDecoder(r.Body)
+	if err = dec.Decode(&req); err != nil {
+		logger.Log.Debug("cannot decode request JSON body", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	opts, err := converter.ToURLOptionsFromHTTP(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out, err := i.shortenerService.UpdateURLOptions(r.Context(), shortURLParam(r), opts, userID)
+	if err != nil {
+		http.Error(w, err.Error(), userURLErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	if err = enc.Encode(converter.ToHTTPFromURLOptions(out)); err != nil {
+		logger.Log.Debug("error encoding response", zap.String("error", err.Error()))
+	}
+}
+
+// userURLErrorStatus returns the HTTP status of the user short URL error.
+func userURLErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, model.ErrBadRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, model.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, model.ErrGone):
+		return http.StatusGone
+	case errors.Is(err, model.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, model.ErrConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
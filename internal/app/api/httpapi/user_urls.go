@@ -3,7 +3,10 @@ package httpapi
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -13,7 +16,25 @@ import (
 )
 
 // UserURLsHandler is the handler for GET /api/user/urls.
+//
+// The query parameters are status (active, expired or deleted), created_from and created_to (RFC 3339),
+// domain, short_domain (the domain of the short URLs, it may be repeated), tag (the link has all the tags,
+// it may be repeated), q (the words of the title, the notes or the destination), sort (created or clicks), order (asc or desc), limit and cursor.
+// The link to the next page is in the Link header (rel="next").
 func (i *Implementation) UserURLsHandler(w http.ResponseWriter, r *http.Request) {
+	i.userURLs(w, r, false)
+}
+
+// BrokenURLsHandler is the handler for GET /api/user/urls/broken.
+//
+// The page has only the links whose destinations fail the checks of the link checker,
+// the query parameters are the same as the ones of GET /api/user/urls.
+func (i *Implementation) BrokenURLsHandler(w http.ResponseWriter, r *http.Request) {
+	i.userURLs(w, r, true)
+}
+
+// userURLs sends the page of the user URLs (only the broken ones if it is requested).
+func (i *Implementation) userURLs(w http.ResponseWriter, r *http.Request, broken bool) {
 
 	userID, err := GetUserID(r)
 	if err != nil {
@@ -22,21 +43,38 @@ func (i *Implementation) UserURLsHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	out, err := i.shortenerService.UserURLs(r.Context(), userID)
+	q, err := userURLsQueryFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.Broken = broken
+
+	out, err := i.shortenerService.UserURLs(r.Context(), userID, q)
 	if err != nil {
-		if errors.Is(err, model.ErrNoContent) {
+		switch {
+		case errors.Is(err, model.ErrNoContent):
 			w.WriteHeader(http.StatusNoContent)
-			return
+		case errors.Is(err, model.ErrBadRequest):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
 		}
-		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	if out.NextCursor != "" {
+		next := *r.URL
+		query := next.Query()
+		query.Set("cursor", out.NextCursor)
+		next.RawQuery = query.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
 	enc := json.NewEncoder(w)
-	resp := converter.ToHTTPFromUserURL(out)
+	resp := converter.ToHTTPFromUserURL(out.URLs)
 	if err = enc.Encode(resp); err != nil {
 		logger.Log.Debug("error encoding response", zap.String("error", err.Error()))
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -44,3 +82,45 @@ func (i *Implementation) UserURLsHandler(w http.ResponseWriter, r *http.Request)
 	}
 	logger.Log.Debug("sending HTTP 200 response")
 }
+
+// userURLsQueryFromRequest parses the query parameters of the user URLs page.
+func userURLsQueryFromRequest(r *http.Request) (q model.UserURLsQuery, err error) {
+	query := r.URL.Query()
+
+	q.Status = query.Get("status")
+	q.Domain = query.Get("domain")
+	if query.Has("short_domain") {
+		q.LinkDomains = query["short_domain"]
+	}
+	q.Tags = query["tag"]
+	q.Text = query.Get("q")
+	q.Sort = query.Get("sort")
+	q.Cursor = query.Get("cursor")
+	switch order := query.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, fmt.Errorf("unknown order %q (expected asc or desc)", order)
+	}
+	if v := query.Get("created_from"); v != "" {
+		if q.CreatedFrom, err = time.Parse(time.RFC3339, v); err != nil {
+			return q, err
+		}
+	}
+	if v := query.Get("created_to"); v != "" {
+		if q.CreatedTo, err = time.Parse(time.RFC3339, v); err != nil {
+			return q, err
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil {
+			return q, err
+		}
+		if q.Limit <= 0 {
+			return q, fmt.Errorf("the limit must be positive")
+		}
+	}
+
+	return q, nil
+}
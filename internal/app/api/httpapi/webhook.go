@@ -0,0 +1,132 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/converter"
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/pkg/shortenerhttpv1"
+)
+
+// CreateWebhookHandler is the handler for POST /api/user/webhooks.
+//
+// The response is 201 Created with the secret of the payload signature (it is not shown later).
+func (i *Implementation) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := GetUserID(r)
+	if err != nil {
+		logger.Log.Debug("getting userID from ctx", zap.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// decoding request
+	var req shortenerhttpv1.WebhookRequest
+	dec := json.NewDecoder(r.Body)
+	if err = dec.Decode(&req); err != nil {
+		logger.Log.Debug("cannot decode request JSON body", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	out, err := i.shortenerService.CreateWebhook(r.Context(), req.URL, req.Events, userID)
+	if err != nil {
+		http.Error(w, err.Error(), userURLErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	enc := json.NewEncoder(w)
+	if err = enc.Encode(converter.ToHTTPFromWebhook(out)); err != nil {
+		logger.Log.Debug("error encoding response", zap.String("error", err.Error()))
+	}
+}
+
+// UserWebhooksHandler is the handler for GET /api/user/webhooks.
+func (i *Implementation) UserWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := GetUserID(r)
+	if err != nil {
+		logger.Log.Debug("getting userID from ctx", zap.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	out, err := i.shortenerService.UserWebhooks(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), userURLErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	if err = enc.Encode(converter.ToHTTPFromWebhooks(out)); err != nil {
+		logger.Log.Debug("error encoding response", zap.String("error", err.Error()))
+	}
+}
+
+// DeleteWebhookHandler is the handler for DELETE /api/user/webhooks/{id}.
+func (i *Implementation) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := GetUserID(r)
+	if err != nil {
+		logger.Log.Debug("getting userID from ctx", zap.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "wrong webhook id", http.StatusBadRequest)
+		return
+	}
+
+	if err = i.shortenerService.DeleteWebhook(r.Context(), id, userID); err != nil {
+		http.Error(w, err.Error(), userURLErrorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// WebhookDeliveriesHandler is the handler for GET /api/user/webhooks/{id}/deliveries.
+//
+// The response is the delivery log of the webhook (the newest first).
+func (i *Implementation) WebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+
+	userID, err := GetUserID(r)
+	if err != nil {
+		logger.Log.Debug("getting userID from ctx", zap.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "wrong webhook id", http.StatusBadRequest)
+		return
+	}
+
+	out, err := i.shortenerService.WebhookDeliveries(r.Context(), id, userID)
+	if err != nil {
+		http.Error(w, err.Error(), userURLErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	if err = enc.Encode(converter.ToHTTPFromWebhookDeliveries(out)); err != nil {
+		logger.Log.Debug("error encoding response", zap.String("error", err.Error()))
+	}
+}
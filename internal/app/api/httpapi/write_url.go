@@ -1,11 +1,14 @@
 package httpapi
 
 import (
+	"errors"
 	"io"
 	"net/http"
+
+	"github.com/zasuchilas/shortener/internal/app/model"
 )
 
-// WriteURLHandler is the handler for POST /.
+// WriteURLHandler is the handler for POST / (the domain query parameter chooses the domain of the short URL).
 func (i *Implementation) WriteURLHandler(w http.ResponseWriter, r *http.Request) {
 
 	// getting userID from context
@@ -22,8 +25,12 @@ func (i *Implementation) WriteURLHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	readyURL, conflict, err := i.shortenerService.WriteURL(r.Context(), string(body), userID)
+	readyURL, conflict, err := i.shortenerService.WriteURL(r.Context(), string(body), r.URL.Query().Get("domain"), userID)
 	if err != nil {
+		if errors.Is(err, model.ErrBadRequest) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -13,10 +13,34 @@ type jsonConfig struct {
 	DatabaseDSN       string `json:"database_dsn"`
 	EnableHTTPS       bool   `json:"enable_https"`
 
-	SecretKey      string `json:"secret_key"`
-	SecureFilePath string `json:"secure_file_path"`
-	LogLevel       string `json:"log_level"`
-	TrustedSubnet  string `json:"trusted_subnet"`
+	SecretKey            string `json:"secret_key"`
+	SecureFilePath       string `json:"secure_file_path"`
+	LogLevel             string `json:"log_level"`
+	TrustedSubnet        string `json:"trusted_subnet"`
+	AdminServerAddress   string `json:"admin_server_address"`
+	TracingExporter      string `json:"tracing_exporter"`
+	TracingEndpoint      string `json:"tracing_endpoint"`
+	TracingFilePath      string `json:"tracing_file_path"`
+	LogMode              string `json:"log_mode"`
+	ShortenRateLimit     string `json:"shorten_rate_limit"`
+	NewUserRateLimit     string `json:"new_user_rate_limit"`
+	AllowedSchemes       string `json:"allowed_schemes"`
+	AllowPrivateNetworks bool   `json:"allow_private_networks"`
+	DomainBlocklistPath  string `json:"domain_blocklist_path"`
+	URLCanonicalization  string `json:"url_canonicalization"`
+	MigrateCanonicalURLs bool   `json:"migrate_canonical_urls"`
+	DedupMode            string `json:"dedup_mode"`
+	DomainWarnlistPath   string `json:"domain_warnlist_path"`
+	LeavingInterstitial  bool   `json:"leaving_interstitial"`
+	RedirectCode         string `json:"redirect_code"`
+	RedirectCacheMaxAge  string `json:"redirect_cache_max_age"`
+	EventBus             string `json:"event_bus"`
+	EventBusAddress      string `json:"event_bus_address"`
+	EventBusTopic        string `json:"event_bus_topic"`
+	ShortDomains         string `json:"short_domains"`
+	FetchMetadata        bool   `json:"fetch_metadata"`
+	LinkCheckInterval    string `json:"link_check_interval"`
+	LinkCheckRate        string `json:"link_check_rate"`
 }
 
 func getJSONConfig(filename string) (*jsonConfig, error) {
@@ -19,6 +19,39 @@ func TestGetJSONConfig(t *testing.T) {
 		SecretKey:         "supersecretkey",
 		SecureFilePath:    "./secure_example.db",
 		LogLevel:          "debug",
+
+		AdminServerAddress: "localhost:33337",
+		TracingExporter:    "file",
+		TracingEndpoint:    "localhost:4318",
+		TracingFilePath:    "./traces_example.json",
+		LogMode:            "production",
+		ShortenRateLimit:   "20/s",
+		NewUserRateLimit:   "30/m",
+
+		AllowedSchemes:       "http,https",
+		AllowPrivateNetworks: true,
+		DomainBlocklistPath:  "./blocklist_example.txt",
+
+		URLCanonicalization:  "basic,sort_query",
+		MigrateCanonicalURLs: true,
+		DedupMode:            "user",
+
+		DomainWarnlistPath:  "./warnlist_example.txt",
+		LeavingInterstitial: true,
+
+		RedirectCode:        "302",
+		RedirectCacheMaxAge: "1h",
+
+		EventBus:        "kafka",
+		EventBusAddress: "localhost:9092",
+		EventBusTopic:   "shortener.links",
+
+		ShortDomains: "https://go.example.com,links.example.org:8080",
+
+		FetchMetadata: true,
+
+		LinkCheckInterval: "24h",
+		LinkCheckRate:     "2/s",
 	}
 
 	res, err := getJSONConfig(filename)
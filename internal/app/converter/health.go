@@ -0,0 +1,23 @@
+package converter
+
+import (
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/pkg/shortenerhttpv1"
+)
+
+// ToHTTPFromHealthReport _
+func ToHTTPFromHealthReport(in *model.HealthReport) shortenerhttpv1.HealthResponse {
+	result := shortenerhttpv1.HealthResponse{
+		Status: in.Status,
+		Checks: make([]shortenerhttpv1.HealthCheckItem, len(in.Checks)),
+	}
+	for i := range in.Checks {
+		result.Checks[i] = shortenerhttpv1.HealthCheckItem{
+			Name:     in.Checks[i].Name,
+			Status:   in.Checks[i].Status,
+			Error:    in.Checks[i].Error,
+			Duration: in.Checks[i].Duration.String(),
+		}
+	}
+	return result
+}
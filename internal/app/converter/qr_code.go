@@ -0,0 +1,29 @@
+package converter
+
+import (
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/pkg/qrcode"
+	"github.com/zasuchilas/shortener/pkg/shortenergrpcv1"
+)
+
+// ToQROptionsFromGRPC _
+func ToQROptionsFromGRPC(in *shortenergrpcv1.QRCodeRequest) model.QROptions {
+	opts := model.QROptions{
+		Format: in.Format,
+		Size:   int(in.Size),
+		Margin: qrcode.DefaultMargin,
+		Level:  in.Level,
+	}
+	if in.Margin != nil {
+		opts.Margin = int(in.GetMargin())
+	}
+	return opts
+}
+
+// ToGRPCFromQRCode _
+func ToGRPCFromQRCode(in *model.QRCode) *shortenergrpcv1.QRCodeResponse {
+	return &shortenergrpcv1.QRCodeResponse{
+		ContentType: in.ContentType,
+		Data:        in.Data,
+	}
+}
@@ -1,6 +1,12 @@
 package converter
 
 import (
+	"fmt"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
 	"github.com/zasuchilas/shortener/internal/app/model"
 	"github.com/zasuchilas/shortener/pkg/shortenergrpcv1"
 	"github.com/zasuchilas/shortener/pkg/shortenerhttpv1"
@@ -44,7 +50,9 @@ func ToShortenBatchInFromGRPC(in *shortenergrpcv1.ShortenBatchRequest) []model.S
 
 // ToGRPCFromShortenBatchOut _
 func ToGRPCFromShortenBatchOut(in []model.ShortenBatchOut) *shortenergrpcv1.ShortenBatchResponse {
-	result := shortenergrpcv1.ShortenBatchResponse{}
+	result := shortenergrpcv1.ShortenBatchResponse{
+		Items: make([]*shortenergrpcv1.ShortenBatchResponse_Item, len(in)),
+	}
 	for i := range in {
 		result.Items[i] = &shortenergrpcv1.ShortenBatchResponse_Item{
 			CorrelationId: in[i].CorrelationID,
@@ -53,3 +61,43 @@ func ToGRPCFromShortenBatchOut(in []model.ShortenBatchOut) *shortenergrpcv1.Shor
 	}
 	return &result
 }
+
+// ToHTTPFromBatchError _
+func ToHTTPFromBatchError(in *model.BatchError) []shortenerhttpv1.ShortenBatchErrorItem {
+	result := make([]shortenerhttpv1.ShortenBatchErrorItem, len(in.Items))
+	for i, item := range in.Items {
+		result[i] = shortenerhttpv1.ShortenBatchErrorItem{
+			Index:         item.Index,
+			CorrelationID: item.CorrelationID,
+			OriginalURL:   item.OriginalURL,
+			Error:         item.Error,
+		}
+	}
+	return result
+}
+
+// ToGRPCStatusFromBatchError converts the batch error to InvalidArgument with the field violations.
+func ToGRPCStatusFromBatchError(in *model.BatchError) *status.Status {
+	st := status.New(codes.InvalidArgument, in.Error())
+	br := &errdetails.BadRequest{}
+	for _, item := range in.Items {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       fmt.Sprintf("items[%d].original_url", item.Index),
+			Description: item.Error,
+		})
+	}
+	if withDetails, err := st.WithDetails(br); err == nil {
+		return withDetails
+	}
+	return st
+}
+
+// ToGRPCFromShortenItemOut _
+func ToGRPCFromShortenItemOut(in model.ShortenItemOut) *shortenergrpcv1.ShortenStreamResponse_Item {
+	return &shortenergrpcv1.ShortenStreamResponse_Item{
+		CorrelationId: in.CorrelationID,
+		OriginalUrl:   in.OriginalURL,
+		ShortUrl:      in.ShortURL,
+		Error:         in.Error,
+	}
+}
@@ -0,0 +1,47 @@
+package converter
+
+import (
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/pkg/shortenerhttpv1"
+)
+
+// ToShortenJobLinesFromHTTP converts the JSON array items to the job lines (the line is the position from 1).
+func ToShortenJobLinesFromHTTP(in []shortenerhttpv1.ShortenBatchRequestItem) []model.ShortenJobLine {
+	result := make([]model.ShortenJobLine, len(in))
+	for i := range in {
+		result[i] = model.ShortenJobLine{
+			Line:          i + 1,
+			CorrelationID: in[i].CorrelationID,
+			OriginalURL:   in[i].OriginalURL,
+		}
+	}
+	return result
+}
+
+// ToHTTPFromShortenJob _
+func ToHTTPFromShortenJob(in *model.ShortenJob) shortenerhttpv1.ShortenJobResponse {
+	return shortenerhttpv1.ShortenJobResponse{
+		ID:        in.ID,
+		Status:    in.Status,
+		Total:     in.Total,
+		Processed: in.Processed,
+		Failed:    in.Failed,
+		Error:     in.Error,
+		Created:   in.Created,
+		Updated:   in.Updated,
+	}
+}
+
+// ToHTTPFromShortenJobLines _
+func ToHTTPFromShortenJobLines(in []model.ShortenJobLine) []shortenerhttpv1.ShortenUploadResultItem {
+	result := make([]shortenerhttpv1.ShortenUploadResultItem, len(in))
+	for i := range in {
+		result[i] = shortenerhttpv1.ShortenUploadResultItem{
+			Line:          in[i].Line,
+			CorrelationID: in[i].CorrelationID,
+			ShortURL:      in[i].ShortURL,
+			Error:         in[i].Error,
+		}
+	}
+	return result
+}
@@ -9,15 +9,21 @@ import (
 // ToHTTPFromStats _
 func ToHTTPFromStats(in model.Stats) shortenerhttpv1.StatsResponse {
 	return shortenerhttpv1.StatsResponse{
-		URLs:  in.URLs,
-		Users: in.Users,
+		URLs:    in.URLs,
+		Users:   in.Users,
+		Domains: in.Domains,
 	}
 }
 
 // ToGRPCFromStats _
 func ToGRPCFromStats(in *model.Stats) *shortenergrpcv1.StatsResponse {
-	return &shortenergrpcv1.StatsResponse{
-		Urls:  int64(in.URLs),
-		Users: int64(in.Users),
+	res := &shortenergrpcv1.StatsResponse{
+		Urls:    int64(in.URLs),
+		Users:   int64(in.Users),
+		Domains: make(map[string]int64, len(in.Domains)),
 	}
+	for domain, urls := range in.Domains {
+		res.Domains[domain] = int64(urls)
+	}
+	return res
 }
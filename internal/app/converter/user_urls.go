@@ -1,7 +1,11 @@
 package converter
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/pkg/shortenergrpcv1"
 	"github.com/zasuchilas/shortener/pkg/shortenerhttpv1"
 )
 
@@ -10,9 +14,242 @@ func ToHTTPFromUserURL(in []model.UserURL) []shortenerhttpv1.UserURLsResponseIte
 	result := make([]shortenerhttpv1.UserURLsResponseItem, len(in))
 	for i := range in {
 		result[i] = shortenerhttpv1.UserURLsResponseItem{
+			Domain:      in[i].Domain,
 			ShortURL:    in[i].ShortURL,
 			OriginalURL: in[i].OriginalURL,
+			Title:       in[i].Title,
+			Notes:       in[i].Notes,
+			Tags:        in[i].Tags,
+		}
+		if meta := in[i].Meta; meta != nil {
+			result[i].Page = &shortenerhttpv1.PageMetadata{
+				Title:       meta.Title,
+				Description: meta.Description,
+				Favicon:     meta.Favicon,
+				Fetched:     meta.Fetched,
+				Error:       meta.Error,
+			}
+		}
+		if check := in[i].Check; check != nil {
+			result[i].Check = &shortenerhttpv1.LinkCheck{
+				Status:   check.Status,
+				Error:    check.Error,
+				Failures: check.Failures,
+				Broken:   check.Broken,
+				Checked:  check.Checked,
+			}
 		}
 	}
 	return result
 }
+
+// ToHTTPFromUpdatedURL _
+func ToHTTPFromUpdatedURL(in *model.UserURL) shortenerhttpv1.UpdateURLResponse {
+	return shortenerhttpv1.UpdateURLResponse{
+		Domain:      in.Domain,
+		ShortURL:    in.ShortURL,
+		OriginalURL: in.OriginalURL,
+	}
+}
+
+// ToHTTPFromURLOptions _
+func ToHTTPFromURLOptions(in *model.UserURL) shortenerhttpv1.URLOptionsResponse {
+	res := shortenerhttpv1.URLOptionsResponse{
+		Domain:       in.Domain,
+		ShortURL:     in.ShortURL,
+		OriginalURL:  in.OriginalURL,
+		Title:        in.Title,
+		Notes:        in.Notes,
+		Tags:         in.Tags,
+		Preview:      in.Preview,
+		RedirectCode: in.RedirectCode,
+		ForwardPath:  in.ForwardPath,
+		MergeQuery:   in.MergeQuery,
+	}
+	if !in.ExpiresAt.IsZero() {
+		res.ExpiresAt = &in.ExpiresAt
+	}
+	return res
+}
+
+// ToURLOptionsFromHTTP _
+func ToURLOptionsFromHTTP(in shortenerhttpv1.URLOptionsRequest) (model.URLOptions, error) {
+	expiresAt, err := parseExpiresAt(in.ExpiresAt)
+	if err != nil {
+		return model.URLOptions{}, err
+	}
+	return model.URLOptions{
+		Title:        in.Title,
+		Notes:        in.Notes,
+		Tags:         in.Tags,
+		Preview:      in.Preview,
+		RedirectCode: in.RedirectCode,
+		ExpiresAt:    expiresAt,
+		ForwardPath:  in.ForwardPath,
+		MergeQuery:   in.MergeQuery,
+	}, nil
+}
+
+// ToHTTPFromURLRevisions _
+func ToHTTPFromURLRevisions(in []model.URLRevision) []shortenerhttpv1.URLRevisionsResponseItem {
+	result := make([]shortenerhttpv1.URLRevisionsResponseItem, len(in))
+	for i := range in {
+		result[i] = shortenerhttpv1.URLRevisionsResponseItem{
+			Revision:    in[i].Revision,
+			OriginalURL: in[i].OrigURL,
+			PreviousURL: in[i].PrevURL,
+			Time:        in[i].Time,
+		}
+	}
+	return result
+}
+
+// ToGRPCFromUpdatedURL _
+func ToGRPCFromUpdatedURL(in *model.UserURL) *shortenergrpcv1.UpdateURLResponse {
+	return &shortenergrpcv1.UpdateURLResponse{
+		ShortUrl:    in.ShortURL,
+		OriginalUrl: in.OriginalURL,
+		Domain:      in.Domain,
+	}
+}
+
+// ToGRPCFromURLOptions _
+func ToGRPCFromURLOptions(in *model.UserURL) *shortenergrpcv1.URLOptionsResponse {
+	res := &shortenergrpcv1.URLOptionsResponse{
+		ShortUrl:     in.ShortURL,
+		OriginalUrl:  in.OriginalURL,
+		Title:        in.Title,
+		Preview:      in.Preview,
+		RedirectCode: int32(in.RedirectCode),
+		ForwardPath:  in.ForwardPath,
+		MergeQuery:   in.MergeQuery,
+		Domain:       in.Domain,
+		Notes:        in.Notes,
+		Tags:         in.Tags,
+	}
+	if !in.ExpiresAt.IsZero() {
+		res.ExpiresAt = in.ExpiresAt.Format(time.RFC3339Nano)
+	}
+	return res
+}
+
+// ToURLOptionsFromGRPC _
+func ToURLOptionsFromGRPC(in *shortenergrpcv1.URLOptionsRequest) (model.URLOptions, error) {
+	expiresAt, err := parseExpiresAt(in.ExpiresAt)
+	if err != nil {
+		return model.URLOptions{}, err
+	}
+	opts := model.URLOptions{
+		Title:       in.Title,
+		Notes:       in.Notes,
+		Preview:     in.Preview,
+		ExpiresAt:   expiresAt,
+		ForwardPath: in.ForwardPath,
+		MergeQuery:  in.MergeQuery,
+	}
+	if in.Tags != nil {
+		tags := append([]string{}, in.Tags.Tags...)
+		opts.Tags = &tags
+	}
+	if in.RedirectCode != nil {
+		code := int(in.GetRedirectCode())
+		opts.RedirectCode = &code
+	}
+	return opts, nil
+}
+
+// parseExpiresAt parses the link expiry option (nil is kept as it is, the empty string removes the expiry).
+func parseExpiresAt(in *string) (*time.Time, error) {
+	if in == nil {
+		return nil, nil
+	}
+	var expiresAt time.Time
+	if *in != "" {
+		t, err := time.Parse(time.RFC3339, *in)
+		if err != nil {
+			return nil, fmt.Errorf("wrong link expiry %q (expected RFC 3339): %w", *in, err)
+		}
+		expiresAt = t
+	}
+	return &expiresAt, nil
+}
+
+// ToGRPCFromURLRevisions _
+func ToGRPCFromURLRevisions(in []model.URLRevision) *shortenergrpcv1.URLRevisionsResponse {
+	items := make([]*shortenergrpcv1.URLRevisionsResponse_Item, len(in))
+	for i := range in {
+		items[i] = &shortenergrpcv1.URLRevisionsResponse_Item{
+			Revision:    in[i].Revision,
+			OriginalUrl: in[i].OrigURL,
+			PreviousUrl: in[i].PrevURL,
+			Time:        in[i].Time.Format(time.RFC3339Nano),
+		}
+	}
+	return &shortenergrpcv1.URLRevisionsResponse{Revisions: items}
+}
+
+// ToUserURLsQueryFromGRPC _
+func ToUserURLsQueryFromGRPC(in *shortenergrpcv1.UserURLsRequest) (q model.UserURLsQuery, err error) {
+	q = model.UserURLsQuery{
+		Status: in.Status,
+		Domain: in.Domain,
+		Sort:   in.Sort,
+		Desc:   in.Desc,
+		Cursor: in.Cursor,
+		Limit:  int(in.Limit),
+		Tags:   in.Tags,
+		Text:   in.Q,
+		Broken: in.Broken,
+	}
+	if len(in.ShortDomains) != 0 {
+		q.LinkDomains = in.ShortDomains
+	}
+	if in.CreatedFrom != "" {
+		if q.CreatedFrom, err = time.Parse(time.RFC3339, in.CreatedFrom); err != nil {
+			return q, fmt.Errorf("wrong created_from %q (expected RFC 3339): %w", in.CreatedFrom, err)
+		}
+	}
+	if in.CreatedTo != "" {
+		if q.CreatedTo, err = time.Parse(time.RFC3339, in.CreatedTo); err != nil {
+			return q, fmt.Errorf("wrong created_to %q (expected RFC 3339): %w", in.CreatedTo, err)
+		}
+	}
+	return q, nil
+}
+
+// ToGRPCFromUserURLs _
+func ToGRPCFromUserURLs(in *model.UserURLsPage) *shortenergrpcv1.UserURLsResponse {
+	res := &shortenergrpcv1.UserURLsResponse{
+		UserUrls:   make([]*shortenergrpcv1.UserURLsResponse_Item, len(in.URLs)),
+		NextCursor: in.NextCursor,
+	}
+	for i := range in.URLs {
+		res.UserUrls[i] = &shortenergrpcv1.UserURLsResponse_Item{
+			ShortUrl:    in.URLs[i].ShortURL,
+			OriginalUrl: in.URLs[i].OriginalURL,
+			Domain:      in.URLs[i].Domain,
+			Title:       in.URLs[i].Title,
+			Notes:       in.URLs[i].Notes,
+			Tags:        in.URLs[i].Tags,
+		}
+		if meta := in.URLs[i].Meta; meta != nil {
+			res.UserUrls[i].Page = &shortenergrpcv1.PageMetadata{
+				Title:       meta.Title,
+				Description: meta.Description,
+				Favicon:     meta.Favicon,
+				FetchedAt:   meta.Fetched.Format(time.RFC3339Nano),
+				Error:       meta.Error,
+			}
+		}
+		if check := in.URLs[i].Check; check != nil {
+			res.UserUrls[i].Check = &shortenergrpcv1.LinkCheck{
+				Status:    int32(check.Status),
+				Error:     check.Error,
+				Failures:  int32(check.Failures),
+				Broken:    check.Broken,
+				CheckedAt: check.Checked.Format(time.RFC3339Nano),
+			}
+		}
+	}
+	return res
+}
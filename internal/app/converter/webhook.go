@@ -0,0 +1,58 @@
+package converter
+
+import (
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/pkg/shortenerhttpv1"
+)
+
+// ToHTTPFromWebhook _ (the secret is in the response only if it is set)
+func ToHTTPFromWebhook(in *model.Webhook) shortenerhttpv1.WebhookResponse {
+	return shortenerhttpv1.WebhookResponse{
+		ID:      in.ID,
+		URL:     in.URL,
+		Events:  in.Events,
+		Secret:  in.Secret,
+		Created: in.Created,
+	}
+}
+
+// ToHTTPFromWebhooks _
+func ToHTTPFromWebhooks(in []model.Webhook) []shortenerhttpv1.WebhookResponse {
+	result := make([]shortenerhttpv1.WebhookResponse, len(in))
+	for i := range in {
+		result[i] = ToHTTPFromWebhook(&in[i])
+	}
+	return result
+}
+
+// ToHTTPFromWebhookDeliveries _
+func ToHTTPFromWebhookDeliveries(in []model.WebhookDelivery) []shortenerhttpv1.WebhookDeliveryResponseItem {
+	result := make([]shortenerhttpv1.WebhookDeliveryResponseItem, len(in))
+	for i, v := range in {
+		result[i] = shortenerhttpv1.WebhookDeliveryResponseItem{
+			ID:           v.ID,
+			Event:        v.Event,
+			Status:       v.Status,
+			Attempts:     v.Attempts,
+			ResponseCode: v.ResponseCode,
+			Error:        v.Error,
+			Created:      v.Created,
+			Updated:      v.Updated,
+		}
+		if v.Status == model.WebhookDeliveryPending {
+			nextTry := v.NextTry
+			result[i].NextTry = &nextTry
+		}
+	}
+	return result
+}
+
+// ToWebhookEventFromLinkEvent converts the link event to the webhook request body.
+func ToWebhookEventFromLinkEvent(in model.LinkEvent) shortenerhttpv1.WebhookEvent {
+	return shortenerhttpv1.WebhookEvent{
+		Type:        in.Type,
+		Time:        in.Time,
+		ShortURL:    in.ShortURL,
+		OriginalURL: in.OrigURL,
+	}
+}
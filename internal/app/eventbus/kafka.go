@@ -0,0 +1,536 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Kafka protocol settings.
+const (
+	KafkaClientID       = "shortener"
+	KafkaProduceTimeout = 10000    // ms, the time for the replicas to acknowledge the records
+	kafkaMaxResponse    = 64 << 20 // the response size limit
+)
+
+// Kafka API keys and versions (the versions supported by the brokers since 1.0).
+const (
+	kafkaProduceKey      int16 = 0
+	kafkaProduceVersion  int16 = 3
+	kafkaMetadataKey     int16 = 3
+	kafkaMetadataVersion int16 = 4
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type (
+	// Kafka is the publisher to the Kafka topic (the binary protocol).
+	//
+	// The partition of the message is chosen by its key with the murmur2 hash, the same way as the default
+	// partitioner of the Java client does, so the events of the link are in the same partition.
+	// The records are written with acks=all, the batch of every partition is sent in one request
+	// and the next batch is sent after the response, so the order of the partition is kept.
+	Kafka struct {
+		bootstrap   []string
+		topic       string
+		mutex       sync.Mutex
+		brokers     map[int32]string   // the addresses by node ID
+		leaders     []int32            // the leaders by partition
+		conns       map[int32]net.Conn // the connections by node ID
+		correlation int32
+	}
+
+	// kafkaEncoder encodes the Kafka protocol primitives.
+	kafkaEncoder struct {
+		buf []byte
+	}
+
+	// kafkaDecoder decodes the Kafka protocol primitives, the first error is kept.
+	kafkaDecoder struct {
+		buf []byte
+		err error
+	}
+)
+
+// NewKafka creates the publisher to the topic, the address is the comma separated list of the bootstrap brokers.
+//
+// The connections are opened with the first publication.
+func NewKafka(address, topic string) (*Kafka, error) {
+	var bootstrap []string
+	for _, addr := range strings.Split(address, ",") {
+		addr = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(addr), "kafka://"))
+		if addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return nil, fmt.Errorf("invalid Kafka broker address %q: %w", addr, err)
+		}
+		bootstrap = append(bootstrap, addr)
+	}
+	if len(bootstrap) == 0 {
+		return nil, errors.New("no Kafka brokers")
+	}
+
+	return &Kafka{
+		bootstrap: bootstrap,
+		topic:     topic,
+		conns:     make(map[int32]net.Conn),
+	}, nil
+}
+
+// Publish publishes the messages to the partitions of their keys and waits for the acknowledgements.
+//
+// The connections and the metadata are dropped on error, they are loaded again with the next publication.
+func (k *Kafka) Publish(ctx context.Context, messages []Message) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if err := k.publish(ctx, messages); err != nil {
+		k.close()
+		return fmt.Errorf("publishing to Kafka: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connections.
+func (k *Kafka) Close() error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.close()
+}
+
+func (k *Kafka) publish(ctx context.Context, messages []Message) error {
+	if k.leaders == nil {
+		if err := k.loadMetadata(ctx); err != nil {
+			return err
+		}
+	}
+
+	// the messages of the leader by partition (in the order of the messages)
+	batches := make(map[int32]map[int32][]Message)
+	for _, msg := range messages {
+		partition := KafkaPartition(msg.Key(), len(k.leaders))
+		leader := k.leaders[partition]
+		if batches[leader] == nil {
+			batches[leader] = make(map[int32][]Message)
+		}
+		batches[leader][partition] = append(batches[leader][partition], msg)
+	}
+
+	for leader, partitions := range batches {
+		if err := k.produce(ctx, leader, partitions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadMetadata loads the brokers and the partition leaders of the topic from the first available bootstrap broker.
+func (k *Kafka) loadMetadata(ctx context.Context) error {
+	var e kafkaEncoder
+	e.int32(1)
+	e.string(k.topic)
+	e.int8(1) // allow_auto_topic_creation
+
+	var errs []error
+	for _, addr := range k.bootstrap {
+		conn, err := dial(ctx, addr)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resp, err := k.roundTrip(ctx, conn, kafkaMetadataKey, kafkaMetadataVersion, e.buf)
+		_ = conn.Close()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return k.parseMetadata(resp)
+	}
+	return fmt.Errorf("loading metadata: %w", errors.Join(errs...))
+}
+
+func (k *Kafka) parseMetadata(resp []byte) error {
+	d := kafkaDecoder{buf: resp}
+	d.int32() // throttle_time_ms
+
+	brokers := make(map[int32]string)
+	for range d.arrayLen() {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.nullableString() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.nullableString() // cluster_id
+	d.int32()          // controller_id
+
+	var leaders []int32
+	for range d.arrayLen() {
+		code := d.int16()
+		name := d.string()
+		d.int8() // is_internal
+		partitions := make(map[int32]int32)
+		for range d.arrayLen() {
+			d.int16() // error_code, the partition without the leader is checked below
+			index := d.int32()
+			partitions[index] = d.int32()
+			d.skipInt32Array() // replica_nodes
+			d.skipInt32Array() // isr_nodes
+		}
+		if d.err != nil || name != k.topic {
+			continue
+		}
+		if code != 0 {
+			return fmt.Errorf("topic %q: %w", k.topic, kafkaError(code))
+		}
+		leaders = make([]int32, len(partitions))
+		for i := range leaders {
+			leader, ok := partitions[int32(i)]
+			if _, known := brokers[leader]; !ok || !known {
+				return fmt.Errorf("partition %d of topic %q has no leader", i, k.topic)
+			}
+			leaders[i] = leader
+		}
+	}
+	if d.err != nil {
+		return fmt.Errorf("parsing metadata: %w", d.err)
+	}
+	if len(leaders) == 0 {
+		return fmt.Errorf("topic %q is not found", k.topic)
+	}
+
+	k.brokers, k.leaders = brokers, leaders
+	return nil
+}
+
+// produce sends the batches of the partitions to the leader and checks the response.
+func (k *Kafka) produce(ctx context.Context, leader int32, partitions map[int32][]Message) error {
+	conn, err := k.conn(ctx, leader)
+	if err != nil {
+		return err
+	}
+
+	var e kafkaEncoder
+	e.int16(-1) // transactional_id
+	e.int16(-1) // acks=all
+	e.int32(KafkaProduceTimeout)
+	e.int32(1)
+	e.string(k.topic)
+	e.int32(int32(len(partitions)))
+	for partition, messages := range partitions {
+		batch, err := encodeRecordBatch(messages)
+		if err != nil {
+			return err
+		}
+		e.int32(partition)
+		e.bytes(batch)
+	}
+
+	resp, err := k.roundTrip(ctx, conn, kafkaProduceKey, kafkaProduceVersion, e.buf)
+	if err != nil {
+		return err
+	}
+
+	d := kafkaDecoder{buf: resp}
+	acknowledged := 0
+	for range d.arrayLen() {
+		d.string() // name
+		for range d.arrayLen() {
+			index := d.int32()
+			code := d.int16()
+			d.int64() // base_offset
+			d.int64() // log_append_time_ms
+			if d.err == nil && code != 0 {
+				return fmt.Errorf("partition %d: %w", index, kafkaError(code))
+			}
+			acknowledged++
+		}
+	}
+	if d.err != nil {
+		return fmt.Errorf("parsing produce response: %w", d.err)
+	}
+	if acknowledged != len(partitions) {
+		return fmt.Errorf("%d of %d partitions are acknowledged", acknowledged, len(partitions))
+	}
+	return nil
+}
+
+// conn returns the connection to the broker (opens it if needed).
+func (k *Kafka) conn(ctx context.Context, id int32) (net.Conn, error) {
+	if conn, ok := k.conns[id]; ok {
+		return conn, nil
+	}
+	addr, ok := k.brokers[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown broker %d", id)
+	}
+	conn, err := dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	k.conns[id] = conn
+	return conn, nil
+}
+
+// roundTrip sends the request and returns the body of the response.
+func (k *Kafka) roundTrip(ctx context.Context, conn net.Conn, key, version int16, body []byte) ([]byte, error) {
+	if err := setDeadline(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	k.correlation++
+	var e kafkaEncoder
+	e.int32(0) // the size is set below
+	e.int16(key)
+	e.int16(version)
+	e.int32(k.correlation)
+	e.string(KafkaClientID)
+	e.buf = append(e.buf, body...)
+	binary.BigEndian.PutUint32(e.buf, uint32(len(e.buf)-4))
+	if _, err := conn.Write(e.buf); err != nil {
+		return nil, err
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > kafkaMaxResponse {
+		return nil, fmt.Errorf("invalid response size %d", n)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	if correlation := int32(binary.BigEndian.Uint32(resp)); correlation != k.correlation {
+		return nil, fmt.Errorf("unexpected correlation ID %d (expected %d)", correlation, k.correlation)
+	}
+	return resp[4:], nil
+}
+
+// close closes the connections and drops the metadata (the caller holds the lock).
+func (k *Kafka) close() error {
+	var errs []error
+	for id, conn := range k.conns {
+		errs = append(errs, conn.Close())
+		delete(k.conns, id)
+	}
+	k.brokers, k.leaders = nil, nil
+	return errors.Join(errs...)
+}
+
+// encodeRecordBatch encodes the messages to the record batch (magic 2) without compression.
+//
+// The key of the record is the key of the message, the value is its JSON, the event ID is in the header.
+func encodeRecordBatch(messages []Message) ([]byte, error) {
+	base := messages[0].Time.UnixMilli()
+	maxTimestamp := base
+	var records []byte
+	for i, msg := range messages {
+		value, err := json.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		timestamp := msg.Time.UnixMilli()
+		maxTimestamp = max(maxTimestamp, timestamp)
+
+		var r []byte
+		r = append(r, 0) // attributes
+		r = binary.AppendVarint(r, timestamp-base)
+		r = binary.AppendVarint(r, int64(i))
+		r = appendVarBytes(r, []byte(msg.Key()))
+		r = appendVarBytes(r, value)
+		r = binary.AppendVarint(r, 1)
+		r = appendVarBytes(r, []byte(IDHeader))
+		r = appendVarBytes(r, []byte(strconv.FormatInt(msg.ID, 10)))
+
+		records = binary.AppendVarint(records, int64(len(r)))
+		records = append(records, r...)
+	}
+
+	// the part of the batch covered by the checksum
+	var c kafkaEncoder
+	c.int16(0) // attributes
+	c.int32(int32(len(messages) - 1))
+	c.int64(base)
+	c.int64(maxTimestamp)
+	c.int64(-1) // producer_id
+	c.int16(-1) // producer_epoch
+	c.int32(-1) // base_sequence
+	c.int32(int32(len(messages)))
+	c.buf = append(c.buf, records...)
+
+	var e kafkaEncoder
+	e.int64(0)                     // base_offset
+	e.int32(int32(9 + len(c.buf))) // the length of the rest: leader epoch, magic, crc and the checksummed part
+	e.int32(-1)                    // partition_leader_epoch
+	e.int8(2)                      // magic
+	e.int32(int32(crc32.Checksum(c.buf, castagnoli)))
+	e.buf = append(e.buf, c.buf...)
+	return e.buf, nil
+}
+
+// KafkaPartition returns the partition of the key, the same as the default partitioner of the Java client.
+func KafkaPartition(key string, partitions int) int32 {
+	return int32((murmur2([]byte(key)) & 0x7fffffff) % int32(partitions))
+}
+
+// murmur2 is the murmur2 hash of the Kafka clients.
+func murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+	length := len(data)
+	h := seed ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+// kafkaError is the error of the Kafka error code.
+func kafkaError(code int16) error {
+	return fmt.Errorf("kafka error code %d", code)
+}
+
+// dial connects to the address with the dial timeout.
+func dial(ctx context.Context, addr string) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: DialTimeout}
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+// appendVarBytes appends the varint length and the bytes.
+func appendVarBytes(buf, b []byte) []byte {
+	buf = binary.AppendVarint(buf, int64(len(b)))
+	return append(buf, b...)
+}
+
+func (e *kafkaEncoder) int8(v int8) {
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *kafkaEncoder) int16(v int16) {
+	e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v))
+}
+
+func (e *kafkaEncoder) int32(v int32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v))
+}
+
+func (e *kafkaEncoder) int64(v int64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v))
+}
+
+func (e *kafkaEncoder) string(v string) {
+	e.int16(int16(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *kafkaEncoder) bytes(v []byte) {
+	e.int32(int32(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// next returns the next n bytes or sets the error.
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.buf) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *kafkaDecoder) int8() int8 {
+	if b := d.next(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *kafkaDecoder) string() string {
+	return string(d.next(int(d.int16())))
+}
+
+func (d *kafkaDecoder) nullableString() {
+	if n := d.int16(); n > 0 {
+		d.next(int(n))
+	}
+}
+
+// arrayLen returns the length of the array (0 for the null array or on error).
+func (d *kafkaDecoder) arrayLen() int {
+	n := int(d.int32())
+	if d.err != nil || n < 0 {
+		return 0
+	}
+	if n > len(d.buf) {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	return n
+}
+
+func (d *kafkaDecoder) skipInt32Array() {
+	d.next(4 * d.arrayLen())
+}
@@ -0,0 +1,253 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKafka is the single broker with the partitions of one topic, it keeps the produced records.
+type fakeKafka struct {
+	t          *testing.T
+	listener   net.Listener
+	topic      string
+	partitions int
+	failCode   int16 // the error code of the next produce response
+	mutex      sync.Mutex
+	records    map[int32][]fakeRecord
+}
+
+// fakeRecord is the produced record.
+type fakeRecord struct {
+	key     string
+	value   Message
+	eventID string
+}
+
+func newFakeKafka(t *testing.T, topic string, partitions int) *fakeKafka {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	k := &fakeKafka{t: t, listener: l, topic: topic, partitions: partitions, records: make(map[int32][]fakeRecord)}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go k.serve(conn)
+		}
+	}()
+	return k
+}
+
+func (k *fakeKafka) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+
+		d := kafkaDecoder{buf: req}
+		key, version, correlation := d.int16(), d.int16(), d.int32()
+		assert.Equal(k.t, KafkaClientID, d.string())
+
+		var e kafkaEncoder
+		e.int32(0)
+		e.int32(correlation)
+		switch {
+		case key == kafkaMetadataKey && version == kafkaMetadataVersion:
+			k.metadata(&d, &e)
+		case key == kafkaProduceKey && version == kafkaProduceVersion:
+			k.produce(&d, &e)
+		default:
+			k.t.Errorf("unexpected request %d v%d", key, version)
+			return
+		}
+		require.NoError(k.t, d.err)
+		binary.BigEndian.PutUint32(e.buf, uint32(len(e.buf)-4))
+		if _, err := conn.Write(e.buf); err != nil {
+			return
+		}
+	}
+}
+
+func (k *fakeKafka) metadata(d *kafkaDecoder, e *kafkaEncoder) {
+	require.Equal(k.t, 1, d.arrayLen())
+	assert.Equal(k.t, k.topic, d.string())
+	d.int8()
+
+	host, port, _ := net.SplitHostPort(k.listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	e.int32(0) // throttle_time_ms
+	e.int32(1)
+	e.int32(7) // node_id
+	e.string(host)
+	e.int32(int32(portNum))
+	e.int16(-1) // rack
+	e.int16(-1) // cluster_id
+	e.int32(7)  // controller_id
+	e.int32(1)
+	e.int16(0)
+	e.string(k.topic)
+	e.int8(0)
+	e.int32(int32(k.partitions))
+	for i := range k.partitions {
+		e.int16(0)
+		e.int32(int32(i))
+		e.int32(7) // leader_id
+		e.int32(1)
+		e.int32(7)
+		e.int32(1)
+		e.int32(7)
+	}
+}
+
+func (k *fakeKafka) produce(d *kafkaDecoder, e *kafkaEncoder) {
+	assert.Equal(k.t, int16(-1), d.int16()) // transactional_id
+	assert.Equal(k.t, int16(-1), d.int16()) // acks
+	d.int32()
+	require.Equal(k.t, 1, d.arrayLen())
+	assert.Equal(k.t, k.topic, d.string())
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	n := d.arrayLen()
+	e.int32(1)
+	e.string(k.topic)
+	e.int32(int32(n))
+	for range n {
+		partition := d.int32()
+		batch := d.next(int(d.int32()))
+		k.records[partition] = append(k.records[partition], k.decodeBatch(batch)...)
+
+		e.int32(partition)
+		e.int16(k.failCode)
+		e.int64(0)
+		e.int64(-1)
+	}
+	e.int32(0) // throttle_time_ms
+	k.failCode = 0
+}
+
+func (k *fakeKafka) decodeBatch(batch []byte) []fakeRecord {
+	d := kafkaDecoder{buf: batch}
+	assert.Equal(k.t, int64(0), d.int64())
+	assert.Equal(k.t, len(batch)-12, int(d.int32()))
+	d.int32()
+	assert.Equal(k.t, int8(2), d.int8())
+	crc := uint32(d.int32())
+	assert.Equal(k.t, crc32.Checksum(d.buf, crc32.MakeTable(crc32.Castagnoli)), crc)
+	d.next(2 + 4 + 8 + 8 + 8 + 2 + 4)
+	count := int(d.int32())
+	require.NoError(k.t, d.err)
+
+	buf := d.buf
+	varint := func() int64 {
+		v, n := binary.Varint(buf)
+		require.Positive(k.t, n)
+		buf = buf[n:]
+		return v
+	}
+	varBytes := func() []byte {
+		n := varint()
+		b := buf[:n]
+		buf = buf[n:]
+		return b
+	}
+
+	records := make([]fakeRecord, count)
+	for i := range records {
+		varint() // length
+		buf = buf[1:]
+		varint()
+		assert.Equal(k.t, int64(i), varint())
+		records[i].key = string(varBytes())
+		require.NoError(k.t, json.Unmarshal(varBytes(), &records[i].value))
+		require.Equal(k.t, int64(1), varint())
+		assert.Equal(k.t, IDHeader, string(varBytes()))
+		records[i].eventID = string(varBytes())
+	}
+	assert.Empty(k.t, buf)
+	return records
+}
+
+func TestKafka_Publish(t *testing.T) {
+	broker := newFakeKafka(t, "shortener.links", 3)
+	k, err := NewKafka(" kafka://"+broker.listener.Addr().String()+", ", "shortener.links")
+	require.NoError(t, err)
+	defer k.Close()
+
+	now := time.Now()
+	var messages []Message
+	for i, code := range []string{"abc", "foobar", "abc", "21", "abc"} {
+		messages = append(messages, Message{ID: int64(i + 1), Type: "link.clicked", Time: now, ShortCode: code})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, k.Publish(ctx, messages[:2]))
+	require.NoError(t, k.Publish(ctx, messages[2:]))
+
+	// the messages of the key are in its partition in the order of publishing
+	broker.mutex.Lock()
+	records := broker.records[KafkaPartition("abc", 3)]
+	broker.mutex.Unlock()
+	var ids []int64
+	for _, r := range records {
+		if r.key == "abc" {
+			ids = append(ids, r.value.ID)
+			assert.Equal(t, strconv.FormatInt(r.value.ID, 10), r.eventID)
+		}
+	}
+	assert.Equal(t, []int64{1, 3, 5}, ids)
+
+	total := 0
+	for partition, records := range broker.records {
+		for _, r := range records {
+			assert.Equal(t, KafkaPartition(r.key, 3), partition)
+		}
+		total += len(records)
+	}
+	assert.Equal(t, len(messages), total)
+
+	// the error of the partition fails the publication, the metadata is loaded again
+	broker.mutex.Lock()
+	broker.failCode = 6 // NOT_LEADER_OR_FOLLOWER
+	broker.mutex.Unlock()
+	assert.Error(t, k.Publish(ctx, messages[:1]))
+	assert.Nil(t, k.leaders)
+	assert.NoError(t, k.Publish(ctx, messages[:1]))
+}
+
+func TestMurmur2(t *testing.T) {
+	// the test vectors of the Kafka clients
+	cases := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+	for key, want := range cases {
+		assert.Equal(t, want, murmur2([]byte(key)), key)
+	}
+}
@@ -0,0 +1,253 @@
+package eventbus
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATSPort is the default port of the NATS server.
+const NATSPort = "4222"
+
+type (
+	// NATS is the publisher to the NATS server (the core protocol).
+	//
+	// The messages are published on one connection, which keeps their order. The publication is confirmed
+	// by the PING after the messages: the server answers PONG after it has processed all of them.
+	// The event ID is sent in the Nats-Msg-Id header, so JetStream deduplicates the messages too.
+	NATS struct {
+		server  *url.URL
+		subject string
+		mutex   sync.Mutex
+		conn    net.Conn
+		reader  *bufio.Reader
+		headers bool // the server supports the headers
+	}
+
+	// natsInfo is the part of the INFO message of the server.
+	natsInfo struct {
+		Headers     bool `json:"headers"`
+		TLSRequired bool `json:"tls_required"`
+	}
+
+	// natsConnect is the CONNECT message of the client.
+	natsConnect struct {
+		Verbose   bool   `json:"verbose"`
+		Pedantic  bool   `json:"pedantic"`
+		Name      string `json:"name"`
+		Lang      string `json:"lang"`
+		Version   string `json:"version"`
+		Protocol  int    `json:"protocol"`
+		Headers   bool   `json:"headers"`
+		User      string `json:"user,omitempty"`
+		Pass      string `json:"pass,omitempty"`
+		AuthToken string `json:"auth_token,omitempty"`
+	}
+)
+
+// NewNATS creates the publisher to the NATS server at the address (nats://[user:password@]host[:port]
+// or host:port, the user without the password is the token), the connection is opened with the first publication.
+func NewNATS(address, subject string) (*NATS, error) {
+	if !strings.Contains(address, "://") {
+		address = "nats://" + address
+	}
+	server, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("parsing NATS address: %w", err)
+	}
+	if server.Scheme != "nats" && server.Scheme != "tls" {
+		return nil, fmt.Errorf("unsupported NATS scheme %q", server.Scheme)
+	}
+	if server.Hostname() == "" {
+		return nil, errors.New("the NATS address has no host")
+	}
+	if strings.ContainsAny(subject, " \t\r\n") {
+		return nil, fmt.Errorf("invalid NATS subject %q", subject)
+	}
+
+	return &NATS{server: server, subject: subject}, nil
+}
+
+// Publish publishes the messages and waits for the server to process them.
+//
+// The connection is closed on error and opened again with the next publication.
+func (n *NATS) Publish(ctx context.Context, messages []Message) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if err := n.publish(ctx, messages); err != nil {
+		n.close()
+		return fmt.Errorf("publishing to NATS: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connection.
+func (n *NATS) Close() error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.close()
+}
+
+func (n *NATS) publish(ctx context.Context, messages []Message) error {
+	if n.conn == nil {
+		if err := n.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if err := setDeadline(ctx, n.conn); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, msg := range messages {
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		if n.headers {
+			hdr := "NATS/1.0\r\nNats-Msg-Id: " + strconv.FormatInt(msg.ID, 10) + "\r\n" +
+				IDHeader + ": " + strconv.FormatInt(msg.ID, 10) + "\r\n\r\n"
+			fmt.Fprintf(&buf, "HPUB %s %d %d\r\n%s", n.subject, len(hdr), len(hdr)+len(payload), hdr)
+		} else {
+			fmt.Fprintf(&buf, "PUB %s %d\r\n", n.subject, len(payload))
+		}
+		buf.Write(payload)
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("PING\r\n")
+
+	if _, err := n.conn.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return n.waitPong()
+}
+
+// connect opens the connection, authenticates and checks that the server has accepted the client.
+func (n *NATS) connect(ctx context.Context) error {
+	host := n.server.Hostname()
+	port := n.server.Port()
+	if port == "" {
+		port = NATSPort
+	}
+
+	dialer := net.Dialer{Timeout: DialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return err
+	}
+	n.conn = conn
+	n.reader = bufio.NewReader(conn)
+	if err = setDeadline(ctx, conn); err != nil {
+		return err
+	}
+
+	line, err := n.readLine()
+	if err != nil {
+		return err
+	}
+	op, args, _ := strings.Cut(line, " ")
+	if !strings.EqualFold(op, "INFO") {
+		return fmt.Errorf("unexpected NATS greeting %q", line)
+	}
+	var info natsInfo
+	if err = json.Unmarshal([]byte(args), &info); err != nil {
+		return fmt.Errorf("parsing NATS INFO: %w", err)
+	}
+	if info.TLSRequired || n.server.Scheme == "tls" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			return err
+		}
+		n.conn = tlsConn
+		n.reader = bufio.NewReader(tlsConn)
+	}
+	n.headers = info.Headers
+
+	connect := natsConnect{
+		Name:     "shortener",
+		Lang:     "go",
+		Version:  "1.0.0",
+		Protocol: 1,
+		Headers:  info.Headers,
+	}
+	if user := n.server.User; user != nil {
+		if pass, ok := user.Password(); ok {
+			connect.User, connect.Pass = user.Username(), pass
+		} else {
+			connect.AuthToken = user.Username()
+		}
+	}
+	payload, err := json.Marshal(connect)
+	if err != nil {
+		return err
+	}
+	if _, err = n.conn.Write([]byte("CONNECT " + string(payload) + "\r\nPING\r\n")); err != nil {
+		return err
+	}
+	// the server answers -ERR instead of PONG if the client is not authorized
+	return n.waitPong()
+}
+
+// waitPong reads the server messages until PONG, the server PINGs are answered.
+func (n *NATS) waitPong() error {
+	for {
+		line, err := n.readLine()
+		if err != nil {
+			return err
+		}
+		op, args, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(op) {
+		case "PONG":
+			return nil
+		case "PING":
+			if _, err = n.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case "-ERR":
+			return fmt.Errorf("NATS error: %s", strings.Trim(args, "'"))
+		case "+OK", "INFO":
+		default:
+			return fmt.Errorf("unexpected NATS message %q", line)
+		}
+	}
+}
+
+// readLine reads the protocol line without CRLF.
+func (n *NATS) readLine() (string, error) {
+	line, err := n.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// close closes the connection (the caller holds the lock).
+func (n *NATS) close() error {
+	if n.conn == nil {
+		return nil
+	}
+	err := n.conn.Close()
+	n.conn, n.reader = nil, nil
+	return err
+}
+
+// setDeadline sets the deadline of the context (or the dial timeout) for the connection.
+func setDeadline(ctx context.Context, conn net.Conn) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DialTimeout)
+	}
+	return conn.SetDeadline(deadline)
+}
@@ -0,0 +1,162 @@
+package eventbus
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNATS is the NATS server that checks the password and keeps the published messages.
+type fakeNATS struct {
+	t        *testing.T
+	listener net.Listener
+	password string
+	headers  bool
+	mutex    sync.Mutex
+	messages []fakeNATSMessage
+}
+
+// fakeNATSMessage is the published message.
+type fakeNATSMessage struct {
+	subject string
+	header  string
+	payload Message
+}
+
+func newFakeNATS(t *testing.T, password string, headers bool) *fakeNATS {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeNATS{t: t, listener: l, password: password, headers: headers}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\",\"headers\":%t,\"auth_required\":true}\r\n", s.headers)
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		op, args, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		switch op {
+		case "CONNECT":
+			var connect natsConnect
+			require.NoError(s.t, json.Unmarshal([]byte(args), &connect))
+			assert.Equal(s.t, s.headers, connect.Headers)
+			if connect.User != "shortener" || connect.Pass != s.password {
+				fmt.Fprint(conn, "-ERR 'Authorization Violation'\r\n")
+				return
+			}
+		case "PING":
+			// the client answers the server PING before it gets PONG
+			fmt.Fprint(conn, "PING\r\n")
+			if line, err = r.ReadString('\n'); err != nil || line != "PONG\r\n" {
+				s.t.Errorf("expected PONG, got %q", line)
+				return
+			}
+			fmt.Fprint(conn, "PONG\r\n")
+		case "HPUB", "PUB":
+			s.publish(r, op, strings.Fields(args))
+		default:
+			s.t.Errorf("unexpected message %q", line)
+			return
+		}
+	}
+}
+
+func (s *fakeNATS) publish(r *bufio.Reader, op string, args []string) {
+	var headerSize int
+	if op == "HPUB" {
+		require.Len(s.t, args, 3)
+		headerSize, _ = strconv.Atoi(args[1])
+	} else {
+		require.Len(s.t, args, 2)
+	}
+	total, _ := strconv.Atoi(args[len(args)-1])
+
+	buf := make([]byte, total+2)
+	_, err := io.ReadFull(r, buf)
+	require.NoError(s.t, err)
+	msg := fakeNATSMessage{subject: args[0], header: string(buf[:headerSize])}
+	require.NoError(s.t, json.Unmarshal(buf[headerSize:total], &msg.payload))
+
+	s.mutex.Lock()
+	s.messages = append(s.messages, msg)
+	s.mutex.Unlock()
+}
+
+func TestNATS_Publish(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	messages := []Message{
+		{ID: 1, Type: "link.created", ShortCode: "abc", OriginalURL: "https://ya.ru"},
+		{ID: 2, Type: "link.clicked", ShortCode: "abc"},
+	}
+
+	for _, headers := range []bool{true, false} {
+		server := newFakeNATS(t, "secret", headers)
+		n, err := NewNATS("nats://shortener:secret@"+server.listener.Addr().String(), "shortener.links")
+		require.NoError(t, err)
+
+		require.NoError(t, n.Publish(ctx, messages[:1]))
+		require.NoError(t, n.Publish(ctx, messages[1:]))
+		require.NoError(t, n.Close())
+
+		server.mutex.Lock()
+		require.Len(t, server.messages, 2)
+		for i, msg := range server.messages {
+			assert.Equal(t, "shortener.links", msg.subject)
+			assert.Equal(t, messages[i].ID, msg.payload.ID)
+			assert.Equal(t, messages[i].Type, msg.payload.Type)
+			if headers {
+				assert.Contains(t, msg.header, "Nats-Msg-Id: "+strconv.FormatInt(messages[i].ID, 10)+"\r\n")
+			} else {
+				assert.Empty(t, msg.header)
+			}
+		}
+		server.mutex.Unlock()
+	}
+
+	// the server error fails the publication
+	server := newFakeNATS(t, "secret", true)
+	n, err := NewNATS("nats://shortener:wrong@"+server.listener.Addr().String(), "shortener.links")
+	require.NoError(t, err)
+	err = n.Publish(ctx, messages)
+	assert.ErrorContains(t, err, "Authorization Violation")
+}
+
+func TestNewNATS(t *testing.T) {
+	n, err := NewNATS("localhost", "links")
+	require.NoError(t, err)
+	assert.Equal(t, "nats", n.server.Scheme)
+
+	_, err = NewNATS("http://localhost:4222", "links")
+	assert.Error(t, err)
+	_, err = NewNATS("localhost:4222", "bad subject")
+	assert.Error(t, err)
+}
@@ -0,0 +1,173 @@
+package eventbus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/metrics"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+	"github.com/zasuchilas/shortener/internal/app/utils/urlfuncs"
+)
+
+// Relay settings.
+const (
+	RelayBatch          = 500              // the number of the outbox events published at once
+	RelayPollInterval   = time.Second      // the interval of checking the outbox
+	RelayLeaseTTL       = 30 * time.Second // the time the relay of the instance holds the outbox
+	RelayPublishTimeout = 10 * time.Second // the deadline of publishing one batch
+	RelayRetryBaseDelay = time.Second      // the delay after the first failed publication
+	RelayRetryMaxDelay  = time.Minute      // the delay limit of the repeated failures
+)
+
+// Relay publishes the events of the storage outbox to the event bus.
+//
+// Only the instance holding the lease of the outbox publishes the events. The batch is removed from the outbox
+// after it is published, so the batch is published again if the publication or the removal fails.
+type Relay struct {
+	repo      repository.IStorage
+	publisher Publisher
+	owner     string
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// NewRelay creates the relay of the storage outbox to the publisher.
+func NewRelay(repo repository.IStorage, publisher Publisher) *Relay {
+	host, _ := os.Hostname()
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	return &Relay{
+		repo:      repo,
+		publisher: publisher,
+		owner:     host + "-" + hex.EncodeToString(id),
+	}
+}
+
+// Start starts the relay in the background.
+func (r *Relay) Start(_ context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+		r.run(ctx)
+	}()
+	return nil
+}
+
+// Stop stops the relay, waits for the current batch and closes the publisher.
+//
+// The events that are not published yet are published after the restart.
+func (r *Relay) Stop(ctx context.Context) error {
+	if r.cancel != nil {
+		r.cancel()
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return r.publisher.Close()
+}
+
+// run publishes the outbox until the context is canceled, the full batch is followed by the next one at once.
+func (r *Relay) run(ctx context.Context) {
+	failures := 0
+	for {
+		published, err := r.RelayBatch(ctx)
+
+		delay := RelayPollInterval
+		switch {
+		case err != nil:
+			failures++
+			delay = retryDelay(failures)
+			logger.Log.Info("relaying link events to the event bus",
+				zap.Int("failures", failures), zap.Duration("retryIn", delay), zap.String("error", err.Error()))
+		case published == RelayBatch:
+			failures = 0
+			delay = 0
+		default:
+			failures = 0
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// RelayBatch publishes the first batch of the outbox and removes it, returns the number of the published events.
+//
+// Nothing is published if the outbox is held by another instance.
+func (r *Relay) RelayBatch(ctx context.Context) (published int, err error) {
+	leased, err := r.repo.LeaseBusRelay(ctx, r.owner, RelayLeaseTTL)
+	if err != nil || !leased {
+		return 0, err
+	}
+
+	events, err := r.repo.PendingBusEvents(ctx, RelayBatch)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	messages := make([]Message, len(events))
+	ids := make([]int64, len(events))
+	for i, event := range events {
+		messages[i] = NewMessage(event)
+		ids[i] = event.ID
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, RelayPublishTimeout)
+	err = r.publisher.Publish(publishCtx, messages)
+	cancel()
+	if err != nil {
+		metrics.BusPublishErrors.Inc()
+		return 0, err
+	}
+	metrics.BusEventsPublished.Add(float64(len(events)))
+
+	// the published batch is removed even if the relay is stopping, otherwise it is published again
+	completeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), RelayPublishTimeout)
+	defer cancel()
+	if err = r.repo.CompleteBusEvents(completeCtx, ids...); err != nil {
+		return 0, err
+	}
+
+	return len(events), nil
+}
+
+// NewMessage returns the message of the outbox event.
+func NewMessage(event *model.BusEvent) Message {
+	return Message{
+		ID:          event.ID,
+		Type:        event.Type,
+		Time:        event.Time,
+		UserID:      event.UserID,
+		Domain:      event.Domain,
+		ShortCode:   event.ShortURL,
+		ShortURL:    urlfuncs.EnrichURL(model.LinkKey(event.Domain, event.ShortURL)),
+		OriginalURL: event.OrigURL,
+	}
+}
+
+// retryDelay returns the delay after the failures, it doubles with every failure up to RelayRetryMaxDelay.
+func retryDelay(failures int) time.Duration {
+	delay := RelayRetryBaseDelay
+	for i := 1; i < failures && delay < RelayRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, RelayRetryMaxDelay)
+}
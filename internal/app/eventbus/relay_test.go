@@ -0,0 +1,101 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+)
+
+func TestRelay_RelayBatch(t *testing.T) {
+	config.EventBus = KindKafka
+	t.Cleanup(func() { config.EventBus = "" })
+
+	ctx := context.TODO()
+	repo := repository.NewDBMaps()
+	publisher := NewMemory()
+	relay := NewRelay(repo, publisher)
+
+	shortURL, _, err := repo.WriteURL(ctx, "", "https://ya.ru", 1)
+	require.NoError(t, err)
+	_, err = repo.ReadURL(ctx, shortURL)
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteURLs(ctx, shortURL))
+
+	// the events are published in the order of the changes and removed from the outbox
+	published, err := relay.RelayBatch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, published)
+	messages := publisher.Messages()
+	require.Len(t, messages, 3)
+	for i, eventType := range []string{model.EventLinkCreated, model.EventLinkClicked, model.EventLinkDeleted} {
+		assert.Equal(t, eventType, messages[i].Type)
+		assert.Equal(t, shortURL, messages[i].Key())
+		assert.Contains(t, messages[i].ShortURL, "/"+shortURL)
+		assert.Equal(t, int64(1), messages[i].UserID)
+	}
+	pending, err := repo.PendingBusEvents(ctx, RelayBatch)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// the failed batch stays in the outbox and is published again
+	_, _, err = repo.WriteURL(ctx, "", "https://google.com", 1)
+	require.NoError(t, err)
+	publisher.SetError(errors.New("broker is down"))
+	_, err = relay.RelayBatch(ctx)
+	assert.Error(t, err)
+	pending, err = repo.PendingBusEvents(ctx, RelayBatch)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+
+	publisher.SetError(nil)
+	published, err = relay.RelayBatch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	messages = publisher.Messages()
+	require.Len(t, messages, 4)
+	assert.Equal(t, pending[0].ID, messages[3].ID)
+}
+
+func TestRelay_StartStop(t *testing.T) {
+	config.EventBus = KindNATS
+	t.Cleanup(func() { config.EventBus = "" })
+
+	repo := repository.NewDBMaps()
+	publisher := NewMemory()
+	relay := NewRelay(repo, publisher)
+	require.NoError(t, relay.Start(context.TODO()))
+
+	_, _, err := repo.WriteURL(context.TODO(), "", "https://ya.ru", 1)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return len(publisher.Messages()) == 1
+	}, 3*RelayPollInterval, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, relay.Stop(ctx))
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, RelayRetryBaseDelay, retryDelay(1))
+	assert.Equal(t, 4*RelayRetryBaseDelay, retryDelay(3))
+	assert.Equal(t, RelayRetryMaxDelay, retryDelay(100))
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("rabbitmq", "localhost:5672", "links")
+	assert.Error(t, err)
+	_, err = New(KindKafka, "", "links")
+	assert.Error(t, err)
+	p, err := New(KindKafka, "localhost:9092,localhost:9093", "links")
+	require.NoError(t, err)
+	assert.Len(t, p.(*Kafka).bootstrap, 2)
+}
@@ -0,0 +1,50 @@
+package grpcserver
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	desc "github.com/zasuchilas/shortener/pkg/shortenergrpcv1"
+)
+
+// HealthCheckInterval is the interval for updating the readiness status.
+const HealthCheckInterval = 5 * time.Second
+
+// watchHealth updates the grpc.health.v1 statuses until the server stops.
+//
+// The empty service name reports liveness (the server is running),
+// the ShortenerV1 service name reports readiness (all dependency checks have passed).
+func (s *Server) watchHealth() {
+	ticker := time.NewTicker(HealthCheckInterval)
+	defer ticker.Stop()
+
+	s.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	for {
+		s.updateReadiness()
+
+		select {
+		case <-s.healthDone:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// updateReadiness sets the readiness status of the ShortenerV1 service.
+func (s *Server) updateReadiness() {
+	ctx, cancel := context.WithTimeout(context.Background(), HealthCheckInterval)
+	defer cancel()
+
+	report := s.shortenerService.Health(ctx)
+	status := healthpb.HealthCheckResponse_SERVING
+	if report.Status != model.HealthStatusOK {
+		logger.Log.Info("the service is not ready", zap.Any("checks", report.Checks))
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	s.health.SetServingStatus(desc.ShortenerV1_ServiceDesc.ServiceName, status)
+}
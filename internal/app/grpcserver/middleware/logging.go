@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/zasuchilas/shortener/internal/app/logger"
+)
+
+// requestIDKey is the metadata key with the request ID (the keys are lowercase in gRPC).
+var requestIDKey = strings.ToLower(logger.RequestIDHeader)
+
+// LoggingInterceptor logs gRPC requests with the same fields as the HTTP access log.
+//
+// The interceptor takes the x-request-id metadata (or generates a new ID), sends it back in the header
+// and puts the request-scoped logger into the context (see logger.FromContext).
+// It must be used after the tracing interceptor, so the trace fields are in the log.
+func LoggingInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	start := time.Now()
+
+	requestID := incomingRequestID(ctx)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, requestID))
+	ctx = logger.NewContext(logger.WithRequestID(ctx, requestID))
+
+	resp, err := handler(ctx, req)
+
+	logRequest(ctx, info.FullMethod, start, err)
+
+	return resp, err
+}
+
+// LoggingStreamInterceptor logs gRPC streams the same way as LoggingInterceptor (when the stream ends).
+func LoggingStreamInterceptor(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	start := time.Now()
+
+	ctx := ss.Context()
+	requestID := incomingRequestID(ctx)
+	_ = ss.SetHeader(metadata.Pairs(requestIDKey, requestID))
+	ctx = logger.NewContext(logger.WithRequestID(ctx, requestID))
+
+	err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+
+	logRequest(ctx, info.FullMethod, start, err)
+
+	return err
+}
+
+// incomingRequestID returns the x-request-id of the request metadata or a new ID.
+func incomingRequestID(ctx context.Context) string {
+	incoming := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDKey); len(values) > 0 {
+			incoming = values[0]
+		}
+	}
+	return logger.RequestIDOrNew(incoming)
+}
+
+// logRequest writes the access log record of the call.
+func logRequest(ctx context.Context, method string, start time.Time, err error) {
+	remoteAddr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+	userAgent := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		userAgent = strings.Join(md.Get("user-agent"), " ")
+	}
+
+	logger.FromContext(ctx).Info(
+		"GRPC REQUEST",
+		zap.String("method", method),
+		zap.String("code", status.Code(err).String()),
+		zap.Duration("duration", time.Since(start)),
+		zap.String("remote_addr", remoteAddr),
+		zap.String("user_agent", userAgent),
+	)
+}
+
+// serverStream is the server stream with the request-scoped context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context _
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/zasuchilas/shortener/internal/app/logger"
+)
+
+func TestLoggingInterceptor(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	prev := logger.Log
+	logger.Log = zap.New(core)
+	defer func() { logger.Log = prev }()
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "req-1"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/shortener_v1.ShortenerV1/ReadURL"}
+	_, err := LoggingInterceptor(ctx, nil, info, func(ctx context.Context, _ any) (any, error) {
+		assert.Equal(t, "req-1", logger.RequestID(ctx))
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	entries := logs.TakeAll()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "req-1", fields["request_id"])
+	assert.Equal(t, info.FullMethod, fields["method"])
+	assert.Equal(t, "OK", fields["code"])
+}
@@ -1,39 +1,78 @@
 package grpcserver
 
 import (
+	"context"
+	"errors"
 	"net"
+	"sync"
 
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 
 	"github.com/zasuchilas/shortener/internal/app/api/grpcapi"
 	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/grpcserver/middleware"
 	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/metrics"
+	"github.com/zasuchilas/shortener/internal/app/ratelimit"
 	"github.com/zasuchilas/shortener/internal/app/service"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
 	desc "github.com/zasuchilas/shortener/pkg/shortenergrpcv1"
 )
 
 // Server _
 type Server struct {
 	server           *grpc.Server
+	health           *health.Server
+	healthDone       chan struct{}
+	stopOnce         sync.Once
 	shortenerService service.ShortenerService
 }
 
 // NewServer _
 func NewServer(shortenerService service.ShortenerService) *Server {
 
+	// the shortening methods are limited by client IP (the users are not identified in gRPC)
+	shortenLimiter := ratelimit.New(config.ShortenRateLimit)
+
 	grpcServer := grpc.NewServer(
 		grpc.Creds(insecure.NewCredentials()),
+		grpc.ChainUnaryInterceptor(
+			tracing.UnaryServerInterceptor,
+			middleware.LoggingInterceptor,
+			metrics.UnaryServerInterceptor,
+			shortenLimiter.UnaryServerInterceptor(
+				desc.ShortenerV1_WriteURL_FullMethodName,
+				desc.ShortenerV1_Shorten_FullMethodName,
+				desc.ShortenerV1_ShortenBatch_FullMethodName,
+			),
+		),
+		grpc.ChainStreamInterceptor(
+			tracing.StreamServerInterceptor,
+			middleware.LoggingStreamInterceptor,
+			metrics.StreamServerInterceptor,
+			shortenLimiter.StreamServerInterceptor(
+				desc.ShortenerV1_ShortenStream_FullMethodName,
+			),
+		),
 	)
 
 	reflection.Register(grpcServer)
 
 	desc.RegisterShortenerV1Server(grpcServer, grpcapi.NewImplementation(shortenerService))
 
+	// standard grpc.health.v1 service
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
 	return &Server{
 		server:           grpcServer,
+		health:           healthServer,
+		healthDone:       make(chan struct{}),
 		shortenerService: shortenerService,
 	}
 }
@@ -47,8 +86,36 @@ func (s *Server) Run() {
 		logger.Log.Panic("gRPC listen")
 	}
 
+	go s.watchHealth()
+
 	err = s.server.Serve(list)
-	if err != nil {
+	if err != nil && !errors.Is(err, grpc.ErrServerStopped) {
 		logger.Log.Panic("gRPC serve")
 	}
 }
+
+// Stop stops gRPC server gracefully.
+//
+// If the active RPCs are not finished until the ctx deadline, the server is stopped forcibly.
+// Stop may be called more than once.
+func (s *Server) Stop(ctx context.Context) error {
+	// the clients stop sending new requests as soon as possible
+	s.stopOnce.Do(func() {
+		close(s.healthDone)
+		s.health.Shutdown()
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,16 @@
+package grpcserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_Stop(t *testing.T) {
+	s := NewServer(nil)
+
+	// the lifecycle manager and the error path may both stop the server
+	assert.NoError(t, s.Stop(context.TODO()))
+	assert.NoError(t, s.Stop(context.TODO()))
+}
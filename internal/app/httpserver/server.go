@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -11,7 +12,10 @@ import (
 
 	"github.com/zasuchilas/shortener/internal/app/config"
 	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/metrics"
+	"github.com/zasuchilas/shortener/internal/app/ratelimit"
 	"github.com/zasuchilas/shortener/internal/app/secure"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
 	"github.com/zasuchilas/shortener/internal/app/utils/compress"
 	"github.com/zasuchilas/shortener/pkg/shortenerhttpv1"
 	"github.com/zasuchilas/shortener/pkg/trusted"
@@ -54,7 +58,7 @@ func (s *Server) Run() {
 			logger.Log.Panic("making pem files for TLS", zap.String("err", err.Error()))
 		}
 		// running https Server
-		if err = s.server.ListenAndServeTLS("./cert.pem", "./key.pem"); err != http.ErrServerClosed {
+		if err = s.server.ListenAndServeTLS(certPath(), keyPath()); err != http.ErrServerClosed {
 			// listener start or stop errors
 			logger.Log.Panic("HTTPS Server ListenAndServeTLS", zap.String("err", err.Error()))
 		}
@@ -62,12 +66,16 @@ func (s *Server) Run() {
 }
 
 // Stop stops http Server.
-func (s *Server) Stop() {
+//
+// Active connections are waited for until the ctx deadline.
+func (s *Server) Stop(ctx context.Context) error {
 	// stopping the Server
-	if err := s.server.Shutdown(context.Background()); err != nil {
+	if err := s.server.Shutdown(ctx); err != nil {
 		// listener closing errors
 		log.Printf("HTTP Server Shutdown: %v", err)
+		return err
 	}
+	return nil
 }
 
 // Router sets the routes.
@@ -77,28 +85,49 @@ func (s *Server) Router() chi.Router {
 	r := chi.NewRouter()
 
 	// middlewares
-	r.Use(middleware.Logger)
-	//r.Use(logger.LoggingMiddleware)
+	r.Use(tracing.HTTPMiddleware)
+	r.Use(metrics.HTTPMiddleware)
+	r.Use(logger.LoggingMiddleware)
 	r.Use(compress.GzipMiddleware)
 	r.Mount("/debug/", middleware.Profiler())
 
 	// routes
 	r.Get("/{shortURL}", s.httpAPI.ReadURLHandler)
+	r.Head("/{shortURL}", s.httpAPI.ReadURLHandler)
 	r.Get("/ping", s.httpAPI.PingHandler)
+	r.Get("/healthz", s.httpAPI.HealthzHandler)
+	r.Get("/readyz", s.httpAPI.ReadyzHandler)
+	r.Get("/api/qr/{shortURL}", s.httpAPI.QRCodeHandler)
 
 	// routes with guard (if there is no valid token returns error 401 Unauthorized)
 	r.Group(func(r chi.Router) {
 		r.Use(s.secure.GuardMiddleware)
 		r.Get("/api/user/urls", s.httpAPI.UserURLsHandler)
+		r.Get("/api/user/urls/broken", s.httpAPI.BrokenURLsHandler)
 		r.Delete("/api/user/urls", s.httpAPI.DeleteURLsHandler)
+		r.Patch("/api/user/urls/{shortURL}", s.httpAPI.UpdateURLHandler)
+		r.Get("/api/user/urls/{shortURL}/revisions", s.httpAPI.URLRevisionsHandler)
+		r.Patch("/api/user/urls/{shortURL}/options", s.httpAPI.URLOptionsHandler)
+		r.Get("/api/jobs/{id}", s.httpAPI.ShortenJobStatusHandler)
+		r.Get("/api/jobs/{id}/result", s.httpAPI.ShortenJobResultHandler)
+		r.Post("/api/user/webhooks", s.httpAPI.CreateWebhookHandler)
+		r.Get("/api/user/webhooks", s.httpAPI.UserWebhooksHandler)
+		r.Delete("/api/user/webhooks/{id}", s.httpAPI.DeleteWebhookHandler)
+		r.Get("/api/user/webhooks/{id}/deliveries", s.httpAPI.WebhookDeliveriesHandler)
 	})
 
 	// routes with secure cookie (if there is no valid token assigns a new token)
+	// and rate limits (new users by IP, shortening by user or IP)
+	newUserLimiter := ratelimit.New(config.NewUserRateLimit)
+	shortenLimiter := ratelimit.New(config.ShortenRateLimit)
 	r.Group(func(r chi.Router) {
+		r.Use(newUserLimiter.NewUserMiddleware(s.secure))
 		r.Use(s.secure.SecureMiddleware)
+		r.Use(shortenLimiter.Middleware(ratelimit.LimitShorten, ratelimit.UserKey))
 		r.Post("/", s.httpAPI.WriteURLHandler)
 		r.Post("/api/shorten", s.httpAPI.ShortenHandler)
 		r.Post("/api/shorten/batch", s.httpAPI.ShortenBatchHandler)
+		r.Post("/api/jobs/shorten", s.httpAPI.ShortenJobHandler)
 	})
 
 	trustedSubnet := trusted.NewTrustedSubnet(config.TrustedSubnet)
@@ -107,5 +136,19 @@ func (s *Server) Router() chi.Router {
 		r.Get("/api/internal/stats", s.httpAPI.StatsHandler)
 	})
 
+	// the short URL with the extra path (/{shortURL}/extra/path) is the fallback of the other routes,
+	// so the API routes keep their 404 and 405 responses
+	r.NotFound(s.notFound)
+
 	return r
 }
+
+// notFound passes GET and HEAD requests with the extra path to the short URL, the rest is not found.
+func (s *Server) notFound(w http.ResponseWriter, r *http.Request) {
+	if (r.Method == http.MethodGet || r.Method == http.MethodHead) &&
+		strings.Contains(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/") {
+		s.httpAPI.ReadURLHandler(w, r)
+		return
+	}
+	http.NotFound(w, r)
+}
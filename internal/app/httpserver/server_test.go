@@ -1,15 +1,23 @@
 package httpserver
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"image/png"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/zasuchilas/shortener/internal/app/api/httpapi"
 	"github.com/zasuchilas/shortener/internal/app/service"
@@ -22,6 +30,7 @@ import (
 	"github.com/zasuchilas/shortener/internal/app/config"
 	"github.com/zasuchilas/shortener/internal/app/repository"
 	"github.com/zasuchilas/shortener/internal/app/secure"
+	"github.com/zasuchilas/shortener/pkg/shortenerhttpv1"
 )
 
 var (
@@ -110,7 +119,7 @@ func TestServer_writeURLHandler(t *testing.T) {
 			target: "/abc",
 			body:   "http://спор т.ru/",
 			want: want{
-				statusCode:  400,
+				statusCode:  404, // GET of the unknown short url
 				contentType: "text/plain",
 				response:    "", // parse "http://спор т.ru/": invalid character " " in host name
 			},
@@ -160,11 +169,11 @@ func TestServer_readURLHandler(t *testing.T) {
 			},
 		},
 		{
-			name:   "negative test #1 (has many different errors)",
+			name:   "unknown short url",
 			method: http.MethodGet,
 			target: "/abc",
 			want: want{
-				statusCode:  400,
+				statusCode:  404,
 				contentType: "text/plain",
 				location:    "",
 			},
@@ -301,6 +310,16 @@ func TestServer_shortenBatchHandler(t *testing.T) {
 			expectedBody:        fmt.Sprintf(`[{"correlation_id": "batch1",	"short_url": "http://%s/19xtf1ts"}]`, config.BaseURL),
 			expectedContentType: "application/json",
 		},
+		{
+			name:         "wrong items",
+			method:       http.MethodPost,
+			url:          url,
+			body:         `[{"correlation_id": "batch1", "original_url": "https://ya.ru"}, {"correlation_id": "batch2", "original_url": "javascript:alert(1)"}]`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `[{"index": 1, "correlation_id": "batch2", "original_url": "javascript:alert(1)",
+				"error": "the URL scheme is not allowed: javascript"}]`,
+			expectedContentType: "application/json",
+		},
 	}
 
 	for _, tc := range tests {
@@ -384,6 +403,285 @@ func TestServer_deleteURLsHandler(t *testing.T) {
 	testServer.Close()
 }
 
+func TestServer_updateURLHandler(t *testing.T) {
+	const url = "/api/user/urls/19xtf1ts"
+	setup()
+
+	// create URL requests of two users
+	req1 := resty.New().R()
+	req1.Method = http.MethodPost
+	req1.URL = testServer.URL
+	req1.SetBody("ya.ru")
+	resp1, _ := req1.Send()
+
+	reqOther := resty.New().R()
+	reqOther.Method = http.MethodPost
+	reqOther.URL = testServer.URL
+	reqOther.SetBody("google.com")
+	respOther, _ := reqOther.Send()
+
+	tests := []struct {
+		name    string
+		url     string
+		body    string
+		cookies []*http.Cookie
+		status  int
+	}{
+		{name: "without token", url: url, body: `{"url": "yandex.ru"}`, status: http.StatusUnauthorized},
+		{name: "wrong body", url: url, body: `{"url":`, cookies: resp1.Cookies(), status: http.StatusBadRequest},
+		{name: "wrong url", url: url, body: `{"url": "javascript:alert(1)"}`, cookies: resp1.Cookies(), status: http.StatusBadRequest},
+		{name: "unknown short url", url: "/api/user/urls/19xtf1ua", body: `{"url": "yandex.ru"}`, cookies: resp1.Cookies(), status: http.StatusNotFound},
+		{name: "other people's short url", url: url, body: `{"url": "yandex.ru"}`, cookies: respOther.Cookies(), status: http.StatusForbidden},
+		{name: "existing destination", url: url, body: `{"url": "google.com"}`, cookies: resp1.Cookies(), status: http.StatusConflict},
+		{name: "valid update", url: url, body: `{"url": "yandex.ru"}`, cookies: resp1.Cookies(), status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := resty.New().R()
+			req.Method = http.MethodPatch
+			req.URL = testServer.URL + tt.url
+			req.SetHeader("Content-Type", "application/json")
+			req.SetBody(tt.body)
+			req.SetCookies(tt.cookies)
+			resp, err := req.Send()
+			assert.NoError(t, err, "error making HTTP request")
+			assert.Equal(t, tt.status, resp.StatusCode(), "Response code didn't match expected")
+		})
+	}
+
+	// the short URL redirects to the new destination
+	resp, _ := testRequest(t, http.MethodGet, "/19xtf1ts", nil)
+	defer resp.Body.Close()
+	assert.Equal(t, "yandex.ru", resp.Header.Get("Location"))
+
+	// the revision is recorded
+	req2 := resty.New().R()
+	req2.Method = http.MethodGet
+	req2.URL = testServer.URL + url + "/revisions"
+	req2.SetCookies(resp1.Cookies())
+	resp2, err := req2.Send()
+	assert.NoError(t, err, "error making HTTP request")
+	assert.Equal(t, http.StatusOK, resp2.StatusCode(), "Response code didn't match expected")
+	var revisions []shortenerhttpv1.URLRevisionsResponseItem
+	require.NoError(t, json.Unmarshal(resp2.Body(), &revisions))
+	require.Len(t, revisions, 1)
+	assert.Equal(t, int64(1), revisions[0].Revision)
+	assert.Equal(t, "ya.ru", revisions[0].PreviousURL)
+	assert.Equal(t, "yandex.ru", revisions[0].OriginalURL)
+
+	testServer.Close()
+}
+
+func TestServer_qrCodeHandler(t *testing.T) {
+	setup()
+	defer testServer.Close()
+
+	client := resty.New()
+	var shortened shortenerhttpv1.ShortenResponse
+	resp, err := client.R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(`{"url": "https://practicum.yandex.ru/", "qr": true}`).
+		SetResult(&shortened).
+		Post(testServer.URL + "/api/shorten")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode())
+
+	// the inlined QR code is the base64-encoded PNG
+	data, err := base64.StdEncoding.DecodeString(shortened.QR)
+	require.NoError(t, err)
+	inlined, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 256, inlined.Bounds().Dx())
+
+	code := shortened.Result[strings.LastIndex(shortened.Result, "/")+1:]
+
+	tests := []struct {
+		name                string
+		query               string
+		expectedCode        int
+		expectedContentType string
+	}{
+		{name: "default png", query: code, expectedCode: http.StatusOK, expectedContentType: "image/png"},
+		{name: "sized png", query: code + "?size=100&level=H&margin=0", expectedCode: http.StatusOK, expectedContentType: "image/png"},
+		{name: "svg", query: code + "?format=svg", expectedCode: http.StatusOK, expectedContentType: "image/svg+xml"},
+		{name: "wrong format", query: code + "?format=gif", expectedCode: http.StatusBadRequest},
+		{name: "wrong level", query: code + "?level=X", expectedCode: http.StatusBadRequest},
+		{name: "wrong size", query: code + "?size=big", expectedCode: http.StatusBadRequest},
+		{name: "too large size", query: code + "?size=100000", expectedCode: http.StatusBadRequest},
+		{name: "unknown short url", query: "unknown1", expectedCode: http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := client.R().Get(testServer.URL + "/api/qr/" + tc.query)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedCode, resp.StatusCode())
+			if tc.expectedCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, tc.expectedContentType, resp.Header().Get("Content-Type"))
+			if tc.expectedContentType == "image/png" {
+				_, err = png.Decode(bytes.NewReader(resp.Body()))
+				assert.NoError(t, err)
+			} else {
+				assert.Contains(t, string(resp.Body()), "<svg")
+			}
+		})
+	}
+}
+
+func TestServer_previewAndOptions(t *testing.T) {
+	const url = "/api/user/urls/19xtf1ts/options"
+	setup()
+	defer testServer.Close()
+
+	// create URL request
+	req1 := resty.New().R()
+	req1.Method = http.MethodPost
+	req1.URL = testServer.URL
+	req1.SetBody("ya.ru")
+	resp1, _ := req1.Send()
+
+	tests := []struct {
+		name    string
+		body    string
+		cookies []*http.Cookie
+		status  int
+	}{
+		{name: "without token", body: `{"title": "Yandex"}`, status: http.StatusUnauthorized},
+		{name: "wrong body", body: `{"title":`, cookies: resp1.Cookies(), status: http.StatusBadRequest},
+		{name: "no options", body: `{}`, cookies: resp1.Cookies(), status: http.StatusBadRequest},
+		{name: "too long title", body: `{"title": "` + strings.Repeat("a", 201) + `"}`, cookies: resp1.Cookies(), status: http.StatusBadRequest},
+		{name: "valid options", body: `{"title": "<b>Yandex</b>"}`, cookies: resp1.Cookies(), status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := resty.New().R()
+			req.Method = http.MethodPatch
+			req.URL = testServer.URL + url
+			req.SetHeader("Content-Type", "application/json")
+			req.SetBody(tt.body)
+			req.SetCookies(tt.cookies)
+			resp, err := req.Send()
+			assert.NoError(t, err, "error making HTTP request")
+			assert.Equal(t, tt.status, resp.StatusCode(), "Response code didn't match expected")
+		})
+	}
+
+	// the visit is counted, the preview page (+ suffix) shows the link info
+	resp, _ := testRequest(t, http.MethodGet, "/19xtf1ts", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	resp, body := testRequest(t, http.MethodGet, "/19xtf1ts+", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/html")
+	assert.Contains(t, body, "&lt;b&gt;Yandex&lt;/b&gt;")
+	assert.Contains(t, body, `href="http://ya.ru"`)
+	assert.Contains(t, body, "Clicks: 1")
+	_, body = testRequest(t, http.MethodGet, "/19xtf1ts+", nil)
+	assert.Contains(t, body, "Clicks: 1")
+
+	// the link with the preview option shows the preview page instead of the redirect
+	req := resty.New().R()
+	req.SetHeader("Content-Type", "application/json")
+	req.SetBody(`{"preview": true}`)
+	req.SetCookies(resp1.Cookies())
+	resp2, err := req.Patch(testServer.URL + url)
+	assert.NoError(t, err, "error making HTTP request")
+	var options shortenerhttpv1.URLOptionsResponse
+	require.NoError(t, json.Unmarshal(resp2.Body(), &options))
+	assert.Equal(t, "<b>Yandex</b>", options.Title)
+	assert.True(t, options.Preview)
+
+	resp, body = testRequest(t, http.MethodGet, "/19xtf1ts", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, "Clicks: 2")
+
+	// the flagged destination gets the "you are leaving" page
+	warnlist := filepath.Join(t.TempDir(), "warnlist.txt")
+	require.NoError(t, os.WriteFile(warnlist, []byte("casino.example\n"), 0600))
+	config.DomainWarnlistPath, config.LeavingInterstitial = warnlist, true
+	defer func() { config.DomainWarnlistPath, config.LeavingInterstitial = "", false }()
+
+	req3 := resty.New().R()
+	req3.SetBody("https://casino.example/")
+	_, err = req3.Post(testServer.URL)
+	assert.NoError(t, err, "error making HTTP request")
+	resp, body = testRequest(t, http.MethodGet, "/19xtf1tt", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, "You are leaving")
+	assert.Contains(t, body, `href="https://casino.example/"`)
+}
+
+func TestServer_redirectCodes(t *testing.T) {
+	const url = "/api/user/urls/19xtf1ts/options"
+	setup()
+	defer testServer.Close()
+
+	req1 := resty.New().R()
+	req1.SetBody("ya.ru")
+	resp1, err := req1.Post(testServer.URL)
+	require.NoError(t, err)
+
+	setOptions := func(body string) int {
+		req := resty.New().R()
+		req.SetHeader("Content-Type", "application/json")
+		req.SetBody(body)
+		req.SetCookies(resp1.Cookies())
+		resp, e := req.Patch(testServer.URL + url)
+		require.NoError(t, e)
+		return resp.StatusCode()
+	}
+
+	config.RedirectCacheMaxAge = "24h"
+	defer func() { config.RedirectCacheMaxAge = "" }()
+
+	// the default temporary redirect is not cached
+	resp, _ := testRequest(t, http.MethodGet, "/19xtf1ts", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "private, no-cache", resp.Header.Get("Cache-Control"))
+
+	// the permanent redirect of the link is cached until the link expiry
+	assert.Equal(t, http.StatusBadRequest, setOptions(`{"redirect_code": 303}`))
+	assert.Equal(t, http.StatusBadRequest, setOptions(`{"expires_at": "tomorrow"}`))
+	assert.Equal(t, http.StatusBadRequest, setOptions(`{"expires_at": "2000-01-01T00:00:00Z"}`))
+	expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	assert.Equal(t, http.StatusOK, setOptions(`{"redirect_code": 308, "expires_at": "`+expiresAt+`"}`))
+
+	resp, _ = testRequest(t, http.MethodGet, "/19xtf1ts", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+	assert.Equal(t, "ya.ru", resp.Header.Get("Location"))
+	maxAge, err := strconv.Atoi(strings.TrimPrefix(resp.Header.Get("Cache-Control"), "public, max-age="))
+	require.NoError(t, err)
+	assert.InDelta(t, 3600, maxAge, 5)
+	_, err = http.ParseTime(resp.Header.Get("Expires"))
+	assert.NoError(t, err)
+
+	// the global default code
+	assert.Equal(t, http.StatusOK, setOptions(`{"redirect_code": 0}`))
+	config.RedirectCode = "302"
+	defer func() { config.RedirectCode = "" }()
+	resp, _ = testRequest(t, http.MethodGet, "/19xtf1ts", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	// the HEAD requests are not counted
+	resp, body := testRequest(t, http.MethodHead, "/19xtf1ts", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Empty(t, body)
+	resp, _ = testRequest(t, http.MethodHead, "/unknown1", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	_, body = testRequest(t, http.MethodGet, "/19xtf1ts+", nil)
+	assert.Contains(t, body, "Clicks: 3")
+}
+
 func TestServer_userURLsHandler(t *testing.T) {
 	const url = "/api/user/urls"
 	setup()
@@ -444,7 +742,7 @@ func TestServer_userURLsHandlerBadUserID(t *testing.T) {
 
 func TestServer_pingHandler(t *testing.T) {
 	const url = "/ping"
-	config.FileStoragePath = "./storage_test.db"
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
 
 	tests := []struct {
 		name           string
@@ -484,6 +782,11 @@ func TestServer_pingHandler(t *testing.T) {
 	}
 
 	_ = os.Remove(config.FileStoragePath)
+	_ = os.Remove(config.FileStoragePath + repository.OutboxFileSuffix)
+	_ = os.Remove(config.FileStoragePath + repository.JobsFileSuffix)
+	_ = os.Remove(config.FileStoragePath + repository.WebhooksFileSuffix)
+	_ = os.Remove(config.FileStoragePath + repository.DeliveriesFileSuffix)
+	_ = os.Remove(config.FileStoragePath + repository.EventsFileSuffix)
 }
 
 func TestGzipCompression(t *testing.T) {
@@ -493,6 +796,9 @@ func TestGzipCompression(t *testing.T) {
 
 func TestServer_Start(t *testing.T) {
 	setup()
+	defer func(enableHTTPS bool, addr string) {
+		config.EnableHTTPS, config.ServerAddress = enableHTTPS, addr
+	}(config.EnableHTTPS, config.ServerAddress)
 
 	//t.Run("http ok", func(t *testing.T) {
 	//	config.EnableHTTPS = false
@@ -524,15 +830,33 @@ func TestServer_Start(t *testing.T) {
 		})
 	})
 
+	t.Run("https pem files", func(t *testing.T) {
+		// the generated key is not left in the package
+		defer func(dir string) { pemDir = dir }(pemDir)
+		pemDir = t.TempDir()
+
+		config.EnableHTTPS = true
+		config.ServerAddress = "-"
+		require.Panics(t, func() {
+			httpServer.Run()
+		})
+		assert.FileExists(t, certPath())
+		assert.FileExists(t, keyPath())
+	})
+
 }
 
 func TestServer_Stop(t *testing.T) {
 	setup()
+	defer func(enableHTTPS bool, addr string) {
+		config.EnableHTTPS, config.ServerAddress = enableHTTPS, addr
+	}(config.EnableHTTPS, config.ServerAddress)
+	config.EnableHTTPS, config.ServerAddress = false, "127.0.0.1:0"
 
 	t.Run("normal stopping", func(t *testing.T) {
 		go httpServer.Run()
 		require.NotPanics(t, func() {
-			httpServer.Stop()
+			_ = httpServer.Stop(context.Background())
 		})
 	})
 }
@@ -589,3 +913,383 @@ func Test_getUserIDBadCtx(t *testing.T) {
 		require.Equal(t, int64(0), res)
 	})
 }
+
+func TestServer_healthHandlers(t *testing.T) {
+	setup()
+	defer testServer.Close()
+
+	t.Run("liveness", func(t *testing.T) {
+		res, body := testRequest(t, http.MethodGet, "/healthz", nil)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.JSONEq(t, `{"status": "ok"}`, body)
+	})
+
+	t.Run("readiness", func(t *testing.T) {
+		res, body := testRequest(t, http.MethodGet, "/readyz", nil)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Contains(t, res.Header.Get("Content-Type"), "application/json")
+		assert.Contains(t, body, `"name":"storage","status":"ok"`)
+		assert.Contains(t, body, `"name":"deletion_queue","status":"ok"`)
+	})
+}
+
+func TestServer_passThrough(t *testing.T) {
+	const url = "/api/user/urls/19xtf1ts/options"
+	setup()
+	defer testServer.Close()
+
+	req1 := resty.New().R()
+	req1.SetBody("https://ya.ru/docs/?lang=ru")
+	resp1, err := req1.Post(testServer.URL)
+	require.NoError(t, err)
+
+	setOptions := func(body string) int {
+		req := resty.New().R()
+		req.SetHeader("Content-Type", "application/json")
+		req.SetBody(body)
+		req.SetCookies(resp1.Cookies())
+		resp, e := req.Patch(testServer.URL + url)
+		require.NoError(t, e)
+		return resp.StatusCode()
+	}
+	location := func(path string) (int, string) {
+		resp, _ := testRequest(t, http.MethodGet, path, nil)
+		resp.Body.Close()
+		return resp.StatusCode, resp.Header.Get("Location")
+	}
+
+	// by default the query is dropped and the extra path is not found
+	code, loc := location("/19xtf1ts?utm_source=x")
+	assert.Equal(t, http.StatusTemporaryRedirect, code)
+	assert.Equal(t, "https://ya.ru/docs/?lang=ru", loc)
+	code, _ = location("/19xtf1ts/extra/path")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// the API routes are not passed through
+	resp, _ := testRequest(t, http.MethodGet, "/api/shorten", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	assert.Equal(t, http.StatusBadRequest, setOptions(`{"merge_query": "both"}`))
+	assert.Equal(t, http.StatusOK, setOptions(`{"forward_path": true, "merge_query": "incoming"}`))
+
+	code, loc = location("/19xtf1ts/extra/a%2Fb?lang=en&utm_source=x")
+	assert.Equal(t, http.StatusTemporaryRedirect, code)
+	assert.Equal(t, "https://ya.ru/docs/extra/a%2Fb?lang=en&utm_source=x", loc)
+	code, _ = location("/19xtf1ts/../admin")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = location("/19xtf1ts/%2E%2E/admin")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// the stored parameters win
+	assert.Equal(t, http.StatusOK, setOptions(`{"merge_query": "stored"}`))
+	code, loc = location("/19xtf1ts?lang=en&utm_source=x")
+	assert.Equal(t, http.StatusTemporaryRedirect, code)
+	assert.Equal(t, "https://ya.ru/docs/?lang=ru&utm_source=x", loc)
+}
+
+func TestServer_userURLsPages(t *testing.T) {
+	const url = "/api/user/urls"
+	setup()
+	defer testServer.Close()
+
+	req1 := resty.New().R()
+	req1.SetBody("ya.ru")
+	resp1, err := req1.Post(testServer.URL)
+	require.NoError(t, err)
+	for _, origURL := range []string{"go.dev", "mail.ya.ru"} {
+		req := resty.New().R()
+		req.SetBody(origURL)
+		req.SetCookies(resp1.Cookies())
+		_, err = req.Post(testServer.URL)
+		require.NoError(t, err)
+	}
+
+	get := func(path string) *resty.Response {
+		req := resty.New().R()
+		req.SetCookies(resp1.Cookies())
+		resp, e := req.Get(testServer.URL + path)
+		require.NoError(t, e)
+		return resp
+	}
+
+	// the next page is in the Link header
+	resp := get(url + "?limit=2&order=desc")
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.JSONEq(t, fmt.Sprintf(`[{"short_url": "http://%[1]s/19xtf1tu", "original_url": "mail.ya.ru"},
+		{"short_url": "http://%[1]s/19xtf1tt", "original_url": "go.dev"}]`, config.BaseURL), string(resp.Body()))
+	link := resp.Header().Get("Link")
+	require.True(t, strings.HasPrefix(link, "<"+url+"?"), link)
+	next, _, _ := strings.Cut(strings.TrimPrefix(link, "<"), ">")
+
+	resp = get(next)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.JSONEq(t, fmt.Sprintf(`[{"short_url": "http://%s/19xtf1ts", "original_url": "ya.ru"}]`, config.BaseURL),
+		string(resp.Body()))
+	assert.Empty(t, resp.Header().Get("Link"))
+
+	// filters
+	resp = get(url + "?domain=ya.ru&status=active")
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Contains(t, string(resp.Body()), "mail.ya.ru")
+	assert.NotContains(t, string(resp.Body()), "go.dev")
+	assert.Equal(t, http.StatusNoContent, get(url+"?status=deleted").StatusCode())
+
+	// wrong parameters
+	for _, query := range []string{"?limit=0", "?limit=5000", "?sort=title", "?order=up", "?status=all",
+		"?created_from=yesterday", "?cursor=wrong", "?created_from=2030-01-01T00:00:00Z&created_to=2020-01-01T00:00:00Z"} {
+		assert.Equal(t, http.StatusBadRequest, get(url+query).StatusCode(), query)
+	}
+}
+
+func TestServer_shortenUpload(t *testing.T) {
+	const url = "/api/shorten/batch"
+	setup()
+	defer testServer.Close()
+
+	upload := func(contentType, body string) *resty.Response {
+		req := resty.New().R()
+		req.SetHeader("Content-Type", contentType)
+		req.SetBody(body)
+		resp, err := req.Post(testServer.URL + url)
+		require.NoError(t, err)
+		return resp
+	}
+
+	// the wrong lines get the errors, the others are stored
+	resp := upload(shortenerhttpv1.ContentTypeNDJSON, `{"correlation_id": "a", "original_url": "https://ya.ru"}
+{"correlation_id": "b", "original_url": 
+{"correlation_id": "c", "original_url": "javascript:alert(1)"}
+
+{"correlation_id": "d", "original_url": "go.dev"}
+`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, shortenerhttpv1.ContentTypeNDJSON, resp.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(string(resp.Body())), "\n")
+	require.Len(t, lines, 4)
+	assert.JSONEq(t, fmt.Sprintf(`{"line": 1, "correlation_id": "a", "short_url": "http://%s/19xtf1ts"}`, config.BaseURL), lines[0])
+	assert.Contains(t, lines[1], `"line":2`)
+	assert.Contains(t, lines[1], `"error"`)
+	assert.JSONEq(t, `{"line": 3, "correlation_id": "c", "error": "the URL scheme is not allowed: javascript"}`, lines[2])
+	assert.JSONEq(t, fmt.Sprintf(`{"line": 5, "correlation_id": "d", "short_url": "http://%s/19xtf1tt"}`, config.BaseURL), lines[3])
+
+	// the CSV header row is skipped
+	resp = upload(shortenerhttpv1.ContentTypeCSV, "correlation_id,original_url\ne,https://ya.ru/docs\nf\n")
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Contains(t, resp.Header().Get("Content-Type"), shortenerhttpv1.ContentTypeCSV)
+	assert.Equal(t, fmt.Sprintf("line,correlation_id,short_url,error\n2,e,http://%s/19xtf1tu,\n"+
+		"3,,,\"expected 2 columns: correlation_id,original_url\"\n", config.BaseURL), string(resp.Body()))
+
+	// the broken upload fails before the results are started
+	resp = upload(shortenerhttpv1.ContentTypeCSV, "g,\"https://ya.ru\n")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+	resp = upload("application/json", `[{"correlation_id": "h", "original_url": `)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+	assert.Contains(t, string(resp.Body()), "cannot decode request JSON body") // the error is sent uncompressed
+}
+
+func TestServer_shortenUpload_streaming(t *testing.T) {
+	setup()
+	defer testServer.Close()
+
+	body, upload := io.Pipe()
+	defer upload.Close()
+	req, err := http.NewRequest(http.MethodPost, testServer.URL+"/api/shorten/batch", body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", shortenerhttpv1.ContentTypeNDJSON)
+
+	// the first chunk of the upload is sent, the upload is not finished
+	go func() {
+		for i := range service.ShortenChunkSize {
+			_, _ = fmt.Fprintf(upload, `{"correlation_id": "%d", "original_url": "https://93.184.215.14/%d"}`+"\n", i, i)
+		}
+	}()
+
+	type started struct {
+		resp    *http.Response
+		results *bufio.Scanner
+	}
+	first := make(chan started, 1)
+	go func() {
+		resp, e := testServer.Client().Do(req)
+		if e != nil {
+			close(first)
+			return
+		}
+		results := bufio.NewScanner(resp.Body)
+		results.Scan()
+		first <- started{resp: resp, results: results}
+	}()
+
+	// the results of the first chunk pass all the middlewares before the end of the upload
+	var s started
+	select {
+	case s = <-first:
+		require.NotNil(t, s.resp)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the results of the first chunk are not streamed")
+	}
+	defer s.resp.Body.Close()
+	assert.Equal(t, http.StatusOK, s.resp.StatusCode)
+	assert.Contains(t, s.results.Text(), `"line":1`)
+
+	_, err = fmt.Fprintln(upload, `{"correlation_id": "last", "original_url": "https://go.dev"}`)
+	require.NoError(t, err)
+	require.NoError(t, upload.Close())
+	lines := 1
+	for s.results.Scan() {
+		lines++
+	}
+	assert.Equal(t, service.ShortenChunkSize+1, lines)
+}
+
+func TestServer_shortenJobs(t *testing.T) {
+	config.AllowPrivateNetworks = true
+	t.Cleanup(func() { config.AllowPrivateNetworks = false })
+	setup()
+	defer testServer.Close()
+
+	req1 := resty.New().R()
+	req1.SetHeader("Content-Type", shortenerhttpv1.ContentTypeNDJSON)
+	req1.SetBody(`{"correlation_id": "a", "original_url": "https://example.com"}
+{"correlation_id": "b", "original_url": "javascript:alert(1)"}
+`)
+	resp1, err := req1.Post(testServer.URL + "/api/jobs/shorten")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, resp1.StatusCode())
+	location := resp1.Header().Get("Location")
+	require.True(t, strings.HasPrefix(location, "/api/jobs/"), location)
+	var job shortenerhttpv1.ShortenJobResponse
+	require.NoError(t, json.Unmarshal(resp1.Body(), &job))
+	assert.Equal(t, 2, job.Total)
+
+	get := func(path, accept string) *resty.Response {
+		req := resty.New().R()
+		req.SetCookies(resp1.Cookies())
+		req.SetHeader("Accept", accept)
+		resp, e := req.Get(testServer.URL + path)
+		require.NoError(t, e)
+		return resp
+	}
+
+	// polling the progress
+	require.Eventually(t, func() bool {
+		resp := get(location, "")
+		require.Equal(t, http.StatusOK, resp.StatusCode())
+		require.NoError(t, json.Unmarshal(resp.Body(), &job))
+		return job.Status == "done"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 2, job.Processed)
+	assert.Equal(t, 1, job.Failed)
+
+	resp := get(location+"/result", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, fmt.Sprintf(`{"line":1,"correlation_id":"a","short_url":"http://%s/19xtf1ts"}`+"\n"+
+		`{"line":2,"correlation_id":"b","error":"the URL scheme is not allowed: javascript"}`+"\n", config.BaseURL),
+		string(resp.Body()))
+
+	resp = get(location+"/result", shortenerhttpv1.ContentTypeCSV)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, fmt.Sprintf("line,correlation_id,short_url,error\n1,a,http://%s/19xtf1ts,\n"+
+		"2,b,,the URL scheme is not allowed: javascript\n", config.BaseURL), string(resp.Body()))
+
+	// the jobs of the other users are not found
+	other, err := resty.New().R().SetBody("https://example.com/other").Post(testServer.URL)
+	require.NoError(t, err)
+	resp, err = resty.New().R().SetCookies(other.Cookies()).Get(testServer.URL + location)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode())
+	resp, err = resty.New().R().SetCookies(resp1.Cookies()).Get(testServer.URL + "/api/jobs/abc")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+}
+
+func TestServer_webhooks(t *testing.T) {
+	config.AllowPrivateNetworks = true
+	t.Cleanup(func() { config.AllowPrivateNetworks = false })
+	setup()
+	defer testServer.Close()
+
+	received := make(chan http.Header, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	// the webhooks are created by the users with the links
+	user, err := resty.New().R().SetBody("https://example.com").Post(testServer.URL)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, user.StatusCode())
+
+	resp, err := resty.New().R().SetCookies(user.Cookies()).
+		SetBody(`{"url": "` + receiver.URL + `/hook", "events": ["link.created"]}`).
+		Post(testServer.URL + "/api/user/webhooks")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode())
+	var hook shortenerhttpv1.WebhookResponse
+	require.NoError(t, json.Unmarshal(resp.Body(), &hook))
+	assert.Equal(t, receiver.URL+"/hook", hook.URL)
+	assert.NotEmpty(t, hook.Secret)
+
+	resp, err = resty.New().R().SetCookies(user.Cookies()).
+		SetBody(`{"url": "` + receiver.URL + `", "events": ["link.unknown"]}`).
+		Post(testServer.URL + "/api/user/webhooks")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+
+	// the secret is not shown in the list
+	resp, err = resty.New().R().SetCookies(user.Cookies()).Get(testServer.URL + "/api/user/webhooks")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+	var hooks []shortenerhttpv1.WebhookResponse
+	require.NoError(t, json.Unmarshal(resp.Body(), &hooks))
+	require.Len(t, hooks, 1)
+	assert.Equal(t, hook.ID, hooks[0].ID)
+	assert.Empty(t, hooks[0].Secret)
+
+	// the new link is delivered to the webhook
+	resp, err = resty.New().R().SetCookies(user.Cookies()).SetBody("https://example.com/new").Post(testServer.URL)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode())
+	select {
+	case header := <-received:
+		assert.Equal(t, "link.created", header.Get(shortenerhttpv1.WebhookEventHeader))
+		assert.True(t, strings.HasPrefix(header.Get(shortenerhttpv1.WebhookSignatureHeader),
+			shortenerhttpv1.WebhookSignaturePrefix))
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook is not called")
+	}
+
+	deliveries := fmt.Sprintf("%s/api/user/webhooks/%d/deliveries", testServer.URL, hook.ID)
+	var items []shortenerhttpv1.WebhookDeliveryResponseItem
+	require.Eventually(t, func() bool {
+		resp, err = resty.New().R().SetCookies(user.Cookies()).Get(deliveries)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode())
+		require.NoError(t, json.Unmarshal(resp.Body(), &items))
+		return len(items) == 1 && items[0].Status == "delivered"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, items[0].Attempts)
+	assert.Equal(t, http.StatusOK, items[0].ResponseCode)
+	assert.Nil(t, items[0].NextTry)
+
+	// the webhooks of the other users are not found
+	other, err := resty.New().R().SetBody("https://example.com/other").Post(testServer.URL)
+	require.NoError(t, err)
+	resp, err = resty.New().R().SetCookies(other.Cookies()).Get(deliveries)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode())
+	resp, err = resty.New().R().SetCookies(other.Cookies()).
+		Delete(fmt.Sprintf("%s/api/user/webhooks/%d", testServer.URL, hook.ID))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode())
+
+	resp, err = resty.New().R().SetCookies(user.Cookies()).
+		Delete(fmt.Sprintf("%s/api/user/webhooks/%d", testServer.URL, hook.ID))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode())
+	resp, err = resty.New().R().SetCookies(user.Cookies()).Get(deliveries)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode())
+}
@@ -11,10 +11,24 @@ import (
 	"math/big"
 	"net"
 	"os"
+	"path/filepath"
 	"time"
 )
 
-// makeTLS generates cert.pem and key.pem
+// pemDir is the directory of the generated cert.pem and key.pem (the working directory).
+var pemDir = "."
+
+// certPath returns the path of the generated certificate.
+func certPath() string {
+	return filepath.Join(pemDir, "cert.pem")
+}
+
+// keyPath returns the path of the generated private key.
+func keyPath() string {
+	return filepath.Join(pemDir, "key.pem")
+}
+
+// makePemFiles generates cert.pem and key.pem in pemDir.
 // Another way is use generate_cert.go in crypto/tls to generate cert.pem and key.pem
 // https://pkg.go.dev/net/http#ListenAndServeTLS
 func makePemFiles() error {
@@ -75,10 +89,10 @@ func makePemFiles() error {
 	}
 
 	// creating cert and key files
-	if err = os.WriteFile("key.pem", privateKeyPEM.Bytes(), 0600); err != nil {
+	if err = os.WriteFile(keyPath(), privateKeyPEM.Bytes(), 0600); err != nil {
 		return err
 	}
-	if err = os.WriteFile("cert.pem", certPEM.Bytes(), 0600); err != nil {
+	if err = os.WriteFile(certPath(), certPEM.Bytes(), 0600); err != nil {
 		return err
 	}
 
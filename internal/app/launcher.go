@@ -7,20 +7,34 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/zasuchilas/shortener/internal/app/adminserver"
 	"github.com/zasuchilas/shortener/internal/app/api/httpapi"
+	"github.com/zasuchilas/shortener/internal/app/eventbus"
 	"github.com/zasuchilas/shortener/internal/app/grpcserver"
 	"github.com/zasuchilas/shortener/internal/app/httpserver"
+	"github.com/zasuchilas/shortener/internal/app/lifecycle"
+	"github.com/zasuchilas/shortener/internal/app/metrics"
+	"github.com/zasuchilas/shortener/internal/app/ratelimit"
 	"github.com/zasuchilas/shortener/internal/app/repository"
 	"github.com/zasuchilas/shortener/internal/app/service/shortener"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
+	"github.com/zasuchilas/shortener/internal/app/utils/urlfuncs"
 
 	"github.com/zasuchilas/shortener/internal/app/config"
 	"github.com/zasuchilas/shortener/internal/app/logger"
 	"github.com/zasuchilas/shortener/internal/app/secure"
 )
 
+// Application timeouts.
+const (
+	ShutdownTimeout  = 15 * time.Second // the deadline for stopping all the application components
+	MigrationTimeout = 10 * time.Minute // the deadline for the data migrations at the start
+)
+
 // App contains the application components.
 type App struct {
 	AppName             string
@@ -28,9 +42,11 @@ type App struct {
 	StorageInstanceName string
 	ctx                 context.Context
 	secure              *secure.Secure
+	adminServer         *adminserver.Server
 	httpServer          *httpserver.Server
 	grpcServer          *grpcserver.Server
 	shortenerRepo       repository.IStorage
+	lifecycle           *lifecycle.Manager
 }
 
 // New creates the application instance.
@@ -51,35 +67,144 @@ func New(buildVersion, buildDate, buildCommit string) *App {
 }
 
 // Run launches the application.
+//
+// It is blocked until the stop signal and returns after all the components are stopped.
 func (a *App) Run() {
 	// logger
-	if err := logger.Initialize(config.LogLevel); err != nil {
+	if err := logger.Initialize(config.LogLevel, config.LogMode); err != nil {
 		log.Fatal(err.Error())
 	}
 	logger.ServiceInfo(a.AppVersion)
 
+	// tracing
+	shutdownTracing, err := tracing.Initialize(a.ctx, a.AppName, a.AppVersion)
+	if err != nil {
+		logger.Log.Fatal("initializing tracing", zap.Error(err))
+	}
+
+	// the signals are caught before any component starts
+	sigint := make(chan os.Signal, 1)
+	signal.Notify(sigint, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(sigint)
+
 	// repository
 	a.initRepository()
 
 	// secure service
 	a.secure = secure.New(config.SecretKey, a.StorageInstanceName, config.SecureFilePath)
 
+	// event bus relay (the outbox of the storage is published if the event bus is set)
+	var eventRelay *eventbus.Relay
+	if config.EventBus != "" {
+		publisher, e := eventbus.New(config.EventBus, config.EventBusAddress, config.EventBusTopic)
+		if e != nil {
+			logger.Log.Fatal("creating event bus publisher", zap.Error(e))
+		}
+		eventRelay = eventbus.NewRelay(a.shortenerRepo, publisher)
+	}
+
 	// shortener service
+	if err = shortener.CheckRedirectSettings(); err != nil {
+		logger.Log.Fatal("checking redirect settings", zap.Error(err))
+	}
+	if err = shortener.CheckLinkCheckSettings(); err != nil {
+		logger.Log.Fatal("checking link check settings", zap.Error(err))
+	}
+	if err = urlfuncs.CheckShortDomains(); err != nil {
+		logger.Log.Fatal("checking short domains", zap.Error(err))
+	}
+	if err = ratelimit.CheckRateLimits(); err != nil {
+		logger.Log.Fatal("checking rate limits", zap.Error(err))
+	}
 	shortenerService := shortener.NewService(a.shortenerRepo, a.secure)
 
+	// admin server (metrics)
+	a.adminServer = adminserver.NewServer()
+
 	// http server
 	a.httpServer = httpserver.NewServer(httpapi.NewImplementation(shortenerService), a.secure)
-	go a.httpServer.Run()
 
 	// grpc server
 	a.grpcServer = grpcserver.NewServer(shortenerService)
-	go a.grpcServer.Run()
+
+	// components are stopped in the reverse order: servers, workers, event relay, secure, storage, tracing
+	// (the admin server is stopped after the api servers, so the metrics are scraped until the end;
+	// the tracing is stopped last, so the spans of the shutdown are exported too)
+	a.lifecycle = lifecycle.New(ShutdownTimeout)
+	a.lifecycle.Append(
+		lifecycle.Hook{
+			Name: "tracing",
+			Stop: shutdownTracing,
+		},
+		lifecycle.Hook{
+			Name: a.StorageInstanceName,
+			Stop: func(_ context.Context) error {
+				a.shortenerRepo.Stop()
+				return nil
+			},
+		},
+		lifecycle.Hook{
+			Name: "secure",
+			Stop: func(_ context.Context) error {
+				a.secure.Stop()
+				return nil
+			},
+		},
+	)
+	if eventRelay != nil {
+		a.lifecycle.Append(lifecycle.Hook{
+			Name:  "event relay",
+			Start: eventRelay.Start,
+			Stop:  eventRelay.Stop,
+		})
+	}
+	a.lifecycle.Append(
+		lifecycle.Hook{
+			Name: "shortener service",
+			Stop: shortenerService.Stop,
+		},
+		lifecycle.Hook{
+			Name: "admin server",
+			Start: func(_ context.Context) error {
+				go a.adminServer.Run()
+				return nil
+			},
+			Stop: a.adminServer.Stop,
+		},
+		lifecycle.Hook{
+			Name: "http server",
+			Start: func(_ context.Context) error {
+				go a.httpServer.Run()
+				return nil
+			},
+			Stop: a.httpServer.Stop,
+		},
+		lifecycle.Hook{
+			Name: "grpc server",
+			Start: func(_ context.Context) error {
+				go a.grpcServer.Run()
+				return nil
+			},
+			Stop: a.grpcServer.Stop,
+		},
+	)
+	if err := a.lifecycle.Start(a.ctx); err != nil {
+		logger.Log.Fatal("starting the application", zap.Error(err))
+	}
 
 	// graceful shutdown
-	a.initGracefulShutdown()
+	a.initGracefulShutdown(sigint)
 }
 
 func (a *App) initRepository() {
+	if err := repository.CheckDedupMode(config.DedupMode); err != nil {
+		logger.Log.Fatal("checking deduplication mode", zap.Error(err))
+	}
+	// the canonical form is used by the migration below
+	if err := urlfuncs.CheckCanonicalization(); err != nil {
+		logger.Log.Fatal("checking URL canonicalization", zap.Error(err))
+	}
+
 	if config.DatabaseDSN != "" {
 		a.shortenerRepo = repository.NewDBPgsql()
 	} else if config.FileStoragePath != "" {
@@ -87,23 +212,41 @@ func (a *App) initRepository() {
 	} else {
 		a.shortenerRepo = repository.NewDBMaps()
 	}
+	a.shortenerRepo = tracing.NewStorage(metrics.NewStorage(a.shortenerRepo))
 	a.StorageInstanceName = a.shortenerRepo.InstanceName()
+
+	if config.MigrateCanonicalURLs {
+		a.migrateCanonicalURLs()
+	}
 }
 
-func (a *App) initGracefulShutdown() {
-	idleConnsClosed := make(chan struct{})
-	sigint := make(chan os.Signal, 1)
-	signal.Notify(sigint, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-	go func() {
-		sig := <-sigint
-		logger.Log.Info("The stop signal has been received", zap.String("signal", sig.String()))
-		a.httpServer.Stop()
-		close(idleConnsClosed)
-	}()
+// migrateCanonicalURLs rewrites the existing original URLs in the canonical form (config.URLCanonicalization),
+// so the old rows are deduplicated with the new ones.
+func (a *App) migrateCanonicalURLs() {
+	ctx, cancel := context.WithTimeout(a.ctx, MigrationTimeout)
+	defer cancel()
+
+	res, err := a.shortenerRepo.MigrateOrigURLs(ctx, urlfuncs.CanonicalURL)
+	if err != nil {
+		logger.Log.Fatal("migrating original URLs to the canonical form", zap.Error(err))
+	}
+	logger.Log.Info("original URLs are migrated to the canonical form",
+		zap.String("canonicalization", config.URLCanonicalization),
+		zap.Int("checked", res.Checked),
+		zap.Int("updated", res.Updated),
+		zap.Int("conflicts", res.Conflicts),
+		zap.Int("failed", res.Failed))
+}
+
+func (a *App) initGracefulShutdown(sigint <-chan os.Signal) {
 	// blocked until the stop signal
-	<-idleConnsClosed
+	sig := <-sigint
+	logger.Log.Info("The stop signal has been received", zap.String("signal", sig.String()))
+
 	// stopping services
-	a.shortenerRepo.Stop()
+	if err := a.lifecycle.Stop(); err != nil {
+		logger.Log.Error("stopping the application", zap.Error(err))
+	}
 	// fin.
 	logger.Log.Info("URL shortening service stopped")
 }
@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+)
+
+// freeAddress returns the local address with a free port.
+func freeAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestApp_GracefulShutdown(t *testing.T) {
+	dir := t.TempDir()
+	config.ServerAddress = freeAddress(t)
+	config.GRPCServerAddress = freeAddress(t)
+	config.AdminServerAddress = freeAddress(t)
+	config.BaseURL = config.ServerAddress
+	config.FileStoragePath = filepath.Join(dir, "storage.db")
+	config.DatabaseDSN = ""
+	config.SecureFilePath = filepath.Join(dir, "secure.db")
+	config.SecretKey = "supersecretkey"
+	config.LogLevel = "error"
+	config.LogMode = logger.ModeProduction
+	config.EnableHTTPS = false
+
+	a := &App{AppName: "shortener", ctx: context.Background()}
+	done := make(chan struct{})
+	go func() {
+		a.Run()
+		close(done)
+	}()
+
+	// waiting for the http server
+	client := resty.New().SetBaseURL("http://" + config.ServerAddress)
+	var (
+		created *resty.Response
+		err     error
+	)
+	require.Eventually(t, func() bool {
+		created, err = client.R().SetBody("https://ya.ru").Post("/")
+		return err == nil && created.StatusCode() == http.StatusCreated
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// the deletion is accepted, but the worker flushes it only by the ticker
+	deleted, err := client.R().
+		SetCookies(created.Cookies()).
+		SetHeader("Content-Type", "application/json").
+		SetBody([]string{path.Base(created.String())}).
+		Delete("/api/user/urls")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, deleted.StatusCode())
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+	select {
+	case <-done:
+	case <-time.After(ShutdownTimeout):
+		t.Fatal("the application was not stopped")
+	}
+
+	// both servers are stopped
+	_, err = net.DialTimeout("tcp", config.ServerAddress, time.Second)
+	assert.Error(t, err)
+	_, err = net.DialTimeout("tcp", config.GRPCServerAddress, time.Second)
+	assert.Error(t, err)
+
+	// the deletion queue was flushed before the storage was stopped
+	storage := repository.NewDBFile()
+	_, err = storage.ReadURL(context.Background(), path.Base(created.String()))
+	assert.ErrorIs(t, err, repository.ErrGone)
+	pending, err := storage.PendingDeleteTasks(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
@@ -0,0 +1,99 @@
+// Package lifecycle starts and stops the application components in order.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/logger"
+)
+
+// Hook contains the start and stop functions of the component.
+//
+// Both functions are optional.
+type Hook struct {
+	Name  string
+	Start func(ctx context.Context) error
+	Stop  func(ctx context.Context) error
+}
+
+// Manager starts the hooks in the order they were added
+// and stops the started ones in the reverse order.
+type Manager struct {
+	hooks   []Hook
+	started int
+	timeout time.Duration
+	mutex   sync.Mutex
+}
+
+// New creates an instance of the component.
+//
+// The timeout is the deadline for stopping all the hooks.
+func New(timeout time.Duration) *Manager {
+	return &Manager{timeout: timeout}
+}
+
+// Append adds hooks to the end of the start order.
+func (m *Manager) Append(hooks ...Hook) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.hooks = append(m.hooks, hooks...)
+}
+
+// Start runs the start functions in order.
+//
+// If some component fails to start, the already started components are stopped.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mutex.Lock()
+	for m.started < len(m.hooks) {
+		hook := m.hooks[m.started]
+		if hook.Start != nil {
+			logger.Log.Debug("starting component", zap.String("name", hook.Name))
+			if err := hook.Start(ctx); err != nil {
+				m.mutex.Unlock()
+				return errors.Join(fmt.Errorf("starting %s: %w", hook.Name, err), m.Stop())
+			}
+		}
+		m.started++
+	}
+	m.mutex.Unlock()
+
+	return nil
+}
+
+// Stop runs the stop functions of the started components in reverse order.
+//
+// All the components share one deadline. When it is exceeded, the rest of the components
+// are still stopped, but with the expired context (they must release resources immediately).
+func (m *Manager) Stop() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	var errs []error
+	for ; m.started > 0; m.started-- {
+		hook := m.hooks[m.started-1]
+		if hook.Stop == nil {
+			continue
+		}
+
+		start := time.Now()
+		if err := hook.Stop(ctx); err != nil {
+			logger.Log.Error("stopping component", zap.String("name", hook.Name), zap.Error(err))
+			errs = append(errs, fmt.Errorf("stopping %s: %w", hook.Name, err))
+			continue
+		}
+		logger.Log.Info("component stopped",
+			zap.String("name", hook.Name), zap.Duration("duration", time.Since(start)))
+	}
+
+	return errors.Join(errs...)
+}
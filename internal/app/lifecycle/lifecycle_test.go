@@ -0,0 +1,75 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager(t *testing.T) {
+	var calls []string
+	hook := func(name string, startErr error) Hook {
+		return Hook{
+			Name: name,
+			Start: func(_ context.Context) error {
+				calls = append(calls, "start "+name)
+				return startErr
+			},
+			Stop: func(_ context.Context) error {
+				calls = append(calls, "stop "+name)
+				return nil
+			},
+		}
+	}
+
+	t.Run("ordered start and stop", func(t *testing.T) {
+		calls = nil
+		m := New(time.Second)
+		m.Append(hook("storage", nil), hook("service", nil), hook("server", nil))
+
+		require.NoError(t, m.Start(context.Background()))
+		require.NoError(t, m.Stop())
+		assert.Equal(t, []string{
+			"start storage", "start service", "start server",
+			"stop server", "stop service", "stop storage",
+		}, calls)
+
+		// nothing is stopped twice
+		require.NoError(t, m.Stop())
+		assert.Len(t, calls, 6)
+	})
+
+	t.Run("failed start stops started components", func(t *testing.T) {
+		calls = nil
+		m := New(time.Second)
+		m.Append(hook("storage", nil), hook("service", errors.New("boom")), hook("server", nil))
+
+		err := m.Start(context.Background())
+		require.ErrorContains(t, err, "starting service: boom")
+		assert.Equal(t, []string{"start storage", "start service", "stop storage"}, calls)
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		m := New(10 * time.Millisecond)
+		stopped := false
+		m.Append(
+			Hook{Name: "storage", Stop: func(ctx context.Context) error {
+				stopped = true
+				return nil
+			}},
+			Hook{Name: "server", Stop: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}},
+		)
+
+		require.NoError(t, m.Start(context.Background()))
+		err := m.Stop()
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.True(t, stopped)
+	})
+}
@@ -0,0 +1,97 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader is the header (gRPC metadata key) with the request ID.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits the length of the incoming request ID.
+const maxRequestIDLength = 128
+
+type (
+	loggerKey    struct{}
+	requestIDKey struct{}
+)
+
+// WithTrace returns the global logger with the trace_id and span_id fields of the span from ctx.
+//
+// If there is no valid span context in ctx, the global logger is returned as is.
+func WithTrace(ctx context.Context) *zap.Logger {
+	return withTrace(ctx, Log)
+}
+
+// withTrace adds the trace_id and span_id fields of the span from ctx to the logger.
+func withTrace(ctx context.Context, l *zap.Logger) *zap.Logger {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return l
+	}
+	return l.With(
+		zap.String("trace_id", sc.TraceID().String()),
+		zap.String("span_id", sc.SpanID().String()),
+	)
+}
+
+// NewContext returns the context with the request-scoped logger.
+//
+// The logger has the request_id field (if the request ID is in ctx) and the trace fields.
+func NewContext(ctx context.Context) context.Context {
+	l := Log
+	if id := RequestID(ctx); id != "" {
+		l = l.With(zap.String("request_id", id))
+	}
+	return context.WithValue(ctx, loggerKey{}, withTrace(ctx, l))
+}
+
+// FromContext returns the request-scoped logger.
+//
+// If there is no logger in ctx (e.g. in the background workers), the global logger with the trace fields is returned.
+func FromContext(ctx context.Context) *zap.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		return l
+	}
+	return WithTrace(ctx)
+}
+
+// WithRequestID returns the context with the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID from ctx (empty if there is no one).
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDOrNew returns the incoming request ID if it is valid, otherwise generates a new one.
+func RequestIDOrNew(incoming string) string {
+	if validRequestID(incoming) {
+		return incoming
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// validRequestID checks that the incoming request ID is safe to log and to send back.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -3,15 +3,19 @@ package logger
 import "fmt"
 
 func ExampleInitialize() {
-	err := Initialize("debug")
+	err := Initialize("debug", ModeDevelopment)
 	fmt.Println(err)
 
-	err2 := Initialize("wrong")
+	err2 := Initialize("wrong", ModeDevelopment)
 	fmt.Println(err2.Error())
 
+	err3 := Initialize("info", "wrong")
+	fmt.Println(err3.Error())
+
 	// Output:
 	// <nil>
 	// unrecognized level: "wrong"
+	// unrecognized mode: "wrong"
 }
 
 func ExampleServiceInfo() {
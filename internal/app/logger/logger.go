@@ -2,6 +2,7 @@
 package logger
 
 import (
+	"fmt"
 	"runtime/debug"
 
 	"go.uber.org/zap"
@@ -9,6 +10,12 @@ import (
 	"github.com/zasuchilas/shortener/internal/app/config"
 )
 
+// Logging modes.
+const (
+	ModeDevelopment = "development" // human-readable console output
+	ModeProduction  = "production"  // JSON output
+)
+
 // Variables
 var (
 	// Log is th global variable for logging access from anywhere in the application.
@@ -16,7 +23,7 @@ var (
 )
 
 // Initialize initializes logging.
-func Initialize(level string) error {
+func Initialize(level, mode string) error {
 	// parsing level
 	lvl, err := zap.ParseAtomicLevel(level)
 	if err != nil {
@@ -24,8 +31,15 @@ func Initialize(level string) error {
 	}
 
 	// setting the configuration
-	cfg := zap.NewDevelopmentConfig()
-	//cfg := zap.NewProductionConfig()
+	var cfg zap.Config
+	switch mode {
+	case ModeDevelopment:
+		cfg = zap.NewDevelopmentConfig()
+	case ModeProduction:
+		cfg = zap.NewProductionConfig()
+	default:
+		return fmt.Errorf("unrecognized mode: %q", mode)
+	}
 	cfg.Level = lvl
 
 	// creating a logger based on the configuration
@@ -69,5 +83,6 @@ func ConfigInfo() {
 		zap.String("BaseURL", config.BaseURL),
 		zap.String("FileStoragePath", config.FileStoragePath),
 		zap.String("DatabaseDSN", config.DatabaseDSN),
+		zap.String("TracingExporter", config.TracingExporter),
 	)
 }
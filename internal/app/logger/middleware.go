@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 )
 
@@ -36,11 +37,29 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode // take the status code
 }
 
-// LoggingMiddleware implements the logging middleware.
+// Flush implements http.Flusher, so the streamed responses are not held by the middleware.
+func (r *loggingResponseWriter) Flush() {
+	_ = http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+// Unwrap returns the original http.ResponseWriter (it is used by http.ResponseController).
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// LoggingMiddleware implements the access logging middleware.
+//
+// The middleware takes the X-Request-ID header (or generates a new ID), sends it back in the response
+// and puts the request-scoped logger into the request context (see FromContext).
+// It must be used after the tracing middleware, so the trace fields are in the log.
 func LoggingMiddleware(h http.Handler) http.Handler {
 	logFn := func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
+		requestID := RequestIDOrNew(r.Header.Get(RequestIDHeader))
+		w.Header().Set(RequestIDHeader, requestID)
+		ctx := NewContext(WithRequestID(r.Context(), requestID))
+
 		responseData := &responseData{
 			status: 0,
 			size:   0,
@@ -50,16 +69,27 @@ func LoggingMiddleware(h http.Handler) http.Handler {
 			ResponseWriter: w,
 			responseData:   responseData,
 		}
-		h.ServeHTTP(&lw, r)
+		h.ServeHTTP(&lw, r.WithContext(ctx))
+
+		// the handler has written the body without the status
+		if responseData.status == 0 {
+			responseData.status = http.StatusOK
+		}
+		route := ""
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			route = rctx.RoutePattern()
+		}
 
-		duration := time.Since(start)
-		Log.Info(
+		FromContext(ctx).Info(
 			"HTTP REQUEST",
 			zap.String("uri", r.RequestURI),
 			zap.String("method", r.Method),
+			zap.String("route", route),
 			zap.Int("status", responseData.status),
-			zap.Duration("duration", duration),
+			zap.Duration("duration", time.Since(start)),
 			zap.Int("size", responseData.size),
+			zap.String("remote_addr", r.RemoteAddr),
+			zap.String("user_agent", r.UserAgent()),
 		)
 	}
 	return http.HandlerFunc(logFn)
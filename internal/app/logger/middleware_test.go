@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// observe replaces the global logger with the observer.
+func observe(t *testing.T) *observer.ObservedLogs {
+	core, logs := observer.New(zap.InfoLevel)
+	prev := Log
+	Log = zap.New(core)
+	t.Cleanup(func() { Log = prev })
+	return logs
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	logs := observe(t)
+
+	r := chi.NewRouter()
+	r.Use(LoggingMiddleware)
+	r.Get("/{shortURL}", func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).Info("from handler")
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+
+	t.Run("incoming request id", func(t *testing.T) {
+		logs.TakeAll()
+		req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+		req.Header.Set(RequestIDHeader, "req-1")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		assert.Equal(t, "req-1", rec.Header().Get(RequestIDHeader))
+		entries := logs.TakeAll()
+		require.Len(t, entries, 2)
+		for _, e := range entries {
+			assert.Equal(t, "req-1", e.ContextMap()["request_id"])
+		}
+		access := entries[1].ContextMap()
+		assert.Equal(t, "/{shortURL}", access["route"])
+		assert.Equal(t, int64(http.StatusTemporaryRedirect), access["status"])
+	})
+
+	t.Run("generated request id", func(t *testing.T) {
+		logs.TakeAll()
+		req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+		req.Header.Set(RequestIDHeader, strings.Repeat("x", maxRequestIDLength+1))
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		id := rec.Header().Get(RequestIDHeader)
+		assert.Len(t, id, 32)
+		assert.Equal(t, id, logs.TakeAll()[1].ContextMap()["request_id"])
+	})
+}
+
+func TestFromContext(t *testing.T) {
+	observe(t)
+
+	// the background workers use the global logger
+	assert.Equal(t, Log, FromContext(context.Background()))
+
+	ctx := NewContext(WithRequestID(context.Background(), "req-2"))
+	assert.NotEqual(t, Log, FromContext(ctx))
+	assert.Equal(t, "req-2", RequestID(ctx))
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor counts requests and measures latencies per gRPC method.
+func UnaryServerInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	start := time.Now()
+
+	resp, err := handler(ctx, req)
+
+	GRPCRequests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	GRPCDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+
+	return resp, err
+}
+
+// StreamServerInterceptor counts streams and measures their durations per gRPC method.
+func StreamServerInterceptor(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	start := time.Now()
+
+	err := handler(srv, ss)
+
+	GRPCRequests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+	GRPCDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+
+	return err
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// HTTPMiddleware counts requests and measures latencies per chi route pattern.
+//
+// The pattern is used instead of the path, so /{shortURL} is one series, not one per link.
+func HTTPMiddleware(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		h.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+		HTTPDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	}
+	return http.HandlerFunc(fn)
+}
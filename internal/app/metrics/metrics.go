@@ -0,0 +1,195 @@
+// Package metrics collects the service metrics in the Prometheus format.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shortener"
+
+// Redirect results.
+const (
+	RedirectHit  = "hit"
+	RedirectMiss = "miss"
+	RedirectGone = "gone"
+)
+
+// Deletion flush outcomes.
+const (
+	FlushDone  = "done"
+	FlushRetry = "retry"
+	FlushDead  = "dead"
+)
+
+// Webhook delivery attempt outcomes.
+const (
+	WebhookDelivered = "delivered"
+	WebhookRetry     = "retry"
+	WebhookFailed    = "failed"
+)
+
+// Destination metadata fetch outcomes.
+const (
+	MetadataFetched = "fetched"
+	MetadataFailed  = "failed"
+	MetadataDropped = "dropped"
+)
+
+// Link check outcomes.
+const (
+	LinkCheckOK     = "ok"
+	LinkCheckFailed = "failed"
+)
+
+// Variables
+var (
+	// Registry contains all the service metrics (including go runtime and process metrics).
+	Registry = prometheus.NewRegistry()
+
+	// HTTPRequests counts HTTP requests by chi route pattern.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	// HTTPDuration measures HTTP request latencies by chi route pattern.
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latencies by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// GRPCRequests counts gRPC requests by full method name.
+	GRPCRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_requests_total",
+		Help:      "Number of gRPC requests by method and status code.",
+	}, []string{"method", "code"})
+
+	// GRPCDuration measures gRPC request latencies by full method name.
+	GRPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_request_duration_seconds",
+		Help:      "gRPC request latencies by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	// Redirects counts short URL resolutions by result (hit, miss, gone).
+	Redirects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redirects_total",
+		Help:      "Number of short URL resolutions by result.",
+	}, []string{"result"})
+
+	// StorageDuration measures storage operation latencies by IStorage method.
+	StorageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Storage operation latencies by storage instance, method and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"storage", "method", "result"})
+
+	// DeletionQueueDepth is the number of deletion tasks waiting for the flush.
+	DeletionQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "deletion_queue_depth",
+		Help:      "Number of deletion tasks waiting in the channel and the worker queue.",
+	})
+
+	// DeletionFlushes counts deletion task flushes by outcome (done, retry, dead).
+	DeletionFlushes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "deletion_flushes_total",
+		Help:      "Number of flushed deletion tasks by outcome.",
+	}, []string{"outcome"})
+
+	// WebhookAttempts counts webhook delivery attempts by outcome (delivered, retry, failed).
+	WebhookAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_attempts_total",
+		Help:      "Number of webhook delivery attempts by outcome.",
+	}, []string{"outcome"})
+
+	// WebhookEventsDropped counts the link events dropped because the webhook queue is full.
+	WebhookEventsDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_events_dropped_total",
+		Help:      "Number of link events dropped by the full webhook queue.",
+	})
+
+	// MetadataFetches counts the fetches of the link destination pages by outcome (fetched, failed, dropped).
+	MetadataFetches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "metadata_fetches_total",
+		Help:      "Number of link destination metadata fetches by outcome.",
+	}, []string{"outcome"})
+
+	// LinkChecks counts the checks of the link destinations by outcome (ok, failed).
+	LinkChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "link_checks_total",
+		Help:      "Number of link destination checks by outcome.",
+	}, []string{"outcome"})
+
+	// BusEventsPublished counts the link events published to the event bus.
+	BusEventsPublished = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bus_events_published_total",
+		Help:      "Number of link events published to the event bus.",
+	})
+
+	// BusPublishErrors counts the failed publications of the outbox batches to the event bus.
+	BusPublishErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bus_publish_errors_total",
+		Help:      "Number of failed publications to the event bus.",
+	})
+
+	// UsersCreated counts new users.
+	UsersCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "users_created_total",
+		Help:      "Number of created users.",
+	})
+
+	// RateLimited counts the rejected requests by limit (shorten, new_user).
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Number of requests rejected by the rate limits.",
+	}, []string{"limit"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		GRPCRequests,
+		GRPCDuration,
+		Redirects,
+		StorageDuration,
+		DeletionQueueDepth,
+		DeletionFlushes,
+		WebhookAttempts,
+		WebhookEventsDropped,
+		MetadataFetches,
+		LinkChecks,
+		BusEventsPublished,
+		BusPublishErrors,
+		UsersCreated,
+		RateLimited,
+	)
+}
+
+// Handler returns the handler for GET /metrics (Prometheus text format).
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zasuchilas/shortener/internal/app/repository"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(HTTPMiddleware)
+	r.Get("/{shortURL}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+
+	for _, path := range []string{"/abc", "/def"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// one series per route, not per link
+	assert.Equal(t, float64(2), testutil.ToFloat64(HTTPRequests.WithLabelValues("/{shortURL}", http.MethodGet, "307")))
+}
+
+func TestNewStorage(t *testing.T) {
+	repo := NewStorage(repository.NewDBMaps())
+
+	_, err := repo.ReadURL(context.TODO(), "19xtf1ts")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	assert.Equal(t, 1, testutil.CollectAndCount(StorageDuration, "shortener_storage_operation_duration_seconds"))
+
+	// the wrapper always exposes the file paths, a RAM storage has none
+	fs, ok := repo.(repository.IFileStorage)
+	require.True(t, ok)
+	assert.Empty(t, fs.FilePaths())
+}
+
+func TestHandler(t *testing.T) {
+	UsersCreated.Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, string(body), "shortener_users_created_total")
+	assert.Contains(t, string(body), "go_goroutines")
+}
@@ -0,0 +1,263 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+)
+
+var (
+	_ repository.IStorage     = (*storage)(nil)
+	_ repository.IFileStorage = (*storage)(nil)
+)
+
+// storage measures the latencies of the wrapped storage methods.
+type storage struct {
+	repository.IStorage
+}
+
+// NewStorage wraps the storage with the latency measurement.
+func NewStorage(repo repository.IStorage) repository.IStorage {
+	return &storage{IStorage: repo}
+}
+
+// observe records the latency of the storage method.
+func (s *storage) observe(method string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	StorageDuration.WithLabelValues(s.InstanceName(), method, result).Observe(time.Since(start).Seconds())
+}
+
+// FilePaths returns the paths of the wrapped storage files (if any).
+func (s *storage) FilePaths() []string {
+	if fs, ok := s.IStorage.(repository.IFileStorage); ok {
+		return fs.FilePaths()
+	}
+	return nil
+}
+
+// WriteURL _
+func (s *storage) WriteURL(ctx context.Context, domain, origURL string, userID int64) (shortURL string, conflict bool, err error) {
+	defer func(start time.Time) { s.observe("WriteURL", start, err) }(time.Now())
+	return s.IStorage.WriteURL(ctx, domain, origURL, userID)
+}
+
+// ReadURL _
+func (s *storage) ReadURL(ctx context.Context, shortURL string) (row *model.URLRow, err error) {
+	defer func(start time.Time) { s.observe("ReadURL", start, err) }(time.Now())
+	return s.IStorage.ReadURL(ctx, shortURL)
+}
+
+// URLInfo _
+func (s *storage) URLInfo(ctx context.Context, shortURL string) (row *model.URLRow, err error) {
+	defer func(start time.Time) { s.observe("URLInfo", start, err) }(time.Now())
+	return s.IStorage.URLInfo(ctx, shortURL)
+}
+
+// Ping _
+func (s *storage) Ping(ctx context.Context) (err error) {
+	defer func(start time.Time) { s.observe("Ping", start, err) }(time.Now())
+	return s.IStorage.Ping(ctx)
+}
+
+// HealthCheck _
+func (s *storage) HealthCheck(ctx context.Context) (err error) {
+	defer func(start time.Time) { s.observe("HealthCheck", start, err) }(time.Now())
+	return s.IStorage.HealthCheck(ctx)
+}
+
+// WriteURLs _
+func (s *storage) WriteURLs(ctx context.Context, domain string, origURLs []string, userID int64) (urlRows map[string]*model.URLRow, err error) {
+	defer func(start time.Time) { s.observe("WriteURLs", start, err) }(time.Now())
+	return s.IStorage.WriteURLs(ctx, domain, origURLs, userID)
+}
+
+// UserURLs _
+func (s *storage) UserURLs(ctx context.Context, userID int64, q model.UserURLsQuery) (urlRowList []*model.URLRow, nextCursor string, err error) {
+	defer func(start time.Time) { s.observe("UserURLs", start, err) }(time.Now())
+	return s.IStorage.UserURLs(ctx, userID, q)
+}
+
+// CheckDeletedURLs _
+func (s *storage) CheckDeletedURLs(ctx context.Context, userID int64, shortURLs []string) (err error) {
+	defer func(start time.Time) { s.observe("CheckDeletedURLs", start, err) }(time.Now())
+	return s.IStorage.CheckDeletedURLs(ctx, userID, shortURLs)
+}
+
+// DeleteURLs _
+func (s *storage) DeleteURLs(ctx context.Context, shortURLs ...string) (err error) {
+	defer func(start time.Time) { s.observe("DeleteURLs", start, err) }(time.Now())
+	return s.IStorage.DeleteURLs(ctx, shortURLs...)
+}
+
+// UpdateURL _
+func (s *storage) UpdateURL(ctx context.Context, userID int64, shortURL, origURL string) (revision *model.URLRevision, err error) {
+	defer func(start time.Time) { s.observe("UpdateURL", start, err) }(time.Now())
+	return s.IStorage.UpdateURL(ctx, userID, shortURL, origURL)
+}
+
+// URLRevisions _
+func (s *storage) URLRevisions(ctx context.Context, userID int64, shortURL string) (revisions []*model.URLRevision, err error) {
+	defer func(start time.Time) { s.observe("URLRevisions", start, err) }(time.Now())
+	return s.IStorage.URLRevisions(ctx, userID, shortURL)
+}
+
+// UpdateURLOptions _
+func (s *storage) UpdateURLOptions(ctx context.Context, userID int64, shortURL string, opts model.URLOptions) (row *model.URLRow, err error) {
+	defer func(start time.Time) { s.observe("UpdateURLOptions", start, err) }(time.Now())
+	return s.IStorage.UpdateURLOptions(ctx, userID, shortURL, opts)
+}
+
+// SetURLMetadata _
+func (s *storage) SetURLMetadata(ctx context.Context, shortURL, origURL string, meta *model.LinkMetadata) (err error) {
+	defer func(start time.Time) { s.observe("SetURLMetadata", start, err) }(time.Now())
+	return s.IStorage.SetURLMetadata(ctx, shortURL, origURL, meta)
+}
+
+// URLsToCheck _
+func (s *storage) URLsToCheck(ctx context.Context, before time.Time, limit int) (urlRows []*model.URLRow, err error) {
+	defer func(start time.Time) { s.observe("URLsToCheck", start, err) }(time.Now())
+	return s.IStorage.URLsToCheck(ctx, before, limit)
+}
+
+// SaveURLCheck _
+func (s *storage) SaveURLCheck(ctx context.Context, row *model.URLRow, check *model.LinkCheck) (saved bool, err error) {
+	defer func(start time.Time) { s.observe("SaveURLCheck", start, err) }(time.Now())
+	return s.IStorage.SaveURLCheck(ctx, row, check)
+}
+
+// WriteDeleteTask _
+func (s *storage) WriteDeleteTask(ctx context.Context, task *model.DeleteTask) (err error) {
+	defer func(start time.Time) { s.observe("WriteDeleteTask", start, err) }(time.Now())
+	return s.IStorage.WriteDeleteTask(ctx, task)
+}
+
+// PendingDeleteTasks _
+func (s *storage) PendingDeleteTasks(ctx context.Context) (tasks []*model.DeleteTask, err error) {
+	defer func(start time.Time) { s.observe("PendingDeleteTasks", start, err) }(time.Now())
+	return s.IStorage.PendingDeleteTasks(ctx)
+}
+
+// CompleteDeleteTasks _
+func (s *storage) CompleteDeleteTasks(ctx context.Context, status string, ids ...int64) (err error) {
+	defer func(start time.Time) { s.observe("CompleteDeleteTasks", start, err) }(time.Now())
+	return s.IStorage.CompleteDeleteTasks(ctx, status, ids...)
+}
+
+// WriteShortenJob _
+func (s *storage) WriteShortenJob(ctx context.Context, job *model.ShortenJob) (err error) {
+	defer func(start time.Time) { s.observe("WriteShortenJob", start, err) }(time.Now())
+	return s.IStorage.WriteShortenJob(ctx, job)
+}
+
+// ShortenJob _
+func (s *storage) ShortenJob(ctx context.Context, id int64) (job *model.ShortenJob, err error) {
+	defer func(start time.Time) { s.observe("ShortenJob", start, err) }(time.Now())
+	return s.IStorage.ShortenJob(ctx, id)
+}
+
+// ShortenJobLines _
+func (s *storage) ShortenJobLines(ctx context.Context, id int64, from, limit int) (lines []model.ShortenJobLine, err error) {
+	defer func(start time.Time) { s.observe("ShortenJobLines", start, err) }(time.Now())
+	return s.IStorage.ShortenJobLines(ctx, id, from, limit)
+}
+
+// UpdateShortenJob _
+func (s *storage) UpdateShortenJob(ctx context.Context, job *model.ShortenJob) (err error) {
+	defer func(start time.Time) { s.observe("UpdateShortenJob", start, err) }(time.Now())
+	return s.IStorage.UpdateShortenJob(ctx, job)
+}
+
+// PendingShortenJobs _
+func (s *storage) PendingShortenJobs(ctx context.Context) (ids []int64, err error) {
+	defer func(start time.Time) { s.observe("PendingShortenJobs", start, err) }(time.Now())
+	return s.IStorage.PendingShortenJobs(ctx)
+}
+
+// DeleteShortenJobs _
+func (s *storage) DeleteShortenJobs(ctx context.Context, before time.Time) (deleted int, err error) {
+	defer func(start time.Time) { s.observe("DeleteShortenJobs", start, err) }(time.Now())
+	return s.IStorage.DeleteShortenJobs(ctx, before)
+}
+
+// WriteWebhook _
+func (s *storage) WriteWebhook(ctx context.Context, hook *model.Webhook) (err error) {
+	defer func(start time.Time) { s.observe("WriteWebhook", start, err) }(time.Now())
+	return s.IStorage.WriteWebhook(ctx, hook)
+}
+
+// UserWebhooks _
+func (s *storage) UserWebhooks(ctx context.Context, userID int64) (hooks []*model.Webhook, err error) {
+	defer func(start time.Time) { s.observe("UserWebhooks", start, err) }(time.Now())
+	return s.IStorage.UserWebhooks(ctx, userID)
+}
+
+// DeleteWebhook _
+func (s *storage) DeleteWebhook(ctx context.Context, userID, id int64) (err error) {
+	defer func(start time.Time) { s.observe("DeleteWebhook", start, err) }(time.Now())
+	return s.IStorage.DeleteWebhook(ctx, userID, id)
+}
+
+// WriteWebhookDeliveries _
+func (s *storage) WriteWebhookDeliveries(ctx context.Context, deliveries []*model.WebhookDelivery) (err error) {
+	defer func(start time.Time) { s.observe("WriteWebhookDeliveries", start, err) }(time.Now())
+	return s.IStorage.WriteWebhookDeliveries(ctx, deliveries)
+}
+
+// UpdateWebhookDelivery _
+func (s *storage) UpdateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) (err error) {
+	defer func(start time.Time) { s.observe("UpdateWebhookDelivery", start, err) }(time.Now())
+	return s.IStorage.UpdateWebhookDelivery(ctx, delivery)
+}
+
+// PendingWebhookDeliveries _
+func (s *storage) PendingWebhookDeliveries(ctx context.Context, before time.Time, limit int) (deliveries []*model.WebhookDelivery, err error) {
+	defer func(start time.Time) { s.observe("PendingWebhookDeliveries", start, err) }(time.Now())
+	return s.IStorage.PendingWebhookDeliveries(ctx, before, limit)
+}
+
+// WebhookDeliveries _
+func (s *storage) WebhookDeliveries(ctx context.Context, userID, id int64, limit int) (deliveries []*model.WebhookDelivery, err error) {
+	defer func(start time.Time) { s.observe("WebhookDeliveries", start, err) }(time.Now())
+	return s.IStorage.WebhookDeliveries(ctx, userID, id, limit)
+}
+
+// WriteBusEvents _
+func (s *storage) WriteBusEvents(ctx context.Context, events []*model.BusEvent) (err error) {
+	defer func(start time.Time) { s.observe("WriteBusEvents", start, err) }(time.Now())
+	return s.IStorage.WriteBusEvents(ctx, events)
+}
+
+// PendingBusEvents _
+func (s *storage) PendingBusEvents(ctx context.Context, limit int) (events []*model.BusEvent, err error) {
+	defer func(start time.Time) { s.observe("PendingBusEvents", start, err) }(time.Now())
+	return s.IStorage.PendingBusEvents(ctx, limit)
+}
+
+// CompleteBusEvents _
+func (s *storage) CompleteBusEvents(ctx context.Context, ids ...int64) (err error) {
+	defer func(start time.Time) { s.observe("CompleteBusEvents", start, err) }(time.Now())
+	return s.IStorage.CompleteBusEvents(ctx, ids...)
+}
+
+// LeaseBusRelay _
+func (s *storage) LeaseBusRelay(ctx context.Context, owner string, ttl time.Duration) (leased bool, err error) {
+	defer func(start time.Time) { s.observe("LeaseBusRelay", start, err) }(time.Now())
+	return s.IStorage.LeaseBusRelay(ctx, owner, ttl)
+}
+
+// Stats _
+func (s *storage) Stats(ctx context.Context) (domains map[string]int, err error) {
+	defer func(start time.Time) { s.observe("Stats", start, err) }(time.Now())
+	return s.IStorage.Stats(ctx)
+}
+
+// MigrateOrigURLs _
+func (s *storage) MigrateOrigURLs(ctx context.Context, migrate func(origURL string) (string, error)) (res *model.URLMigration, err error) {
+	defer func(start time.Time) { s.observe("MigrateOrigURLs", start, err) }(time.Now())
+	return s.IStorage.MigrateOrigURLs(ctx, migrate)
+}
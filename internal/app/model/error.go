@@ -1,6 +1,10 @@
 package model
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 // Errors _
 var (
@@ -8,4 +12,36 @@ var (
 	ErrGone       = errors.New("deleted")
 	ErrBadRequest = errors.New("bad request")
 	ErrNoContent  = errors.New("no content")
+	ErrForbidden  = errors.New("forbidden")
+	ErrConflict   = errors.New("conflict")
 )
+
+// BatchItemError is the error of the wrong batch item.
+type BatchItemError struct {
+	Index         int
+	CorrelationID string
+	OriginalURL   string
+	Error         string
+}
+
+// BatchError contains the errors of all the wrong batch items.
+//
+// It is ErrBadRequest for errors.Is.
+type BatchError struct {
+	Items []BatchItemError
+}
+
+// Error _
+func (e *BatchError) Error() string {
+	items := make([]string, len(e.Items))
+	for i, item := range e.Items {
+		items[i] = fmt.Sprintf("Pos: %d, correlation_id: \"%s\", original_url: \"%s\", error: \"%s\"",
+			item.Index, item.CorrelationID, item.OriginalURL, item.Error)
+	}
+	return fmt.Sprintf("wrong batch items: %s", strings.Join(items, ", "))
+}
+
+// Unwrap _
+func (e *BatchError) Unwrap() error {
+	return ErrBadRequest
+}
@@ -1,17 +1,183 @@
 // Package models is used to store service models.
 package model
 
-import "time"
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Deletion task statuses in the storage outbox.
+const (
+	DeleteTaskPending = "pending" // accepted, waiting for the flush
+	DeleteTaskDone    = "done"    // the short urls are marked as deleted
+	DeleteTaskDead    = "dead"    // all attempts have failed (dead letter)
+)
+
+// Shortening job statuses.
+const (
+	ShortenJobQueued  = "queued"  // accepted, waiting for a worker
+	ShortenJobRunning = "running" // some chunks are processed
+	ShortenJobDone    = "done"    // all the lines are processed (some of them may have failed)
+	ShortenJobFailed  = "failed"  // the storage has failed, the rest of the lines are not processed
+)
+
+// Link lifecycle events (the webhook event types).
+const (
+	EventLinkCreated = "link.created"
+	EventLinkClicked = "link.clicked"
+	EventLinkExpired = "link.expired"
+	EventLinkDeleted = "link.deleted"
+	EventLinkBroken  = "link.broken" // the destination has started failing the checks of the link checker
+)
+
+// Webhook delivery statuses.
+const (
+	WebhookDeliveryPending   = "pending"   // waiting for the first or the next attempt
+	WebhookDeliveryDelivered = "delivered" // the receiver has responded with 2xx
+	WebhookDeliveryFailed    = "failed"    // all attempts have failed or the webhook is deleted
+)
+
+// Health statuses.
+const (
+	HealthStatusOK   = "ok"
+	HealthStatusFail = "fail"
+)
+
+// Ways to open the short URL.
+const (
+	OpenRedirect     = "redirect"     // redirect to the destination
+	OpenPreview      = "preview"      // the preview page with the link info
+	OpenInterstitial = "interstitial" // the "you are leaving" page for the flagged destinations
+)
+
+// Ways to merge the query of the visitor request into the destination query.
+const (
+	QueryMergeNone     = ""         // the incoming query is dropped
+	QueryMergeIncoming = "incoming" // the incoming parameters replace the stored ones with the same name
+	QueryMergeStored   = "stored"   // the stored parameters are kept, the incoming ones with the other names are added
+)
+
+// Statuses of the user URLs filter.
+const (
+	URLStatusAll     = ""        // all the links
+	URLStatusActive  = "active"  // not deleted and not expired
+	URLStatusExpired = "expired" // not deleted, but expired
+	URLStatusDeleted = "deleted"
+)
+
+// Orders of the user URLs.
+const (
+	UserURLsSortCreated = "created" // by the creation time (the rows created before it was recorded go first)
+	UserURLsSortClicks  = "clicks"  // by the number of visits
+)
+
+// QR code image formats.
+const (
+	QRFormatPNG = "png"
+	QRFormatSVG = "svg"
+)
 
 // Types
 type (
 	// URLRow is a row in file storage and postgresql storage
 	URLRow struct {
-		ID       int64  `json:"id"`
-		ShortURL string `json:"short_url"`
-		OrigURL  string `json:"original_url"`
-		UserID   int64  `json:"user_id"`
-		Deleted  bool   `json:"deleted"`
+		ID       int64     `json:"id"`
+		Domain   string    `json:"domain,omitempty"` // the domain of the short link (empty is the domain of config.BaseURL)
+		ShortURL string    `json:"short_url"`        // the short code, it is unique on the domain
+		OrigURL  string    `json:"original_url"`
+		UserID   int64     `json:"user_id"`
+		Deleted  bool      `json:"deleted"`
+		Created  time.Time `json:"created"` // zero for the rows created before it was recorded
+		Title    string    `json:"title,omitempty"`
+		Notes    string    `json:"notes,omitempty"`   // the free-form notes of the owner
+		Tags     []string  `json:"tags,omitempty"`    // the lowercase tags in order
+		Preview  bool      `json:"preview,omitempty"` // the preview page is shown instead of the redirect
+		Clicks   int64     `json:"clicks,omitempty"`  // number of the short URL visits
+
+		RedirectCode int       `json:"redirect_code,omitempty"` // 0 means the default code
+		ExpiresAt    time.Time `json:"expires_at"`              // zero means the link never expires
+
+		ForwardPath bool   `json:"forward_path,omitempty"` // the path after the short URL is added to the destination path
+		MergeQuery  string `json:"merge_query,omitempty"`  // QueryMergeNone, QueryMergeIncoming or QueryMergeStored
+
+		Meta  *LinkMetadata `json:"meta,omitempty"`  // nil if the destination page is not fetched yet
+		Check *LinkCheck    `json:"check,omitempty"` // nil if the destination is not checked yet
+	}
+
+	// LinkMetadata is the metadata of the destination page fetched in the background (config.FetchMetadata).
+	//
+	// The metadata is replaced as a whole, so the storages may share it between the copies of the row.
+	LinkMetadata struct {
+		Title       string    `json:"title,omitempty"`
+		Description string    `json:"description,omitempty"`
+		Favicon     string    `json:"favicon,omitempty"` // the absolute URL of the icon
+		Fetched     time.Time `json:"fetched"`
+		Error       string    `json:"error,omitempty"` // the reason the page is not fetched
+	}
+
+	// LinkCheck is the result of the last check of the destination by the link checker (config.LinkCheckInterval).
+	LinkCheck struct {
+		Checked  time.Time `json:"checked"`
+		Status   int       `json:"status,omitempty"`   // the HTTP status of the response (0 if there is no response)
+		Error    string    `json:"error,omitempty"`    // the reason the check has failed
+		Failures int       `json:"failures,omitempty"` // the failed checks in a row
+		Broken   bool      `json:"broken,omitempty"`   // the destination has failed several checks in a row
+	}
+
+	// URLOptions are the link options changed by the owner (nil options are kept as they are).
+	URLOptions struct {
+		Title        *string
+		Notes        *string
+		Tags         *[]string // the empty list removes the tags
+		Preview      *bool
+		RedirectCode *int       // 0 resets the default code
+		ExpiresAt    *time.Time // zero time removes the expiry
+		ForwardPath  *bool
+		MergeQuery   *string
+	}
+
+	// UserURLsQuery is the page of the user URLs with the filters and the order (the zero values are not applied).
+	//
+	// The pages are read by the keyset: the cursor is the position after the last row of the previous page,
+	// so the rows added or deleted between the pages do not shift them.
+	UserURLsQuery struct {
+		Status      string    // URLStatusAll, URLStatusActive, URLStatusExpired or URLStatusDeleted
+		CreatedFrom time.Time // inclusive
+		CreatedTo   time.Time // exclusive
+		Domain      string    // substring of the destination host (case-insensitive)
+		LinkDomains []string  // the domains of the short links (nil means all, "" is the default domain)
+		Tags        []string  // the link has all the tags
+		Text        string    // every word is the beginning of a word of the title, the notes or the destination
+		Broken      bool      // the destination is broken (see LinkCheck)
+		Sort        string    // UserURLsSortCreated (default) or UserURLsSortClicks
+		Desc        bool      // descending order
+		Cursor      string    // the next cursor of the previous page (empty for the first page)
+		Limit       int       // page size (0 means all the rows)
+	}
+
+	// UserURLsPage is the page of the user URLs.
+	UserURLsPage struct {
+		URLs       []UserURL
+		NextCursor string // empty if it is the last page
+	}
+
+	// URLRevision is the change of the link destination made by its owner.
+	URLRevision struct {
+		Revision int64     `json:"revision"`     // number of the link revision (from 1)
+		ShortURL string    `json:"short_url"`    // the link key (see LinkKey)
+		OrigURL  string    `json:"original_url"` // the new destination
+		PrevURL  string    `json:"previous_url"` // the destination before the revision
+		UserID   int64     `json:"user_id"`
+		Time     time.Time `json:"time"`
+	}
+
+	// URLMigration is the result of rewriting the original URLs of the existing rows.
+	URLMigration struct {
+		Checked   int // rows checked
+		Updated   int // rows rewritten
+		Conflicts int // rows kept as is, because the new original URL belongs to another row
+		Failed    int // rows kept as is, because the migrate function failed
 	}
 
 	// UserRow is a row in secure data file
@@ -33,22 +199,243 @@ type (
 		ShortURL      string
 	}
 
+	// ShortenItemOut is the result of the item that is shortened on its own (the wrong items do not fail the others).
+	ShortenItemOut struct {
+		CorrelationID string
+		OriginalURL   string // as it is received
+		ShortURL      string // empty if the item has failed
+		Error         string
+	}
+
+	// ShortenJob is the asynchronous shortening of the large upload.
+	//
+	// The job is saved in the storage with its lines, the workers process the lines in chunks
+	// and save the results and the progress after every chunk, so the job resumes after the restart.
+	ShortenJob struct {
+		ID        int64     `json:"id"`
+		UserID    int64     `json:"user_id"`
+		Status    string    `json:"status"`
+		Total     int       `json:"total"`     // number of the lines
+		Processed int       `json:"processed"` // number of the lines processed (the lines go in order)
+		Failed    int       `json:"failed"`    // number of the processed lines with the errors
+		Error     string    `json:"error,omitempty"`
+		Created   time.Time `json:"created"`
+		Updated   time.Time `json:"updated"`
+
+		// Lines are the lines to write or the lines read (the storage returns the job without the lines).
+		Lines []ShortenJobLine `json:"lines,omitempty"`
+	}
+
+	// ShortenJobLine is the line of the shortening job and its result.
+	ShortenJobLine struct {
+		N             int    `json:"n"`              // position in the job (from 0)
+		Line          int    `json:"line,omitempty"` // line of the upload
+		CorrelationID string `json:"correlation_id,omitempty"`
+		OriginalURL   string `json:"original_url,omitempty"`
+		ShortURL      string `json:"short_url,omitempty"`
+		Error         string `json:"error,omitempty"` // the line that can't be decoded has the error before processing
+	}
+
+	// LinkEvent is the event of the link lifecycle sent to the webhooks of the link owner.
+	LinkEvent struct {
+		Type     string
+		UserID   int64  // the owner of the link
+		ShortURL string // the link key (see LinkKey)
+		OrigURL  string // empty for the deleted links
+		Time     time.Time
+	}
+
+	// BusEvent is the link event in the outbox of the event bus.
+	//
+	// The storage writes the event together with the change of the link, the relay publishes it later.
+	BusEvent struct {
+		ID        int64     `json:"id"`
+		Type      string    `json:"type"`
+		UserID    int64     `json:"user_id"`
+		Domain    string    `json:"domain,omitempty"`
+		ShortURL  string    `json:"short_url"`
+		OrigURL   string    `json:"original_url,omitempty"`
+		Time      time.Time `json:"time"`
+		Published bool      `json:"published,omitempty"` // the event is acknowledged by the broker
+	}
+
+	// Webhook is the subscription of the user to the link events.
+	Webhook struct {
+		ID      int64     `json:"id"`
+		UserID  int64     `json:"user_id"`
+		URL     string    `json:"url"`
+		Events  []string  `json:"events,omitempty"` // empty means all the events
+		Secret  string    `json:"secret"`           // the key of the payload signature
+		Created time.Time `json:"created"`
+		Deleted bool      `json:"deleted,omitempty"`
+	}
+
+	// WebhookDelivery is the event sent to the webhook (the delivery log record).
+	WebhookDelivery struct {
+		ID           int64     `json:"id"`
+		WebhookID    int64     `json:"webhook_id"`
+		UserID       int64     `json:"user_id"`
+		Event        string    `json:"event"`
+		URL          string    `json:"url"`     // the webhook URL at the moment of the event
+		Payload      string    `json:"payload"` // the JSON body
+		Status       string    `json:"status"`
+		Attempts     int       `json:"attempts"`
+		ResponseCode int       `json:"response_code,omitempty"` // of the last attempt
+		Error        string    `json:"error,omitempty"`         // of the last attempt
+		Created      time.Time `json:"created"`
+		Updated      time.Time `json:"updated"`
+		NextTry      time.Time `json:"next_try"`
+	}
+
 	// UserURL _
 	UserURL struct {
-		ShortURL    string
-		OriginalURL string
+		Domain       string // the host of the short link domain
+		ShortURL     string
+		OriginalURL  string
+		Title        string
+		Notes        string
+		Tags         []string
+		Preview      bool
+		RedirectCode int
+		ExpiresAt    time.Time
+		ForwardPath  bool
+		MergeQuery   string
+		Meta         *LinkMetadata // the destination page (nil if it is not fetched yet)
+		Check        *LinkCheck    // the last check of the destination (nil if it is not checked yet)
 	}
 
 	// DeleteTask is element for batch deleting chan.
+	//
+	// Every task is saved in the storage outbox before it is accepted,
+	// so the ID is the outbox row identifier.
 	DeleteTask struct {
-		Time      time.Time
-		UserID    int64
-		ShortURLs []string
+		ID        int64     `json:"id"`
+		Time      time.Time `json:"time"`
+		UserID    int64     `json:"user_id"`
+		ShortURLs []string  `json:"short_urls"` // the link keys (see LinkKey)
+		Status    string    `json:"status"`
+	}
+
+	// OpenURLIn is the request to open the short URL.
+	OpenURLIn struct {
+		ShortURL string
+		Host     string // the request host, it chooses the domain of the short URL (empty is the default domain)
+		Head     bool   // the HEAD request (the visit is not counted)
+		Path     string // escaped path after the short URL (/abc/extra/path gives /extra/path)
+		Query    string // raw query of the request
+	}
+
+	// OpenedURL is the short URL opened by the visitor.
+	OpenedURL struct {
+		Mode     string // OpenRedirect, OpenPreview or OpenInterstitial
+		ShortURL string // ready short URL
+		OrigURL  string
+		Created  time.Time // zero if it is unknown
+		Title    string
+		Clicks   int64
+		Flagged  bool // the destination is flagged by the safety checks
+
+		Code        int           // redirect status code
+		ExpiresAt   time.Time     // zero if the link never expires
+		CacheMaxAge time.Duration // how long the redirect may be cached (0 means it must not be cached)
+	}
+
+	// QROptions are the parameters of the QR code image (the zero values are the defaults, except the margin).
+	QROptions struct {
+		Format string // png or svg
+		Size   int    // width and height of the image in pixels
+		Margin int    // quiet zone width in modules
+		Level  string // error correction level: L, M, Q or H
+	}
+
+	// QRCode is the QR code image.
+	QRCode struct {
+		ContentType string
+		Data        []byte
 	}
 
 	// Stats _
 	Stats struct {
-		URLs  int
-		Users int
+		URLs    int
+		Users   int
+		Domains map[string]int // the number of URLs by the host of the short link domain
+	}
+
+	// HealthCheck is the result of one readiness check.
+	HealthCheck struct {
+		Name     string
+		Status   string
+		Error    string
+		Duration time.Duration
+	}
+
+	// HealthReport is the aggregated readiness report.
+	HealthReport struct {
+		Status string
+		Checks []HealthCheck
 	}
 )
+
+// LinkKey returns the key of the short code on the domain, it identifies the link in the storage.
+//
+// The key of the default domain is the short code itself, the key of the other domain is domain/code.
+func LinkKey(domain, shortURL string) string {
+	if domain == "" {
+		return shortURL
+	}
+	return domain + "/" + shortURL
+}
+
+// SplitLinkKey returns the domain and the short code of the link key.
+func SplitLinkKey(key string) (domain, shortURL string) {
+	if i := strings.LastIndexByte(key, '/'); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return "", key
+}
+
+// SearchWords returns the lowercase words of the text for the link search (the letters and the digits
+// between the other characters), every word is returned once in the order of the text.
+func SearchWords(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := make(map[string]bool, len(words))
+	res := words[:0]
+	for _, w := range words {
+		if !seen[w] {
+			seen[w] = true
+			res = append(res, w)
+		}
+	}
+	return res
+}
+
+// SearchWords returns the words of the row found by the link search: the words of the title,
+// the notes and the original URL.
+func (r *URLRow) SearchWords() []string {
+	return SearchWords(r.Title + " " + r.Notes + " " + r.OrigURL)
+}
+
+// Key returns the link key of the row.
+func (r *URLRow) Key() string {
+	return LinkKey(r.Domain, r.ShortURL)
+}
+
+// Finished reports whether the shortening job is done or failed (the unfinished job is queued or running).
+func (j *ShortenJob) Finished() bool {
+	return j.Status == ShortenJobDone || j.Status == ShortenJobFailed
+}
+
+// Subscribed reports whether the webhook receives the events of the type.
+func (w *Webhook) Subscribed(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/zasuchilas/shortener/internal/app/metrics"
+)
+
+// UnaryServerInterceptor limits the calls of the methods (full method names) by the client IP.
+//
+// The limited call gets the ResourceExhausted code and the retry-after header (seconds).
+func (l *Limiter) UnaryServerInterceptor(methods ...string) grpc.UnaryServerInterceptor {
+	limited := make(map[string]struct{}, len(methods))
+	for _, m := range methods {
+		limited[m] = struct{}{}
+	}
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if _, ok := limited[info.FullMethod]; !ok {
+			return handler(ctx, req)
+		}
+
+		if ok, retryAfter := l.Allow(grpcKey(ctx)); !ok {
+			metrics.RateLimited.WithLabelValues(LimitShorten).Inc()
+			_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", RetryAfterSeconds(retryAfter)))
+			return nil, status.Errorf(codes.ResourceExhausted, "too many requests, retry after %s", retryAfter)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor limits the streams of the methods (full method names) by the client IP.
+//
+// The whole stream is one call for the limiter, the same as the batch request.
+func (l *Limiter) StreamServerInterceptor(methods ...string) grpc.StreamServerInterceptor {
+	limited := make(map[string]struct{}, len(methods))
+	for _, m := range methods {
+		limited[m] = struct{}{}
+	}
+
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if _, ok := limited[info.FullMethod]; !ok {
+			return handler(srv, ss)
+		}
+
+		if ok, retryAfter := l.Allow(grpcKey(ss.Context())); !ok {
+			metrics.RateLimited.WithLabelValues(LimitShorten).Inc()
+			_ = ss.SetHeader(metadata.Pairs("retry-after", RetryAfterSeconds(retryAfter)))
+			return status.Errorf(codes.ResourceExhausted, "too many requests, retry after %s", retryAfter)
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+// grpcKey returns the limiting key of the call: the client IP (the metadata is set by the client, so it is not used).
+func grpcKey(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		return "ip:" + host
+	}
+	return "ip:"
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/zasuchilas/shortener/internal/app/metrics"
+	"github.com/zasuchilas/shortener/internal/app/secure"
+)
+
+// Limit names (the label of the rate limited requests metric).
+const (
+	LimitShorten = "shorten"
+	LimitNewUser = "new_user"
+)
+
+// Middleware limits the requests by the key returned by keyFunc.
+//
+// The limited request gets 429 Too Many Requests with the Retry-After header.
+func (l *Limiter) Middleware(name string, keyFunc func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if ok, retryAfter := l.Allow(keyFunc(r)); !ok {
+				metrics.RateLimited.WithLabelValues(name).Inc()
+				w.Header().Set("Retry-After", RetryAfterSeconds(retryAfter))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			h.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// NewUserMiddleware limits the creation of new users by client IP.
+//
+// The requests with a valid token are not limited, so it must be used before secure.SecureMiddleware.
+func (l *Limiter) NewUserMiddleware(sec *secure.Secure) func(http.Handler) http.Handler {
+	limit := l.Middleware(LimitNewUser, ClientKey)
+	return func(h http.Handler) http.Handler {
+		limited := limit(h)
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if !l.Enabled() {
+				h.ServeHTTP(w, r)
+				return
+			}
+			if _, err := sec.GetTokenUserID(r); err == nil {
+				h.ServeHTTP(w, r)
+				return
+			}
+			limited.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// UserKey returns the limiting key of the request: the user ID or the client IP.
+//
+// Only the verified identities are used, the keys sent by the client could be changed by every request.
+func UserKey(r *http.Request) string {
+	if userID, ok := r.Context().Value(secure.ContextUserIDKey).(int64); ok && userID > 0 {
+		return "user:" + strconv.FormatInt(userID, 10)
+	}
+	return ClientKey(r)
+}
+
+// ClientKey returns the limiting key by the client IP.
+//
+// The proxy headers are not used, because they are set by the client.
+func ClientKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
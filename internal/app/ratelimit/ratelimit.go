@@ -0,0 +1,163 @@
+// Package ratelimit limits the request rate with the token buckets.
+//
+// The rate is set as "<count>/<unit>" (e.g. 20/s, 100/m, 1000/h): the bucket holds count tokens
+// and is refilled completely during the unit (the count is positive). An empty rate disables the limiting.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+)
+
+// IdleBucketTTL is the time after which the unused full bucket is removed.
+const IdleBucketTTL = 10 * time.Minute
+
+// cleanupEvery is the number of Allow calls between the removals of the idle buckets.
+const cleanupEvery = 1024
+
+type (
+	// Rate is the bucket capacity and the time to refill it completely.
+	Rate struct {
+		Count int
+		Per   time.Duration
+	}
+
+	// bucket is the token bucket of one key.
+	bucket struct {
+		tokens float64
+		last   time.Time
+	}
+
+	// Limiter is the set of token buckets by key (user or IP).
+	Limiter struct {
+		rate    Rate
+		buckets map[string]*bucket
+		calls   int
+		now     func() time.Time
+		mutex   sync.Mutex
+	}
+)
+
+// ParseRate parses the rate in the "<count>/<unit>" format, units are s, m, h.
+func ParseRate(spec string) (Rate, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return Rate{}, nil
+	}
+
+	count, unit, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("wrong rate format %q (expected <count>/<unit>)", spec)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return Rate{}, fmt.Errorf("wrong rate count %q", count)
+	}
+
+	var per time.Duration
+	switch unit {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return Rate{}, fmt.Errorf("wrong rate unit %q (expected s, m or h)", unit)
+	}
+
+	return Rate{Count: n, Per: per}, nil
+}
+
+// CheckRateLimits checks config.ShortenRateLimit and config.NewUserRateLimit.
+func CheckRateLimits() error {
+	if _, err := ParseRate(config.ShortenRateLimit); err != nil {
+		return fmt.Errorf("wrong shortening rate limit: %w", err)
+	}
+	if _, err := ParseRate(config.NewUserRateLimit); err != nil {
+		return fmt.Errorf("wrong new users rate limit: %w", err)
+	}
+	return nil
+}
+
+// New creates the limiter by the rate spec.
+//
+// The specs of the settings are checked at the start (see CheckRateLimits).
+func New(spec string) *Limiter {
+	rate, _ := ParseRate(spec)
+	return NewLimiter(rate)
+}
+
+// NewLimiter creates the limiter with the rate (the zero rate disables the limiting).
+func NewLimiter(rate Rate) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Enabled reports whether the limiting is enabled.
+func (l *Limiter) Enabled() bool {
+	return l.rate.Count > 0 && l.rate.Per > 0
+}
+
+// Allow takes the token from the key bucket.
+//
+// If the bucket is empty, returns false and the time until the next token.
+func (l *Limiter) Allow(key string) (ok bool, retryAfter time.Duration) {
+	if !l.Enabled() {
+		return true, 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.calls++
+	if l.calls%cleanupEvery == 0 {
+		l.cleanup(now)
+	}
+
+	capacity := float64(l.rate.Count)
+	perToken := l.rate.Per / time.Duration(l.rate.Count)
+
+	b, found := l.buckets[key]
+	if !found {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+
+	// refilling the bucket
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+float64(elapsed)/float64(perToken))
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.tokens) * float64(perToken))
+}
+
+// cleanup removes the buckets that are full and have not been used for IdleBucketTTL.
+func (l *Limiter) cleanup(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > IdleBucketTTL && now.Sub(b.last) >= l.rate.Per {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RetryAfterSeconds returns the Retry-After value (whole seconds, at least 1).
+func RetryAfterSeconds(retryAfter time.Duration) string {
+	return strconv.Itoa(int(math.Max(1, math.Ceil(retryAfter.Seconds()))))
+}
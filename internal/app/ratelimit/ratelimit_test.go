@@ -0,0 +1,205 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/secure"
+)
+
+// newTestLimiter creates the limiter with the manual clock.
+func newTestLimiter(rate Rate) (*Limiter, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLimiter(rate)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Rate
+		wantErr bool
+	}{
+		{spec: "", want: Rate{}},
+		{spec: "20/s", want: Rate{Count: 20, Per: time.Second}},
+		{spec: "100/m", want: Rate{Count: 100, Per: time.Minute}},
+		{spec: " 5/h ", want: Rate{Count: 5, Per: time.Hour}},
+		{spec: "20", wantErr: true},
+		{spec: "x/s", wantErr: true},
+		{spec: "-1/s", wantErr: true},
+		{spec: "0/s", wantErr: true},
+		{spec: "20/d", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseRate(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCheckRateLimits(t *testing.T) {
+	defer func() { config.ShortenRateLimit, config.NewUserRateLimit = "", "" }()
+
+	tests := []struct {
+		shorten, newUser string
+		wantErr          bool
+	}{
+		{shorten: "", newUser: ""},
+		{shorten: "20/s", newUser: "30/m"},
+		{shorten: "fast", newUser: "30/m", wantErr: true},
+		{shorten: "20/s", newUser: "0/m", wantErr: true},
+	}
+	for _, tt := range tests {
+		config.ShortenRateLimit, config.NewUserRateLimit = tt.shorten, tt.newUser
+		err := CheckRateLimits()
+		assert.Equal(t, tt.wantErr, err != nil, "%s %s: %v", tt.shorten, tt.newUser, err)
+	}
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	l, now := newTestLimiter(Rate{Count: 2, Per: time.Second})
+
+	// the burst is the bucket capacity
+	for i := 0; i < 2; i++ {
+		ok, _ := l.Allow("a")
+		assert.True(t, ok)
+	}
+	ok, retryAfter := l.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	// the other keys have their own buckets
+	ok, _ = l.Allow("b")
+	assert.True(t, ok)
+
+	// the bucket is refilled over time
+	*now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("a")
+	assert.True(t, ok)
+
+	// the idle buckets are removed
+	*now = now.Add(IdleBucketTTL + time.Second)
+	l.cleanup(*now)
+	assert.Empty(t, l.buckets)
+}
+
+func TestLimiter_disabled(t *testing.T) {
+	l := New("wrong")
+	assert.False(t, l.Enabled())
+	for i := 0; i < 100; i++ {
+		ok, _ := l.Allow("a")
+		assert.True(t, ok)
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	assert.Equal(t, "1", RetryAfterSeconds(10*time.Millisecond))
+	assert.Equal(t, "2", RetryAfterSeconds(1500*time.Millisecond))
+}
+
+func TestLimiter_Middleware(t *testing.T) {
+	l, _ := newTestLimiter(Rate{Count: 1, Per: time.Minute})
+	h := l.Middleware(LimitShorten, UserKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	send := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusCreated, send("").Code)
+	limited := send("")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	assert.Equal(t, "60", limited.Header().Get("Retry-After"))
+
+	// the unverified API keys don't reset the limit of the client
+	assert.Equal(t, http.StatusTooManyRequests, send("key-1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send("key-2").Code)
+}
+
+func TestUserKey(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	assert.Equal(t, "ip:192.0.2.1", UserKey(req))
+
+	req = req.WithContext(context.WithValue(req.Context(), secure.ContextUserIDKey, int64(7)))
+	assert.Equal(t, "user:7", UserKey(req))
+
+	req.Header.Set("X-API-Key", "key-1")
+	assert.Equal(t, "user:7", UserKey(req))
+}
+
+func TestLimiter_NewUserMiddleware(t *testing.T) {
+	sec := secure.New("supersecretkey", "", "")
+	l, _ := newTestLimiter(Rate{Count: 1, Per: time.Minute})
+	h := l.NewUserMiddleware(sec)(sec.SecureMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})))
+
+	// the first request creates the user
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	cookies := rec.Result().Cookies()
+	require.NotEmpty(t, cookies)
+	defer rec.Result().Body.Close()
+
+	// the next new user from the same IP is limited
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, 1, sec.UsersCount())
+
+	// the existing user is not limited
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
+
+func TestLimiter_UnaryServerInterceptor(t *testing.T) {
+	l, _ := newTestLimiter(Rate{Count: 1, Per: time.Second})
+	interceptor := l.UnaryServerInterceptor("/shortenergrpcv1.ShortenerV1/Shorten")
+	handler := func(ctx context.Context, _ any) (any, error) { return "ok", nil }
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "key-1"))
+	shorten := &grpc.UnaryServerInfo{FullMethod: "/shortenergrpcv1.ShortenerV1/Shorten"}
+	_, err := interceptor(ctx, nil, shorten, handler)
+	require.NoError(t, err)
+	_, err = interceptor(ctx, nil, shorten, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// the unverified API keys don't reset the limit of the client
+	rotated := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "key-2"))
+	_, err = interceptor(rotated, nil, shorten, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// the other methods are not limited
+	read := &grpc.UnaryServerInfo{FullMethod: "/shortenergrpcv1.ShortenerV1/ReadURL"}
+	_, err = interceptor(ctx, nil, read, handler)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"sync"
+
+	"github.com/zasuchilas/shortener/internal/app/model"
+)
+
+// ClicksBatch is the number of the visits the RAM based storages count under the read lock
+// before they are applied to the rows under the write lock.
+const ClicksBatch = 1024
+
+// clickCounter counts the visits of the short URLs of the RAM based storages under the read lock,
+// so the redirects are not serialized behind each other and the writes.
+//
+// The rows are changed under the write lock only: the visits are applied when the batch is full,
+// before the other outbox events are written (the events keep their order) and before the visits are read.
+type clickCounter struct {
+	visited []*model.URLRow   // in the order of the visits
+	events  []*model.BusEvent // the events of the visits if the event bus is enabled
+	visits  map[*model.URLRow]int64
+	mutex   sync.Mutex
+}
+
+// add counts the visit of the row, returns the visits of the row that are not applied yet
+// and reports whether the batch is full (the caller holds the read lock of the storage).
+func (c *clickCounter) add(row *model.URLRow) (visits int64, full bool) {
+	var event *model.BusEvent
+	if busEnabled() {
+		event = newBusEvent(model.EventLinkClicked, row)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.visits == nil {
+		c.visits = make(map[*model.URLRow]int64)
+	}
+	c.visited = append(c.visited, row)
+	c.visits[row]++
+	if event != nil {
+		c.events = append(c.events, event)
+	}
+
+	return c.visits[row], len(c.visited) >= ClicksBatch
+}
+
+// pending reports whether there are visits that are not applied yet.
+func (c *clickCounter) pending() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.visited) > 0
+}
+
+// apply applies the counted visits to the rows and returns their events,
+// reports false if there are no visits (the caller holds the write lock of the storage).
+func (c *clickCounter) apply() (events []*model.BusEvent, applied bool) {
+	c.mutex.Lock()
+	visited, events := c.visited, c.events
+	c.visited, c.events, c.visits = nil, nil, nil
+	c.mutex.Unlock()
+
+	for _, row := range visited {
+		row.Clicks++
+	}
+	return events, len(visited) > 0
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"sort"
 	"sync"
 	"time"
 
@@ -19,17 +21,66 @@ import (
 )
 
 var (
-	_ IStorage = (*DBFiles)(nil)
+	_ IStorage     = (*DBFiles)(nil)
+	_ IFileStorage = (*DBFiles)(nil)
+)
+
+// Suffixes added to the storage file path to get the paths of the journals.
+const (
+	OutboxFileSuffix     = ".outbox"     // deletion outbox
+	RevisionsFileSuffix  = ".revisions"  // link revisions
+	JobsFileSuffix       = ".jobs"       // shortening jobs
+	WebhooksFileSuffix   = ".webhooks"   // webhooks
+	DeliveriesFileSuffix = ".deliveries" // webhook deliveries
+	EventsFileSuffix     = ".events"     // event bus outbox
 )
 
 // DBFiles is a file storage implementation.
+//
+// The deletion outbox is kept next to the storage file as an append-only journal
+// (every status change of the task is a new line, the last line wins).
+//
+// The link revisions are kept in the append-only journal too. The revision is written to the journal
+// before the storage file is rewritten, so the storage file is fixed from the journal at the start
+// if the rewriting has failed.
+//
+// The shortening jobs are kept in the append-only journal: the job with all its lines is written
+// when it is accepted, then the progress with the results of every processed chunk.
+// The journal is rewritten without the jobs removed by the retention.
+//
+// The webhooks and their deliveries are kept in the append-only journals too (the last line wins,
+// the deleted webhook is the line with the flag). The journals are compacted at the start.
+//
+// The outbox of the event bus is the append-only journal: the event is written right after the change
+// of the link (the file storage has no transactions), the published event is the line with the flag.
 type DBFiles struct {
-	urls     map[string]*model.URLRow
+	urls     map[string]*model.URLRow // by dedupKey
 	hash     map[string]*model.URLRow
 	owners   map[int64][]*model.URLRow
 	original []*model.URLRow
 	lastID   int64
+	codes    map[string]int64 // the last short code numbers of the additional domains
+	unsaved  bool             // the rows have the changes that are not written to the file (the visits, the metadata, the checks)
+	index    *searchIndex
 	mutex    sync.RWMutex
+
+	revisions map[string][]*model.URLRevision // by short URL
+
+	tasks      map[int64]*model.DeleteTask
+	lastTaskID int64
+
+	jobs      map[int64]*model.ShortenJob
+	lastJobID int64
+
+	webhooks       map[int64]*model.Webhook
+	lastWebhookID  int64
+	deliveries     map[int64]*model.WebhookDelivery
+	lastDeliveryID int64
+
+	busEvents      []*model.BusEvent // the outbox of the event bus (the oldest first)
+	lastBusEventID int64
+
+	clicks clickCounter // the visits counted under the read lock
 }
 
 // NewDBFile creates an instance of the component.
@@ -38,7 +89,16 @@ func NewDBFile() *DBFiles {
 		urls:   make(map[string]*model.URLRow),
 		hash:   make(map[string]*model.URLRow),
 		owners: make(map[int64][]*model.URLRow),
+		codes:  make(map[string]int64),
+		index:  newSearchIndex(),
+		tasks:  make(map[int64]*model.DeleteTask),
+		jobs:   make(map[int64]*model.ShortenJob),
 		mutex:  sync.RWMutex{},
+
+		revisions: make(map[string][]*model.URLRevision),
+
+		webhooks:   make(map[int64]*model.Webhook),
+		deliveries: make(map[int64]*model.WebhookDelivery),
 	}
 
 	lastID, err := db.loadFromFile()
@@ -47,11 +107,49 @@ func NewDBFile() *DBFiles {
 	}
 	db.lastID = lastID
 
+	if err = db.loadRevisions(); err != nil {
+		logger.Log.Fatal("loading link revisions from file", zap.Error(err))
+	}
+	db.index.update(db.original...)
+
+	lastTaskID, err := db.loadOutbox()
+	if err != nil {
+		logger.Log.Fatal("loading deletion outbox from file", zap.Error(err))
+	}
+	db.lastTaskID = lastTaskID
+
+	if err = db.loadJobs(); err != nil {
+		logger.Log.Fatal("loading shortening jobs from file", zap.Error(err))
+	}
+
+	if err = db.loadWebhooks(); err != nil {
+		logger.Log.Fatal("loading webhooks from file", zap.Error(err))
+	}
+
+	if err = db.loadBusEvents(); err != nil {
+		logger.Log.Fatal("loading event bus outbox from file", zap.Error(err))
+	}
+
 	return db
 }
 
 // Stop stops the component.
-func (d *DBFiles) Stop() {}
+//
+// The visits counted, the metadata and the checks saved after the last rewriting are written to the file.
+func (d *DBFiles) Stop() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.applyClicks(); err != nil {
+		logger.Log.Error("writing the clicked events to the outbox file", zap.Error(err))
+	}
+	if !d.unsaved {
+		return
+	}
+	if err := d.rewriteFile(); err != nil {
+		logger.Log.Error("saving the visits to the storage file", zap.Error(err))
+	}
+}
 
 // InstanceName returns current instance name.
 func (d *DBFiles) InstanceName() string {
@@ -59,39 +157,59 @@ func (d *DBFiles) InstanceName() string {
 }
 
 // WriteURL writes URL in the storage.
-func (d *DBFiles) WriteURL(ctx context.Context, origURL string, userID int64) (shortURL string, conflict bool, err error) {
+func (d *DBFiles) WriteURL(ctx context.Context, domain, origURL string, userID int64) (shortURL string, conflict bool, err error) {
 	// checking if already exist
-	found, ok := d.urls[origURL]
+	d.mutex.RLock()
+	found, ok := d.urls[dedupKey(domain, origURL, userID)]
+	d.mutex.RUnlock()
 	if ok {
-		return found.ShortURL, true, nil
+		return found.Key(), true, nil
 	}
 
 	// writing URL
-	urlRows, err := d.WriteURLs(ctx, []string{origURL}, userID)
+	urlRows, err := d.WriteURLs(ctx, domain, []string{origURL}, userID)
 	if err != nil {
 		return "", false, err
 	}
 	if urlRows == nil || urlRows[origURL] == nil {
 		return "", false, errors.New("something wrong with writing URL")
 	}
-	return urlRows[origURL].ShortURL, false, nil
+	return urlRows[origURL].Key(), false, nil
 }
 
-// ReadURL reads URL from the storage.
-func (d *DBFiles) ReadURL(_ context.Context, shortURL string) (origURL string, err error) {
+// ReadURL reads the row of the short URL from the storage and counts the visit.
+//
+// The visit is counted under the read lock and applied to the row later (see clickCounter),
+// the visits are written to the file with the next rewriting of the file or at the stop.
+func (d *DBFiles) ReadURL(_ context.Context, shortURL string) (row *model.URLRow, err error) {
+	var visits int64
+	full := false
+
 	d.mutex.RLock()
 	found, ok := d.hash[shortURL]
+	if ok && !found.Deleted && !isExpired(found) {
+		visits, full = d.clicks.add(found)
+	}
+	row, err = openRow(found)
 	d.mutex.RUnlock()
 
-	if !ok {
-		return "", fmt.Errorf("%w", ErrNotFound)
+	if full {
+		d.flushClicks()
 	}
-
-	if found.Deleted {
-		return "", fmt.Errorf("%w", ErrGone)
+	if err != nil {
+		return nil, err
 	}
+	row.Clicks += visits
+	return row, nil
+}
 
-	return found.OrigURL, nil
+// URLInfo reads the row of the short URL from the storage (the visit is not counted).
+func (d *DBFiles) URLInfo(_ context.Context, shortURL string) (row *model.URLRow, err error) {
+	d.flushClicks()
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return openRow(d.hash[shortURL])
 }
 
 // Ping pings the storage.
@@ -101,8 +219,31 @@ func (d *DBFiles) Ping(_ context.Context) error {
 	return errors.New("not allowed")
 }
 
+// HealthCheck checks that the storage is able to serve requests.
+//
+// The storage and outbox files must be available for appending.
+func (d *DBFiles) HealthCheck(_ context.Context) error {
+	for _, path := range d.FilePaths() {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return err
+		}
+		if err = f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FilePaths returns the paths of the storage files.
+func (d *DBFiles) FilePaths() []string {
+	return []string{
+		config.FileStoragePath, outboxPath(), revisionsPath(), jobsPath(), webhooksPath(), deliveriesPath(), eventsPath(),
+	}
+}
+
 // WriteURLs writes URLs in the storage.
-func (d *DBFiles) WriteURLs(ctx context.Context, origURLs []string, userID int64) (urlRows map[string]*model.URLRow, err error) {
+func (d *DBFiles) WriteURLs(ctx context.Context, domain string, origURLs []string, userID int64) (urlRows map[string]*model.URLRow, err error) {
 
 	urlRows = make(map[string]*model.URLRow)
 
@@ -125,6 +266,7 @@ func (d *DBFiles) WriteURLs(ctx context.Context, origURLs []string, userID int64
 		d.owners[userID] = make([]*model.URLRow, 0)
 	}
 
+	var events []*model.BusEvent
 loop:
 	for _, origURL := range origURLs {
 		select {
@@ -133,7 +275,7 @@ loop:
 			break loop
 		default:
 			logger.Log.Debug("find is ready in file storage", zap.String("origURL", origURL))
-			found, ok := d.urls[origURL]
+			found, ok := d.urls[dedupKey(domain, origURL, userID)]
 			if ok {
 				logger.Log.Debug("row already exist", zap.String("shortURL", found.ShortURL))
 				urlRows[origURL] = found
@@ -141,13 +283,15 @@ loop:
 			}
 
 			nextID := d.lastID + 1
-			shortURL := hashfuncs.EncodeZeroHash(nextID)
+			shortURL := nextShortURL(domain, nextID, d.codes)
 			nextURLRow := &model.URLRow{
 				ID:       nextID,
+				Domain:   domain,
 				ShortURL: shortURL,
 				OrigURL:  origURL,
 				UserID:   userID,
 				Deleted:  false,
+				Created:  time.Now(),
 			}
 
 			// writing new row to file storage
@@ -157,17 +301,23 @@ loop:
 				break loop
 			}
 
-			d.urls[origURL] = nextURLRow
-			d.hash[shortURL] = nextURLRow
+			d.urls[dedupKey(domain, origURL, userID)] = nextURLRow
+			d.hash[nextURLRow.Key()] = nextURLRow
 			d.owners[userID] = append(d.owners[userID], nextURLRow)
+			d.index.update(nextURLRow)
 			d.original = append(d.original, nextURLRow)
 			d.lastID = nextID
+			events = append(events, newBusEvent(model.EventLinkCreated, nextURLRow))
 
 			logger.Log.Debug("inserted new row",
 				zap.String("shortURL", shortURL), zap.String("origURL", origURL))
 			urlRows[origURL] = nextURLRow
 		}
 	}
+	// the events of the written rows are saved even if the rest is not written
+	if e := d.writeBusEvents(events...); e != nil && err == nil {
+		err = e
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -175,18 +325,21 @@ loop:
 	return urlRows, nil
 }
 
-// UserURLs returns user URLs from storage.
-func (d *DBFiles) UserURLs(_ context.Context, userID int64) (urlRowList []*model.URLRow, err error) {
-
+// UserURLs returns the page of the user URLs from storage.
+func (d *DBFiles) UserURLs(_ context.Context, userID int64, q model.UserURLsQuery) (urlRowList []*model.URLRow, nextCursor string, err error) {
+	d.flushClicks()
 	d.mutex.RLock()
-	found, ok := d.owners[userID]
-	d.mutex.RUnlock()
+	defer d.mutex.RUnlock()
 
+	found, ok := d.owners[userID]
 	if !ok || len(found) == 0 {
-		return nil, fmt.Errorf("%w", ErrNotFound)
+		return nil, "", fmt.Errorf("%w", ErrNotFound)
+	}
+	if rows, ok := d.index.find(userID, q); ok {
+		found = rows
 	}
 
-	return found, nil
+	return userURLsPage(found, q)
 }
 
 // CheckDeletedURLs checks deleting URLs.
@@ -211,19 +364,28 @@ func (d *DBFiles) DeleteURLs(_ context.Context, shortURLs ...string) error {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 
+	events := make([]*model.BusEvent, 0, len(shortURLs))
 	for _, shortURL := range shortURLs {
 
 		found, ok := d.hash[shortURL]
-		if !ok {
+		if !ok || found.Deleted {
 			continue
 		}
 
 		found.Deleted = true
 		// since found is a pointer, the value must change in all components
 		// (url, hash, owner and original)
+		events = append(events, newBusEvent(model.EventLinkDeleted, found))
+	}
+
+	if err := d.writeBusEvents(events...); err != nil {
+		return err
 	}
+	return d.rewriteFile()
+}
 
-	// rewrite file storage from original component
+// rewriteFile rewrites the file storage from the original component (the caller holds the lock).
+func (d *DBFiles) rewriteFile() error {
 	w, err := filefuncs.NewFileReWriter(config.FileStoragePath)
 	if err != nil {
 		return err
@@ -241,61 +403,1013 @@ func (d *DBFiles) DeleteURLs(_ context.Context, shortURLs ...string) error {
 		return err
 	}
 
+	d.unsaved = false
 	return nil
 }
 
-// Stats returns count of URLs.
-func (d *DBFiles) Stats(_ context.Context) (int, error) {
+// UpdateURL changes the destination of the user short URL and records the revision.
+//
+// The revision in the journal is the commit of the change: if the storage file can't be rewritten,
+// the error is logged and the file is fixed from the journal at the next start.
+func (d *DBFiles) UpdateURL(_ context.Context, userID int64, shortURL, origURL string) (revision *model.URLRevision, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	row := d.hash[shortURL]
+	revision, err = newRevision(userID, row, origURL, d.urls, d.revisions[shortURL])
+	if err != nil || revision == nil {
+		return nil, err
+	}
+
+	w, err := filefuncs.NewFileWriter(revisionsPath())
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+	if err = w.WriteURLRevision(revision); err != nil {
+		return nil, err
+	}
+
+	setOrigURL(d.urls, row, origURL)
+	row.Meta, row.Check = nil, nil // the page and the checks of the previous destination
+	d.index.update(row)
+	d.revisions[shortURL] = append(d.revisions[shortURL], revision)
+
+	if e := d.rewriteFile(); e != nil {
+		logger.Log.Error("rewriting storage file after the link revision, it will be fixed at the next start",
+			zap.String("shortURL", shortURL), zap.Int64("revision", revision.Revision), zap.Error(e))
+	}
+
+	return revision, nil
+}
+
+// URLRevisions returns the revisions of the user short URL (the first revision first).
+func (d *DBFiles) URLRevisions(_ context.Context, userID int64, shortURL string) (revisions []*model.URLRevision, err error) {
 	d.mutex.RLock()
 	defer d.mutex.RUnlock()
 
-	return len(d.urls), nil
+	if err = checkUserURL(userID, d.hash[shortURL]); err != nil {
+		return nil, err
+	}
+
+	return copyRevisions(d.revisions[shortURL]), nil
 }
 
-// TODO: as an option: use cache lib with reading from file
+// UpdateURLOptions changes the options of the user short URL (nil options are kept as they are).
+func (d *DBFiles) UpdateURLOptions(_ context.Context, userID int64, shortURL string, opts model.URLOptions) (row *model.URLRow, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
 
-// loadFromFile loads URLs from the storage.
-func (d *DBFiles) loadFromFile() (lastID int64, err error) {
-	r, err := filefuncs.NewFileReader(config.FileStoragePath)
+	found := d.hash[shortURL]
+	if err = checkUserURL(userID, found); err != nil {
+		return nil, err
+	}
+
+	// the options are restored if the file can't be rewritten
+	prev := *found
+	if err = setURLOptions(userID, found, opts); err != nil {
+		return nil, err
+	}
+	if err = d.rewriteFile(); err != nil {
+		*found = prev
+		return nil, err
+	}
+	d.index.update(found)
+
+	updated := *found
+	return &updated, nil
+}
+
+// SetURLMetadata saves the metadata of the destination page of the short URL.
+//
+// The metadata is kept in memory like the visits, it is written to the file with the next rewriting of the file
+// or at the stop (the lost metadata is fetched again when the destination is changed).
+func (d *DBFiles) SetURLMetadata(_ context.Context, shortURL, origURL string, meta *model.LinkMetadata) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	set, err := setURLMetadata(d.hash[shortURL], origURL, meta)
+	if set {
+		d.unsaved = true
+	}
+	return err
+}
+
+// URLsToCheck returns no more than limit links whose destinations are not checked since the time.
+func (d *DBFiles) URLsToCheck(_ context.Context, before time.Time, limit int) (urlRows []*model.URLRow, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return urlsToCheck(d.hash, before, limit), nil
+}
+
+// SaveURLCheck saves the result of the check of the row.
+//
+// The result is kept in memory like the visits, it is written to the file with the next rewriting of the file
+// or at the stop (the lost result is checked again).
+func (d *DBFiles) SaveURLCheck(_ context.Context, row *model.URLRow, check *model.LinkCheck) (saved bool, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if saved, err = setURLCheck(d.hash[row.Key()], row, check); saved {
+		d.unsaved = true
+	}
+	return saved, err
+}
+
+// WriteDeleteTask saves the deletion task in the outbox and sets its ID.
+func (d *DBFiles) WriteDeleteTask(_ context.Context, task *model.DeleteTask) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	w, err := filefuncs.NewFileWriter(outboxPath())
 	if err != nil {
-		return 0, err
+		return err
 	}
-	defer r.Close()
+	defer w.Close()
 
-	var lastHash string
-	for {
-		row, e := r.ReadURLRow()
-		if e == io.EOF {
-			break
+	saved := *task
+	saved.ID = d.lastTaskID + 1
+	saved.Status = model.DeleteTaskPending
+	if err = w.WriteDeleteTask(&saved); err != nil {
+		return err
+	}
+
+	d.tasks[saved.ID] = &saved
+	d.lastTaskID = saved.ID
+	task.ID = saved.ID
+	task.Status = saved.Status
+
+	return nil
+}
+
+// PendingDeleteTasks returns the outbox deletion tasks that are not completed yet.
+func (d *DBFiles) PendingDeleteTasks(_ context.Context) (tasks []*model.DeleteTask, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	tasks = make([]*model.DeleteTask, 0, len(d.tasks))
+	for _, task := range d.tasks {
+		found := *task
+		tasks = append(tasks, &found)
+	}
+	sortDeleteTasks(tasks)
+
+	return tasks, nil
+}
+
+// CompleteDeleteTasks sets the final status (done or dead) for the outbox deletion tasks.
+func (d *DBFiles) CompleteDeleteTasks(_ context.Context, status string, ids ...int64) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	w, err := filefuncs.NewFileWriter(outboxPath())
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	for _, id := range ids {
+		task, ok := d.tasks[id]
+		if !ok {
+			continue
 		}
-		if e != nil {
-			err = e
-			logger.Log.Debug("reading urls from file", zap.Error(err))
-			break
+
+		completed := *task
+		completed.Status = status
+		if err = w.WriteDeleteTask(&completed); err != nil {
+			return err
 		}
+		delete(d.tasks, id)
+	}
 
-		d.urls[row.OrigURL] = row
-		d.hash[row.ShortURL] = row
+	return nil
+}
 
-		_, ex := d.owners[row.UserID]
-		if !ex {
-			d.owners[row.UserID] = make([]*model.URLRow, 0)
-		}
-		d.owners[row.UserID] = append(d.owners[row.UserID], row)
+// WriteShortenJob saves the new shortening job with its lines and sets its ID.
+func (d *DBFiles) WriteShortenJob(_ context.Context, job *model.ShortenJob) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
 
-		d.original = append(d.original, row)
+	w, err := filefuncs.NewFileWriter(jobsPath())
+	if err != nil {
+		return err
+	}
+	defer w.Close()
 
-		lastHash = row.ShortURL
+	saved := *job
+	saved.ID = d.lastJobID + 1
+	saved.Status = model.ShortenJobQueued
+	saved.Lines = make([]model.ShortenJobLine, len(job.Lines))
+	copy(saved.Lines, job.Lines)
+	if err = w.WriteShortenJob(&saved); err != nil {
+		return err
 	}
 
-	if lastHash == "" {
-		return 0, nil
+	d.jobs[saved.ID] = &saved
+	d.lastJobID = saved.ID
+	job.ID = saved.ID
+	job.Status = saved.Status
+
+	return nil
+}
+
+// ShortenJob returns the shortening job without the lines.
+func (d *DBFiles) ShortenJob(_ context.Context, id int64) (job *model.ShortenJob, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	found, ok := d.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w", ErrNotFound)
+	}
+	return copyShortenJob(found), nil
+}
+
+// ShortenJobLines returns no more than limit lines of the shortening job from the position.
+func (d *DBFiles) ShortenJobLines(_ context.Context, id int64, from, limit int) (lines []model.ShortenJobLine, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	found, ok := d.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w", ErrNotFound)
+	}
+	return shortenJobLines(found, from, limit), nil
+}
+
+// UpdateShortenJob saves the progress of the shortening job and the results of the processed lines.
+func (d *DBFiles) UpdateShortenJob(_ context.Context, job *model.ShortenJob) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	found, ok := d.jobs[job.ID]
+	if !ok {
+		return fmt.Errorf("%w", ErrNotFound)
 	}
 
-	lastID, err = hashfuncs.DecodeZeroHash(lastHash)
+	w, err := filefuncs.NewFileWriter(jobsPath())
 	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	// the journal line is written first, so the results are not lost if the process is stopped
+	progress := *job
+	progress.UserID = found.UserID
+	progress.Total = found.Total
+	progress.Created = found.Created
+	if err = w.WriteShortenJob(&progress); err != nil {
+		return err
+	}
+	applyShortenJob(found, job)
+
+	return nil
+}
+
+// PendingShortenJobs returns the IDs of the shortening jobs that are not finished yet.
+func (d *DBFiles) PendingShortenJobs(_ context.Context) (ids []int64, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return pendingShortenJobs(d.jobs), nil
+}
+
+// DeleteShortenJobs removes the finished shortening jobs (with their lines) updated before the time
+// and rewrites the journal.
+func (d *DBFiles) DeleteShortenJobs(_ context.Context, before time.Time) (deleted int, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	ids := expiredShortenJobs(d.jobs, before)
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	for _, id := range ids {
+		delete(d.jobs, id)
+	}
+	if err = d.rewriteJobs(); err != nil {
 		return 0, err
 	}
+	return len(ids), nil
+}
+
+// WriteWebhook saves the new webhook of the user and sets its ID.
+func (d *DBFiles) WriteWebhook(_ context.Context, hook *model.Webhook) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	w, err := filefuncs.NewFileWriter(webhooksPath())
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	saved := copyWebhook(hook)
+	saved.ID = d.lastWebhookID + 1
+	if err = w.WriteWebhook(saved); err != nil {
+		return err
+	}
+
+	d.webhooks[saved.ID] = saved
+	d.lastWebhookID = saved.ID
+	hook.ID = saved.ID
+
+	return nil
+}
+
+// UserWebhooks returns the webhooks of the user.
+func (d *DBFiles) UserWebhooks(_ context.Context, userID int64) (hooks []*model.Webhook, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return userWebhooks(d.webhooks, userID), nil
+}
+
+// DeleteWebhook deletes the webhook of the user with its deliveries.
+func (d *DBFiles) DeleteWebhook(_ context.Context, userID, id int64) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	found, ok := d.webhooks[id]
+	if !ok || found.UserID != userID {
+		return fmt.Errorf("%w", ErrNotFound)
+	}
+
+	w, err := filefuncs.NewFileWriter(webhooksPath())
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	// the deliveries of the deleted webhook are removed from the journal at the start
+	deleted := copyWebhook(found)
+	deleted.Deleted = true
+	if err = w.WriteWebhook(deleted); err != nil {
+		return err
+	}
+	delete(d.webhooks, id)
+	pruneWebhookDeliveries(d.deliveries, id, true)
+
+	return nil
+}
+
+// WriteWebhookDeliveries saves the new deliveries and sets their IDs.
+func (d *DBFiles) WriteWebhookDeliveries(_ context.Context, deliveries []*model.WebhookDelivery) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	w, err := filefuncs.NewFileWriter(deliveriesPath())
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	for _, delivery := range deliveries {
+		saved := *delivery
+		saved.ID = d.lastDeliveryID + 1
+		if err = w.WriteWebhookDelivery(&saved); err != nil {
+			return err
+		}
+		d.deliveries[saved.ID] = &saved
+		d.lastDeliveryID = saved.ID
+		delivery.ID = saved.ID
+	}
+
+	return nil
+}
+
+// UpdateWebhookDelivery saves the result of the delivery attempt.
+func (d *DBFiles) UpdateWebhookDelivery(_ context.Context, delivery *model.WebhookDelivery) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.deliveries[delivery.ID]; !ok {
+		return fmt.Errorf("%w", ErrNotFound)
+	}
+
+	w, err := filefuncs.NewFileWriter(deliveriesPath())
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	saved := *delivery
+	if err = w.WriteWebhookDelivery(&saved); err != nil {
+		return err
+	}
+	d.deliveries[saved.ID] = &saved
+	if saved.Status != model.WebhookDeliveryPending {
+		pruneWebhookDeliveries(d.deliveries, saved.WebhookID, false)
+	}
+
+	return nil
+}
+
+// PendingWebhookDeliveries returns no more than limit pending deliveries to try before the time.
+func (d *DBFiles) PendingWebhookDeliveries(_ context.Context, before time.Time, limit int) (deliveries []*model.WebhookDelivery, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return pendingWebhookDeliveries(d.deliveries, before, limit), nil
+}
+
+// WebhookDeliveries returns no more than limit last deliveries of the user webhook.
+func (d *DBFiles) WebhookDeliveries(_ context.Context, userID, id int64, limit int) (deliveries []*model.WebhookDelivery, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if hook, ok := d.webhooks[id]; !ok || hook.UserID != userID {
+		return nil, fmt.Errorf("%w", ErrNotFound)
+	}
+	return webhookDeliveries(d.deliveries, id, limit), nil
+}
+
+// WriteBusEvents saves the link events in the outbox of the event bus and sets their IDs.
+func (d *DBFiles) WriteBusEvents(_ context.Context, events []*model.BusEvent) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	saved := make([]*model.BusEvent, len(events))
+	for i, event := range events {
+		e := *event
+		saved[i] = &e
+	}
+	if err := d.writeBusEvents(saved...); err != nil {
+		return err
+	}
+	for i, event := range events {
+		event.ID = saved[i].ID
+	}
+
+	return nil
+}
+
+// PendingBusEvents returns no more than limit outbox events that are not published yet.
+func (d *DBFiles) PendingBusEvents(_ context.Context, limit int) (events []*model.BusEvent, err error) {
+	d.flushClicks()
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return pendingBusEvents(d.busEvents, limit), nil
+}
+
+// CompleteBusEvents removes the published events from the outbox (the published events are removed
+// from the journal at the start).
+func (d *DBFiles) CompleteBusEvents(_ context.Context, ids ...int64) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	w, err := filefuncs.NewFileWriter(eventsPath())
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	for _, id := range ids {
+		if err = w.WriteBusEvent(&model.BusEvent{ID: id, Published: true}); err != nil {
+			return err
+		}
+	}
+	d.busEvents = completeBusEvents(d.busEvents, ids)
+
+	return nil
+}
+
+// LeaseBusRelay takes the lease of the outbox relay.
+//
+// The storage file is not shared with other instances, so the lease is always taken.
+func (d *DBFiles) LeaseBusRelay(_ context.Context, _ string, _ time.Duration) (leased bool, err error) {
+	return true, nil
+}
+
+// writeBusEvents appends the events to the outbox journal and sets their IDs if the event bus is enabled
+// (the caller holds the lock).
+func (d *DBFiles) writeBusEvents(events ...*model.BusEvent) error {
+	// the visits counted before go first, so the events keep their order
+	clicked, applied := d.clicks.apply()
+	if applied {
+		d.unsaved = true
+	}
+	events = append(clicked, events...)
+	if !busEnabled() || len(events) == 0 {
+		return nil
+	}
+
+	w, err := filefuncs.NewFileWriter(eventsPath())
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	for _, event := range events {
+		event.ID = d.lastBusEventID + 1
+		if err = w.WriteBusEvent(event); err != nil {
+			return err
+		}
+		d.busEvents = append(d.busEvents, event)
+		d.lastBusEventID = event.ID
+	}
+
+	return nil
+}
+
+// applyClicks applies the visits counted under the read lock to the rows and writes their events
+// (the caller holds the lock).
+//
+// The visit is not lost if the event is not saved, as the visits are not written to the file at once.
+func (d *DBFiles) applyClicks() error {
+	return d.writeBusEvents()
+}
+
+// flushClicks applies the visits counted under the read lock (see clickCounter).
+func (d *DBFiles) flushClicks() {
+	if !d.clicks.pending() {
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.applyClicks(); err != nil {
+		logger.Log.Error("writing the clicked events to the outbox file", zap.Error(err))
+	}
+}
+
+// MigrateOrigURLs rewrites the original URLs of the existing rows with the migrate function.
+//
+// The storage file is rewritten if some rows are changed.
+func (d *DBFiles) MigrateOrigURLs(_ context.Context, migrate func(origURL string) (string, error)) (*model.URLMigration, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	rows := make([]*model.URLRow, len(d.original))
+	copy(rows, d.original)
+
+	res := migrateRows(rows, d.urls, migrate)
+	d.index.update(rows...)
+	if res.Updated == 0 {
+		return res, nil
+	}
+
+	return res, d.rewriteFile()
+}
+
+// Stats returns count of URLs by domain.
+func (d *DBFiles) Stats(_ context.Context) (domains map[string]int, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return domainStats(d.hash), nil
+}
+
+// TODO: as an option: use cache lib with reading from file
+
+// loadFromFile loads URLs from the storage.
+func (d *DBFiles) loadFromFile() (lastID int64, err error) {
+	r, err := filefuncs.NewFileReader(config.FileStoragePath)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	var lastHash string
+	for {
+		row, e := r.ReadURLRow()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			err = e
+			logger.Log.Debug("reading urls from file", zap.Error(err))
+			break
+		}
+
+		// the first row wins if the deduplication mode has been changed and there are duplicates
+		if key := dedupKey(row.Domain, row.OrigURL, row.UserID); d.urls[key] == nil {
+			d.urls[key] = row
+		}
+		d.hash[row.Key()] = row
+
+		_, ex := d.owners[row.UserID]
+		if !ex {
+			d.owners[row.UserID] = make([]*model.URLRow, 0)
+		}
+		d.owners[row.UserID] = append(d.owners[row.UserID], row)
+
+		d.original = append(d.original, row)
+
+		// the codes of the additional domains are not the row IDs, they continue the sequences of the domains
+		if row.Domain != "" {
+			code, e := hashfuncs.DecodeZeroHash(row.ShortURL)
+			if e != nil {
+				return 0, e
+			}
+			d.codes[row.Domain] = max(d.codes[row.Domain], code)
+			lastID = max(lastID, row.ID)
+			continue
+		}
+		lastHash = row.ShortURL
+	}
+	if lastHash == "" {
+		return lastID, nil
+	}
+
+	lastCode, err := hashfuncs.DecodeZeroHash(lastHash)
+	if err != nil {
+		return 0, err
+	}
+
+	return max(lastID, lastCode), nil
+}
+
+// loadRevisions loads the link revisions from the journal (if there is one)
+// and applies the last revisions that are not in the storage file yet.
+func (d *DBFiles) loadRevisions() error {
+	if _, err := os.Stat(revisionsPath()); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	r, err := filefuncs.NewFileReader(revisionsPath())
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for {
+		revision, e := r.ReadURLRevision()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			return e
+		}
+		d.revisions[revision.ShortURL] = append(d.revisions[revision.ShortURL], revision)
+	}
+
+	// the rows are rewritten by the revisions only if they have the previous destination
+	// (the destination can be changed without the revision by the migration)
+	fixed := 0
+	for shortURL, revisions := range d.revisions {
+		row, ok := d.hash[shortURL]
+		last := revisions[len(revisions)-1]
+		if !ok || row.OrigURL == last.OrigURL || row.OrigURL != last.PrevURL {
+			continue
+		}
+		setOrigURL(d.urls, row, last.OrigURL)
+		row.Meta, row.Check = nil, nil
+		fixed++
+	}
+	if fixed == 0 {
+		return nil
+	}
+
+	logger.Log.Info("storage file is fixed from the revisions journal", zap.Int("rows", fixed))
+	return d.rewriteFile()
+}
+
+// loadOutbox loads pending deletion tasks from the outbox journal
+// and compacts the journal (only pending tasks are left in it).
+func (d *DBFiles) loadOutbox() (lastTaskID int64, err error) {
+	r, err := filefuncs.NewFileReader(outboxPath())
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		task, e := r.ReadDeleteTask()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			err = e
+			logger.Log.Debug("reading deletion tasks from file", zap.Error(err))
+			break
+		}
+
+		if task.ID > lastTaskID {
+			lastTaskID = task.ID
+		}
+		if task.Status == model.DeleteTaskPending {
+			d.tasks[task.ID] = task
+		} else {
+			delete(d.tasks, task.ID)
+		}
+	}
+	_ = r.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	// compacting the journal
+	w, err := filefuncs.NewFileReWriter(outboxPath())
+	if err != nil {
+		return 0, err
+	}
+	defer w.Close()
+
+	pending := make([]*model.DeleteTask, 0, len(d.tasks))
+	for _, task := range d.tasks {
+		pending = append(pending, task)
+	}
+	sortDeleteTasks(pending)
+	for _, task := range pending {
+		if err = w.WriteDeleteTask(task); err != nil {
+			return 0, err
+		}
+	}
+
+	return lastTaskID, nil
+}
+
+// loadJobs loads the shortening jobs from the journal and compacts it
+// (every job is left as one line with all its lines and results).
+func (d *DBFiles) loadJobs() error {
+	r, err := filefuncs.NewFileReader(jobsPath())
+	if err != nil {
+		return err
+	}
+
+	for {
+		job, e := r.ReadShortenJob()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			err = e
+			logger.Log.Debug("reading shortening jobs from file", zap.Error(err))
+			break
+		}
+
+		if job.ID > d.lastJobID {
+			d.lastJobID = job.ID
+		}
+		if job.Status == "" {
+			continue // the placeholder of the last ID
+		}
+		// the first line of the job has all the lines, the next ones have the progress
+		if found, ok := d.jobs[job.ID]; ok {
+			applyShortenJob(found, job)
+		} else {
+			d.jobs[job.ID] = job
+		}
+	}
+	_ = r.Close()
+	if err != nil {
+		return err
+	}
+
+	// compacting the journal
+	return d.rewriteJobs()
+}
+
+// rewriteJobs writes the shortening jobs to the new journal.
+//
+// The IDs of the removed jobs are not reused, because the placeholder of the last ID
+// is left in the journal if the last job is removed.
+func (d *DBFiles) rewriteJobs() error {
+	w, err := filefuncs.NewFileReWriter(jobsPath())
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	ids := make([]int64, 0, len(d.jobs))
+	for id := range d.jobs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	for _, id := range ids {
+		if err = w.WriteShortenJob(d.jobs[id]); err != nil {
+			return err
+		}
+	}
+	if _, ok := d.jobs[d.lastJobID]; !ok && d.lastJobID > 0 {
+		return w.WriteShortenJob(&model.ShortenJob{ID: d.lastJobID})
+	}
+
+	return nil
+}
+
+// loadWebhooks loads the webhooks and their deliveries from the journals and compacts them
+// (the deleted webhooks and their deliveries are dropped, the finished deliveries are limited by WebhookLogSize).
+func (d *DBFiles) loadWebhooks() error {
+	r, err := filefuncs.NewFileReader(webhooksPath())
+	if err != nil {
+		return err
+	}
+	for {
+		hook, e := r.ReadWebhook()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			err = e
+			logger.Log.Debug("reading webhooks from file", zap.Error(err))
+			break
+		}
+
+		if hook.ID > d.lastWebhookID {
+			d.lastWebhookID = hook.ID
+		}
+		if hook.Deleted {
+			delete(d.webhooks, hook.ID)
+		} else {
+			d.webhooks[hook.ID] = hook
+		}
+	}
+	_ = r.Close()
+	if err != nil {
+		return err
+	}
+
+	r, err = filefuncs.NewFileReader(deliveriesPath())
+	if err != nil {
+		return err
+	}
+	for {
+		delivery, e := r.ReadWebhookDelivery()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			err = e
+			logger.Log.Debug("reading webhook deliveries from file", zap.Error(err))
+			break
+		}
+
+		if delivery.ID > d.lastDeliveryID {
+			d.lastDeliveryID = delivery.ID
+		}
+		d.deliveries[delivery.ID] = delivery
+	}
+	_ = r.Close()
+	if err != nil {
+		return err
+	}
+
+	for id, delivery := range d.deliveries {
+		if _, ok := d.webhooks[delivery.WebhookID]; !ok {
+			delete(d.deliveries, id)
+		}
+	}
+	for id := range d.webhooks {
+		pruneWebhookDeliveries(d.deliveries, id, false)
+	}
+
+	// compacting the journals
+	if err = d.rewriteWebhooks(); err != nil {
+		return err
+	}
+	return d.rewriteWebhookDeliveries()
+}
+
+// rewriteWebhooks writes the webhooks to the new journal.
+//
+// The IDs of the deleted webhooks are not reused, because the last webhook is always left in the journal
+// (as deleted if it is).
+func (d *DBFiles) rewriteWebhooks() error {
+	w, err := filefuncs.NewFileReWriter(webhooksPath())
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	ids := make([]int64, 0, len(d.webhooks))
+	for id := range d.webhooks {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	for _, id := range ids {
+		if err = w.WriteWebhook(d.webhooks[id]); err != nil {
+			return err
+		}
+	}
+	if _, ok := d.webhooks[d.lastWebhookID]; !ok && d.lastWebhookID > 0 {
+		return w.WriteWebhook(&model.Webhook{ID: d.lastWebhookID, Deleted: true})
+	}
+
+	return nil
+}
+
+// rewriteWebhookDeliveries writes the deliveries to the new journal
+// (the placeholder of the last ID is left in the journal if the last delivery is dropped).
+func (d *DBFiles) rewriteWebhookDeliveries() error {
+	w, err := filefuncs.NewFileReWriter(deliveriesPath())
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	ids := make([]int64, 0, len(d.deliveries))
+	for id := range d.deliveries {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	for _, id := range ids {
+		if err = w.WriteWebhookDelivery(d.deliveries[id]); err != nil {
+			return err
+		}
+	}
+	// the receivers deduplicate the events by the delivery ID, so the IDs are not reused
+	if _, ok := d.deliveries[d.lastDeliveryID]; !ok && d.lastDeliveryID > 0 {
+		return w.WriteWebhookDelivery(&model.WebhookDelivery{ID: d.lastDeliveryID})
+	}
+
+	return nil
+}
+
+// loadBusEvents loads the outbox of the event bus from the journal and compacts it
+// (the published events are dropped).
+func (d *DBFiles) loadBusEvents() error {
+	r, err := filefuncs.NewFileReader(eventsPath())
+	if err != nil {
+		return err
+	}
+	pending := make(map[int64]*model.BusEvent)
+	for {
+		event, e := r.ReadBusEvent()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			err = e
+			logger.Log.Debug("reading event bus outbox from file", zap.Error(err))
+			break
+		}
+
+		if event.ID > d.lastBusEventID {
+			d.lastBusEventID = event.ID
+		}
+		if event.Published {
+			delete(pending, event.ID)
+		} else {
+			pending[event.ID] = event
+		}
+	}
+	_ = r.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, event := range pending {
+		d.busEvents = append(d.busEvents, event)
+	}
+	sort.Slice(d.busEvents, func(i, j int) bool {
+		return d.busEvents[i].ID < d.busEvents[j].ID
+	})
+
+	// compacting the journal
+	w, err := filefuncs.NewFileReWriter(eventsPath())
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	for _, event := range d.busEvents {
+		if err = w.WriteBusEvent(event); err != nil {
+			return err
+		}
+	}
+	// the consumers deduplicate the events by the ID, so the IDs are not reused
+	if _, ok := pending[d.lastBusEventID]; !ok && d.lastBusEventID > 0 {
+		return w.WriteBusEvent(&model.BusEvent{ID: d.lastBusEventID, Published: true})
+	}
+
+	return nil
+}
+
+// outboxPath returns the deletion outbox file path.
+func outboxPath() string {
+	return config.FileStoragePath + OutboxFileSuffix
+}
+
+// revisionsPath returns the link revisions journal file path.
+func revisionsPath() string {
+	return config.FileStoragePath + RevisionsFileSuffix
+}
+
+// jobsPath returns the shortening jobs journal file path.
+func jobsPath() string {
+	return config.FileStoragePath + JobsFileSuffix
+}
+
+// webhooksPath returns the webhooks journal file path.
+func webhooksPath() string {
+	return config.FileStoragePath + WebhooksFileSuffix
+}
+
+// deliveriesPath returns the webhook deliveries journal file path.
+func deliveriesPath() string {
+	return config.FileStoragePath + DeliveriesFileSuffix
+}
 
-	return lastID, nil
+// eventsPath returns the event bus outbox journal file path.
+func eventsPath() string {
+	return config.FileStoragePath + EventsFileSuffix
 }
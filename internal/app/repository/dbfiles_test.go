@@ -2,43 +2,37 @@ package repository
 
 import (
 	"context"
-	"os"
+	"errors"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/zasuchilas/shortener/internal/app/config"
 	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/utils/filefuncs"
 )
 
 func TestDBFiles_InstanceName(t *testing.T) {
-	config.FileStoragePath = "./storage_test.db"
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
 	s := NewDBFile()
-	defer func() {
-		_ = os.Remove(config.FileStoragePath)
-	}()
 	assert.Equal(t, InstanceFile, s.InstanceName())
-	_ = os.Remove(config.FileStoragePath)
 }
 
 func TestDBFiles_Ping(t *testing.T) {
-	config.FileStoragePath = "./storage_test.db"
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
 	s := NewDBFile()
-	defer func() {
-		_ = os.Remove(config.FileStoragePath)
-	}()
 	err := s.Ping(context.TODO())
 	assert.Error(t, err)
 	assert.Equal(t, "not allowed", err.Error())
-	_ = os.Remove(config.FileStoragePath)
 }
 
 func TestDBFiles_WriteURL(t *testing.T) {
-	config.FileStoragePath = "./storage_test.db"
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
 	s := NewDBFile()
-	defer func() {
-		_ = os.Remove(config.FileStoragePath)
-	}()
 
 	tests := []struct {
 		name     string
@@ -68,7 +62,7 @@ func TestDBFiles_WriteURL(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			shortURL, conflict, err := s.WriteURL(context.TODO(), tt.origURL, tt.userID)
+			shortURL, conflict, err := s.WriteURL(context.TODO(), "", tt.origURL, tt.userID)
 
 			assert.Equal(t, tt.shortURL, shortURL)
 			assert.Equal(t, tt.conflict, conflict)
@@ -78,11 +72,8 @@ func TestDBFiles_WriteURL(t *testing.T) {
 }
 
 func TestDBFiles_ReadURL(t *testing.T) {
-	config.FileStoragePath = "./storage_test.db"
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
 	s := NewDBFile()
-	defer func() {
-		_ = os.Remove(config.FileStoragePath)
-	}()
 
 	// select from empty db
 	_, err := s.ReadURL(context.TODO(), "19xtf1ts")
@@ -91,22 +82,20 @@ func TestDBFiles_ReadURL(t *testing.T) {
 	// creating URL row
 	_, _, _ = s.WriteURL(
 		context.TODO(),
+		"",
 		"https://ya.ru",
 		1,
 	)
 
 	//
-	origURL, err := s.ReadURL(context.TODO(), "19xtf1ts")
+	row, err := s.ReadURL(context.TODO(), "19xtf1ts")
 	assert.NoError(t, err)
-	assert.Equal(t, "https://ya.ru", origURL)
+	assert.Equal(t, "https://ya.ru", row.OrigURL)
 }
 
 func TestDBFiles_UserURLs(t *testing.T) {
-	config.FileStoragePath = "./storage_test.db"
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
 	s := NewDBFile()
-	defer func() {
-		_ = os.Remove(config.FileStoragePath)
-	}()
 
 	tests := []struct {
 		name         string
@@ -125,7 +114,7 @@ func TestDBFiles_UserURLs(t *testing.T) {
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			actual, err := s.UserURLs(context.TODO(), tt.userID)
+			actual, _, err := s.UserURLs(context.TODO(), tt.userID, model.UserURLsQuery{})
 
 			assert.Equal(t, tt.expectedURLs, actual)
 			assert.Error(t, tt.expectedErr, err)
@@ -134,11 +123,8 @@ func TestDBFiles_UserURLs(t *testing.T) {
 }
 
 func TestDBFiles_CheckDeletedURLs(t *testing.T) {
-	config.FileStoragePath = "./storage_test.db"
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
 	s := NewDBFile()
-	defer func() {
-		_ = os.Remove(config.FileStoragePath)
-	}()
 
 	tests := []struct {
 		name        string
@@ -165,11 +151,8 @@ func TestDBFiles_CheckDeletedURLs(t *testing.T) {
 }
 
 func TestDBFiles_DeleteURLs(t *testing.T) {
-	config.FileStoragePath = "./storage_test.db"
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
 	s := NewDBFile()
-	defer func() {
-		_ = os.Remove(config.FileStoragePath)
-	}()
 
 	tests := []struct {
 		name        string
@@ -192,3 +175,484 @@ func TestDBFiles_DeleteURLs(t *testing.T) {
 		})
 	}
 }
+
+func TestDBFiles_DeleteTasks(t *testing.T) {
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
+	s := NewDBFile()
+
+	first := &model.DeleteTask{UserID: 1, ShortURLs: []string{"19xtf1ts"}}
+	second := &model.DeleteTask{UserID: 1, ShortURLs: []string{"19xtf1tt", "19xtf1tu"}}
+	assert.NoError(t, s.WriteDeleteTask(context.TODO(), first))
+	assert.NoError(t, s.WriteDeleteTask(context.TODO(), second))
+	assert.NoError(t, s.CompleteDeleteTasks(context.TODO(), model.DeleteTaskDone, first.ID))
+
+	// the pending task survives the restart
+	restarted := NewDBFile()
+	pending, err := restarted.PendingDeleteTasks(context.TODO())
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, second.ID, pending[0].ID)
+	assert.Equal(t, []string{"19xtf1tt", "19xtf1tu"}, pending[0].ShortURLs)
+
+	// new tasks don't reuse the pending ids
+	third := &model.DeleteTask{UserID: 1, ShortURLs: []string{"19xtf1tv"}}
+	assert.NoError(t, restarted.WriteDeleteTask(context.TODO(), third))
+	assert.Greater(t, third.ID, second.ID)
+}
+
+func TestDBFiles_Domains(t *testing.T) {
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
+	s := NewDBFile()
+	ctx := context.TODO()
+
+	out, err := s.WriteURLs(ctx, "go.example.com", []string{"https://ya.ru", "https://go.dev"}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "go.example.com/19xtf1ts", out["https://ya.ru"].Key())
+	assert.Equal(t, "go.example.com/19xtf1tt", out["https://go.dev"].Key())
+	shortURL, _, err := s.WriteURL(ctx, "", "https://ya.ru", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "19xtf1tu", shortURL)
+
+	// the codes of the domains go on after the restart
+	restarted := NewDBFile()
+	row, err := restarted.ReadURL(ctx, "go.example.com/19xtf1tt")
+	require.NoError(t, err)
+	assert.Equal(t, "https://go.dev", row.OrigURL)
+	shortURL, _, err = restarted.WriteURL(ctx, "go.example.com", "https://mail.ya.ru", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "go.example.com/19xtf1tu", shortURL)
+	shortURL, _, err = restarted.WriteURL(ctx, "", "https://mail.ya.ru", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "19xtf1tw", shortURL)
+
+	domains, err := restarted.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"": 2, "go.example.com": 3}, domains)
+}
+
+func TestDBFiles_Search(t *testing.T) {
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
+	s := NewDBFile()
+	ctx := context.TODO()
+
+	shortURL, _, err := s.WriteURL(ctx, "", "https://go.dev/doc", 1)
+	require.NoError(t, err)
+	_, _, err = s.WriteURL(ctx, "", "https://ya.ru", 1)
+	require.NoError(t, err)
+	notes, tags := "Read it first", []string{"docs", "go"}
+	_, err = s.UpdateURLOptions(ctx, 1, shortURL, model.URLOptions{Notes: &notes, Tags: &tags})
+	require.NoError(t, err)
+
+	// the notes and the tags are indexed after the restart
+	restarted := NewDBFile()
+	rows, _, err := restarted.UserURLs(ctx, 1, model.UserURLsQuery{Tags: []string{"go"}, Text: "read"})
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, shortURL, rows[0].ShortURL)
+	assert.Equal(t, "Read it first", rows[0].Notes)
+	assert.Equal(t, []string{"docs", "go"}, rows[0].Tags)
+}
+
+func TestDBFiles_SetURLMetadata(t *testing.T) {
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
+	s := NewDBFile()
+	ctx := context.TODO()
+
+	shortURL, _, err := s.WriteURL(ctx, "", "https://go.dev/doc", 1)
+	require.NoError(t, err)
+	meta := &model.LinkMetadata{Title: "Documentation", Fetched: time.Now().UTC().Truncate(time.Second)}
+	require.NoError(t, s.SetURLMetadata(ctx, shortURL, "https://go.dev/doc", meta))
+	assert.ErrorIs(t, s.SetURLMetadata(ctx, "unknown", "https://go.dev/doc", meta), ErrNotFound)
+
+	// the metadata is written at the stop
+	s.Stop()
+	restarted := NewDBFile()
+	row, err := restarted.URLInfo(ctx, shortURL)
+	require.NoError(t, err)
+	require.NotNil(t, row.Meta)
+	assert.Equal(t, "Documentation", row.Meta.Title)
+	assert.True(t, meta.Fetched.Equal(row.Meta.Fetched))
+
+	// the metadata of the previous destination is dropped and the late one is skipped
+	_, err = restarted.UpdateURL(ctx, 1, shortURL, "https://go.dev/blog")
+	require.NoError(t, err)
+	require.NoError(t, restarted.SetURLMetadata(ctx, shortURL, "https://go.dev/doc", meta))
+	row, err = restarted.URLInfo(ctx, shortURL)
+	require.NoError(t, err)
+	assert.Nil(t, row.Meta)
+}
+
+func TestDBFiles_MigrateOrigURLs(t *testing.T) {
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
+	s := NewDBFile()
+
+	shortURL, _, _ := s.WriteURL(context.TODO(), "", "HTTPS://YA.RU", 1)
+	_, _, _ = s.WriteURL(context.TODO(), "", "https://ya.ru", 1)
+
+	res, err := s.MigrateOrigURLs(context.TODO(), func(origURL string) (string, error) {
+		if origURL == "https://ya.ru" {
+			return "", errors.New("wrong URL")
+		}
+		return strings.ToLower(origURL) + "/", nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &model.URLMigration{Checked: 2, Updated: 1, Failed: 1}, res)
+
+	// the migrated URL survives the restart
+	restarted := NewDBFile()
+	row, err := restarted.ReadURL(context.TODO(), shortURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://ya.ru/", row.OrigURL)
+}
+
+func TestDBFiles_DedupUser(t *testing.T) {
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
+	s := NewDBFile()
+	defer func() {
+		config.DedupMode = ""
+	}()
+
+	// the row of the global mode
+	first, _, _ := s.WriteURL(context.TODO(), "", "https://ya.ru", 1)
+
+	config.DedupMode = DedupUser
+	restarted := NewDBFile()
+	second, conflict, err := restarted.WriteURL(context.TODO(), "", "https://ya.ru", 2)
+	assert.NoError(t, err)
+	assert.False(t, conflict)
+	assert.NotEqual(t, first, second)
+
+	// the old row is still found for its owner
+	repeated, conflict, err := restarted.WriteURL(context.TODO(), "", "https://ya.ru", 1)
+	assert.NoError(t, err)
+	assert.True(t, conflict)
+	assert.Equal(t, first, repeated)
+
+	// back to the global mode: the first row wins
+	config.DedupMode = DedupGlobal
+	restarted = NewDBFile()
+	repeated, conflict, err = restarted.WriteURL(context.TODO(), "", "https://ya.ru", 2)
+	assert.NoError(t, err)
+	assert.True(t, conflict)
+	assert.Equal(t, first, repeated)
+
+	urlRows, _, err := restarted.UserURLs(context.TODO(), 2, model.UserURLsQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, urlRows, 1)
+	assert.Equal(t, second, urlRows[0].ShortURL)
+}
+
+func TestDBFiles_UpdateURL(t *testing.T) {
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
+	s := NewDBFile()
+
+	shortURL, _, _ := s.WriteURL(context.TODO(), "", "https://ya.ru", 1)
+	revision, err := s.UpdateURL(context.TODO(), 1, shortURL, "https://yandex.ru")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), revision.Revision)
+
+	// the revision and the new destination survive the restart
+	restarted := NewDBFile()
+	row, err := restarted.ReadURL(context.TODO(), shortURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://yandex.ru", row.OrigURL)
+
+	revision, err = restarted.UpdateURL(context.TODO(), 1, shortURL, "https://yandex.ru/search")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), revision.Revision)
+
+	// the storage file is fixed from the journal (as if the rewriting had failed)
+	w, err := filefuncs.NewFileWriter(config.FileStoragePath + RevisionsFileSuffix)
+	assert.NoError(t, err)
+	assert.NoError(t, w.WriteURLRevision(&model.URLRevision{
+		Revision: 3,
+		ShortURL: shortURL,
+		OrigURL:  "https://yandex.ru/maps",
+		PrevURL:  "https://yandex.ru/search",
+		UserID:   1,
+	}))
+	assert.NoError(t, w.Close())
+
+	restarted = NewDBFile()
+	row, err = restarted.ReadURL(context.TODO(), shortURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://yandex.ru/maps", row.OrigURL)
+
+	revisions, err := restarted.URLRevisions(context.TODO(), 1, shortURL)
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 3)
+}
+
+func TestDBFiles_URLOptions(t *testing.T) {
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
+	s := NewDBFile()
+
+	shortURL, _, _ := s.WriteURL(context.TODO(), "", "https://ya.ru", 1)
+	title := "Yandex"
+	_, err := s.UpdateURLOptions(context.TODO(), 1, shortURL, model.URLOptions{Title: &title})
+	assert.NoError(t, err)
+	_, err = s.ReadURL(context.TODO(), shortURL)
+	assert.NoError(t, err)
+
+	// the options are saved at once, the visits are saved at the stop
+	restarted := NewDBFile()
+	row, err := restarted.URLInfo(context.TODO(), shortURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "Yandex", row.Title)
+	assert.Equal(t, int64(0), row.Clicks)
+	assert.False(t, row.Created.IsZero())
+
+	s.Stop()
+	restarted = NewDBFile()
+	row, err = restarted.URLInfo(context.TODO(), shortURL)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), row.Clicks)
+}
+
+func TestDBFiles_ShortenJobs(t *testing.T) {
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
+	s := NewDBFile()
+
+	ctx := context.TODO()
+	job := &model.ShortenJob{UserID: 1, Total: 3, Lines: []model.ShortenJobLine{
+		{N: 0, Line: 1, CorrelationID: "a", OriginalURL: "https://ya.ru"},
+		{N: 1, Line: 2, Error: "invalid character"},
+		{N: 2, Line: 3, CorrelationID: "c", OriginalURL: "go.dev"},
+	}}
+	assert.NoError(t, s.WriteShortenJob(ctx, job))
+	assert.Equal(t, model.ShortenJobQueued, job.Status)
+
+	// the progress of the first chunk
+	progress := *job
+	progress.Status = model.ShortenJobRunning
+	progress.Processed = 2
+	progress.Failed = 1
+	progress.Lines = []model.ShortenJobLine{
+		{N: 0, Line: 1, CorrelationID: "a", OriginalURL: "https://ya.ru", ShortURL: "http://localhost:8080/19xtf1ts"},
+		{N: 1, Line: 2, Error: "invalid character"},
+	}
+	assert.NoError(t, s.UpdateShortenJob(ctx, &progress))
+
+	// the unfinished job survives the restart with its results
+	restarted := NewDBFile()
+	ids, err := restarted.PendingShortenJobs(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{job.ID}, ids)
+
+	found, err := restarted.ShortenJob(ctx, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, found.Processed)
+	assert.Equal(t, 1, found.Failed)
+	assert.Empty(t, found.Lines)
+
+	lines, err := restarted.ShortenJobLines(ctx, job.ID, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, lines, 3)
+	assert.Equal(t, "http://localhost:8080/19xtf1ts", lines[0].ShortURL)
+	lines, err = restarted.ShortenJobLines(ctx, job.ID, 2, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.ShortenJobLine{{N: 2, Line: 3, CorrelationID: "c", OriginalURL: "go.dev"}}, lines)
+
+	_, err = restarted.ShortenJob(ctx, job.ID+1)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// new jobs don't reuse the ids
+	next := &model.ShortenJob{UserID: 1, Total: 1, Lines: []model.ShortenJobLine{{OriginalURL: "ya.ru"}}}
+	assert.NoError(t, restarted.WriteShortenJob(ctx, next))
+	assert.Greater(t, next.ID, job.ID)
+}
+
+func TestDBFiles_DeleteShortenJobs(t *testing.T) {
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
+	s := NewDBFile()
+
+	ctx := context.TODO()
+	now := time.Now()
+	jobs := make([]*model.ShortenJob, 3)
+	for i := range jobs {
+		jobs[i] = &model.ShortenJob{UserID: 1, Total: 1, Lines: []model.ShortenJobLine{{OriginalURL: "ya.ru"}}}
+		assert.NoError(t, s.WriteShortenJob(ctx, jobs[i]))
+	}
+	// the first and the last jobs are finished long ago, the second one is running
+	for _, job := range []*model.ShortenJob{jobs[0], jobs[2]} {
+		progress := *job
+		progress.Status = model.ShortenJobDone
+		progress.Processed = 1
+		progress.Updated = now.Add(-time.Hour)
+		progress.Lines = []model.ShortenJobLine{{OriginalURL: "ya.ru", ShortURL: "http://localhost:8080/19xtf1ts"}}
+		assert.NoError(t, s.UpdateShortenJob(ctx, &progress))
+	}
+	running := *jobs[1]
+	running.Status = model.ShortenJobRunning
+	running.Updated = now.Add(-time.Hour)
+	assert.NoError(t, s.UpdateShortenJob(ctx, &running))
+
+	deleted, err := s.DeleteShortenJobs(ctx, now.Add(-2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+	deleted, err = s.DeleteShortenJobs(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	// the removed jobs don't come back after the restart
+	restarted := NewDBFile()
+	_, err = restarted.ShortenJob(ctx, jobs[0].ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = restarted.ShortenJob(ctx, jobs[2].ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	ids, err := restarted.PendingShortenJobs(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{jobs[1].ID}, ids)
+
+	// new jobs don't reuse the ids of the removed ones
+	next := &model.ShortenJob{UserID: 1, Total: 1, Lines: []model.ShortenJobLine{{OriginalURL: "ya.ru"}}}
+	assert.NoError(t, restarted.WriteShortenJob(ctx, next))
+	assert.Greater(t, next.ID, jobs[2].ID)
+}
+
+func TestDBFiles_Webhooks(t *testing.T) {
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
+	s := NewDBFile()
+
+	ctx := context.TODO()
+	hook := &model.Webhook{UserID: 1, URL: "https://example.com/hook", Events: []string{model.EventLinkCreated}, Secret: "s"}
+	assert.NoError(t, s.WriteWebhook(ctx, hook))
+	deleted := &model.Webhook{UserID: 1, URL: "https://example.com/old", Secret: "s"}
+	assert.NoError(t, s.WriteWebhook(ctx, deleted))
+
+	now := time.Now()
+	deliveries := make([]*model.WebhookDelivery, 0, WebhookLogSize+2)
+	for range WebhookLogSize + 2 {
+		deliveries = append(deliveries, &model.WebhookDelivery{
+			WebhookID: hook.ID, UserID: 1, Event: model.EventLinkCreated, URL: hook.URL,
+			Status: model.WebhookDeliveryPending, NextTry: now,
+		})
+	}
+	assert.NoError(t, s.WriteWebhookDeliveries(ctx, deliveries))
+	assert.NoError(t, s.WriteWebhookDeliveries(ctx, []*model.WebhookDelivery{
+		{WebhookID: deleted.ID, UserID: 1, Status: model.WebhookDeliveryPending, NextTry: now},
+	}))
+	assert.NoError(t, s.DeleteWebhook(ctx, 1, deleted.ID))
+	assert.ErrorIs(t, s.DeleteWebhook(ctx, 2, hook.ID), ErrNotFound)
+
+	// all but the last one are delivered, the oldest ones are pruned from the log
+	for _, d := range deliveries[:len(deliveries)-1] {
+		d.Status = model.WebhookDeliveryDelivered
+		d.Attempts = 1
+		assert.NoError(t, s.UpdateWebhookDelivery(ctx, d))
+	}
+	last := deliveries[len(deliveries)-1]
+	last.Attempts = 1
+	last.NextTry = now.Add(time.Minute)
+	assert.NoError(t, s.UpdateWebhookDelivery(ctx, last))
+
+	// the webhooks and the log survive the restart
+	restarted := NewDBFile()
+	hooks, err := restarted.UserWebhooks(ctx, 1)
+	assert.NoError(t, err)
+	require.Len(t, hooks, 1)
+	assert.Equal(t, hook.ID, hooks[0].ID)
+	assert.Equal(t, []string{model.EventLinkCreated}, hooks[0].Events)
+
+	pending, err := restarted.PendingWebhookDeliveries(ctx, now, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+	pending, err = restarted.PendingWebhookDeliveries(ctx, now.Add(time.Hour), 10)
+	assert.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, last.ID, pending[0].ID)
+
+	log, err := restarted.WebhookDeliveries(ctx, 1, hook.ID, WebhookLogSize+10)
+	assert.NoError(t, err)
+	assert.Len(t, log, WebhookLogSize+1)
+	assert.Equal(t, last.ID, log[0].ID)
+	_, err = restarted.WebhookDeliveries(ctx, 1, deleted.ID, 10)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// new webhooks and deliveries don't reuse the ids
+	next := &model.Webhook{UserID: 1, URL: "https://example.com/next"}
+	assert.NoError(t, restarted.WriteWebhook(ctx, next))
+	assert.Greater(t, next.ID, deleted.ID)
+	nextDelivery := &model.WebhookDelivery{WebhookID: next.ID, UserID: 1}
+	assert.NoError(t, restarted.WriteWebhookDeliveries(ctx, []*model.WebhookDelivery{nextDelivery}))
+	assert.Greater(t, nextDelivery.ID, int64(WebhookLogSize+3))
+}
+
+func TestDBFiles_BusEvents(t *testing.T) {
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
+	config.EventBus = "nats"
+	s := NewDBFile()
+	defer func() {
+		config.EventBus = ""
+	}()
+
+	ctx := context.TODO()
+	urlRows, err := s.WriteURLs(ctx, "", []string{"https://ya.ru", "https://google.com"}, 1)
+	require.NoError(t, err)
+	shortURL := urlRows["https://ya.ru"].ShortURL
+	_, err = s.ReadURL(ctx, shortURL)
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteURLs(ctx, shortURL))
+	expired := &model.BusEvent{Type: model.EventLinkExpired, UserID: 1, ShortURL: urlRows["https://google.com"].ShortURL}
+	require.NoError(t, s.WriteBusEvents(ctx, []*model.BusEvent{expired}))
+	assert.Equal(t, int64(5), expired.ID)
+
+	events, err := s.PendingBusEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 5)
+	require.NoError(t, s.CompleteBusEvents(ctx, events[0].ID, events[1].ID))
+
+	// the pending events survive the restart
+	restarted := NewDBFile()
+	pending, err := restarted.PendingBusEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 3)
+	for i, event := range pending {
+		assert.Equal(t, events[i+2].ID, event.ID)
+		assert.Equal(t, events[i+2].Type, event.Type)
+		assert.Equal(t, events[i+2].ShortURL, event.ShortURL)
+	}
+	assert.Equal(t, model.EventLinkClicked, pending[0].Type)
+
+	// the IDs of the published events are not reused
+	require.NoError(t, restarted.CompleteBusEvents(ctx, 3, 4, 5))
+	restarted = NewDBFile()
+	pending, err = restarted.PendingBusEvents(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	_, _, err = restarted.WriteURL(ctx, "", "https://example.com", 2)
+	require.NoError(t, err)
+	pending, err = restarted.PendingBusEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, int64(6), pending[0].ID)
+}
+
+func TestDBFiles_SaveURLCheck(t *testing.T) {
+	config.FileStoragePath = filepath.Join(t.TempDir(), "storage.db")
+	s := NewDBFile()
+	ctx := context.TODO()
+
+	shortURL, _, err := s.WriteURL(ctx, "", "https://go.dev/doc", 1)
+	require.NoError(t, err)
+	rows, err := s.URLsToCheck(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	check := &model.LinkCheck{Checked: time.Now().UTC().Truncate(time.Second), Status: 410, Failures: 2, Broken: true}
+	saved, err := s.SaveURLCheck(ctx, rows[0], check)
+	require.NoError(t, err)
+	assert.True(t, saved)
+
+	// the check is written at the stop
+	s.Stop()
+	restarted := NewDBFile()
+	row, err := restarted.URLInfo(ctx, shortURL)
+	require.NoError(t, err)
+	require.NotNil(t, row.Check)
+	assert.Equal(t, 410, row.Check.Status)
+	assert.True(t, row.Check.Broken)
+	assert.True(t, check.Checked.Equal(row.Check.Checked))
+	rows, err = restarted.URLsToCheck(ctx, check.Checked, 10)
+	require.NoError(t, err)
+	assert.Empty(t, rows)
+}
@@ -12,7 +12,6 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/zasuchilas/shortener/internal/app/logger"
-	"github.com/zasuchilas/shortener/internal/app/utils/hashfuncs"
 )
 
 var (
@@ -21,11 +20,31 @@ var (
 
 // DBMaps is a RAM storage on double maps.
 type DBMaps struct {
-	urls   map[string]*model.URLRow
+	urls   map[string]*model.URLRow // by dedupKey
 	hash   map[string]*model.URLRow
 	owners map[int64][]*model.URLRow
 	lastID int64
+	codes  map[string]int64 // the last short code numbers of the additional domains
+	index  *searchIndex
 	mutex  sync.RWMutex
+
+	revisions map[string][]*model.URLRevision // by short URL
+
+	tasks      map[int64]*model.DeleteTask
+	lastTaskID int64
+
+	jobs      map[int64]*model.ShortenJob
+	lastJobID int64
+
+	webhooks       map[int64]*model.Webhook
+	lastWebhookID  int64
+	deliveries     map[int64]*model.WebhookDelivery
+	lastDeliveryID int64
+
+	busEvents      []*model.BusEvent // the outbox of the event bus (the oldest first)
+	lastBusEventID int64
+
+	clicks clickCounter // the visits counted under the read lock
 }
 
 // NewDBMaps creates an instance of the component.
@@ -34,6 +53,15 @@ func NewDBMaps() *DBMaps {
 		urls:   make(map[string]*model.URLRow),
 		hash:   make(map[string]*model.URLRow),
 		owners: make(map[int64][]*model.URLRow),
+		codes:  make(map[string]int64),
+		index:  newSearchIndex(),
+		tasks:  make(map[int64]*model.DeleteTask),
+		jobs:   make(map[int64]*model.ShortenJob),
+
+		webhooks:   make(map[int64]*model.Webhook),
+		deliveries: make(map[int64]*model.WebhookDelivery),
+
+		revisions: make(map[string][]*model.URLRevision),
 	}
 	return db
 }
@@ -47,39 +75,58 @@ func (d *DBMaps) InstanceName() string {
 }
 
 // WriteURL writes URL in the storage.
-func (d *DBMaps) WriteURL(ctx context.Context, origURL string, userID int64) (shortURL string, conflict bool, err error) {
+func (d *DBMaps) WriteURL(ctx context.Context, domain, origURL string, userID int64) (shortURL string, conflict bool, err error) {
 	// checking if already exist
-	found, ok := d.urls[origURL]
+	d.mutex.RLock()
+	found, ok := d.urls[dedupKey(domain, origURL, userID)]
+	d.mutex.RUnlock()
 	if ok {
-		return found.ShortURL, true, nil
+		return found.Key(), true, nil
 	}
 
 	// writing URL
-	urlRows, err := d.WriteURLs(ctx, []string{origURL}, userID)
+	urlRows, err := d.WriteURLs(ctx, domain, []string{origURL}, userID)
 	if err != nil {
 		return "", false, err
 	}
 	if urlRows == nil || urlRows[origURL] == nil {
 		return "", false, errors.New("something wrong with writing URL")
 	}
-	return urlRows[origURL].ShortURL, false, nil
+	return urlRows[origURL].Key(), false, nil
 }
 
-// ReadURL reads URL from the storage.
-func (d *DBMaps) ReadURL(_ context.Context, shortURL string) (origURL string, err error) {
+// ReadURL reads the row of the short URL from the storage and counts the visit.
+//
+// The visit is counted under the read lock and applied to the row later (see clickCounter).
+func (d *DBMaps) ReadURL(_ context.Context, shortURL string) (row *model.URLRow, err error) {
+	var visits int64
+	full := false
+
 	d.mutex.RLock()
 	found, ok := d.hash[shortURL]
+	if ok && !found.Deleted && !isExpired(found) {
+		visits, full = d.clicks.add(found)
+	}
+	row, err = openRow(found)
 	d.mutex.RUnlock()
 
-	if !ok {
-		return "", fmt.Errorf("%w", ErrNotFound)
+	if full {
+		d.flushClicks()
 	}
-
-	if found.Deleted {
-		return "", fmt.Errorf("%w", ErrGone)
+	if err != nil {
+		return nil, err
 	}
+	row.Clicks += visits
+	return row, nil
+}
+
+// URLInfo reads the row of the short URL from the storage (the visit is not counted).
+func (d *DBMaps) URLInfo(_ context.Context, shortURL string) (row *model.URLRow, err error) {
+	d.flushClicks()
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
 
-	return found.OrigURL, nil
+	return openRow(d.hash[shortURL])
 }
 
 // Ping pings the storage.
@@ -89,8 +136,15 @@ func (d *DBMaps) Ping(_ context.Context) error {
 	return errors.New("not allowed")
 }
 
+// HealthCheck checks that the storage is able to serve requests.
+//
+// RAM storage is always ready.
+func (d *DBMaps) HealthCheck(_ context.Context) error {
+	return nil
+}
+
 // WriteURLs writes URLs in the storage.
-func (d *DBMaps) WriteURLs(ctx context.Context, origURLs []string, userID int64) (urlRows map[string]*model.URLRow, err error) {
+func (d *DBMaps) WriteURLs(ctx context.Context, domain string, origURLs []string, userID int64) (urlRows map[string]*model.URLRow, err error) {
 
 	urlRows = make(map[string]*model.URLRow)
 
@@ -115,7 +169,7 @@ loop:
 			break loop
 		default:
 			logger.Log.Debug("find is ready in maps storage", zap.String("origURL", origURL))
-			found, ok := d.urls[origURL]
+			found, ok := d.urls[dedupKey(domain, origURL, userID)]
 			if ok {
 				logger.Log.Debug("row already exist", zap.String("shortURL", found.ShortURL))
 				urlRows[origURL] = found
@@ -123,18 +177,22 @@ loop:
 			}
 
 			nextID := d.lastID + 1
-			shortURL := hashfuncs.EncodeZeroHash(nextID)
+			shortURL := nextShortURL(domain, nextID, d.codes)
 			nextURLRow := &model.URLRow{
 				ID:       nextID,
+				Domain:   domain,
 				ShortURL: shortURL,
 				OrigURL:  origURL,
 				UserID:   userID,
 				Deleted:  false,
+				Created:  time.Now(),
 			}
-			d.urls[origURL] = nextURLRow
-			d.hash[shortURL] = nextURLRow
+			d.urls[dedupKey(domain, origURL, userID)] = nextURLRow
+			d.hash[nextURLRow.Key()] = nextURLRow
 			d.owners[userID] = append(d.owners[userID], nextURLRow)
+			d.index.update(nextURLRow)
 			d.lastID = nextID
+			d.writeBusEvent(model.EventLinkCreated, nextURLRow)
 
 			logger.Log.Debug("inserted new row",
 				zap.String("shortURL", shortURL), zap.String("origURL", origURL))
@@ -148,17 +206,21 @@ loop:
 	return urlRows, nil
 }
 
-// UserURLs returns user URLs from storage.
-func (d *DBMaps) UserURLs(_ context.Context, userID int64) (urlRowList []*model.URLRow, err error) {
+// UserURLs returns the page of the user URLs from storage.
+func (d *DBMaps) UserURLs(_ context.Context, userID int64, q model.UserURLsQuery) (urlRowList []*model.URLRow, nextCursor string, err error) {
+	d.flushClicks()
 	d.mutex.RLock()
-	found, ok := d.owners[userID]
-	d.mutex.RUnlock()
+	defer d.mutex.RUnlock()
 
+	found, ok := d.owners[userID]
 	if !ok || len(found) == 0 {
-		return nil, fmt.Errorf("%w", ErrNotFound)
+		return nil, "", fmt.Errorf("%w", ErrNotFound)
+	}
+	if rows, ok := d.index.find(userID, q); ok {
+		found = rows
 	}
 
-	return found, nil
+	return userURLsPage(found, q)
 }
 
 // CheckDeletedURLs checks deleting URLs.
@@ -187,22 +249,396 @@ func (d *DBMaps) DeleteURLs(_ context.Context, shortURLs ...string) error {
 	for _, shortURL := range shortURLs {
 
 		found, ok := d.hash[shortURL]
-		if !ok {
+		if !ok || found.Deleted {
 			continue
 		}
 
 		found.Deleted = true // since found is a pointer, the value must change in all components (url, hash, owner)
+		d.writeBusEvent(model.EventLinkDeleted, found)
+	}
+
+	return nil
+}
+
+// UpdateURL changes the destination of the user short URL and records the revision.
+func (d *DBMaps) UpdateURL(_ context.Context, userID int64, shortURL, origURL string) (revision *model.URLRevision, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	row := d.hash[shortURL]
+	revision, err = newRevision(userID, row, origURL, d.urls, d.revisions[shortURL])
+	if err != nil || revision == nil {
+		return nil, err
+	}
+
+	setOrigURL(d.urls, row, origURL)
+	row.Meta, row.Check = nil, nil // the page and the checks of the previous destination
+	d.index.update(row)
+	d.revisions[shortURL] = append(d.revisions[shortURL], revision)
+
+	return revision, nil
+}
+
+// URLRevisions returns the revisions of the user short URL (the first revision first).
+func (d *DBMaps) URLRevisions(_ context.Context, userID int64, shortURL string) (revisions []*model.URLRevision, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if err = checkUserURL(userID, d.hash[shortURL]); err != nil {
+		return nil, err
+	}
+
+	return copyRevisions(d.revisions[shortURL]), nil
+}
+
+// UpdateURLOptions changes the options of the user short URL (nil options are kept as they are).
+func (d *DBMaps) UpdateURLOptions(_ context.Context, userID int64, shortURL string, opts model.URLOptions) (row *model.URLRow, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	found := d.hash[shortURL]
+	if err = setURLOptions(userID, found, opts); err != nil {
+		return nil, err
+	}
+	d.index.update(found)
+
+	updated := *found
+	return &updated, nil
+}
+
+// SetURLMetadata saves the metadata of the destination page of the short URL.
+func (d *DBMaps) SetURLMetadata(_ context.Context, shortURL, origURL string, meta *model.LinkMetadata) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	_, err := setURLMetadata(d.hash[shortURL], origURL, meta)
+	return err
+}
+
+// URLsToCheck returns no more than limit links whose destinations are not checked since the time.
+func (d *DBMaps) URLsToCheck(_ context.Context, before time.Time, limit int) (urlRows []*model.URLRow, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return urlsToCheck(d.hash, before, limit), nil
+}
+
+// SaveURLCheck saves the result of the check of the row.
+func (d *DBMaps) SaveURLCheck(_ context.Context, row *model.URLRow, check *model.LinkCheck) (saved bool, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return setURLCheck(d.hash[row.Key()], row, check)
+}
+
+// WriteDeleteTask saves the deletion task in the outbox and sets its ID.
+//
+// The outbox of RAM storage lives as long as the process.
+func (d *DBMaps) WriteDeleteTask(_ context.Context, task *model.DeleteTask) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.lastTaskID++
+	task.ID = d.lastTaskID
+	task.Status = model.DeleteTaskPending
+
+	saved := *task
+	d.tasks[task.ID] = &saved
+
+	return nil
+}
+
+// PendingDeleteTasks returns the outbox deletion tasks that are not completed yet.
+func (d *DBMaps) PendingDeleteTasks(_ context.Context) (tasks []*model.DeleteTask, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	tasks = make([]*model.DeleteTask, 0, len(d.tasks))
+	for _, task := range d.tasks {
+		found := *task
+		tasks = append(tasks, &found)
+	}
+	sortDeleteTasks(tasks)
+
+	return tasks, nil
+}
+
+// CompleteDeleteTasks sets the final status (done or dead) for the outbox deletion tasks.
+//
+// RAM storage keeps no history, the completed tasks are removed (the outbox holds the pending tasks only).
+func (d *DBMaps) CompleteDeleteTasks(_ context.Context, _ string, ids ...int64) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, id := range ids {
+		delete(d.tasks, id)
 	}
 
 	return nil
 }
 
-// Stats returns count of URLs.
-func (d *DBMaps) Stats(_ context.Context) (int, error) {
+// WriteShortenJob saves the new shortening job with its lines and sets its ID.
+//
+// The jobs of RAM storage live as long as the process (or until they are removed by the retention).
+func (d *DBMaps) WriteShortenJob(_ context.Context, job *model.ShortenJob) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.lastJobID++
+	job.ID = d.lastJobID
+	job.Status = model.ShortenJobQueued
+
+	saved := *job
+	saved.Lines = make([]model.ShortenJobLine, len(job.Lines))
+	copy(saved.Lines, job.Lines)
+	d.jobs[job.ID] = &saved
+
+	return nil
+}
+
+// ShortenJob returns the shortening job without the lines.
+func (d *DBMaps) ShortenJob(_ context.Context, id int64) (job *model.ShortenJob, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	found, ok := d.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w", ErrNotFound)
+	}
+	return copyShortenJob(found), nil
+}
+
+// ShortenJobLines returns no more than limit lines of the shortening job from the position.
+func (d *DBMaps) ShortenJobLines(_ context.Context, id int64, from, limit int) (lines []model.ShortenJobLine, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	found, ok := d.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("%w", ErrNotFound)
+	}
+	return shortenJobLines(found, from, limit), nil
+}
+
+// UpdateShortenJob saves the progress of the shortening job and the results of the processed lines.
+func (d *DBMaps) UpdateShortenJob(_ context.Context, job *model.ShortenJob) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	found, ok := d.jobs[job.ID]
+	if !ok {
+		return fmt.Errorf("%w", ErrNotFound)
+	}
+	applyShortenJob(found, job)
+	return nil
+}
+
+// PendingShortenJobs returns the IDs of the shortening jobs that are not finished yet.
+func (d *DBMaps) PendingShortenJobs(_ context.Context) (ids []int64, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return pendingShortenJobs(d.jobs), nil
+}
+
+// DeleteShortenJobs removes the finished shortening jobs (with their lines) updated before the time.
+func (d *DBMaps) DeleteShortenJobs(_ context.Context, before time.Time) (deleted int, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, id := range expiredShortenJobs(d.jobs, before) {
+		delete(d.jobs, id)
+		deleted++
+	}
+	return deleted, nil
+}
+
+// WriteWebhook saves the new webhook of the user and sets its ID.
+func (d *DBMaps) WriteWebhook(_ context.Context, hook *model.Webhook) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.lastWebhookID++
+	hook.ID = d.lastWebhookID
+	d.webhooks[hook.ID] = copyWebhook(hook)
+
+	return nil
+}
+
+// UserWebhooks returns the webhooks of the user.
+func (d *DBMaps) UserWebhooks(_ context.Context, userID int64) (hooks []*model.Webhook, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return userWebhooks(d.webhooks, userID), nil
+}
+
+// DeleteWebhook deletes the webhook of the user with its deliveries.
+func (d *DBMaps) DeleteWebhook(_ context.Context, userID, id int64) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if hook, ok := d.webhooks[id]; !ok || hook.UserID != userID {
+		return fmt.Errorf("%w", ErrNotFound)
+	}
+	delete(d.webhooks, id)
+	pruneWebhookDeliveries(d.deliveries, id, true)
+
+	return nil
+}
+
+// WriteWebhookDeliveries saves the new deliveries and sets their IDs.
+func (d *DBMaps) WriteWebhookDeliveries(_ context.Context, deliveries []*model.WebhookDelivery) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, delivery := range deliveries {
+		d.lastDeliveryID++
+		delivery.ID = d.lastDeliveryID
+		saved := *delivery
+		d.deliveries[delivery.ID] = &saved
+	}
+
+	return nil
+}
+
+// UpdateWebhookDelivery saves the result of the delivery attempt.
+func (d *DBMaps) UpdateWebhookDelivery(_ context.Context, delivery *model.WebhookDelivery) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.deliveries[delivery.ID]; !ok {
+		return fmt.Errorf("%w", ErrNotFound)
+	}
+	saved := *delivery
+	d.deliveries[delivery.ID] = &saved
+	if saved.Status != model.WebhookDeliveryPending {
+		pruneWebhookDeliveries(d.deliveries, saved.WebhookID, false)
+	}
+
+	return nil
+}
+
+// PendingWebhookDeliveries returns no more than limit pending deliveries to try before the time.
+func (d *DBMaps) PendingWebhookDeliveries(_ context.Context, before time.Time, limit int) (deliveries []*model.WebhookDelivery, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return pendingWebhookDeliveries(d.deliveries, before, limit), nil
+}
+
+// WebhookDeliveries returns no more than limit last deliveries of the user webhook.
+func (d *DBMaps) WebhookDeliveries(_ context.Context, userID, id int64, limit int) (deliveries []*model.WebhookDelivery, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	if hook, ok := d.webhooks[id]; !ok || hook.UserID != userID {
+		return nil, fmt.Errorf("%w", ErrNotFound)
+	}
+	return webhookDeliveries(d.deliveries, id, limit), nil
+}
+
+// WriteBusEvents saves the link events in the outbox of the event bus and sets their IDs.
+func (d *DBMaps) WriteBusEvents(_ context.Context, events []*model.BusEvent) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.applyClicks()
+	for _, event := range events {
+		saved := *event
+		d.appendBusEvent(&saved)
+		event.ID = saved.ID
+	}
+
+	return nil
+}
+
+// PendingBusEvents returns no more than limit outbox events that are not published yet.
+func (d *DBMaps) PendingBusEvents(_ context.Context, limit int) (events []*model.BusEvent, err error) {
+	d.flushClicks()
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return pendingBusEvents(d.busEvents, limit), nil
+}
+
+// CompleteBusEvents removes the published events from the outbox.
+func (d *DBMaps) CompleteBusEvents(_ context.Context, ids ...int64) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.busEvents = completeBusEvents(d.busEvents, ids)
+
+	return nil
+}
+
+// LeaseBusRelay takes the lease of the outbox relay.
+//
+// The outbox of RAM storage is not shared with other instances, so the lease is always taken.
+func (d *DBMaps) LeaseBusRelay(_ context.Context, _ string, _ time.Duration) (leased bool, err error) {
+	return true, nil
+}
+
+// writeBusEvent saves the event of the link in the outbox if the event bus is enabled
+// (the caller holds the lock).
+func (d *DBMaps) writeBusEvent(eventType string, row *model.URLRow) {
+	// the visits counted before go first, so the events keep their order
+	d.applyClicks()
+	if !busEnabled() {
+		return
+	}
+	d.appendBusEvent(newBusEvent(eventType, row))
+}
+
+// appendBusEvent sets the ID of the event and appends it to the outbox (the caller holds the lock).
+func (d *DBMaps) appendBusEvent(event *model.BusEvent) {
+	d.lastBusEventID++
+	event.ID = d.lastBusEventID
+	d.busEvents = append(d.busEvents, event)
+}
+
+// applyClicks applies the visits counted under the read lock to the rows and saves their events
+// (the caller holds the lock).
+func (d *DBMaps) applyClicks() {
+	events, _ := d.clicks.apply()
+	for _, event := range events {
+		d.appendBusEvent(event)
+	}
+}
+
+// flushClicks applies the visits counted under the read lock (see clickCounter).
+func (d *DBMaps) flushClicks() {
+	if !d.clicks.pending() {
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.applyClicks()
+}
+
+// MigrateOrigURLs rewrites the original URLs of the existing rows with the migrate function.
+func (d *DBMaps) MigrateOrigURLs(_ context.Context, migrate func(origURL string) (string, error)) (*model.URLMigration, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	rows := make([]*model.URLRow, 0, len(d.hash))
+	for _, row := range d.hash {
+		rows = append(rows, row)
+	}
+
+	res := migrateRows(rows, d.urls, migrate)
+	d.index.update(rows...)
+
+	return res, nil
+}
+
+// Stats returns count of URLs by domain.
+func (d *DBMaps) Stats(_ context.Context) (domains map[string]int, err error) {
 	d.mutex.RLock()
 	defer d.mutex.RUnlock()
 
-	return len(d.urls), nil
+	return domainStats(d.hash), nil
 }
 
 // Write is for testing usage
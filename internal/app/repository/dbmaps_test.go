@@ -2,10 +2,15 @@ package repository
 
 import (
 	"context"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/zasuchilas/shortener/internal/app/config"
 	"github.com/zasuchilas/shortener/internal/app/model"
 )
 
@@ -52,7 +57,7 @@ func TestDBMaps_WriteURL(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			shortURL, conflict, err := s.WriteURL(context.TODO(), tt.origURL, tt.userID)
+			shortURL, conflict, err := s.WriteURL(context.TODO(), "", tt.origURL, tt.userID)
 
 			assert.Equal(t, tt.shortURL, shortURL)
 			assert.Equal(t, tt.conflict, conflict)
@@ -71,14 +76,15 @@ func TestDBMaps_ReadURL(t *testing.T) {
 	// creating URL row
 	_, _, _ = s.WriteURL(
 		context.TODO(),
+		"",
 		"https://ya.ru",
 		1,
 	)
 
 	//
-	origURL, err := s.ReadURL(context.TODO(), "19xtf1ts")
+	row, err := s.ReadURL(context.TODO(), "19xtf1ts")
 	assert.NoError(t, err)
-	assert.Equal(t, "https://ya.ru", origURL)
+	assert.Equal(t, "https://ya.ru", row.OrigURL)
 }
 
 func TestDBMaps_UserURLs(t *testing.T) {
@@ -101,7 +107,7 @@ func TestDBMaps_UserURLs(t *testing.T) {
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			actual, err := s.UserURLs(context.TODO(), tt.userID)
+			actual, _, err := s.UserURLs(context.TODO(), tt.userID, model.UserURLsQuery{})
 
 			assert.Equal(t, tt.expectedURLs, actual)
 			assert.Error(t, tt.expectedErr, err)
@@ -160,3 +166,518 @@ func TestDBMaps_DeleteURLs(t *testing.T) {
 		})
 	}
 }
+
+func TestDBMaps_DeleteTasks(t *testing.T) {
+	s := NewDBMaps()
+
+	task := &model.DeleteTask{UserID: 1, ShortURLs: []string{"19xtf1ts"}}
+	assert.NoError(t, s.WriteDeleteTask(context.TODO(), task))
+	assert.Equal(t, int64(1), task.ID)
+	assert.Equal(t, model.DeleteTaskPending, task.Status)
+
+	pending, err := s.PendingDeleteTasks(context.TODO())
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, []string{"19xtf1ts"}, pending[0].ShortURLs)
+
+	dead := &model.DeleteTask{UserID: 1, ShortURLs: []string{"2bxtf1ts"}}
+	assert.NoError(t, s.WriteDeleteTask(context.TODO(), dead))
+
+	assert.NoError(t, s.CompleteDeleteTasks(context.TODO(), model.DeleteTaskDone, task.ID))
+	assert.NoError(t, s.CompleteDeleteTasks(context.TODO(), model.DeleteTaskDead, dead.ID))
+	pending, err = s.PendingDeleteTasks(context.TODO())
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// the completed tasks are not returned again, the repeated completion is not an error
+	assert.NoError(t, s.CompleteDeleteTasks(context.TODO(), model.DeleteTaskDone, task.ID, dead.ID))
+	next := &model.DeleteTask{UserID: 1, ShortURLs: []string{"3cxtf1ts"}}
+	assert.NoError(t, s.WriteDeleteTask(context.TODO(), next))
+	pending, err = s.PendingDeleteTasks(context.TODO())
+	assert.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, next.ID, pending[0].ID)
+	assert.Equal(t, model.DeleteTaskPending, pending[0].Status)
+}
+
+func TestDBMaps_MigrateOrigURLs(t *testing.T) {
+	s := NewDBMaps()
+	first, _, _ := s.WriteURL(context.TODO(), "", "HTTPS://YA.RU", 1)
+	second, _, _ := s.WriteURL(context.TODO(), "", "https://ya.ru/", 1)
+	third, _, _ := s.WriteURL(context.TODO(), "", "https://Example.com", 1)
+
+	res, err := s.MigrateOrigURLs(context.TODO(), func(origURL string) (string, error) {
+		return strings.ToLower(strings.TrimSuffix(origURL, "/")), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &model.URLMigration{Checked: 3, Updated: 2, Conflicts: 1}, res)
+
+	// the first row owns the canonical URL, the duplicate is kept as it is
+	row, err := s.ReadURL(context.TODO(), first)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://ya.ru", row.OrigURL)
+	row, err = s.ReadURL(context.TODO(), second)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://ya.ru/", row.OrigURL)
+	row, err = s.ReadURL(context.TODO(), third)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com", row.OrigURL)
+
+	// the canonical URL is found by the new writes
+	shortURL, conflict, err := s.WriteURL(context.TODO(), "", "https://example.com", 2)
+	assert.NoError(t, err)
+	assert.True(t, conflict)
+	assert.Equal(t, third, shortURL)
+}
+
+func TestDBMaps_DedupUser(t *testing.T) {
+	config.DedupMode = DedupUser
+	defer func() { config.DedupMode = "" }()
+	s := NewDBMaps()
+
+	first, conflict, err := s.WriteURL(context.TODO(), "", "https://ya.ru", 1)
+	assert.NoError(t, err)
+	assert.False(t, conflict)
+
+	// the other user gets own short URL
+	second, conflict, err := s.WriteURL(context.TODO(), "", "https://ya.ru", 2)
+	assert.NoError(t, err)
+	assert.False(t, conflict)
+	assert.NotEqual(t, first, second)
+
+	// the same user gets the conflict
+	repeated, conflict, err := s.WriteURL(context.TODO(), "", "https://ya.ru", 2)
+	assert.NoError(t, err)
+	assert.True(t, conflict)
+	assert.Equal(t, second, repeated)
+
+	urlRows, err := s.WriteURLs(context.TODO(), "", []string{"https://ya.ru"}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, first, urlRows["https://ya.ru"].ShortURL)
+
+	// every user deletes own short URL only
+	assert.NoError(t, s.CheckDeletedURLs(context.TODO(), 2, []string{second}))
+	assert.ErrorIs(t, s.CheckDeletedURLs(context.TODO(), 2, []string{first}), ErrBadRequest)
+
+	domains, err := s.Stats(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"": 2}, domains)
+}
+
+func TestDBMaps_UpdateURL(t *testing.T) {
+	s := NewDBMaps()
+	shortURL, _, _ := s.WriteURL(context.TODO(), "", "https://ya.ru", 1)
+	other, _, _ := s.WriteURL(context.TODO(), "", "https://google.com", 2)
+
+	tests := []struct {
+		name     string
+		userID   int64
+		shortURL string
+		origURL  string
+		err      error
+	}{
+		{name: "unknown short url", userID: 1, shortURL: "19xtf1ua", origURL: "https://yandex.ru", err: ErrNotFound},
+		{name: "other people's short url", userID: 1, shortURL: other, origURL: "https://yandex.ru", err: ErrForbidden},
+		{name: "existing destination", userID: 1, shortURL: shortURL, origURL: "https://google.com", err: ErrConflict},
+		{name: "valid update", userID: 1, shortURL: shortURL, origURL: "https://yandex.ru"},
+		{name: "the same destination", userID: 1, shortURL: shortURL, origURL: "https://yandex.ru"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.UpdateURL(context.TODO(), tt.userID, tt.shortURL, tt.origURL)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	row, err := s.ReadURL(context.TODO(), shortURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://yandex.ru", row.OrigURL)
+
+	// the new destination is deduplicated, the old one is free
+	found, conflict, _ := s.WriteURL(context.TODO(), "", "https://yandex.ru", 2)
+	assert.True(t, conflict)
+	assert.Equal(t, shortURL, found)
+	_, conflict, _ = s.WriteURL(context.TODO(), "", "https://ya.ru", 2)
+	assert.False(t, conflict)
+
+	revisions, err := s.URLRevisions(context.TODO(), 1, shortURL)
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 1)
+	assert.Equal(t, int64(1), revisions[0].Revision)
+	assert.Equal(t, "https://ya.ru", revisions[0].PrevURL)
+	assert.Equal(t, "https://yandex.ru", revisions[0].OrigURL)
+
+	_, err = s.URLRevisions(context.TODO(), 2, shortURL)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	// the deleted short url can't be changed
+	assert.NoError(t, s.DeleteURLs(context.TODO(), shortURL))
+	_, err = s.UpdateURL(context.TODO(), 1, shortURL, "https://ya.ru/about")
+	assert.ErrorIs(t, err, ErrGone)
+}
+
+func TestDBMaps_URLOptions(t *testing.T) {
+	s := NewDBMaps()
+	shortURL, _, _ := s.WriteURL(context.TODO(), "", "https://ya.ru", 1)
+
+	// the visits are counted by ReadURL only
+	for i := 0; i < 2; i++ {
+		_, err := s.ReadURL(context.TODO(), shortURL)
+		assert.NoError(t, err)
+	}
+	row, err := s.URLInfo(context.TODO(), shortURL)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), row.Clicks)
+	assert.False(t, row.Created.IsZero())
+
+	title, preview := "Yandex", true
+	row, err = s.UpdateURLOptions(context.TODO(), 1, shortURL, model.URLOptions{Title: &title, Preview: &preview})
+	assert.NoError(t, err)
+	assert.Equal(t, "Yandex", row.Title)
+	assert.True(t, row.Preview)
+
+	// the missing options are kept
+	preview = false
+	row, err = s.UpdateURLOptions(context.TODO(), 1, shortURL, model.URLOptions{Preview: &preview})
+	assert.NoError(t, err)
+	assert.Equal(t, "Yandex", row.Title)
+	assert.False(t, row.Preview)
+
+	_, err = s.UpdateURLOptions(context.TODO(), 2, shortURL, model.URLOptions{Title: &title})
+	assert.ErrorIs(t, err, ErrForbidden)
+	_, err = s.UpdateURLOptions(context.TODO(), 1, "19xtf1ua", model.URLOptions{Title: &title})
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// the returned row is the copy
+	row.Title = "changed"
+	row, _ = s.URLInfo(context.TODO(), shortURL)
+	assert.Equal(t, "Yandex", row.Title)
+
+	assert.NoError(t, s.DeleteURLs(context.TODO(), shortURL))
+	_, err = s.URLInfo(context.TODO(), shortURL)
+	assert.ErrorIs(t, err, ErrGone)
+	_, err = s.UpdateURLOptions(context.TODO(), 1, shortURL, model.URLOptions{Title: &title})
+	assert.ErrorIs(t, err, ErrGone)
+}
+
+func TestDBMaps_Search(t *testing.T) {
+	s := NewDBMaps()
+	ctx := context.TODO()
+
+	shortURLs := make([]string, 0, 3)
+	for _, origURL := range []string{"https://go.dev/doc", "https://ya.ru/search", "https://github.com/golang/go"} {
+		shortURL, _, err := s.WriteURL(ctx, "", origURL, 1)
+		require.NoError(t, err)
+		shortURLs = append(shortURLs, shortURL)
+	}
+	_, _, err := s.WriteURL(ctx, "", "https://go.dev/blog", 2)
+	require.NoError(t, err)
+
+	setOptions := func(shortURL, title, notes string, tags ...string) {
+		_, err := s.UpdateURLOptions(ctx, 1, shortURL, model.URLOptions{Title: &title, Notes: &notes, Tags: &tags})
+		require.NoError(t, err)
+	}
+	setOptions(shortURLs[0], "Go documentation", "Read it first", "go", "docs")
+	setOptions(shortURLs[1], "Yandex", "", "search")
+	setOptions(shortURLs[2], "Go sources", "Mirror of the repository", "go", "code")
+
+	search := func(q model.UserURLsQuery) []string {
+		rows, _, err := s.UserURLs(ctx, 1, q)
+		require.NoError(t, err)
+		res := make([]string, len(rows))
+		for i, row := range rows {
+			res[i] = row.ShortURL
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{shortURLs[0], shortURLs[2]}, search(model.UserURLsQuery{Tags: []string{"go"}}))
+	assert.Equal(t, []string{shortURLs[2]}, search(model.UserURLsQuery{Tags: []string{"go", "code"}}))
+	assert.Equal(t, []string{}, search(model.UserURLsQuery{Tags: []string{"unknown"}}))
+
+	// the words of the title, the notes and the destination are matched by their beginnings
+	assert.Equal(t, []string{shortURLs[0], shortURLs[2]}, search(model.UserURLsQuery{Text: "GO"}))
+	assert.Equal(t, []string{shortURLs[2]}, search(model.UserURLsQuery{Text: "go repo"}))
+	assert.Equal(t, []string{shortURLs[1]}, search(model.UserURLsQuery{Text: "ya.ru"}))
+	assert.Equal(t, []string{shortURLs[0]}, search(model.UserURLsQuery{Text: "first", Tags: []string{"docs"}}))
+	assert.Equal(t, []string{}, search(model.UserURLsQuery{Text: "blog"})) // of the other user
+
+	// the changed rows are indexed again
+	assert.Equal(t, []string{}, search(model.UserURLsQuery{Text: "mail"}))
+	empty := []string{}
+	_, err = s.UpdateURLOptions(ctx, 1, shortURLs[0], model.URLOptions{Tags: &empty})
+	require.NoError(t, err)
+	_, err = s.UpdateURL(ctx, 1, shortURLs[1], "https://mail.ru/search")
+	require.NoError(t, err)
+	assert.Equal(t, []string{shortURLs[2]}, search(model.UserURLsQuery{Tags: []string{"go"}}))
+	assert.Equal(t, []string{shortURLs[1]}, search(model.UserURLsQuery{Text: "yandex mail"}))
+}
+
+func TestDBMaps_Expiry(t *testing.T) {
+	s := NewDBMaps()
+	shortURL, _, _ := s.WriteURL(context.TODO(), "", "https://ya.ru", 1)
+
+	expiresAt := time.Now().Add(-time.Second)
+	_, err := s.UpdateURLOptions(context.TODO(), 1, shortURL, model.URLOptions{ExpiresAt: &expiresAt})
+	assert.NoError(t, err)
+
+	// the expired link is gone and its visits are not counted
+	_, err = s.ReadURL(context.TODO(), shortURL)
+	assert.ErrorIs(t, err, ErrGone)
+	_, err = s.URLInfo(context.TODO(), shortURL)
+	assert.ErrorIs(t, err, ErrGone)
+
+	// the owner can prolong the link
+	expiresAt = time.Time{}
+	_, err = s.UpdateURLOptions(context.TODO(), 1, shortURL, model.URLOptions{ExpiresAt: &expiresAt})
+	assert.NoError(t, err)
+	row, err := s.ReadURL(context.TODO(), shortURL)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), row.Clicks)
+}
+
+func TestDBMaps_UserURLsPage(t *testing.T) {
+	s := NewDBMaps()
+	ctx := context.TODO()
+	start := time.Now()
+
+	shortURLs := make([]string, 0, 5)
+	for _, origURL := range []string{"https://ya.ru/1", "https://mail.ya.ru/2", "https://go.dev/3", "go.dev/4", "https://YA.RU:8080/5"} {
+		shortURL, _, err := s.WriteURL(ctx, "", origURL, 1)
+		require.NoError(t, err)
+		shortURLs = append(shortURLs, shortURL)
+	}
+	for i := 0; i < 3; i++ {
+		_, _ = s.ReadURL(ctx, shortURLs[2])
+	}
+	_, _ = s.ReadURL(ctx, shortURLs[0])
+	require.NoError(t, s.DeleteURLs(ctx, shortURLs[1]))
+
+	pages := func(q model.UserURLsQuery) [][]string {
+		res := make([][]string, 0)
+		for {
+			rows, next, err := s.UserURLs(ctx, 1, q)
+			require.NoError(t, err)
+			page := make([]string, len(rows))
+			for i, row := range rows {
+				page[i] = row.ShortURL
+			}
+			res = append(res, page)
+			if next == "" {
+				return res
+			}
+			q.Cursor = next
+		}
+	}
+
+	// by the creation time
+	assert.Equal(t, [][]string{shortURLs[:2], shortURLs[2:4], shortURLs[4:]}, pages(model.UserURLsQuery{Limit: 2}))
+	assert.Equal(t, [][]string{{shortURLs[4], shortURLs[3], shortURLs[2]}, {shortURLs[1], shortURLs[0]}},
+		pages(model.UserURLsQuery{Desc: true, Limit: 3}))
+
+	// by the clicks, the ID is the tie-breaker
+	assert.Equal(t, [][]string{{shortURLs[2], shortURLs[0]}, {shortURLs[4], shortURLs[3]}, {shortURLs[1]}},
+		pages(model.UserURLsQuery{Sort: model.UserURLsSortClicks, Desc: true, Limit: 2}))
+
+	// filters
+	assert.Equal(t, [][]string{{shortURLs[0], shortURLs[4]}},
+		pages(model.UserURLsQuery{Status: model.URLStatusActive, Domain: "Ya.ru"}))
+	assert.Equal(t, [][]string{{shortURLs[1]}}, pages(model.UserURLsQuery{Status: model.URLStatusDeleted}))
+	assert.Equal(t, [][]string{{shortURLs[2], shortURLs[3]}}, pages(model.UserURLsQuery{Domain: "go.dev"}))
+	assert.Equal(t, [][]string{{}}, pages(model.UserURLsQuery{CreatedFrom: time.Now().Add(time.Minute)}))
+	assert.Len(t, pages(model.UserURLsQuery{CreatedFrom: start, CreatedTo: time.Now().Add(time.Minute)})[0], 5)
+
+	// the cursor of another order is wrong
+	_, next, err := s.UserURLs(ctx, 1, model.UserURLsQuery{Limit: 1})
+	require.NoError(t, err)
+	_, _, err = s.UserURLs(ctx, 1, model.UserURLsQuery{Sort: model.UserURLsSortClicks, Cursor: next})
+	assert.ErrorIs(t, err, ErrBadRequest)
+	_, _, err = s.UserURLs(ctx, 1, model.UserURLsQuery{Cursor: "wrong"})
+	assert.ErrorIs(t, err, ErrBadRequest)
+}
+
+func TestDBMaps_Domains(t *testing.T) {
+	s := NewDBMaps()
+	ctx := context.TODO()
+
+	// the same code on the different domains
+	shortURL, conflict, err := s.WriteURL(ctx, "", "https://ya.ru", 1)
+	require.NoError(t, err)
+	assert.False(t, conflict)
+	assert.Equal(t, "19xtf1ts", shortURL)
+	shortURL, conflict, err = s.WriteURL(ctx, "go.example.com", "https://ya.ru", 1)
+	require.NoError(t, err)
+	assert.False(t, conflict)
+	assert.Equal(t, "go.example.com/19xtf1ts", shortURL)
+
+	// the original URL is deduplicated within the domain
+	shortURL, conflict, err = s.WriteURL(ctx, "go.example.com", "https://ya.ru", 1)
+	require.NoError(t, err)
+	assert.True(t, conflict)
+	assert.Equal(t, "go.example.com/19xtf1ts", shortURL)
+
+	row, err := s.ReadURL(ctx, "go.example.com/19xtf1ts")
+	require.NoError(t, err)
+	assert.Equal(t, "go.example.com", row.Domain)
+	assert.Equal(t, "19xtf1ts", row.ShortURL)
+	_, err = s.ReadURL(ctx, "links.example.org/19xtf1ts")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	rows, _, err := s.UserURLs(ctx, 1, model.UserURLsQuery{LinkDomains: []string{"go.example.com"}})
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, "go.example.com", rows[0].Domain)
+
+	domains, err := s.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"": 1, "go.example.com": 1}, domains)
+}
+
+func TestDBMaps_BusEvents(t *testing.T) {
+	ctx := context.TODO()
+
+	// the outbox is not written without the event bus
+	s := NewDBMaps()
+	_, _, err := s.WriteURL(ctx, "", "https://ya.ru", 1)
+	require.NoError(t, err)
+	events, err := s.PendingBusEvents(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	config.EventBus = "kafka"
+	t.Cleanup(func() { config.EventBus = "" })
+
+	s = NewDBMaps()
+	shortURL, _, err := s.WriteURL(ctx, "", "https://ya.ru", 1)
+	require.NoError(t, err)
+	_, _, err = s.WriteURL(ctx, "", "https://ya.ru", 1) // conflict
+	require.NoError(t, err)
+	_, err = s.ReadURL(ctx, shortURL)
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteURLs(ctx, shortURL))
+	require.NoError(t, s.DeleteURLs(ctx, shortURL)) // already deleted
+	_, err = s.ReadURL(ctx, shortURL)
+	assert.ErrorIs(t, err, ErrGone)
+
+	// the events of the link are in the order of the changes
+	events, err = s.PendingBusEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	for i, eventType := range []string{model.EventLinkCreated, model.EventLinkClicked, model.EventLinkDeleted} {
+		assert.Equal(t, int64(i+1), events[i].ID)
+		assert.Equal(t, eventType, events[i].Type)
+		assert.Equal(t, shortURL, events[i].ShortURL)
+		assert.Equal(t, "https://ya.ru", events[i].OrigURL)
+		assert.Equal(t, int64(1), events[i].UserID)
+	}
+
+	require.NoError(t, s.CompleteBusEvents(ctx, events[0].ID, events[1].ID))
+	events, err = s.PendingBusEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, model.EventLinkDeleted, events[0].Type)
+}
+
+func TestDBMaps_ReadURL_clicks(t *testing.T) {
+	ctx := context.TODO()
+	config.EventBus = "kafka"
+	t.Cleanup(func() { config.EventBus = "" })
+
+	s := NewDBMaps()
+	shortURL, _, err := s.WriteURL(ctx, "", "https://ya.ru", 1)
+	require.NoError(t, err)
+
+	// the visits are counted under the read lock, the pending ones are returned with the row
+	row, err := s.ReadURL(ctx, shortURL)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), row.Clicks)
+	row, err = s.ReadURL(ctx, shortURL)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), row.Clicks)
+
+	// more than the batch, the batches are applied while the others are counted
+	const workers, reads = 4, ClicksBatch
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range reads {
+				_, e := s.ReadURL(ctx, shortURL)
+				assert.NoError(t, e)
+			}
+		}()
+	}
+	wg.Wait()
+
+	const total = workers*reads + 2
+	row, err = s.URLInfo(ctx, shortURL)
+	require.NoError(t, err)
+	assert.Equal(t, int64(total), row.Clicks)
+
+	events, err := s.PendingBusEvents(ctx, total+10)
+	require.NoError(t, err)
+	require.Len(t, events, total+1)
+	assert.Equal(t, model.EventLinkCreated, events[0].Type)
+	for _, event := range events[1:] {
+		assert.Equal(t, model.EventLinkClicked, event.Type)
+	}
+}
+
+func TestDBMaps_URLChecks(t *testing.T) {
+	ctx := context.TODO()
+	s := NewDBMaps()
+
+	first, _, err := s.WriteURL(ctx, "", "https://ya.ru", 1)
+	require.NoError(t, err)
+	second, _, err := s.WriteURL(ctx, "", "https://go.dev", 1)
+	require.NoError(t, err)
+	deleted, _, err := s.WriteURL(ctx, "", "https://example.com", 1)
+	require.NoError(t, err)
+	require.NoError(t, s.DeleteURLs(ctx, deleted))
+
+	// the links that are never checked are due, the deleted ones are not
+	now := time.Now()
+	rows, err := s.URLsToCheck(ctx, now, 10)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, first, rows[0].ShortURL)
+	assert.Equal(t, second, rows[1].ShortURL)
+
+	broken := &model.LinkCheck{Checked: now, Status: 404, Failures: 2, Broken: true}
+	saved, err := s.SaveURLCheck(ctx, rows[0], broken)
+	require.NoError(t, err)
+	assert.True(t, saved)
+
+	// the row is checked by another instance since it was read
+	saved, err = s.SaveURLCheck(ctx, rows[0], &model.LinkCheck{Checked: now.Add(time.Second)})
+	require.NoError(t, err)
+	assert.False(t, saved)
+	_, err = s.SaveURLCheck(ctx, &model.URLRow{ShortURL: "unknown"}, broken)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// the checked link is due after the interval, the never checked one goes first
+	rows, err = s.URLsToCheck(ctx, now, 10)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, second, rows[0].ShortURL)
+	rows, err = s.URLsToCheck(ctx, now.Add(time.Hour), 1)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, second, rows[0].ShortURL)
+
+	// the broken links are listed by the query
+	brokenRows, _, err := s.UserURLs(ctx, 1, model.UserURLsQuery{Broken: true, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, brokenRows, 1)
+	assert.Equal(t, first, brokenRows[0].ShortURL)
+	require.NotNil(t, brokenRows[0].Check)
+	assert.Equal(t, 404, brokenRows[0].Check.Status)
+
+	// the check of the previous destination is dropped
+	_, err = s.UpdateURL(ctx, 1, first, "https://ya.ru/search")
+	require.NoError(t, err)
+	brokenRows, _, err = s.UserURLs(ctx, 1, model.UserURLsQuery{Broken: true, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, brokenRows)
+}
@@ -5,9 +5,11 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgtype"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"go.uber.org/zap"
 
@@ -21,6 +23,12 @@ var (
 	_ IStorage = (*DBPgsql)(nil)
 )
 
+// ShortenJobWriteTimeout is the deadline for writing the new shortening job with all its lines.
+const ShortenJobWriteTimeout = 30 * time.Second
+
+// IndexBuildTimeout is the deadline for building one index of the existing table at the start.
+const IndexBuildTimeout = 10 * time.Minute
+
 // DBPgsql is a postgresql storage implementation.
 type DBPgsql struct {
 	db *sql.DB
@@ -36,6 +44,8 @@ func NewDBPgsql() *DBPgsql {
 
 	logger.Log.Debug("creating db tables if need")
 	createTablesIfNeed(pg) // TODO: constant table creation rows can be migrated
+	logger.Log.Debug("creating db indexes if need")
+	createIndexesIfNeed(pg)
 
 	db := &DBPgsql{
 		db: pg,
@@ -57,44 +67,69 @@ func (d *DBPgsql) InstanceName() string {
 }
 
 // WriteURL writes URL in the storage.
-func (d *DBPgsql) WriteURL(ctx context.Context, origURL string, userID int64) (shortURL string, conflict bool, err error) {
+func (d *DBPgsql) WriteURL(ctx context.Context, domain, origURL string, userID int64) (shortURL string, conflict bool, err error) {
 
 	logger.Log.Debug("checking if already exist")
-	found, ex, err := findByOrig(ctx, d.db, origURL)
+	found, ex, err := findByOrig(ctx, d.db, domain, origURL, userID)
 	if err != nil {
 		return "", false, err
 	}
 	if ex {
-		return found.ShortURL, true, nil
+		return found.Key(), true, nil
 	}
 
 	logger.Log.Debug("writing URL")
-	urlRows, err := d.WriteURLs(ctx, []string{origURL}, userID)
+	urlRows, err := d.WriteURLs(ctx, domain, []string{origURL}, userID)
 	if err != nil {
 		return "", false, err
 	}
 	if urlRows == nil || urlRows[origURL] == nil {
 		return "", false, errors.New("something wrong with writing URL")
 	}
-	return urlRows[origURL].ShortURL, false, nil
+	return urlRows[origURL].Key(), false, nil
+}
+
+// ReadURL reads the row of the short URL from the storage and counts the visit.
+//
+// The clicked event is saved in the outbox with the visit in one statement.
+func (d *DBPgsql) ReadURL(ctx context.Context, shortURL string) (row *model.URLRow, err error) {
+	domain, code := model.SplitLinkKey(shortURL)
+	row, err = scanURLRow(d.db.QueryRowContext(ctx,
+		"WITH hit AS (UPDATE urls SET clicks = clicks + 1 "+
+			"WHERE domain = $4 AND short = $1 AND NOT deleted AND (expires_at IS NULL OR expires_at > now()) "+
+			"RETURNING "+urlRowColumns+"), "+
+			"event AS (INSERT INTO link_events (type, user_id, domain, short, original) "+
+			"SELECT $2, user_id, domain, short, original FROM hit WHERE $3) "+
+			"SELECT "+urlRowColumns+" FROM hit",
+		code, model.EventLinkClicked, busEnabled(), domain))
+	if !errors.Is(err, sql.ErrNoRows) {
+		return row, err
+	}
+
+	// the short URL is not found, deleted or expired
+	return d.URLInfo(ctx, shortURL)
 }
 
-// ReadURL reads URL from the storage.
-func (d *DBPgsql) ReadURL(ctx context.Context, shortURL string) (origURL string, err error) {
+// URLInfo reads the row of the short URL from the storage (the visit is not counted).
+func (d *DBPgsql) URLInfo(ctx context.Context, shortURL string) (row *model.URLRow, err error) {
 	found, ex, err := findByShort(ctx, d.db, shortURL)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if !ex {
-		return "", fmt.Errorf("%w", ErrNotFound)
+		return nil, fmt.Errorf("%w", ErrNotFound)
 	}
 
 	if found.Deleted {
-		return "", fmt.Errorf("%w", ErrGone)
+		return nil, fmt.Errorf("%w", ErrGone)
 	}
 
-	return found.OrigURL, nil
+	if isExpired(found) {
+		return nil, &ExpiredError{Row: found}
+	}
+
+	return found, nil
 }
 
 // Ping pings the storage.
@@ -102,9 +137,18 @@ func (d *DBPgsql) Ping(ctx context.Context) error {
 	return d.db.PingContext(ctx)
 }
 
+// HealthCheck checks that the storage is able to serve requests.
+func (d *DBPgsql) HealthCheck(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
 // WriteURLs writes URLs in the storage.
+//
+// The created events are saved in the outbox in the same transaction.
+// The code sequence of the additional domain is locked by the transaction, so its codes go without gaps.
 func (d *DBPgsql) WriteURLs(
 	ctx context.Context,
+	domain string,
 	origURLs []string,
 	userID int64,
 ) (urlRows map[string]*model.URLRow, err error) {
@@ -122,16 +166,26 @@ func (d *DBPgsql) WriteURLs(
 	// INSERT INTO urls (uuid, short, original) VALUES ($1, $2, $3) ... so SERIAL will break
 	// INSERT INTO urls (short, original) VALUES ($1, $2) ON CONFLICT DO NOTHING ... so urls_uuid_seq will break
 	// IT IS NECESSARY: if origURL already exists, do nothing (including not changing the urls_uuid_set counter)
+	// (in the user deduplication mode only the rows of the same user are checked, $6 is 0 in the global mode;
+	// the original URL is deduplicated on the domain $7)
 	stmt, err := tx.PrepareContext(ctxTm,
-		"INSERT INTO urls (short, original, user_id) "+
-			"SELECT $1, $2, $4 "+
-			"WHERE NOT EXISTS (SELECT 1 FROM urls WHERE original = $3)")
+		"INSERT INTO urls (short, original, user_id, dedup_user_id, domain) "+
+			"SELECT $1, $2, $4, $5, $7 "+
+			"WHERE NOT EXISTS (SELECT 1 FROM urls WHERE domain = $7 AND original = $3 AND ($6 = 0 OR user_id = $6))")
 	if err != nil {
-		logger.Log.Error("preparing stmt", zap.Error(err))
+		logger.FromContext(ctx).Error("preparing stmt", zap.Error(err))
 		return nil, err
 	}
 	defer stmt.Close()
 
+	eventStmt, err := tx.PrepareContext(ctxTm,
+		"INSERT INTO link_events (type, user_id, domain, short, original) VALUES ($1, $2, $3, $4, $5)")
+	if err != nil {
+		logger.FromContext(ctx).Error("preparing stmt", zap.Error(err))
+		return nil, err
+	}
+	defer eventStmt.Close()
+
 loop:
 	for _, origURL := range origURLs {
 		select {
@@ -143,17 +197,42 @@ loop:
 			var nextID int64
 			nextID, err = getNextUUID(ctx, tx)
 			if err != nil {
-				logger.Log.Error("getting next id", zap.Error(err))
+				logger.FromContext(ctx).Error("getting next id", zap.Error(err))
 				break loop
 			}
 			shortURLCandidate := hashfuncs.EncodeZeroHash(nextID)
-			logger.Log.Info("got next shortURL candidate & next id",
+			if domain != "" {
+				var code int64
+				if code, err = nextDomainCode(ctx, tx, domain, 1); err != nil {
+					logger.FromContext(ctx).Error("getting next domain code", zap.Error(err))
+					break loop
+				}
+				shortURLCandidate = hashfuncs.EncodeZeroHash(code)
+			}
+			logger.FromContext(ctx).Info("got next shortURL candidate & next id",
 				zap.String("shortURLCandidate", shortURLCandidate), zap.Int64("id", nextID))
 
 			logger.Log.Debug("executing stmt")
-			_, err = stmt.ExecContext(ctx, shortURLCandidate, origURL, origURL, userID)
+			var res sql.Result
+			res, err = stmt.ExecContext(ctx, shortURLCandidate, origURL, origURL, userID, dedupUserID(userID), dedupUserID(userID), domain)
+			if err != nil {
+				logger.FromContext(ctx).Error("executing stmt", zap.Error(err))
+				break loop
+			}
+
+			count, e := res.RowsAffected()
+			if e == nil && count == 0 && domain != "" {
+				// the code of the existing original URL is returned to the sequence
+				if _, err = nextDomainCode(ctx, tx, domain, -1); err != nil {
+					break loop
+				}
+			}
+			if e != nil || count == 0 || !busEnabled() {
+				continue
+			}
+			_, err = eventStmt.ExecContext(ctx, model.EventLinkCreated, userID, domain, shortURLCandidate, origURL)
 			if err != nil {
-				logger.Log.Error("executing stmt", zap.Error(err))
+				logger.FromContext(ctx).Error("inserting link event", zap.Error(err))
 				break loop
 			}
 		}
@@ -170,25 +249,32 @@ loop:
 	}
 
 	logger.Log.Debug("getting inserted urls")
-	urlRows, err = selectByOrigURLs(ctx, d.db, origURLs)
+	urlRows, err = selectByOrigURLs(ctx, d.db, domain, origURLs, userID)
 	if err != nil {
-		logger.Log.Error("finding inserted url in postgresql storage (not impossible)", zap.Error(err))
+		logger.FromContext(ctx).Error("finding inserted url in postgresql storage (not impossible)", zap.Error(err))
 		return nil, err
 	}
 	return urlRows, nil
 }
 
-// UserURLs returns user URLs from storage.
-func (d *DBPgsql) UserURLs(ctx context.Context, userID int64) (urlRowList []*model.URLRow, err error) {
-	found, ex, err := findByUser(ctx, d.db, userID)
-	if !ex {
-		return nil, fmt.Errorf("%w", ErrNotFound)
-	}
-	if err != nil {
-		return nil, err
+// UserURLs returns the page of the user URLs from storage.
+func (d *DBPgsql) UserURLs(ctx context.Context, userID int64, q model.UserURLsQuery) (urlRowList []*model.URLRow, nextCursor string, err error) {
+	urlRowList, nextCursor, err = findUserURLs(ctx, d.db, userID, q)
+	if err != nil || len(urlRowList) > 0 {
+		return urlRowList, nextCursor, err
 	}
 
-	return found, nil
+	// the empty page is not found only if the user has no URLs at all
+	var ex bool
+	err = d.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM urls WHERE user_id = $1)", userID).Scan(&ex)
+	switch {
+	case err != nil:
+		return nil, "", err
+	case !ex:
+		return nil, "", fmt.Errorf("%w", ErrNotFound)
+	default:
+		return urlRowList, "", nil
+	}
 }
 
 // CheckDeletedURLs checks deleting URLs.
@@ -201,14 +287,21 @@ func (d *DBPgsql) CheckDeletedURLs(ctx context.Context, userID int64, shortURLs
 }
 
 // DeleteURLs deletes URLs from the storage.
+//
+// The deleted events of the rows that were not deleted before are saved in the outbox in one statement.
 func (d *DBPgsql) DeleteURLs(ctx context.Context, shortURLs ...string) error {
 
 	ctxTm, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	stmt, err := d.db.PrepareContext(ctxTm, `UPDATE urls SET deleted = true WHERE short = any($1)`)
+	stmt, err := d.db.PrepareContext(ctxTm,
+		`WITH deleted AS (UPDATE urls SET deleted = true
+			WHERE (domain, short) IN (SELECT * FROM unnest($4::text[], $1::text[])) AND NOT deleted
+			RETURNING user_id, domain, short, original)
+		INSERT INTO link_events (type, user_id, domain, short, original)
+		SELECT $2, user_id, domain, short, original FROM deleted WHERE $3`)
 	if err != nil {
-		logger.Log.Info("preparing stmt", zap.String("error", err.Error()))
+		logger.FromContext(ctx).Info("preparing stmt", zap.String("error", err.Error()))
 		return err
 	}
 	defer stmt.Close()
@@ -217,199 +310,1384 @@ func (d *DBPgsql) DeleteURLs(ctx context.Context, shortURLs ...string) error {
 	case <-ctxTm.Done():
 		return fmt.Errorf("the operation was canceled")
 	default:
-		_, err = stmt.ExecContext(ctxTm, shortURLs)
+		domains, codes := splitLinkKeys(shortURLs)
+		_, err = stmt.ExecContext(ctxTm, codes, model.EventLinkDeleted, busEnabled(), domains)
 		if err != nil {
 			return err
 		}
-		logger.Log.Info("urls deleted", zap.String("shortURLs", strings.Join(shortURLs, ", ")))
+		logger.FromContext(ctx).Info("urls deleted", zap.String("shortURLs", strings.Join(shortURLs, ", ")))
 	}
 
 	return nil
 }
 
-// Stats returns count of URLs.
-func (d *DBPgsql) Stats(ctx context.Context) (int, error) {
+// UpdateURL changes the destination of the user short URL and records the revision.
+//
+// The row is locked, updated and the revision is inserted in one transaction.
+func (d *DBPgsql) UpdateURL(ctx context.Context, userID int64, shortURL, origURL string) (revision *model.URLRevision, err error) {
+	ctxTm, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
 
-	count, err := urlsCount(ctx, d.db)
+	tx, err := d.db.BeginTx(ctxTm, nil)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		row      model.URLRow
+		rowDedup int64
+	)
+	domain, code := model.SplitLinkKey(shortURL)
+	err = tx.QueryRowContext(ctxTm,
+		"SELECT id, domain, short, original, user_id, deleted, dedup_user_id FROM urls WHERE domain = $1 AND short = $2 FOR UPDATE",
+		domain, code).Scan(&row.ID, &row.Domain, &row.ShortURL, &row.OrigURL, &row.UserID, &row.Deleted, &rowDedup)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, fmt.Errorf("%w", ErrNotFound)
+	case err != nil:
+		return nil, err
+	}
+	if err = checkUserURL(userID, &row); err != nil {
+		return nil, err
+	}
+	if row.Deleted {
+		return nil, fmt.Errorf("%w", ErrGone)
+	}
+	if row.OrigURL == origURL {
+		return nil, nil
+	}
+
+	// the same conditions as in the migration (by the deduplication mode and by the unique index of the row)
+	var other string
+	err = tx.QueryRowContext(ctxTm,
+		"SELECT short FROM urls WHERE domain = $5 AND original = $1 AND id <> $2 "+
+			"AND ($3 = 0 OR user_id = $3 OR dedup_user_id = $4) LIMIT 1",
+		origURL, row.ID, dedupUserID(userID), rowDedup, row.Domain).Scan(&other)
+	switch {
+	case err == nil:
+		return nil, fmt.Errorf("%w the destination already has the short link %s", ErrConflict, other)
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	// the metadata and the checks of the previous destination are dropped
+	if _, err = tx.ExecContext(ctxTm,
+		"UPDATE urls SET original = $1, meta_title = '', meta_description = '', meta_favicon = '', meta_error = '', "+
+			"meta_fetched_at = NULL, check_status = 0, check_error = '', check_failures = 0, check_broken = false, "+
+			"checked_at = NULL WHERE id = $2",
+		origURL, row.ID); err != nil {
+		logger.FromContext(ctx).Error("updating url", zap.Error(err))
+		return nil, err
+	}
+
+	revision = &model.URLRevision{
+		ShortURL: row.Key(),
+		OrigURL:  origURL,
+		PrevURL:  row.OrigURL,
+		UserID:   userID,
+	}
+	err = tx.QueryRowContext(ctxTm,
+		"INSERT INTO url_revisions (url_id, revision, short, original, previous, user_id) "+
+			"SELECT $1, coalesce(max(revision), 0) + 1, $2, $3, $4, $5 FROM url_revisions WHERE url_id = $1 "+
+			"RETURNING revision, created_at",
+		row.ID, revision.ShortURL, origURL, row.OrigURL, userID).Scan(&revision.Revision, &revision.Time)
+	if err != nil {
+		logger.FromContext(ctx).Error("inserting url revision", zap.Error(err))
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
 	}
 
-	return count, nil
+	return revision, nil
 }
 
-func createTablesIfNeed(db *sql.DB) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// URLRevisions returns the revisions of the user short URL (the first revision first).
+func (d *DBPgsql) URLRevisions(ctx context.Context, userID int64, shortURL string) (revisions []*model.URLRevision, err error) {
+	found, ex, err := findByShort(ctx, d.db, shortURL)
+	if err != nil {
+		return nil, err
+	}
+	if !ex {
+		found = nil
+	}
+	if err = checkUserURL(userID, found); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.QueryContext(ctx,
+		"SELECT revision, short, original, previous, user_id, created_at FROM url_revisions WHERE url_id = $1 ORDER BY revision",
+		found.ID)
+	if err != nil {
+		logger.FromContext(ctx).Error("creating query", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions = make([]*model.URLRevision, 0)
+	for rows.Next() {
+		var v model.URLRevision
+		err = rows.Scan(&v.Revision, &v.ShortURL, &v.OrigURL, &v.PrevURL, &v.UserID, &v.Time)
+		if err != nil {
+			logger.FromContext(ctx).Error("scanning rows", zap.String("error", err.Error()))
+			return nil, err
+		}
+		revisions = append(revisions, &v)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		logger.FromContext(ctx).Error("checkin rows on errors", zap.String("error", err.Error()))
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// UpdateURLOptions changes the options of the user short URL (nil options are kept as they are).
+func (d *DBPgsql) UpdateURLOptions(ctx context.Context, userID int64, shortURL string, opts model.URLOptions) (row *model.URLRow, err error) {
+	ctxTm, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	q := `CREATE TABLE IF NOT EXISTS urls (
-					id SERIAL PRIMARY KEY,
-					short VARCHAR(254) NOT NULL,
-					original VARCHAR(254) NOT NULL UNIQUE,
-    			user_id INTEGER NOT NULL DEFAULT 0,
-    			deleted BOOL NOT NULL DEFAULT false
-				);
-				CREATE INDEX IF NOT EXISTS idx_short ON urls (short);
-				CREATE INDEX IF NOT EXISTS idx_user_id ON urls (user_id);
-				CREATE INDEX IF NOT EXISTS idx_deleted ON urls (deleted);
-				`
+	// the expiry is changed if $5 is true ($6 is null to remove it)
+	domain, code := model.SplitLinkKey(shortURL)
+	var expiresAt *time.Time
+	if opts.ExpiresAt != nil && !opts.ExpiresAt.IsZero() {
+		expiresAt = opts.ExpiresAt
+	}
+	// the tags are changed if they are set (the empty list is not null)
+	var tags any
+	if opts.Tags != nil {
+		tags = append([]string{}, *opts.Tags...)
+	}
+	row, err = scanURLRow(d.db.QueryRowContext(ctxTm,
+		"UPDATE urls SET title = coalesce($1, title), preview = coalesce($2, preview), "+
+			"redirect_code = coalesce($3, redirect_code), "+
+			"expires_at = CASE WHEN $5::boolean THEN $6::timestamptz ELSE expires_at END, "+
+			"forward_path = coalesce($8, forward_path), merge_query = coalesce($9, merge_query), "+
+			"notes = coalesce($11, notes), tags = coalesce($12::text[], tags) "+
+			"WHERE domain = $10 AND short = $4 AND user_id = $7 AND NOT deleted RETURNING "+urlRowColumns,
+		opts.Title, opts.Preview, opts.RedirectCode, code, opts.ExpiresAt != nil, expiresAt, userID,
+		opts.ForwardPath, opts.MergeQuery, domain, opts.Notes, tags))
+	if !errors.Is(err, sql.ErrNoRows) {
+		return row, err
+	}
 
-	_, err := db.ExecContext(ctx, q)
+	// the short URL is not found, deleted or owned by another user
+	found, ex, err := findByShort(ctx, d.db, shortURL)
 	if err != nil {
-		logger.Log.Fatal("creating postgresql tables", zap.Error(err))
+		return nil, err
 	}
+	if !ex {
+		found = nil
+	}
+	if err = checkUserURL(userID, found); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w", ErrGone)
 }
 
-func getNextUUID(ctx context.Context, tx *sql.Tx) (int64, error) {
-	var lastID int64
-	var isCalled bool
-	err := tx.QueryRowContext(ctx,
-		`SELECT last_value, is_called FROM urls_id_seq`).Scan(&lastID, &isCalled)
+// SetURLMetadata saves the metadata of the destination page of the short URL.
+func (d *DBPgsql) SetURLMetadata(ctx context.Context, shortURL, origURL string, meta *model.LinkMetadata) error {
+	ctxTm, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	domain, code := model.SplitLinkKey(shortURL)
+	var id int64
+	err := d.db.QueryRowContext(ctxTm,
+		"UPDATE urls SET meta_title = $1, meta_description = $2, meta_favicon = $3, meta_error = $4, meta_fetched_at = $5 "+
+			"WHERE domain = $6 AND short = $7 AND original = $8 AND NOT deleted RETURNING id",
+		meta.Title, meta.Description, meta.Favicon, meta.Error, meta.Fetched, domain, code, origURL).Scan(&id)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	// the metadata is skipped if the link is changed, but the missing short URL is the error
+	_, ex, err := findByShort(ctx, d.db, shortURL)
 	if err != nil {
-		return 0, err
+		return err
 	}
-	if !isCalled {
-		return lastID, nil
+	if !ex {
+		return fmt.Errorf("%w", ErrNotFound)
 	}
-	return lastID + 1, nil
+	return nil
 }
 
-func selectByOrigURLs(ctx context.Context, db *sql.DB, origURLs []string) (urlRows map[string]*model.URLRow, err error) {
+// URLsToCheck returns no more than limit links whose destinations are not checked since the time.
+func (d *DBPgsql) URLsToCheck(ctx context.Context, before time.Time, limit int) (urlRows []*model.URLRow, err error) {
+	ctxTm, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
 
-	logger.Log.Debug("selectByOrigURLs", zap.Any("origURLs", origURLs))
-	rows, err := db.QueryContext(ctx,
-		`SELECT id, short, original FROM urls WHERE original = any($1)`,
-		origURLs) // strings.Join(origURLs, ","))
+	rows, err := d.db.QueryContext(ctxTm,
+		"SELECT "+urlRowColumns+" FROM urls WHERE NOT deleted AND (checked_at IS NULL OR checked_at < $1) "+
+			"ORDER BY checked_at NULLS FIRST, id LIMIT $2",
+		before, limit)
 	if err != nil {
-		logger.Log.Error("creating query", zap.String("error", err.Error()))
 		return nil, err
 	}
 	defer rows.Close()
 
-	urlRows = make(map[string]*model.URLRow)
+	urlRows = make([]*model.URLRow, 0)
 	for rows.Next() {
-		var urlRow model.URLRow
-		err = rows.Scan(&urlRow.ID, &urlRow.ShortURL, &urlRow.OrigURL)
-		if err != nil {
-			logger.Log.Error("scanning rows", zap.String("error", err.Error()))
+		var row *model.URLRow
+		if row, err = scanURLRow(rows); err != nil {
 			return nil, err
 		}
-		urlRows[urlRow.OrigURL] = &urlRow
+		urlRows = append(urlRows, row)
 	}
+	return urlRows, rows.Err()
+}
 
-	err = rows.Err()
+// SaveURLCheck saves the result of the check of the row.
+//
+// The time of the previous check is the version of the row, so the instances don't save the same check twice.
+func (d *DBPgsql) SaveURLCheck(ctx context.Context, row *model.URLRow, check *model.LinkCheck) (saved bool, err error) {
+	ctxTm, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var prev *time.Time
+	if row.Check != nil {
+		prev = &row.Check.Checked
+	}
+	res, err := d.db.ExecContext(ctxTm,
+		"UPDATE urls SET check_status = $1, check_error = $2, check_failures = $3, check_broken = $4, checked_at = $5 "+
+			"WHERE domain = $6 AND short = $7 AND original = $8 AND NOT deleted "+
+			"AND checked_at IS NOT DISTINCT FROM $9::timestamptz",
+		check.Status, check.Error, check.Failures, check.Broken, check.Checked,
+		row.Domain, row.ShortURL, row.OrigURL, prev)
 	if err != nil {
-		logger.Log.Error("checkin rows on errors", zap.String("error", err.Error()))
-		return nil, err
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 0 {
+		return n != 0, err
 	}
 
-	return urlRows, nil
+	// the result is skipped if the link is changed, but the missing short URL is the error
+	_, ex, err := findByShort(ctx, d.db, row.Key())
+	if err != nil {
+		return false, err
+	}
+	if !ex {
+		return false, fmt.Errorf("%w", ErrNotFound)
+	}
+	return false, nil
 }
 
-func selectByShortURLs(ctx context.Context, db *sql.DB, shortURLs []string) (urlRows map[string]*model.URLRow, err error) {
-	rows, err := db.QueryContext(ctx,
-		`SELECT id, short, original, user_id, deleted FROM urls WHERE short = any($1)`,
-		shortURLs)
+// WriteDeleteTask saves the deletion task in the outbox and sets its ID.
+func (d *DBPgsql) WriteDeleteTask(ctx context.Context, task *model.DeleteTask) error {
+	ctxTm, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := d.db.QueryRowContext(ctxTm,
+		"INSERT INTO delete_tasks (user_id, short_urls, created_at, status) "+
+			"VALUES ($1, $2, $3, $4) RETURNING id",
+		task.UserID, task.ShortURLs, task.Time, model.DeleteTaskPending).Scan(&task.ID)
 	if err != nil {
-		logger.Log.Error("creating query", zap.String("error", err.Error()))
+		logger.FromContext(ctx).Error("inserting deletion task", zap.Error(err))
+		return err
+	}
+	task.Status = model.DeleteTaskPending
+
+	return nil
+}
+
+// PendingDeleteTasks returns the outbox deletion tasks that are not completed yet.
+func (d *DBPgsql) PendingDeleteTasks(ctx context.Context) (tasks []*model.DeleteTask, err error) {
+	rows, err := d.db.QueryContext(ctx,
+		"SELECT id, user_id, short_urls, created_at, status FROM delete_tasks WHERE status = $1 ORDER BY id",
+		model.DeleteTaskPending)
+	if err != nil {
+		logger.FromContext(ctx).Error("creating query", zap.String("error", err.Error()))
 		return nil, err
 	}
 	defer rows.Close()
 
-	urlRows = make(map[string]*model.URLRow)
+	m := pgtype.NewMap()
+	tasks = make([]*model.DeleteTask, 0)
 	for rows.Next() {
-		var urlRow model.URLRow
-		err = rows.Scan(&urlRow.ID, &urlRow.ShortURL, &urlRow.OrigURL, &urlRow.UserID, &urlRow.Deleted)
+		var v model.DeleteTask
+		err = rows.Scan(&v.ID, &v.UserID, m.SQLScanner(&v.ShortURLs), &v.Time, &v.Status)
 		if err != nil {
-			logger.Log.Error("scanning rows", zap.String("error", err.Error()))
+			logger.FromContext(ctx).Error("scanning rows", zap.String("error", err.Error()))
 			return nil, err
 		}
-		urlRows[urlRow.OrigURL] = &urlRow
+		tasks = append(tasks, &v)
 	}
 
 	err = rows.Err()
 	if err != nil {
-		logger.Log.Error("checkin rows on errors", zap.String("error", err.Error()))
+		logger.FromContext(ctx).Error("checkin rows on errors", zap.String("error", err.Error()))
 		return nil, err
 	}
 
-	return urlRows, nil
+	return tasks, nil
 }
 
-func findByShort(ctx context.Context, db *sql.DB, shortURL string) (urlRow *model.URLRow, exist bool, err error) {
-	var v model.URLRow
-	err = db.QueryRowContext(ctx,
-		"SELECT id, short, original, user_id, deleted FROM urls WHERE short = $1",
-		shortURL).Scan(&v.ID, &v.ShortURL, &v.OrigURL, &v.UserID, &v.Deleted)
-	switch {
-	case err == sql.ErrNoRows:
-		return nil, false, nil
-	case err != nil:
-		return nil, false, err
-	default:
-		return &v, true, nil
+// CompleteDeleteTasks sets the final status (done or dead) for the outbox deletion tasks.
+func (d *DBPgsql) CompleteDeleteTasks(ctx context.Context, status string, ids ...int64) error {
+	ctxTm, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctxTm,
+		"UPDATE delete_tasks SET status = $1 WHERE id = any($2)", status, ids)
+	if err != nil {
+		logger.FromContext(ctx).Info("completing deletion tasks", zap.String("error", err.Error()))
+		return err
 	}
+
+	return nil
 }
 
-func urlsCount(ctx context.Context, db *sql.DB) (count int, err error) {
-	err = db.QueryRowContext(ctx,
-		"SELECT count(*) FROM urls").Scan(&count)
-	switch {
-	case err == sql.ErrNoRows:
-		return 0, nil
-	case err != nil:
-		return 0, err
-	default:
-		return count, nil
+// WriteShortenJob saves the new shortening job with its lines and sets its ID.
+//
+// The lines are inserted with one statement, so the large job is written quickly.
+func (d *DBPgsql) WriteShortenJob(ctx context.Context, job *model.ShortenJob) error {
+	ctxTm, cancel := context.WithTimeout(ctx, ShortenJobWriteTimeout)
+	defer cancel()
+
+	tx, err := d.db.BeginTx(ctxTm, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctxTm,
+		"INSERT INTO shorten_jobs (user_id, status, total, created_at, updated_at) "+
+			"VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		job.UserID, model.ShortenJobQueued, job.Total, job.Created, job.Updated).Scan(&job.ID)
+	if err != nil {
+		logger.FromContext(ctx).Error("inserting shortening job", zap.Error(err))
+		return err
+	}
+
+	ns := make([]int64, len(job.Lines))
+	lines := make([]int64, len(job.Lines))
+	correlationIDs := make([]string, len(job.Lines))
+	origURLs := make([]string, len(job.Lines))
+	errs := make([]string, len(job.Lines))
+	for i, line := range job.Lines {
+		ns[i], lines[i] = int64(line.N), int64(line.Line)
+		correlationIDs[i], origURLs[i], errs[i] = line.CorrelationID, line.OriginalURL, line.Error
+	}
+	_, err = tx.ExecContext(ctxTm,
+		"INSERT INTO shorten_job_lines (job_id, n, line, correlation_id, original_url, error) "+
+			"SELECT $1, * FROM unnest($2::integer[], $3::integer[], $4::text[], $5::text[], $6::text[])",
+		job.ID, ns, lines, correlationIDs, origURLs, errs)
+	if err != nil {
+		logger.FromContext(ctx).Error("inserting shortening job lines", zap.Error(err))
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
 	}
+	job.Status = model.ShortenJobQueued
+
+	return nil
 }
 
-func findByOrig(ctx context.Context, db *sql.DB, origURL string) (urlRow *model.URLRow, exist bool, err error) {
-	var v model.URLRow
-	err = db.QueryRowContext(ctx,
-		"SELECT id, short, original, user_id FROM urls WHERE original = $1",
-		origURL).Scan(&v.ID, &v.ShortURL, &v.OrigURL, &v.UserID)
-	switch {
-	case err == sql.ErrNoRows:
-		return nil, false, nil
-	case err != nil:
-		return nil, false, err
-	default:
-		return &v, true, nil
+// ShortenJob returns the shortening job without the lines.
+func (d *DBPgsql) ShortenJob(ctx context.Context, id int64) (job *model.ShortenJob, err error) {
+	var v model.ShortenJob
+	err = d.db.QueryRowContext(ctx,
+		"SELECT id, user_id, status, total, processed, failed, error, created_at, updated_at FROM shorten_jobs WHERE id = $1",
+		id).Scan(&v.ID, &v.UserID, &v.Status, &v.Total, &v.Processed, &v.Failed, &v.Error, &v.Created, &v.Updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w", ErrNotFound)
 	}
+	if err != nil {
+		logger.FromContext(ctx).Error("selecting shortening job", zap.Error(err))
+		return nil, err
+	}
+	return &v, nil
 }
 
-func findByUser(ctx context.Context, db *sql.DB, userID int64) (urlRowList []*model.URLRow, exist bool, err error) {
+// ShortenJobLines returns no more than limit lines of the shortening job from the position.
+func (d *DBPgsql) ShortenJobLines(ctx context.Context, id int64, from, limit int) (lines []model.ShortenJobLine, err error) {
+	if _, err = d.ShortenJob(ctx, id); err != nil {
+		return nil, err
+	}
 
-	rows, err := db.QueryContext(ctx,
-		"SELECT id, short, original, user_id FROM urls WHERE user_id = $1",
-		userID)
+	rows, err := d.db.QueryContext(ctx,
+		"SELECT n, line, correlation_id, original_url, short_url, error FROM shorten_job_lines "+
+			"WHERE job_id = $1 AND n >= $2 ORDER BY n LIMIT $3",
+		id, from, limit)
 	if err != nil {
-		logger.Log.Error("creating query", zap.String("error", err.Error()))
-		return nil, false, err
+		logger.FromContext(ctx).Error("creating query", zap.String("error", err.Error()))
+		return nil, err
 	}
 	defer rows.Close()
 
-	urlRowList = make([]*model.URLRow, 0)
+	lines = make([]model.ShortenJobLine, 0, limit)
 	for rows.Next() {
-		var v model.URLRow
-		err = rows.Scan(&v.ID, &v.ShortURL, &v.OrigURL, &v.UserID)
-		if err != nil {
-			logger.Log.Error("scanning rows", zap.String("error", err.Error()))
-			return nil, false, err
+		var v model.ShortenJobLine
+		if err = rows.Scan(&v.N, &v.Line, &v.CorrelationID, &v.OriginalURL, &v.ShortURL, &v.Error); err != nil {
+			logger.FromContext(ctx).Error("scanning rows", zap.String("error", err.Error()))
+			return nil, err
 		}
-		urlRowList = append(urlRowList, &v)
+		lines = append(lines, v)
 	}
 
-	err = rows.Err()
+	if err = rows.Err(); err != nil {
+		logger.FromContext(ctx).Error("checkin rows on errors", zap.String("error", err.Error()))
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+// UpdateShortenJob saves the progress of the shortening job and the results of the processed lines.
+func (d *DBPgsql) UpdateShortenJob(ctx context.Context, job *model.ShortenJob) error {
+	ctxTm, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := d.db.BeginTx(ctxTm, nil)
 	if err != nil {
-		logger.Log.Error("checkin rows on errors", zap.String("error", err.Error()))
-		return nil, false, err
+		return err
 	}
+	defer tx.Rollback()
 
-	if len(urlRowList) == 0 {
-		return nil, false, errors.New("not found")
+	res, err := tx.ExecContext(ctxTm,
+		"UPDATE shorten_jobs SET status = $2, processed = $3, failed = $4, error = $5, updated_at = $6 WHERE id = $1",
+		job.ID, job.Status, job.Processed, job.Failed, job.Error, job.Updated)
+	if err != nil {
+		logger.FromContext(ctx).Error("updating shortening job", zap.Error(err))
+		return err
+	}
+	if count, e := res.RowsAffected(); e == nil && count == 0 {
+		return fmt.Errorf("%w", ErrNotFound)
 	}
 
-	return urlRowList, true, nil
+	if len(job.Lines) > 0 {
+		ns := make([]int64, len(job.Lines))
+		shortURLs := make([]string, len(job.Lines))
+		errs := make([]string, len(job.Lines))
+		for i, line := range job.Lines {
+			ns[i], shortURLs[i], errs[i] = int64(line.N), line.ShortURL, line.Error
+		}
+		_, err = tx.ExecContext(ctxTm,
+			"UPDATE shorten_job_lines AS l SET short_url = r.short_url, error = r.error "+
+				"FROM unnest($2::integer[], $3::text[], $4::text[]) AS r (n, short_url, error) "+
+				"WHERE l.job_id = $1 AND l.n = r.n",
+			job.ID, ns, shortURLs, errs)
+		if err != nil {
+			logger.FromContext(ctx).Error("updating shortening job lines", zap.Error(err))
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// PendingShortenJobs returns the IDs of the shortening jobs that are not finished yet.
+func (d *DBPgsql) PendingShortenJobs(ctx context.Context) (ids []int64, err error) {
+	rows, err := d.db.QueryContext(ctx,
+		"SELECT id FROM shorten_jobs WHERE status = any($1) ORDER BY id",
+		[]string{model.ShortenJobQueued, model.ShortenJobRunning})
+	if err != nil {
+		logger.FromContext(ctx).Error("creating query", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids = make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			logger.FromContext(ctx).Error("scanning rows", zap.String("error", err.Error()))
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		logger.FromContext(ctx).Error("checkin rows on errors", zap.String("error", err.Error()))
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// DeleteShortenJobs removes the finished shortening jobs updated before the time (the lines are removed by the cascade).
+func (d *DBPgsql) DeleteShortenJobs(ctx context.Context, before time.Time) (deleted int, err error) {
+	res, err := d.db.ExecContext(ctx,
+		"DELETE FROM shorten_jobs WHERE status = any($1) AND updated_at < $2",
+		[]string{model.ShortenJobDone, model.ShortenJobFailed}, before)
+	if err != nil {
+		logger.FromContext(ctx).Error("deleting shortening jobs", zap.Error(err))
+		return 0, err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+// WriteWebhook saves the new webhook of the user and sets its ID.
+func (d *DBPgsql) WriteWebhook(ctx context.Context, hook *model.Webhook) error {
+	events := hook.Events
+	if events == nil {
+		events = []string{}
+	}
+	err := d.db.QueryRowContext(ctx,
+		"INSERT INTO webhooks (user_id, url, events, secret, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		hook.UserID, hook.URL, events, hook.Secret, hook.Created).Scan(&hook.ID)
+	if err != nil {
+		logger.FromContext(ctx).Error("inserting webhook", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// UserWebhooks returns the webhooks of the user.
+func (d *DBPgsql) UserWebhooks(ctx context.Context, userID int64) (hooks []*model.Webhook, err error) {
+	rows, err := d.db.QueryContext(ctx,
+		"SELECT id, user_id, url, events, secret, created_at FROM webhooks WHERE user_id = $1 ORDER BY id",
+		userID)
+	if err != nil {
+		logger.FromContext(ctx).Error("creating query", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	m := pgtype.NewMap()
+	hooks = make([]*model.Webhook, 0)
+	for rows.Next() {
+		var v model.Webhook
+		err = rows.Scan(&v.ID, &v.UserID, &v.URL, m.SQLScanner(&v.Events), &v.Secret, &v.Created)
+		if err != nil {
+			logger.FromContext(ctx).Error("scanning rows", zap.String("error", err.Error()))
+			return nil, err
+		}
+		if len(v.Events) == 0 {
+			v.Events = nil
+		}
+		hooks = append(hooks, &v)
+	}
+
+	if err = rows.Err(); err != nil {
+		logger.FromContext(ctx).Error("checkin rows on errors", zap.String("error", err.Error()))
+		return nil, err
+	}
+
+	return hooks, nil
+}
+
+// DeleteWebhook deletes the webhook of the user with its deliveries.
+func (d *DBPgsql) DeleteWebhook(ctx context.Context, userID, id int64) error {
+	res, err := d.db.ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		logger.FromContext(ctx).Error("deleting webhook", zap.Error(err))
+		return err
+	}
+	if count, e := res.RowsAffected(); e == nil && count == 0 {
+		return fmt.Errorf("%w", ErrNotFound)
+	}
+	return nil
+}
+
+// WriteWebhookDeliveries saves the new deliveries and sets their IDs.
+func (d *DBPgsql) WriteWebhookDeliveries(ctx context.Context, deliveries []*model.WebhookDelivery) error {
+	ctxTm, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := d.db.BeginTx(ctxTm, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctxTm,
+		"INSERT INTO webhook_deliveries (webhook_id, user_id, event, url, payload, status, attempts, "+
+			"response_code, error, created_at, updated_at, next_try) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	ids := make([]int64, len(deliveries))
+	for i, v := range deliveries {
+		err = stmt.QueryRowContext(ctxTm, v.WebhookID, v.UserID, v.Event, v.URL, v.Payload, v.Status, v.Attempts,
+			v.ResponseCode, v.Error, v.Created, v.Updated, v.NextTry).Scan(&ids[i])
+		if err != nil {
+			logger.FromContext(ctx).Error("inserting webhook delivery", zap.Error(err))
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	for i, v := range deliveries {
+		v.ID = ids[i]
+	}
+
+	return nil
+}
+
+// UpdateWebhookDelivery saves the result of the delivery attempt.
+//
+// The finished deliveries of the webhook except for the last WebhookLogSize ones are deleted.
+func (d *DBPgsql) UpdateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	ctxTm, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	res, err := d.db.ExecContext(ctxTm,
+		"UPDATE webhook_deliveries SET status = $2, attempts = $3, response_code = $4, error = $5, "+
+			"updated_at = $6, next_try = $7 WHERE id = $1",
+		delivery.ID, delivery.Status, delivery.Attempts, delivery.ResponseCode, delivery.Error,
+		delivery.Updated, delivery.NextTry)
+	if err != nil {
+		logger.FromContext(ctx).Error("updating webhook delivery", zap.Error(err))
+		return err
+	}
+	if count, e := res.RowsAffected(); e == nil && count == 0 {
+		return fmt.Errorf("%w", ErrNotFound)
+	}
+	if delivery.Status == model.WebhookDeliveryPending {
+		return nil
+	}
+
+	_, err = d.db.ExecContext(ctxTm,
+		"DELETE FROM webhook_deliveries WHERE webhook_id = $1 AND status <> $2 AND id NOT IN "+
+			"(SELECT id FROM webhook_deliveries WHERE webhook_id = $1 AND status <> $2 ORDER BY id DESC LIMIT $3)",
+		delivery.WebhookID, model.WebhookDeliveryPending, WebhookLogSize)
+	if err != nil {
+		// the old records are deleted with the next delivery
+		logger.FromContext(ctx).Info("pruning webhook deliveries", zap.Error(err))
+	}
+
+	return nil
+}
+
+// PendingWebhookDeliveries returns no more than limit pending deliveries to try before the time.
+func (d *DBPgsql) PendingWebhookDeliveries(ctx context.Context, before time.Time, limit int) (deliveries []*model.WebhookDelivery, err error) {
+	return d.queryWebhookDeliveries(ctx,
+		"WHERE status = $1 AND next_try <= $2 ORDER BY id LIMIT $3",
+		model.WebhookDeliveryPending, before, limit)
+}
+
+// WebhookDeliveries returns no more than limit last deliveries of the user webhook.
+func (d *DBPgsql) WebhookDeliveries(ctx context.Context, userID, id int64, limit int) (deliveries []*model.WebhookDelivery, err error) {
+	var found int64
+	err = d.db.QueryRowContext(ctx, "SELECT id FROM webhooks WHERE id = $1 AND user_id = $2", id, userID).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w", ErrNotFound)
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("selecting webhook", zap.Error(err))
+		return nil, err
+	}
+
+	return d.queryWebhookDeliveries(ctx, "WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2", id, limit)
+}
+
+// queryWebhookDeliveries selects the deliveries with the condition.
+func (d *DBPgsql) queryWebhookDeliveries(ctx context.Context, where string, args ...any) ([]*model.WebhookDelivery, error) {
+	rows, err := d.db.QueryContext(ctx,
+		"SELECT id, webhook_id, user_id, event, url, payload, status, attempts, response_code, error, "+
+			"created_at, updated_at, next_try FROM webhook_deliveries "+where,
+		args...)
+	if err != nil {
+		logger.FromContext(ctx).Error("creating query", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]*model.WebhookDelivery, 0)
+	for rows.Next() {
+		var v model.WebhookDelivery
+		err = rows.Scan(&v.ID, &v.WebhookID, &v.UserID, &v.Event, &v.URL, &v.Payload, &v.Status, &v.Attempts,
+			&v.ResponseCode, &v.Error, &v.Created, &v.Updated, &v.NextTry)
+		if err != nil {
+			logger.FromContext(ctx).Error("scanning rows", zap.String("error", err.Error()))
+			return nil, err
+		}
+		deliveries = append(deliveries, &v)
+	}
+
+	if err = rows.Err(); err != nil {
+		logger.FromContext(ctx).Error("checkin rows on errors", zap.String("error", err.Error()))
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// WriteBusEvents saves the link events in the outbox of the event bus and sets their IDs.
+func (d *DBPgsql) WriteBusEvents(ctx context.Context, events []*model.BusEvent) error {
+	ctxTm, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := d.db.BeginTx(ctxTm, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctxTm,
+		"INSERT INTO link_events (type, user_id, domain, short, original, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	ids := make([]int64, len(events))
+	for i, v := range events {
+		err = stmt.QueryRowContext(ctxTm, v.Type, v.UserID, v.Domain, v.ShortURL, v.OrigURL, v.Time).Scan(&ids[i])
+		if err != nil {
+			logger.FromContext(ctx).Error("inserting link event", zap.Error(err))
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	for i, v := range events {
+		v.ID = ids[i]
+	}
+
+	return nil
+}
+
+// PendingBusEvents returns no more than limit outbox events that are not published yet.
+//
+// The events of the link are saved by the transactions that lock its row, so they are committed
+// in the order of their IDs.
+func (d *DBPgsql) PendingBusEvents(ctx context.Context, limit int) (events []*model.BusEvent, err error) {
+	rows, err := d.db.QueryContext(ctx,
+		"SELECT id, type, user_id, domain, short, original, created_at FROM link_events ORDER BY id LIMIT $1", limit)
+	if err != nil {
+		logger.FromContext(ctx).Error("creating query", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	events = make([]*model.BusEvent, 0)
+	for rows.Next() {
+		var v model.BusEvent
+		if err = rows.Scan(&v.ID, &v.Type, &v.UserID, &v.Domain, &v.ShortURL, &v.OrigURL, &v.Time); err != nil {
+			logger.FromContext(ctx).Error("scanning rows", zap.String("error", err.Error()))
+			return nil, err
+		}
+		events = append(events, &v)
+	}
+
+	if err = rows.Err(); err != nil {
+		logger.FromContext(ctx).Error("checkin rows on errors", zap.String("error", err.Error()))
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// CompleteBusEvents removes the published events from the outbox.
+func (d *DBPgsql) CompleteBusEvents(ctx context.Context, ids ...int64) error {
+	_, err := d.db.ExecContext(ctx, "DELETE FROM link_events WHERE id = any($1)", ids)
+	if err != nil {
+		logger.FromContext(ctx).Error("deleting link events", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// LeaseBusRelay takes or renews the lease of the outbox relay for the owner for the ttl.
+//
+// The lease is the only row of the table, it is taken if it is held by the owner or expired.
+func (d *DBPgsql) LeaseBusRelay(ctx context.Context, owner string, ttl time.Duration) (leased bool, err error) {
+	res, err := d.db.ExecContext(ctx,
+		"INSERT INTO event_relay_lease (id, owner, expires_at) VALUES (1, $1, now() + $2 * interval '1 millisecond') "+
+			"ON CONFLICT (id) DO UPDATE SET owner = EXCLUDED.owner, expires_at = EXCLUDED.expires_at "+
+			"WHERE event_relay_lease.owner = EXCLUDED.owner OR event_relay_lease.expires_at < now()",
+		owner, ttl.Milliseconds())
+	if err != nil {
+		logger.FromContext(ctx).Error("taking event relay lease", zap.Error(err))
+		return false, err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return count == 1, nil
+}
+
+// Stats returns count of URLs by domain.
+func (d *DBPgsql) Stats(ctx context.Context) (domains map[string]int, err error) {
+	rows, err := d.db.QueryContext(ctx, "SELECT domain, count(*) FROM urls GROUP BY domain")
+	if err != nil {
+		logger.FromContext(ctx).Error("creating query", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains = make(map[string]int)
+	for rows.Next() {
+		var (
+			domain string
+			count  int
+		)
+		if err = rows.Scan(&domain, &count); err != nil {
+			logger.FromContext(ctx).Error("scanning rows", zap.String("error", err.Error()))
+			return nil, err
+		}
+		domains[domain] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		logger.FromContext(ctx).Error("checkin rows on errors", zap.String("error", err.Error()))
+		return nil, err
+	}
+
+	return domains, nil
+}
+
+// MigrateOrigURLs rewrites the original URLs of the existing rows with the migrate function.
+//
+// The rows are updated in one transaction, the row is skipped if the new original URL is already in the table.
+func (d *DBPgsql) MigrateOrigURLs(ctx context.Context, migrate func(origURL string) (string, error)) (*model.URLMigration, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT id, domain, short, original, user_id FROM urls ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	urlRows := make([]model.URLRow, 0)
+	for rows.Next() {
+		var v model.URLRow
+		if err = rows.Scan(&v.ID, &v.Domain, &v.ShortURL, &v.OrigURL, &v.UserID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		urlRows = append(urlRows, v)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// the conflicts are checked by the deduplication mode ($3 is 0 in the global mode)
+	// and by the unique index of the row (it can be left from the other mode)
+	stmt, err := tx.PrepareContext(ctx,
+		`UPDATE urls u SET original = $1 WHERE u.id = $2 AND NOT EXISTS (
+			SELECT 1 FROM urls o WHERE o.domain = u.domain AND o.original = $1
+				AND ($3 = 0 OR o.user_id = $3 OR o.dedup_user_id = u.dedup_user_id)
+		)`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	res := &model.URLMigration{}
+	for _, row := range urlRows {
+		res.Checked++
+		newURL, e := migrate(row.OrigURL)
+		if e != nil {
+			logger.FromContext(ctx).Info("migrating original URL", zap.String("shortURL", row.Key()), zap.String("error", e.Error()))
+			res.Failed++
+			continue
+		}
+		if newURL == row.OrigURL {
+			continue
+		}
+
+		result, e := stmt.ExecContext(ctx, newURL, row.ID, dedupUserID(row.UserID))
+		if e != nil {
+			return nil, e
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			res.Conflicts++
+			continue
+		}
+		res.Updated++
+	}
+
+	return res, tx.Commit()
+}
+
+func createTablesIfNeed(db *sql.DB) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	q := `CREATE TABLE IF NOT EXISTS urls (
+					id SERIAL PRIMARY KEY,
+					short VARCHAR(254) NOT NULL,
+					original VARCHAR(254) NOT NULL,
+    			user_id INTEGER NOT NULL DEFAULT 0,
+    			deleted BOOL NOT NULL DEFAULT false
+				);
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS dedup_user_id INTEGER NOT NULL DEFAULT 0;
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ;
+				ALTER TABLE urls ALTER COLUMN created_at SET DEFAULT now();
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '';
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS preview BOOL NOT NULL DEFAULT false;
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS clicks BIGINT NOT NULL DEFAULT 0;
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS redirect_code INTEGER NOT NULL DEFAULT 0;
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS forward_path BOOLEAN NOT NULL DEFAULT false;
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS merge_query TEXT NOT NULL DEFAULT '';
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS domain VARCHAR(254) NOT NULL DEFAULT '';
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS notes TEXT NOT NULL DEFAULT '';
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS meta_title TEXT NOT NULL DEFAULT '';
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS meta_description TEXT NOT NULL DEFAULT '';
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS meta_favicon TEXT NOT NULL DEFAULT '';
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS meta_error TEXT NOT NULL DEFAULT '';
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS meta_fetched_at TIMESTAMPTZ;
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS check_status INTEGER NOT NULL DEFAULT 0;
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS check_error TEXT NOT NULL DEFAULT '';
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS check_failures INTEGER NOT NULL DEFAULT 0;
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS check_broken BOOL NOT NULL DEFAULT false;
+				ALTER TABLE urls ADD COLUMN IF NOT EXISTS checked_at TIMESTAMPTZ;
+				ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_original_key;
+				CREATE INDEX IF NOT EXISTS idx_short ON urls (short);
+				CREATE TABLE IF NOT EXISTS domain_codes (
+					domain VARCHAR(254) PRIMARY KEY,
+					last_code BIGINT NOT NULL
+				);
+				CREATE INDEX IF NOT EXISTS idx_deleted ON urls (deleted);
+				CREATE TABLE IF NOT EXISTS delete_tasks (
+					id SERIAL PRIMARY KEY,
+					user_id INTEGER NOT NULL,
+					short_urls TEXT[] NOT NULL,
+					created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+					status VARCHAR(16) NOT NULL DEFAULT 'pending'
+				);
+				CREATE INDEX IF NOT EXISTS idx_delete_tasks_status ON delete_tasks (status);
+				CREATE TABLE IF NOT EXISTS url_revisions (
+					id SERIAL PRIMARY KEY,
+					url_id INTEGER NOT NULL,
+					revision INTEGER NOT NULL,
+					short VARCHAR(254) NOT NULL,
+					original VARCHAR(254) NOT NULL,
+					previous VARCHAR(254) NOT NULL,
+					user_id INTEGER NOT NULL,
+					created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+					UNIQUE (url_id, revision)
+				);
+				CREATE TABLE IF NOT EXISTS shorten_jobs (
+					id SERIAL PRIMARY KEY,
+					user_id INTEGER NOT NULL,
+					status VARCHAR(16) NOT NULL DEFAULT 'queued',
+					total INTEGER NOT NULL,
+					processed INTEGER NOT NULL DEFAULT 0,
+					failed INTEGER NOT NULL DEFAULT 0,
+					error TEXT NOT NULL DEFAULT '',
+					created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+					updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+				);
+				CREATE INDEX IF NOT EXISTS idx_shorten_jobs_status ON shorten_jobs (status);
+				CREATE TABLE IF NOT EXISTS shorten_job_lines (
+					job_id INTEGER NOT NULL REFERENCES shorten_jobs (id) ON DELETE CASCADE,
+					n INTEGER NOT NULL,
+					line INTEGER NOT NULL,
+					correlation_id TEXT NOT NULL,
+					original_url TEXT NOT NULL,
+					short_url TEXT NOT NULL DEFAULT '',
+					error TEXT NOT NULL DEFAULT '',
+					PRIMARY KEY (job_id, n)
+				);
+				CREATE TABLE IF NOT EXISTS webhooks (
+					id SERIAL PRIMARY KEY,
+					user_id INTEGER NOT NULL,
+					url TEXT NOT NULL,
+					events TEXT[] NOT NULL DEFAULT '{}',
+					secret TEXT NOT NULL,
+					created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+				);
+				CREATE INDEX IF NOT EXISTS idx_webhooks_user_id ON webhooks (user_id);
+				CREATE TABLE IF NOT EXISTS webhook_deliveries (
+					id SERIAL PRIMARY KEY,
+					webhook_id INTEGER NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+					user_id INTEGER NOT NULL,
+					event VARCHAR(32) NOT NULL,
+					url TEXT NOT NULL,
+					payload TEXT NOT NULL,
+					status VARCHAR(16) NOT NULL DEFAULT 'pending',
+					attempts INTEGER NOT NULL DEFAULT 0,
+					response_code INTEGER NOT NULL DEFAULT 0,
+					error TEXT NOT NULL DEFAULT '',
+					created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+					updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+					next_try TIMESTAMPTZ NOT NULL DEFAULT now()
+				);
+				CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status ON webhook_deliveries (status, next_try);
+				CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, id);
+				CREATE TABLE IF NOT EXISTS link_events (
+					id BIGSERIAL PRIMARY KEY,
+					type VARCHAR(32) NOT NULL,
+					user_id INTEGER NOT NULL,
+					short VARCHAR(254) NOT NULL,
+					original VARCHAR(254) NOT NULL DEFAULT '',
+					created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+				);
+				ALTER TABLE link_events ADD COLUMN IF NOT EXISTS domain VARCHAR(254) NOT NULL DEFAULT '';
+				CREATE TABLE IF NOT EXISTS event_relay_lease (
+					id INTEGER PRIMARY KEY,
+					owner TEXT NOT NULL,
+					expires_at TIMESTAMPTZ NOT NULL
+				);
+				`
+
+	_, err := db.ExecContext(ctx, q)
+	if err != nil {
+		logger.Log.Fatal("creating postgresql tables", zap.Error(err))
+	}
+}
+
+// pgIndex is the index built by createIndexesIfNeed.
+type pgIndex struct {
+	name       string
+	definition string // ON table ... of CREATE INDEX
+	unique     bool
+}
+
+// lateIndexes are the indexes of the tables that may be large already, they are built after the tables are created.
+var lateIndexes = []pgIndex{
+	{name: "idx_domain_original_dedup", definition: "ON urls (domain, original, dedup_user_id)", unique: true},
+	{name: "idx_domain_short", definition: "ON urls (domain, short)", unique: true},
+	{name: "idx_user_id_id", definition: "ON urls (user_id, id)"},
+	{name: "idx_urls_tags", definition: "ON urls USING GIN (tags)"},
+	{name: "idx_urls_search", definition: "ON urls USING GIN (" + searchDocument + ")"},
+	{name: "idx_urls_checked_at", definition: "ON urls (checked_at NULLS FIRST, id) WHERE NOT deleted"},
+	{name: "idx_urls_broken", definition: "ON urls (user_id) WHERE check_broken"},
+}
+
+// staleIndexes are the indexes replaced by lateIndexes, they are dropped after lateIndexes are built.
+var staleIndexes = []string{
+	"idx_user_id",        // covered by idx_user_id_id
+	"idx_original_dedup", // the unique (original, dedup_user_id), replaced by idx_domain_original_dedup
+}
+
+// createIndexesIfNeed builds the missing lateIndexes one by one and drops staleIndexes.
+//
+// The indexes are built concurrently (the table is not locked for writes) with their own deadline,
+// so the large table doesn't fail the start by the deadline of the tables creation.
+// The invalid index left by the failed build is dropped and built again.
+// The stale unique indexes keep the links unique until the indexes replacing them are built.
+func createIndexesIfNeed(db *sql.DB) {
+	for _, idx := range lateIndexes {
+		if err := createIndexIfNeed(db, idx); err != nil {
+			logger.Log.Fatal("creating postgresql index", zap.String("index", idx.name), zap.Error(err))
+		}
+	}
+
+	for _, name := range staleIndexes {
+		ctx, cancel := context.WithTimeout(context.Background(), IndexBuildTimeout)
+		_, err := db.ExecContext(ctx, "DROP INDEX CONCURRENTLY IF EXISTS "+name)
+		cancel()
+		if err != nil {
+			logger.Log.Fatal("dropping postgresql index", zap.String("index", name), zap.Error(err))
+		}
+	}
+}
+
+// createIndexIfNeed builds the index if it doesn't exist or is invalid.
+func createIndexIfNeed(db *sql.DB, idx pgIndex) error {
+	ctx, cancel := context.WithTimeout(context.Background(), IndexBuildTimeout)
+	defer cancel()
+
+	var valid bool
+	err := db.QueryRowContext(ctx,
+		`SELECT i.indisvalid FROM pg_index i JOIN pg_class c ON c.oid = i.indexrelid
+			WHERE c.relname = $1 AND pg_table_is_visible(c.oid)`, idx.name).Scan(&valid)
+	switch {
+	case err == nil && valid:
+		return nil
+	case err == nil:
+		logger.Log.Info("dropping invalid postgresql index", zap.String("index", idx.name))
+		if _, err = db.ExecContext(ctx, "DROP INDEX CONCURRENTLY IF EXISTS "+idx.name); err != nil {
+			return err
+		}
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	create := "CREATE INDEX"
+	if idx.unique {
+		create = "CREATE UNIQUE INDEX"
+	}
+	logger.Log.Info("building postgresql index", zap.String("index", idx.name))
+	_, err = db.ExecContext(ctx, create+" CONCURRENTLY IF NOT EXISTS "+idx.name+" "+idx.definition)
+	return err
+}
+
+func getNextUUID(ctx context.Context, tx *sql.Tx) (int64, error) {
+	var lastID int64
+	var isCalled bool
+	err := tx.QueryRowContext(ctx,
+		`SELECT last_value, is_called FROM urls_id_seq`).Scan(&lastID, &isCalled)
+	if err != nil {
+		return 0, err
+	}
+	if !isCalled {
+		return lastID, nil
+	}
+	return lastID + 1, nil
+}
+
+// nextDomainCode moves the code sequence of the domain by the delta (1 or -1 to return the code)
+// and returns the new last code, the sequence row is locked until the end of the transaction.
+func nextDomainCode(ctx context.Context, tx *sql.Tx, domain string, delta int64) (code int64, err error) {
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO domain_codes (domain, last_code) VALUES ($1, $2) "+
+			"ON CONFLICT (domain) DO UPDATE SET last_code = domain_codes.last_code + $2 RETURNING last_code",
+		domain, delta).Scan(&code)
+	return code, err
+}
+
+// splitLinkKeys returns the domains and the short codes of the link keys (in the same order).
+func splitLinkKeys(keys []string) (domains, codes []string) {
+	domains, codes = make([]string, len(keys)), make([]string, len(keys))
+	for i, key := range keys {
+		domains[i], codes[i] = model.SplitLinkKey(key)
+	}
+	return domains, codes
+}
+
+// selectByOrigURLs returns the rows of the original URLs on the domain by the deduplication mode
+// (the first row wins if there are duplicates left from the user mode).
+func selectByOrigURLs(ctx context.Context, db *sql.DB, domain string, origURLs []string, userID int64) (urlRows map[string]*model.URLRow, err error) {
+
+	logger.Log.Debug("selectByOrigURLs", zap.Any("origURLs", origURLs))
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, domain, short, original FROM urls WHERE domain = $3 AND original = any($1) AND ($2 = 0 OR user_id = $2) ORDER BY id DESC`,
+		origURLs, dedupUserID(userID), domain) // strings.Join(origURLs, ","))
+	if err != nil {
+		logger.FromContext(ctx).Error("creating query", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	urlRows = make(map[string]*model.URLRow)
+	for rows.Next() {
+		var urlRow model.URLRow
+		err = rows.Scan(&urlRow.ID, &urlRow.Domain, &urlRow.ShortURL, &urlRow.OrigURL)
+		if err != nil {
+			logger.FromContext(ctx).Error("scanning rows", zap.String("error", err.Error()))
+			return nil, err
+		}
+		urlRows[urlRow.OrigURL] = &urlRow
+	}
+
+	err = rows.Err()
+	if err != nil {
+		logger.FromContext(ctx).Error("checkin rows on errors", zap.String("error", err.Error()))
+		return nil, err
+	}
+
+	return urlRows, nil
+}
+
+func selectByShortURLs(ctx context.Context, db *sql.DB, shortURLs []string) (urlRows map[string]*model.URLRow, err error) {
+	domains, codes := splitLinkKeys(shortURLs)
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, domain, short, original, user_id, deleted FROM urls
+		WHERE (domain, short) IN (SELECT * FROM unnest($1::text[], $2::text[]))`,
+		domains, codes)
+	if err != nil {
+		logger.FromContext(ctx).Error("creating query", zap.String("error", err.Error()))
+		return nil, err
+	}
+	defer rows.Close()
+
+	urlRows = make(map[string]*model.URLRow)
+	for rows.Next() {
+		var urlRow model.URLRow
+		err = rows.Scan(&urlRow.ID, &urlRow.Domain, &urlRow.ShortURL, &urlRow.OrigURL, &urlRow.UserID, &urlRow.Deleted)
+		if err != nil {
+			logger.FromContext(ctx).Error("scanning rows", zap.String("error", err.Error()))
+			return nil, err
+		}
+		// the original URL is not unique in the user deduplication mode
+		urlRows[urlRow.Key()] = &urlRow
+	}
+
+	err = rows.Err()
+	if err != nil {
+		logger.FromContext(ctx).Error("checkin rows on errors", zap.String("error", err.Error()))
+		return nil, err
+	}
+
+	return urlRows, nil
+}
+
+// urlRowColumns are the columns read by scanURLRow.
+const urlRowColumns = "id, domain, short, original, user_id, deleted, created_at, title, preview, clicks, redirect_code, expires_at, " +
+	"forward_path, merge_query, notes, tags, meta_title, meta_description, meta_favicon, meta_error, meta_fetched_at, " +
+	"check_status, check_error, check_failures, check_broken, checked_at"
+
+// searchDocument is the full-text document of the link search, its words are the same as model.URLRow.SearchWords
+// returns (the letters and the digits between the other characters), so the search of all the storages is the same.
+const searchDocument = `to_tsvector('simple', regexp_replace(title || ' ' || notes || ' ' || original, '[^[:alnum:]]+', ' ', 'g'))`
+
+// scanURLRow scans the urlRowColumns of the row (created_at is null for the rows created before it was recorded,
+// expires_at is null for the links that never expire, meta_fetched_at is null until the destination page is fetched,
+// checked_at is null until the destination is checked).
+func scanURLRow(row interface{ Scan(dest ...any) error }) (*model.URLRow, error) {
+	var (
+		v                                    model.URLRow
+		meta                                 model.LinkMetadata
+		check                                model.LinkCheck
+		created, expiresAt, fetched, checked sql.NullTime
+	)
+	err := row.Scan(&v.ID, &v.Domain, &v.ShortURL, &v.OrigURL, &v.UserID, &v.Deleted, &created, &v.Title, &v.Preview, &v.Clicks,
+		&v.RedirectCode, &expiresAt, &v.ForwardPath, &v.MergeQuery, &v.Notes, pgtype.NewMap().SQLScanner(&v.Tags),
+		&meta.Title, &meta.Description, &meta.Favicon, &meta.Error, &fetched,
+		&check.Status, &check.Error, &check.Failures, &check.Broken, &checked)
+	if err != nil {
+		return nil, err
+	}
+	v.Created, v.ExpiresAt = created.Time, expiresAt.Time
+	if len(v.Tags) == 0 {
+		v.Tags = nil
+	}
+	if fetched.Valid {
+		meta.Fetched = fetched.Time
+		v.Meta = &meta
+	}
+	if checked.Valid {
+		check.Checked = checked.Time
+		v.Check = &check
+	}
+	return &v, nil
+}
+
+func findByShort(ctx context.Context, db *sql.DB, shortURL string) (urlRow *model.URLRow, exist bool, err error) {
+	domain, code := model.SplitLinkKey(shortURL)
+	urlRow, err = scanURLRow(db.QueryRowContext(ctx,
+		"SELECT "+urlRowColumns+" FROM urls WHERE domain = $1 AND short = $2",
+		domain, code))
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, false, nil
+	case err != nil:
+		return nil, false, err
+	default:
+		return urlRow, true, nil
+	}
+}
+
+// findByOrig returns the row of the original URL on the domain by the deduplication mode.
+func findByOrig(ctx context.Context, db *sql.DB, domain, origURL string, userID int64) (urlRow *model.URLRow, exist bool, err error) {
+	var v model.URLRow
+	err = db.QueryRowContext(ctx,
+		"SELECT id, domain, short, original, user_id FROM urls "+
+			"WHERE domain = $3 AND original = $1 AND ($2 = 0 OR user_id = $2) ORDER BY id LIMIT 1",
+		origURL, dedupUserID(userID), domain).Scan(&v.ID, &v.Domain, &v.ShortURL, &v.OrigURL, &v.UserID)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, false, nil
+	case err != nil:
+		return nil, false, err
+	default:
+		return &v, true, nil
+	}
+}
+
+// Sort keys of the user URLs (see userURLsSortKey).
+const (
+	userURLsCreatedKey = "coalesce((extract(epoch FROM created_at) * 1000000)::bigint, 0)"
+	userURLsClicksKey  = "clicks"
+)
+
+// findUserURLs selects the page of the user URLs by the keyset of the query.
+func findUserURLs(ctx context.Context, db *sql.DB, userID int64, q model.UserURLsQuery) (urlRowList []*model.URLRow, nextCursor string, err error) {
+	cursor, err := decodeUserURLsCursor(q)
+	if err != nil {
+		return nil, "", err
+	}
+
+	where := []string{"user_id = $1"}
+	args := []any{userID}
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	switch q.Status {
+	case model.URLStatusActive:
+		where = append(where, "NOT deleted AND (expires_at IS NULL OR expires_at > now())")
+	case model.URLStatusExpired:
+		where = append(where, "NOT deleted AND expires_at <= now()")
+	case model.URLStatusDeleted:
+		where = append(where, "deleted")
+	}
+	if !q.CreatedFrom.IsZero() {
+		where = append(where, "created_at >= "+arg(q.CreatedFrom))
+	}
+	if !q.CreatedTo.IsZero() {
+		where = append(where, "created_at < "+arg(q.CreatedTo))
+	}
+	if q.Domain != "" {
+		// the same authority as urlAuthority returns
+		where = append(where, "strpos(lower(substring(original FROM '^(?:[^:/?#]+://)?([^/?#]*)')), "+
+			arg(strings.ToLower(q.Domain))+") > 0")
+	}
+	if q.LinkDomains != nil {
+		where = append(where, "domain = any("+arg(q.LinkDomains)+")")
+	}
+	if len(q.Tags) != 0 {
+		where = append(where, "tags @> "+arg(q.Tags)+"::text[]")
+	}
+	if q.Broken {
+		where = append(where, "check_broken")
+	}
+	if words := model.SearchWords(q.Text); len(words) != 0 {
+		// every word is the prefix of a word of the document (the words have no operators of tsquery)
+		where = append(where, searchDocument+" @@ to_tsquery('simple', "+arg(strings.Join(words, ":* & ")+":*")+")")
+	}
+
+	key, cmp, order := userURLsCreatedKey, ">", "ASC"
+	if userURLsSort(q) == model.UserURLsSortClicks {
+		key = userURLsClicksKey
+	}
+	if q.Desc {
+		cmp, order = "<", "DESC"
+	}
+	if cursor != nil {
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)", key, cmp, arg(cursor.key), arg(cursor.id)))
+	}
+
+	query := "SELECT " + urlRowColumns + " FROM urls WHERE " + strings.Join(where, " AND ") +
+		fmt.Sprintf(" ORDER BY %s %s, id %s", key, order, order)
+	if q.Limit > 0 {
+		// one more row tells whether there is the next page
+		query += " LIMIT " + arg(q.Limit+1)
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.FromContext(ctx).Error("creating query", zap.String("error", err.Error()))
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	urlRowList = make([]*model.URLRow, 0)
+	for rows.Next() {
+		var row *model.URLRow
+		if row, err = scanURLRow(rows); err != nil {
+			logger.FromContext(ctx).Error("scanning rows", zap.String("error", err.Error()))
+			return nil, "", err
+		}
+		urlRowList = append(urlRowList, row)
+	}
+	if err = rows.Err(); err != nil {
+		logger.FromContext(ctx).Error("checkin rows on errors", zap.String("error", err.Error()))
+		return nil, "", err
+	}
+
+	if q.Limit > 0 && len(urlRowList) > q.Limit {
+		urlRowList = urlRowList[:q.Limit]
+		nextCursor = encodeUserURLsCursor(q, urlRowList[q.Limit-1])
+	}
+	return urlRowList, nextCursor, nil
 }
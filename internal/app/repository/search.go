@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/zasuchilas/shortener/internal/app/model"
+)
+
+// searchIndex is the index of the link tags and the search words of the RAM based storages
+// (see model.URLRow.SearchWords), it finds the user rows of the search queries without the scan of all the rows.
+//
+// The index keeps the terms of every row, so the old terms are removed when the row is indexed again
+// after its change. It is used under the storage lock.
+type searchIndex struct {
+	tags  map[int64]map[string]rowSet // by user ID and tag
+	words map[int64]map[string]rowSet // by user ID and word
+	terms map[int64]rowTerms          // by row ID
+}
+
+// rowSet is the set of the rows by ID.
+type rowSet map[int64]*model.URLRow
+
+// rowTerms are the terms of the indexed row.
+type rowTerms struct {
+	userID int64
+	tags   []string
+	words  []string
+}
+
+// newSearchIndex creates the empty index.
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		tags:  make(map[int64]map[string]rowSet),
+		words: make(map[int64]map[string]rowSet),
+		terms: make(map[int64]rowTerms),
+	}
+}
+
+// update indexes the new or changed rows.
+func (x *searchIndex) update(rows ...*model.URLRow) {
+	for _, row := range rows {
+		terms := rowTerms{userID: row.UserID, tags: row.Tags, words: row.SearchWords()}
+		if old, ok := x.terms[row.ID]; ok {
+			if old.userID == terms.userID && slices.Equal(old.tags, terms.tags) && slices.Equal(old.words, terms.words) {
+				continue
+			}
+			removeTerms(x.tags[old.userID], old.tags, row.ID)
+			removeTerms(x.words[old.userID], old.words, row.ID)
+		}
+		x.terms[row.ID] = terms
+		x.tags[row.UserID] = addTerms(x.tags[row.UserID], terms.tags, row)
+		x.words[row.UserID] = addTerms(x.words[row.UserID], terms.words, row)
+	}
+}
+
+// find returns the user rows having the tags and the words of the query,
+// ok is false if the query has no tags and no words (all the user rows are found).
+func (x *searchIndex) find(userID int64, q model.UserURLsQuery) (rows []*model.URLRow, ok bool) {
+	words := model.SearchWords(q.Text)
+	if len(q.Tags) == 0 && len(words) == 0 {
+		return nil, false
+	}
+
+	var found rowSet
+	for _, tag := range q.Tags {
+		found = intersectRows(found, x.tags[userID][tag])
+	}
+	for _, word := range words {
+		// the word is the beginning of the indexed words
+		prefixed := make(rowSet)
+		for indexed, set := range x.words[userID] {
+			if strings.HasPrefix(indexed, word) {
+				for id, row := range set {
+					prefixed[id] = row
+				}
+			}
+		}
+		found = intersectRows(found, prefixed)
+	}
+
+	rows = make([]*model.URLRow, 0, len(found))
+	for _, row := range found {
+		rows = append(rows, row)
+	}
+	return rows, true
+}
+
+// addTerms adds the row to the sets of the terms.
+func addTerms(index map[string]rowSet, terms []string, row *model.URLRow) map[string]rowSet {
+	if index == nil {
+		index = make(map[string]rowSet)
+	}
+	for _, term := range terms {
+		if index[term] == nil {
+			index[term] = make(rowSet)
+		}
+		index[term][row.ID] = row
+	}
+	return index
+}
+
+// removeTerms removes the row from the sets of the terms.
+func removeTerms(index map[string]rowSet, terms []string, id int64) {
+	for _, term := range terms {
+		delete(index[term], id)
+		if len(index[term]) == 0 {
+			delete(index, term)
+		}
+	}
+}
+
+// intersectRows returns the rows that are in both sets, the nil set a means all the rows.
+func intersectRows(a, b rowSet) rowSet {
+	if a == nil {
+		a = make(rowSet, len(b))
+		for id, row := range b {
+			a[id] = row
+		}
+		return a
+	}
+	for id := range a {
+		if _, ok := b[id]; !ok {
+			delete(a, id)
+		}
+	}
+	return a
+}
+
+// matchSearch reports whether the row has the tags and the words of the query.
+func matchSearch(q model.UserURLsQuery, row *model.URLRow) bool {
+	for _, tag := range q.Tags {
+		if !slices.Contains(row.Tags, tag) {
+			return false
+		}
+	}
+	words := model.SearchWords(q.Text)
+	if len(words) == 0 {
+		return true
+	}
+	rowWords := row.SearchWords()
+	for _, word := range words {
+		if !slices.ContainsFunc(rowWords, func(w string) bool { return strings.HasPrefix(w, word) }) {
+			return false
+		}
+	}
+	return true
+}
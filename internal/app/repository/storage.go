@@ -4,12 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/zasuchilas/shortener/internal/app/config"
 	"github.com/zasuchilas/shortener/internal/app/logger"
 	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/utils/hashfuncs"
 )
 
 // Names implementation of the storage interface.
@@ -19,14 +25,45 @@ const (
 	InstancePostgresql = "dbpgsql" // postgresql
 )
 
+// Deduplication modes of the original URLs (config.DedupMode).
+const (
+	DedupGlobal = "global" // one short URL for the original URL, the first user owns it
+	DedupUser   = "user"   // every user has own short URL for the original URL
+)
+
 // Errors returned from the package.
 var (
 	ErrNotFound   = errors.New("not found")
 	ErrGone       = errors.New("deleted")
 	ErrBadRequest = errors.New("bad request")
+	ErrForbidden  = errors.New("forbidden")
+	ErrConflict   = errors.New("conflict")
 )
 
+// WebhookLogSize is the number of the finished deliveries kept in the log of the webhook.
+const WebhookLogSize = 100
+
+// ExpiredError is returned if the link has expired, it has the row of the link (the owner is notified).
+//
+// It is ErrGone for errors.Is.
+type ExpiredError struct {
+	Row *model.URLRow
+}
+
+// Error _
+func (e *ExpiredError) Error() string {
+	return ErrGone.Error() + " the link has expired"
+}
+
+// Unwrap _
+func (e *ExpiredError) Unwrap() error {
+	return ErrGone
+}
+
 // IStorage describes the interface to be implemented.
+//
+// The short URLs passed to the storage are the link keys (see model.LinkKey), so the same short code
+// is the different links on the different domains.
 type IStorage interface {
 	// Stop stops the component.
 	Stop()
@@ -34,20 +71,30 @@ type IStorage interface {
 	// InstanceName returns current instance name.
 	InstanceName() string
 
-	// WriteURL writes URL in the storage.
-	WriteURL(ctx context.Context, origURL string, userID int64) (shortURL string, conflict bool, err error)
+	// WriteURL writes URL on the domain in the storage and returns the link key.
+	WriteURL(ctx context.Context, domain, origURL string, userID int64) (shortURL string, conflict bool, err error)
+
+	// ReadURL reads the row of the short URL from the storage and counts the visit.
+	ReadURL(ctx context.Context, shortURL string) (row *model.URLRow, err error)
 
-	// ReadURL reads URL from the storage.
-	ReadURL(ctx context.Context, shortURL string) (origURL string, err error)
+	// URLInfo reads the row of the short URL from the storage (the visit is not counted).
+	URLInfo(ctx context.Context, shortURL string) (row *model.URLRow, err error)
 
 	// Ping pings the storage.
 	Ping(ctx context.Context) error
 
-	// WriteURLs writes URLs in the storage.
-	WriteURLs(ctx context.Context, origURLs []string, userID int64) (urlRows map[string]*model.URLRow, err error)
+	// HealthCheck checks that the storage is able to serve requests.
+	HealthCheck(ctx context.Context) error
 
-	// UserURLs returns user URLs from storage.
-	UserURLs(ctx context.Context, userID int64) (urlRowList []*model.URLRow, err error)
+	// WriteURLs writes URLs on the domain in the storage.
+	//
+	// The short codes of the default domain are made of the row IDs, the other domains have own sequences.
+	WriteURLs(ctx context.Context, domain string, origURLs []string, userID int64) (urlRows map[string]*model.URLRow, err error)
+
+	// UserURLs returns the page of the user URLs from storage by the filters and the order of the query
+	// and the cursor of the next page (empty if it is the last page).
+	// ErrNotFound is returned if the user has no URLs, ErrBadRequest if the cursor is wrong.
+	UserURLs(ctx context.Context, userID int64, q model.UserURLsQuery) (urlRowList []*model.URLRow, nextCursor string, err error)
 
 	// CheckDeletedURLs checks deleting URLs.
 	CheckDeletedURLs(ctx context.Context, userID int64, shortURLs []string) error
@@ -55,11 +102,171 @@ type IStorage interface {
 	// DeleteURLs deletes URLs from the storage.
 	DeleteURLs(ctx context.Context, shortURLs ...string) error
 
-	// Stats returns urls and users count.
-	Stats(ctx context.Context) (int, error)
+	// UpdateURL changes the destination of the user short URL and records the revision.
+	//
+	// Returns nil revision if the destination is the same.
+	UpdateURL(ctx context.Context, userID int64, shortURL, origURL string) (revision *model.URLRevision, err error)
+
+	// URLRevisions returns the revisions of the user short URL (the first revision first).
+	URLRevisions(ctx context.Context, userID int64, shortURL string) (revisions []*model.URLRevision, err error)
+
+	// UpdateURLOptions changes the options of the user short URL (nil options are kept as they are).
+	UpdateURLOptions(ctx context.Context, userID int64, shortURL string, opts model.URLOptions) (row *model.URLRow, err error)
+
+	// SetURLMetadata saves the metadata of the destination page of the short URL.
+	//
+	// The metadata is skipped if the destination is not origURL anymore (it was changed while the page was fetched)
+	// or the link is deleted. ErrNotFound is returned if there is no such short URL.
+	SetURLMetadata(ctx context.Context, shortURL, origURL string, meta *model.LinkMetadata) error
+
+	// URLsToCheck returns no more than limit links (not deleted) whose destinations are not checked since the time,
+	// the links that are never checked first, then the oldest checks.
+	URLsToCheck(ctx context.Context, before time.Time, limit int) (urlRows []*model.URLRow, err error)
+
+	// SaveURLCheck saves the result of the check of the row returned by URLsToCheck.
+	//
+	// The result is skipped (false) if the link is checked by another instance, its destination is changed
+	// or it is deleted since the row was read. ErrNotFound is returned if there is no such short URL.
+	SaveURLCheck(ctx context.Context, row *model.URLRow, check *model.LinkCheck) (saved bool, err error)
+
+	// WriteDeleteTask saves the deletion task in the outbox and sets its ID.
+	WriteDeleteTask(ctx context.Context, task *model.DeleteTask) error
+
+	// PendingDeleteTasks returns the outbox deletion tasks that are not completed yet.
+	PendingDeleteTasks(ctx context.Context) (tasks []*model.DeleteTask, err error)
+
+	// CompleteDeleteTasks sets the final status (done or dead) for the outbox deletion tasks.
+	CompleteDeleteTasks(ctx context.Context, status string, ids ...int64) error
+
+	// WriteShortenJob saves the new shortening job with its lines and sets its ID.
+	WriteShortenJob(ctx context.Context, job *model.ShortenJob) error
+
+	// ShortenJob returns the shortening job without the lines (ErrNotFound if there is no such job).
+	ShortenJob(ctx context.Context, id int64) (job *model.ShortenJob, err error)
+
+	// ShortenJobLines returns no more than limit lines of the shortening job from the position.
+	ShortenJobLines(ctx context.Context, id int64, from, limit int) (lines []model.ShortenJobLine, err error)
+
+	// UpdateShortenJob saves the progress of the shortening job and the results of the processed lines (job.Lines).
+	UpdateShortenJob(ctx context.Context, job *model.ShortenJob) error
+
+	// PendingShortenJobs returns the IDs of the shortening jobs that are not finished yet (the oldest first).
+	PendingShortenJobs(ctx context.Context) (ids []int64, err error)
+
+	// DeleteShortenJobs removes the finished shortening jobs (with their lines) updated before the time.
+	DeleteShortenJobs(ctx context.Context, before time.Time) (deleted int, err error)
+
+	// WriteWebhook saves the new webhook of the user and sets its ID.
+	WriteWebhook(ctx context.Context, hook *model.Webhook) error
+
+	// UserWebhooks returns the webhooks of the user (the oldest first).
+	UserWebhooks(ctx context.Context, userID int64) (hooks []*model.Webhook, err error)
+
+	// DeleteWebhook deletes the webhook of the user (ErrNotFound if the user has no such webhook).
+	DeleteWebhook(ctx context.Context, userID, id int64) error
+
+	// WriteWebhookDeliveries saves the new deliveries and sets their IDs.
+	WriteWebhookDeliveries(ctx context.Context, deliveries []*model.WebhookDelivery) error
+
+	// UpdateWebhookDelivery saves the result of the delivery attempt.
+	//
+	// Only the last WebhookLogSize finished deliveries of the webhook are kept.
+	UpdateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+
+	// PendingWebhookDeliveries returns no more than limit pending deliveries to try before the time (the oldest first).
+	PendingWebhookDeliveries(ctx context.Context, before time.Time, limit int) (deliveries []*model.WebhookDelivery, err error)
+
+	// WebhookDeliveries returns no more than limit last deliveries of the user webhook (the newest first).
+	WebhookDeliveries(ctx context.Context, userID, id int64, limit int) (deliveries []*model.WebhookDelivery, err error)
+
+	// WriteBusEvents saves the link events in the outbox of the event bus and sets their IDs.
+	//
+	// The created, clicked and deleted events are saved by the storage with the change of the link,
+	// this method is for the events that are not the changes of the storage (the expiry).
+	WriteBusEvents(ctx context.Context, events []*model.BusEvent) error
+
+	// PendingBusEvents returns no more than limit outbox events that are not published yet (the oldest first).
+	PendingBusEvents(ctx context.Context, limit int) (events []*model.BusEvent, err error)
+
+	// CompleteBusEvents removes the published events from the outbox.
+	CompleteBusEvents(ctx context.Context, ids ...int64) error
+
+	// LeaseBusRelay takes or renews the lease of the outbox relay for the owner for the ttl.
+	//
+	// Returns false if the lease is held by another owner, so only one instance publishes the events.
+	LeaseBusRelay(ctx context.Context, owner string, ttl time.Duration) (leased bool, err error)
+
+	// Stats returns urls count by domain.
+	Stats(ctx context.Context) (domains map[string]int, err error)
+
+	// MigrateOrigURLs rewrites the original URLs of the existing rows with the migrate function.
+	//
+	// The row is kept as is if its new original URL belongs to another row (both short URLs keep working).
+	MigrateOrigURLs(ctx context.Context, migrate func(origURL string) (string, error)) (*model.URLMigration, error)
+}
+
+// IFileStorage is implemented by the storages that keep data in local files.
+type IFileStorage interface {
+	// FilePaths returns the paths of the storage files.
+	FilePaths() []string
+}
+
+// CheckDedupMode checks the deduplication mode (empty means global).
+func CheckDedupMode(mode string) error {
+	switch mode {
+	case "", DedupGlobal, DedupUser:
+		return nil
+	default:
+		return fmt.Errorf("unknown deduplication mode %q (expected %s or %s)", mode, DedupGlobal, DedupUser)
+	}
+}
+
+// dedupUserID returns the user the original URL is deduplicated for (0 means for all users).
+func dedupUserID(userID int64) int64 {
+	if config.DedupMode == DedupUser {
+		return userID
+	}
+	return 0
+}
+
+// dedupKey returns the key of the original URL on the domain in the urls index of the RAM based storages.
+func dedupKey(domain, origURL string, userID int64) string {
+	key := origURL
+	if id := dedupUserID(userID); id != 0 {
+		key = strconv.FormatInt(id, 10) + " " + origURL
+	}
+	if domain != "" {
+		key = domain + " " + key
+	}
+	return key
+}
+
+// nextShortURL returns the short code of the new row of the RAM based storages (the caller holds the lock).
+//
+// The codes of the default domain are made of the row IDs, the codes of the other domains are made of
+// their own sequences, so the same code is used on every domain.
+func nextShortURL(domain string, id int64, codes map[string]int64) string {
+	if domain == "" {
+		return hashfuncs.EncodeZeroHash(id)
+	}
+	codes[domain]++
+	return hashfuncs.EncodeZeroHash(codes[domain])
+}
+
+// domainStats returns the number of the rows by domain of the RAM based storages.
+func domainStats(hash map[string]*model.URLRow) map[string]int {
+	res := make(map[string]int)
+	for _, row := range hash {
+		res[row.Domain]++
+	}
+	return res
 }
 
 // checkUserURLs checks whether the user has the ability to delete the url data.
+//
+// Only the owner can delete the row. In the global deduplication mode the short URL returned to another user
+// with a conflict stays owned by the user who shortened the original URL first,
+// in the user mode every user has own rows, so the conflicting short URLs are always deletable.
 func checkUserURLs(userID int64, urlRows map[string]*model.URLRow) error {
 
 	logger.Log.Debug("checking user urls", zap.Any("urls", urlRows))
@@ -72,13 +279,14 @@ func checkUserURLs(userID int64, urlRows map[string]*model.URLRow) error {
 	forbiddenRows := make([]string, 0)
 	for _, row := range urlRows {
 		if row.UserID != userID {
-			forbiddenRows = append(forbiddenRows, row.ShortURL)
+			forbiddenRows = append(forbiddenRows, row.Key())
 		}
 		if row.Deleted {
-			alreadyDeleted = append(alreadyDeleted, row.ShortURL)
+			alreadyDeleted = append(alreadyDeleted, row.Key())
 		}
 	}
 	if len(forbiddenRows) > 0 {
+		sort.Strings(forbiddenRows)
 		return fmt.Errorf("%w you can't delete other people's short links (%s)", ErrBadRequest, strings.Join(forbiddenRows, ", "))
 	}
 	if len(alreadyDeleted) == len(urlRows) {
@@ -87,3 +295,412 @@ func checkUserURLs(userID int64, urlRows map[string]*model.URLRow) error {
 
 	return nil
 }
+
+// checkUserURL checks whether the user owns the url data.
+func checkUserURL(userID int64, row *model.URLRow) error {
+	switch {
+	case row == nil:
+		return fmt.Errorf("%w", ErrNotFound)
+	case row.UserID != userID:
+		return fmt.Errorf("%w you can't change other people's short links", ErrForbidden)
+	}
+	return nil
+}
+
+// isExpired reports whether the link has expired.
+func isExpired(row *model.URLRow) bool {
+	return !row.ExpiresAt.IsZero() && !row.ExpiresAt.After(time.Now())
+}
+
+// openRow checks that the short URL of the RAM based storages can be opened and returns the copy of its row,
+// so the caller can't change the storage.
+//
+// The deleted and expired links are gone.
+func openRow(row *model.URLRow) (*model.URLRow, error) {
+	switch {
+	case row == nil:
+		return nil, fmt.Errorf("%w", ErrNotFound)
+	case row.Deleted:
+		return nil, fmt.Errorf("%w", ErrGone)
+	}
+	found := *row
+	if isExpired(row) {
+		return nil, &ExpiredError{Row: &found}
+	}
+	return &found, nil
+}
+
+// setURLOptions checks the changing of the row options in the RAM based storages and applies them
+// (the expired link can be changed, so the owner can prolong it).
+func setURLOptions(userID int64, row *model.URLRow, opts model.URLOptions) error {
+	if err := checkUserURL(userID, row); err != nil {
+		return err
+	}
+	if row.Deleted {
+		return fmt.Errorf("%w", ErrGone)
+	}
+	if opts.Title != nil {
+		row.Title = *opts.Title
+	}
+	if opts.Notes != nil {
+		row.Notes = *opts.Notes
+	}
+	if opts.Tags != nil {
+		row.Tags = slices.Clone(*opts.Tags)
+	}
+	if opts.Preview != nil {
+		row.Preview = *opts.Preview
+	}
+	if opts.RedirectCode != nil {
+		row.RedirectCode = *opts.RedirectCode
+	}
+	if opts.ExpiresAt != nil {
+		row.ExpiresAt = *opts.ExpiresAt
+	}
+	if opts.ForwardPath != nil {
+		row.ForwardPath = *opts.ForwardPath
+	}
+	if opts.MergeQuery != nil {
+		row.MergeQuery = *opts.MergeQuery
+	}
+	return nil
+}
+
+// setURLMetadata sets the metadata of the row of the RAM based storages,
+// reports false if the metadata is skipped (see IStorage.SetURLMetadata).
+func setURLMetadata(row *model.URLRow, origURL string, meta *model.LinkMetadata) (bool, error) {
+	switch {
+	case row == nil:
+		return false, fmt.Errorf("%w", ErrNotFound)
+	case row.Deleted || row.OrigURL != origURL:
+		return false, nil
+	}
+	saved := *meta
+	row.Meta = &saved
+	return true, nil
+}
+
+// urlsToCheck returns the copies of the rows of the RAM based storages to check (see IStorage.URLsToCheck).
+func urlsToCheck(rows map[string]*model.URLRow, before time.Time, limit int) []*model.URLRow {
+	res := make([]*model.URLRow, 0)
+	for _, row := range rows {
+		if row.Deleted || (row.Check != nil && !row.Check.Checked.Before(before)) {
+			continue
+		}
+		found := *row
+		res = append(res, &found)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		a, b := lastChecked(res[i]), lastChecked(res[j])
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return res[i].ID < res[j].ID
+	})
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+// lastChecked returns the time of the last check of the row (zero if it is never checked).
+func lastChecked(row *model.URLRow) time.Time {
+	if row.Check == nil {
+		return time.Time{}
+	}
+	return row.Check.Checked
+}
+
+// setURLCheck sets the result of the check of the row of the RAM based storages,
+// reports false if the result is skipped (see IStorage.SaveURLCheck).
+func setURLCheck(row, checked *model.URLRow, check *model.LinkCheck) (bool, error) {
+	switch {
+	case row == nil:
+		return false, fmt.Errorf("%w", ErrNotFound)
+	case row.Deleted || row.OrigURL != checked.OrigURL || !lastChecked(row).Equal(lastChecked(checked)):
+		return false, nil
+	}
+	saved := *check
+	row.Check = &saved
+	return true, nil
+}
+
+// newRevision checks the changing of the row destination in the RAM based storages
+// and returns the revision to record (nil if the destination is the same).
+func newRevision(
+	userID int64,
+	row *model.URLRow,
+	origURL string,
+	urls map[string]*model.URLRow,
+	revisions []*model.URLRevision,
+) (*model.URLRevision, error) {
+	if err := checkUserURL(userID, row); err != nil {
+		return nil, err
+	}
+	if row.Deleted {
+		return nil, fmt.Errorf("%w", ErrGone)
+	}
+	if row.OrigURL == origURL {
+		return nil, nil
+	}
+	if other, ok := urls[dedupKey(row.Domain, origURL, row.UserID)]; ok && other != row {
+		return nil, fmt.Errorf("%w the destination already has the short link %s", ErrConflict, other.Key())
+	}
+
+	return &model.URLRevision{
+		Revision: int64(len(revisions)) + 1,
+		ShortURL: row.Key(),
+		OrigURL:  origURL,
+		PrevURL:  row.OrigURL,
+		UserID:   userID,
+		Time:     time.Now(),
+	}, nil
+}
+
+// setOrigURL changes the original URL of the row and the urls index of the RAM based storages.
+func setOrigURL(urls map[string]*model.URLRow, row *model.URLRow, origURL string) {
+	if oldKey := dedupKey(row.Domain, row.OrigURL, row.UserID); urls[oldKey] == row {
+		delete(urls, oldKey)
+	}
+	row.OrigURL = origURL
+	urls[dedupKey(row.Domain, origURL, row.UserID)] = row
+}
+
+// copyRevisions returns the copies of the revisions, so the caller can't change the storage.
+func copyRevisions(revisions []*model.URLRevision) []*model.URLRevision {
+	res := make([]*model.URLRevision, len(revisions))
+	for i, revision := range revisions {
+		found := *revision
+		res[i] = &found
+	}
+	return res
+}
+
+// sortDeleteTasks orders the outbox deletion tasks by acceptance (ID).
+func sortDeleteTasks(tasks []*model.DeleteTask) {
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].ID < tasks[j].ID
+	})
+}
+
+// migrateRows rewrites the original URLs of the rows (ordered by ID) and the urls index of the RAM based storages.
+func migrateRows(rows []*model.URLRow, urls map[string]*model.URLRow, migrate func(string) (string, error)) *model.URLMigration {
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].ID < rows[j].ID
+	})
+
+	res := &model.URLMigration{}
+	for _, row := range rows {
+		res.Checked++
+		newURL, err := migrate(row.OrigURL)
+		if err != nil {
+			logger.Log.Info("migrating original URL", zap.String("shortURL", row.Key()), zap.String("error", err.Error()))
+			res.Failed++
+			continue
+		}
+		if newURL == row.OrigURL {
+			continue
+		}
+		newKey := dedupKey(row.Domain, newURL, row.UserID)
+		if other, ok := urls[newKey]; ok && other != row {
+			res.Conflicts++
+			continue
+		}
+
+		setOrigURL(urls, row, newURL)
+		res.Updated++
+	}
+
+	return res
+}
+
+// copyShortenJob returns the copy of the shortening job of the RAM based storages without the lines.
+func copyShortenJob(job *model.ShortenJob) *model.ShortenJob {
+	found := *job
+	found.Lines = nil
+	return &found
+}
+
+// shortenJobLines returns the copies of no more than limit lines of the job from the position.
+func shortenJobLines(job *model.ShortenJob, from, limit int) []model.ShortenJobLine {
+	from = max(0, min(from, len(job.Lines)))
+	to := min(from+max(0, limit), len(job.Lines))
+	lines := make([]model.ShortenJobLine, to-from)
+	copy(lines, job.Lines[from:to])
+	return lines
+}
+
+// applyShortenJob applies the progress and the results of the processed lines to the stored job
+// (the lines out of the job are ignored).
+func applyShortenJob(stored, job *model.ShortenJob) {
+	stored.Status = job.Status
+	stored.Processed = job.Processed
+	stored.Failed = job.Failed
+	stored.Error = job.Error
+	stored.Updated = job.Updated
+	for _, line := range job.Lines {
+		if line.N >= 0 && line.N < len(stored.Lines) {
+			stored.Lines[line.N] = line
+		}
+	}
+}
+
+// pendingShortenJobs returns the IDs of the shortening jobs of the RAM based storages that are not finished yet.
+func pendingShortenJobs(jobs map[int64]*model.ShortenJob) []int64 {
+	ids := make([]int64, 0)
+	for id, job := range jobs {
+		if !job.Finished() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// expiredShortenJobs returns the IDs of the shortening jobs of the RAM based storages
+// that are finished and updated before the time.
+func expiredShortenJobs(jobs map[int64]*model.ShortenJob, before time.Time) []int64 {
+	ids := make([]int64, 0)
+	for id, job := range jobs {
+		if job.Finished() && job.Updated.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// copyWebhook returns the copy of the webhook of the RAM based storages, so the caller can't change the storage.
+func copyWebhook(hook *model.Webhook) *model.Webhook {
+	found := *hook
+	found.Events = append([]string(nil), hook.Events...)
+	return &found
+}
+
+// userWebhooks returns the copies of the user webhooks of the RAM based storages (the oldest first).
+func userWebhooks(hooks map[int64]*model.Webhook, userID int64) []*model.Webhook {
+	res := make([]*model.Webhook, 0)
+	for _, hook := range hooks {
+		if hook.UserID == userID {
+			res = append(res, copyWebhook(hook))
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// pendingWebhookDeliveries returns the copies of the pending deliveries of the RAM based storages
+// to try before the time (the oldest first).
+func pendingWebhookDeliveries(deliveries map[int64]*model.WebhookDelivery, before time.Time, limit int) []*model.WebhookDelivery {
+	res := make([]*model.WebhookDelivery, 0)
+	for _, delivery := range deliveries {
+		if delivery.Status == model.WebhookDeliveryPending && !delivery.NextTry.After(before) {
+			found := *delivery
+			res = append(res, &found)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+// webhookDeliveries returns the copies of the last deliveries of the webhook of the RAM based storages
+// (the newest first).
+func webhookDeliveries(deliveries map[int64]*model.WebhookDelivery, id int64, limit int) []*model.WebhookDelivery {
+	res := make([]*model.WebhookDelivery, 0)
+	for _, delivery := range deliveries {
+		if delivery.WebhookID == id {
+			found := *delivery
+			res = append(res, &found)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID > res[j].ID
+	})
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+// pruneWebhookDeliveries removes the deliveries of the webhook of the RAM based storages
+// except for the pending ones and the last WebhookLogSize finished ones (all of them if the webhook is deleted).
+func pruneWebhookDeliveries(deliveries map[int64]*model.WebhookDelivery, id int64, deleted bool) {
+	finished := make([]int64, 0)
+	for deliveryID, delivery := range deliveries {
+		if delivery.WebhookID != id {
+			continue
+		}
+		if deleted {
+			delete(deliveries, deliveryID)
+			continue
+		}
+		if delivery.Status != model.WebhookDeliveryPending {
+			finished = append(finished, deliveryID)
+		}
+	}
+	if len(finished) <= WebhookLogSize {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i] > finished[j]
+	})
+	for _, deliveryID := range finished[WebhookLogSize:] {
+		delete(deliveries, deliveryID)
+	}
+}
+
+// busEnabled reports whether the link events are saved in the outbox of the event bus.
+//
+// The events are not saved if there is no relay to publish them.
+func busEnabled() bool {
+	return config.EventBus != ""
+}
+
+// newBusEvent returns the outbox event of the link.
+func newBusEvent(eventType string, row *model.URLRow) *model.BusEvent {
+	return &model.BusEvent{
+		Type:     eventType,
+		UserID:   row.UserID,
+		Domain:   row.Domain,
+		ShortURL: row.ShortURL,
+		OrigURL:  row.OrigURL,
+		Time:     time.Now(),
+	}
+}
+
+// pendingBusEvents returns the copies of the first events of the outbox of the RAM based storages.
+func pendingBusEvents(events []*model.BusEvent, limit int) []*model.BusEvent {
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	res := make([]*model.BusEvent, len(events))
+	for i, event := range events {
+		found := *event
+		res[i] = &found
+	}
+	return res
+}
+
+// completeBusEvents removes the published events from the outbox of the RAM based storages.
+func completeBusEvents(events []*model.BusEvent, ids []int64) []*model.BusEvent {
+	published := make(map[int64]struct{}, len(ids))
+	for _, id := range ids {
+		published[id] = struct{}{}
+	}
+	res := events[:0]
+	for _, event := range events {
+		if _, ok := published[event.ID]; !ok {
+			res = append(res, event)
+		}
+	}
+	clear(events[len(res):])
+	return res
+}
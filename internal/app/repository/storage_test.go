@@ -3,6 +3,8 @@ package repository
 import (
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+
 	"github.com/zasuchilas/shortener/internal/app/model"
 )
 
@@ -13,6 +15,10 @@ func Test_checkUserURLs(t *testing.T) {
 	}
 
 	rows := make(map[string]*model.URLRow, 1)
+	foreign := map[string]*model.URLRow{
+		"1": {ShortURL: "1", OrigURL: "1", UserID: 1},
+		"2": {ShortURL: "2", OrigURL: "1", UserID: 2},
+	}
 	rows["1"] = &model.URLRow{
 		ID:       0,
 		ShortURL: "1",
@@ -34,6 +40,22 @@ func Test_checkUserURLs(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "own rows",
+			args: args{
+				userID:  1,
+				urlRows: rows,
+			},
+			wantErr: false,
+		},
+		{
+			name: "foreign row of the same original URL",
+			args: args{
+				userID:  2,
+				urlRows: foreign,
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -43,3 +65,10 @@ func Test_checkUserURLs(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckDedupMode(t *testing.T) {
+	assert.NoError(t, CheckDedupMode(""))
+	assert.NoError(t, CheckDedupMode(DedupGlobal))
+	assert.NoError(t, CheckDedupMode(DedupUser))
+	assert.ErrorContains(t, CheckDedupMode("shared"), `unknown deduplication mode "shared"`)
+}
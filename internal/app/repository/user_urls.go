@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zasuchilas/shortener/internal/app/model"
+)
+
+// userURLsCursor is the position after the last row of the page: the sort key and the row ID
+// (the ID makes the position unique, if the keys are equal).
+type userURLsCursor struct {
+	sort string
+	key  int64
+	id   int64
+}
+
+// encodeUserURLsCursor returns the opaque cursor after the row.
+func encodeUserURLsCursor(q model.UserURLsQuery, row *model.URLRow) string {
+	raw := fmt.Sprintf("%s:%d:%d", userURLsSort(q), userURLsSortKey(q, row), row.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeUserURLsCursor parses the cursor of the query (nil if it is the first page).
+//
+// The cursor of another order is not accepted.
+func decodeUserURLsCursor(q model.UserURLsQuery) (*userURLsCursor, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+
+	wrong := fmt.Errorf("%w wrong cursor %q", ErrBadRequest, q.Cursor)
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, wrong
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 || parts[0] != userURLsSort(q) {
+		return nil, wrong
+	}
+	c := &userURLsCursor{sort: parts[0]}
+	if c.key, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return nil, wrong
+	}
+	if c.id, err = strconv.ParseInt(parts[2], 10, 64); err != nil {
+		return nil, wrong
+	}
+	return c, nil
+}
+
+// userURLsSort returns the order of the query (by the creation time by default).
+func userURLsSort(q model.UserURLsQuery) string {
+	if q.Sort == "" {
+		return model.UserURLsSortCreated
+	}
+	return q.Sort
+}
+
+// userURLsSortKey returns the sort key of the row: the number of visits or the creation time in microseconds
+// (the precision of postgresql, 0 for the rows created before it was recorded).
+func userURLsSortKey(q model.UserURLsQuery, row *model.URLRow) int64 {
+	if userURLsSort(q) == model.UserURLsSortClicks {
+		return row.Clicks
+	}
+	if row.Created.IsZero() {
+		return 0
+	}
+	return row.Created.UnixMicro()
+}
+
+// urlAuthority returns the lowercase authority of the destination (the host with the port and the user info),
+// the same as it is matched in postgresql.
+func urlAuthority(origURL string) string {
+	rest := origURL
+	if i := strings.Index(rest, "://"); i >= 0 && !strings.ContainsAny(rest[:i], "/?#") {
+		rest = rest[i+3:]
+	}
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	return strings.ToLower(rest)
+}
+
+// matchUserURL reports whether the row passes the filters of the query.
+func matchUserURL(q model.UserURLsQuery, row *model.URLRow) bool {
+	switch q.Status {
+	case model.URLStatusActive:
+		if row.Deleted || isExpired(row) {
+			return false
+		}
+	case model.URLStatusExpired:
+		if row.Deleted || !isExpired(row) {
+			return false
+		}
+	case model.URLStatusDeleted:
+		if !row.Deleted {
+			return false
+		}
+	}
+	if !q.CreatedFrom.IsZero() && (row.Created.IsZero() || row.Created.Before(q.CreatedFrom)) {
+		return false
+	}
+	if !q.CreatedTo.IsZero() && (row.Created.IsZero() || !row.Created.Before(q.CreatedTo)) {
+		return false
+	}
+	if q.Domain != "" && !strings.Contains(urlAuthority(row.OrigURL), strings.ToLower(q.Domain)) {
+		return false
+	}
+	if q.LinkDomains != nil && !slices.Contains(q.LinkDomains, row.Domain) {
+		return false
+	}
+	if q.Broken && (row.Check == nil || !row.Check.Broken) {
+		return false
+	}
+	return matchSearch(q, row)
+}
+
+// userURLsPage returns the page of the user rows of the RAM based storages (the rows are copied,
+// so the caller can't change the storage) and the cursor of the next page.
+//
+// It is called under the storage lock.
+func userURLsPage(rows []*model.URLRow, q model.UserURLsQuery) (urlRowList []*model.URLRow, nextCursor string, err error) {
+	cursor, err := decodeUserURLsCursor(q)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// less reports whether the position a goes before b in the order of the query
+	less := func(keyA, idA, keyB, idB int64) bool {
+		if q.Desc {
+			keyA, idA, keyB, idB = keyB, idB, keyA, idA
+		}
+		return keyA < keyB || keyA == keyB && idA < idB
+	}
+
+	urlRowList = make([]*model.URLRow, 0)
+	for _, row := range rows {
+		if !matchUserURL(q, row) {
+			continue
+		}
+		if cursor != nil && !less(cursor.key, cursor.id, userURLsSortKey(q, row), row.ID) {
+			continue
+		}
+		found := *row
+		urlRowList = append(urlRowList, &found)
+	}
+	sort.Slice(urlRowList, func(i, j int) bool {
+		a, b := urlRowList[i], urlRowList[j]
+		return less(userURLsSortKey(q, a), a.ID, userURLsSortKey(q, b), b.ID)
+	})
+
+	if q.Limit > 0 && len(urlRowList) > q.Limit {
+		urlRowList = urlRowList[:q.Limit]
+		nextCursor = encodeUserURLsCursor(q, urlRowList[q.Limit-1])
+	}
+	return urlRowList, nextCursor, nil
+}
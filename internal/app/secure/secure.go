@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"sync"
 
 	"github.com/zasuchilas/shortener/internal/app/model"
@@ -17,6 +18,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/metrics"
 	"github.com/zasuchilas/shortener/internal/app/utils/filefuncs"
 	"github.com/zasuchilas/shortener/internal/app/utils/hashfuncs"
 )
@@ -30,6 +32,8 @@ type Secure struct {
 
 	persist             bool
 	filePath            string
+	writer              *filefuncs.FileWriter
+	stopped             bool
 	users               map[int64]*model.UserRow
 	lastUserID          int64
 	storageInstanceName string
@@ -136,6 +140,7 @@ func (s *Secure) NewUser(_ context.Context) (userID int64, err error) {
 
 	s.users[nextUserID] = nextUser
 	s.lastUserID = nextUserID
+	metrics.UsersCreated.Inc()
 	logger.Log.Debug("inserted new user row",
 		zap.Int64("userID", nextUserID),
 		zap.String("userHash", userHash),
@@ -160,6 +165,25 @@ func (s *Secure) CheckUser(_ context.Context, userID int64, userHash string) (fo
 	return true, err
 }
 
+// HealthCheck checks that new users can be saved.
+func (s *Secure) HealthCheck(_ context.Context) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if !s.persist {
+		return nil
+	}
+	if s.stopped {
+		return errors.New("secure storage is stopped")
+	}
+
+	f, err := os.OpenFile(s.filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
 // UsersCount returns users count.
 func (s *Secure) UsersCount() int {
 	s.mutex.RLock()
@@ -259,19 +283,43 @@ func (s *Secure) loadFromFile() (lastUserID int64, err error) {
 	return lastUserID, nil
 }
 
+// Stop closes the secure data file.
+//
+// New users can't be created after stopping.
+func (s *Secure) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.stopped = true
+	if s.writer == nil {
+		return
+	}
+	if err := s.writer.Close(); err != nil {
+		logger.Log.Error("closing secure data file", zap.Error(err))
+	}
+	s.writer = nil
+}
+
 // writeUserPersist writes user data into secure storage file.
+//
+// The file is opened on the first write and stays open until Stop.
 func (s *Secure) writeUserPersist(user *model.UserRow) error {
 	if !s.persist {
 		return nil
 	}
+	if s.stopped {
+		return errors.New("secure storage is stopped")
+	}
 
-	w, err := filefuncs.NewFileWriter(s.filePath)
-	if err != nil {
-		return err
+	if s.writer == nil {
+		w, err := filefuncs.NewFileWriter(s.filePath)
+		if err != nil {
+			return err
+		}
+		s.writer = w
 	}
-	defer w.Close()
 
-	return w.WriteUserRow(user)
+	return s.writer.WriteUserRow(user)
 }
 
 // generateRandom generates random bytes.
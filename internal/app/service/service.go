@@ -6,13 +6,36 @@ import (
 	"github.com/zasuchilas/shortener/internal/app/model"
 )
 
+// ShortenChunkSize is the maximum number of URLs written by ShortenChunk in one storage transaction.
+//
+// The bulk APIs split the uploads into the chunks of this size, so every transaction is short.
+const ShortenChunkSize = 100
+
+// ShortenJobMaxLines is the maximum number of lines of the asynchronous shortening job.
+const ShortenJobMaxLines = 100000
+
 // ShortenerService _
 type ShortenerService interface {
 	Ping(ctx context.Context) error
-	ReadURL(ctx context.Context, shortURL string) (origURL string, err error)
-	WriteURL(ctx context.Context, rawURL string, userID int64) (readyURL string, conflict bool, err error)
-	ShortenBatch(ctx context.Context, in []model.ShortenBatchIn, userID int64) (out []model.ShortenBatchOut, err error)
+	Health(ctx context.Context) *model.HealthReport
+	ReadURL(ctx context.Context, in model.OpenURLIn) (origURL string, err error)
+	OpenURL(ctx context.Context, in model.OpenURLIn) (out *model.OpenedURL, err error)
+	WriteURL(ctx context.Context, rawURL, rawDomain string, userID int64) (readyURL string, conflict bool, err error)
+	ShortenBatch(ctx context.Context, in []model.ShortenBatchIn, rawDomain string, userID int64) (out []model.ShortenBatchOut, err error)
+	ShortenChunk(ctx context.Context, in []model.ShortenBatchIn, userID int64) (out []model.ShortenItemOut, err error)
+	SubmitShortenJob(ctx context.Context, lines []model.ShortenJobLine, userID int64) (out *model.ShortenJob, err error)
+	ShortenJob(ctx context.Context, id, userID int64) (out *model.ShortenJob, err error)
+	ShortenJobResults(ctx context.Context, id, userID int64, from, limit int) (out []model.ShortenJobLine, err error)
 	DeleteURLs(ctx context.Context, rawShortURLs []string, userID int64) error
-	UserURLs(ctx context.Context, userID int64) (out []model.UserURL, err error)
+	CreateWebhook(ctx context.Context, rawURL string, events []string, userID int64) (out *model.Webhook, err error)
+	UserWebhooks(ctx context.Context, userID int64) (out []model.Webhook, err error)
+	DeleteWebhook(ctx context.Context, id, userID int64) error
+	WebhookDeliveries(ctx context.Context, id, userID int64) (out []model.WebhookDelivery, err error)
+	UpdateURL(ctx context.Context, rawShortURL, rawURL string, userID int64) (out *model.UserURL, err error)
+	URLRevisions(ctx context.Context, rawShortURL string, userID int64) (out []model.URLRevision, err error)
+	UpdateURLOptions(ctx context.Context, rawShortURL string, opts model.URLOptions, userID int64) (out *model.UserURL, err error)
+	UserURLs(ctx context.Context, userID int64, q model.UserURLsQuery) (out *model.UserURLsPage, err error)
+	QRCode(ctx context.Context, rawShortURL string, opts model.QROptions) (out *model.QRCode, err error)
+	ReadyURLQRCode(ctx context.Context, readyURL string, opts model.QROptions) (out *model.QRCode, err error)
 	Stats(ctx context.Context) (out *model.Stats, err error)
 }
@@ -7,21 +7,30 @@ import (
 	"strings"
 	"time"
 
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/logger"
 	"github.com/zasuchilas/shortener/internal/app/model"
 	"github.com/zasuchilas/shortener/internal/app/repository"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
 )
 
 // DeleteURLs _
-func (s *service) DeleteURLs(ctx context.Context, rawShortURLs []string, userID int64) error {
+func (s *service) DeleteURLs(ctx context.Context, rawShortURLs []string, userID int64) (err error) {
+	ctx, span := tracing.Start(ctx, "shortener.DeleteURLs")
+	defer func() { tracing.End(span, err) }()
 
 	// clearing data
 	var shortURLs []string
 	for _, rawShortURL := range rawShortURLs {
-		clean := strings.TrimSpace(rawShortURL)
-		if len(clean) == 0 {
+		if len(strings.TrimSpace(rawShortURL)) == 0 {
 			continue
 		}
-		shortURLs = append(shortURLs, clean)
+		key, e := shortURLKey(rawShortURL)
+		if e != nil {
+			return e
+		}
+		shortURLs = append(shortURLs, key)
 	}
 
 	// checking request data (1)
@@ -36,7 +45,7 @@ func (s *service) DeleteURLs(ctx context.Context, rawShortURLs []string, userID
 	}
 
 	// checking request data (3)
-	err := s.shortenerRepo.CheckDeletedURLs(ctx, userID, shortURLs)
+	err = s.shortenerRepo.CheckDeletedURLs(ctx, userID, shortURLs)
 	if err != nil {
 		if errors.Is(err, repository.ErrBadRequest) {
 			return fmt.Errorf("%w", model.ErrBadRequest)
@@ -44,11 +53,24 @@ func (s *service) DeleteURLs(ctx context.Context, rawShortURLs []string, userID
 		return err
 	}
 
-	s.deleteCh <- model.DeleteTask{
+	// saving the task in the outbox, so it survives the restart
+	task := model.DeleteTask{
 		Time:      time.Now(),
 		UserID:    userID,
 		ShortURLs: shortURLs,
 	}
+	if err = s.shortenerRepo.WriteDeleteTask(ctx, &task); err != nil {
+		return fmt.Errorf("saving the deletion task %w", err)
+	}
+
+	// the request goroutine must not wait for the worker
+	select {
+	case s.deleteCh <- task:
+	default:
+		// the worker will pick the task up from the outbox
+		s.deleteResync.Store(true)
+		logger.FromContext(ctx).Info("the deletion queue is full, the task is left in the outbox", zap.Int64("id", task.ID))
+	}
 
 	return nil
 }
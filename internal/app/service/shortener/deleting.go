@@ -0,0 +1,277 @@
+package shortener
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/metrics"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
+)
+
+type (
+	// deleteItem is the deletion task waiting in the worker queue.
+	deleteItem struct {
+		task     model.DeleteTask
+		attempts int
+		nextTry  time.Time
+	}
+
+	// deleteQueue is the worker queue of the deletion tasks (accessed by the worker goroutine only).
+	deleteQueue struct {
+		items map[int64]*deleteItem
+	}
+)
+
+func newDeleteQueue() *deleteQueue {
+	return &deleteQueue{items: make(map[int64]*deleteItem)}
+}
+
+// push adds the task to the queue if it is not there yet.
+func (q *deleteQueue) push(task model.DeleteTask) {
+	if _, ok := q.items[task.ID]; ok {
+		return
+	}
+	q.items[task.ID] = &deleteItem{task: task}
+}
+
+// readyURLs returns the number of short urls that can be flushed right now.
+func (q *deleteQueue) readyURLs(now time.Time) (count int) {
+	for _, item := range q.items {
+		if !item.nextTry.After(now) {
+			count += len(item.task.ShortURLs)
+		}
+	}
+	return count
+}
+
+// chunks splits the ready tasks into chunks of no more than maxURLs short urls.
+//
+// A task is never split between chunks (one task is not larger than DeletingMaxRowsRequest).
+func (q *deleteQueue) chunks(now time.Time, maxURLs int) (chunks [][]*deleteItem) {
+	ready := make([]*deleteItem, 0, len(q.items))
+	for _, item := range q.items {
+		if !item.nextTry.After(now) {
+			ready = append(ready, item)
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool {
+		return ready[i].task.ID < ready[j].task.ID
+	})
+
+	var (
+		chunk []*deleteItem
+		size  int
+	)
+	for _, item := range ready {
+		if len(chunk) > 0 && size+len(item.task.ShortURLs) > maxURLs {
+			chunks = append(chunks, chunk)
+			chunk, size = nil, 0
+		}
+		chunk = append(chunk, item)
+		size += len(item.task.ShortURLs)
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+// fail registers a failed attempt and schedules the next one.
+//
+// Returns true if the attempts are over and the task must go to the dead letters.
+func (q *deleteQueue) fail(item *deleteItem, now time.Time) (dead bool) {
+	item.attempts++
+	if item.attempts >= DeletingMaxAttempts {
+		return true
+	}
+	item.nextTry = now.Add(retryDelay(item.attempts))
+	return false
+}
+
+// remove removes the tasks from the queue.
+func (q *deleteQueue) remove(items []*deleteItem) {
+	for _, item := range items {
+		delete(q.items, item.task.ID)
+	}
+}
+
+// retryDelay returns the exponential delay before the next attempt of the deletion task.
+func retryDelay(attempts int) time.Duration {
+	return backoff(DeletingRetryBaseDelay, DeletingRetryMaxDelay, attempts)
+}
+
+// backoff returns the exponential delay before the next attempt (the base delay after the first one).
+func backoff(base, maxDelay time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxDelay {
+			return maxDelay
+		}
+	}
+	return delay
+}
+
+// flushDeletingTasks start batch deleting urls.
+func (s *service) flushDeletingTasks() {
+
+	// the interval for sending data to the database
+	ticker := time.NewTicker(DeletingFlushInterval)
+	defer ticker.Stop()
+
+	// the tasks accepted before the restart are waiting in the outbox
+	ctx := context.Background()
+	queue := newDeleteQueue()
+	s.restoreDeletingTasks(ctx, queue)
+
+	for {
+		metrics.DeletionQueueDepth.Set(float64(len(s.deleteCh) + len(queue.items)))
+
+		select {
+		case task := <-s.deleteCh:
+			queue.push(task)
+			// the flush is triggered by the size, not only by the ticker
+			if queue.readyURLs(time.Now()) >= DeletingMaxRowsRequest {
+				s.flushDeleteQueue(ctx, queue, time.Now())
+			}
+		case <-ticker.C:
+			// some tasks did not fit into the channel and are only in the outbox
+			if s.deleteResync.Swap(false) {
+				s.restoreDeletingTasks(ctx, queue)
+			}
+			s.flushDeleteQueue(ctx, queue, time.Now())
+		case stopCtx := <-s.stopCh:
+			s.drainDeletingTasks(stopCtx, queue)
+			close(s.doneCh)
+			return
+		}
+	}
+}
+
+// drainDeletingTasks takes all the tasks from the channel and flushes the queue for the last time.
+func (s *service) drainDeletingTasks(ctx context.Context, queue *deleteQueue) {
+loop:
+	for {
+		metrics.DeletionQueueDepth.Set(float64(len(s.deleteCh) + len(queue.items)))
+
+		select {
+		case task := <-s.deleteCh:
+			queue.push(task)
+		default:
+			break loop
+		}
+	}
+	if s.deleteResync.Swap(false) {
+		s.restoreDeletingTasks(ctx, queue)
+	}
+
+	s.flushDeleteQueue(ctx, queue, time.Now())
+	if len(queue.items) > 0 {
+		logger.Log.Info("deletion tasks are left in the outbox until the next start",
+			zap.Int("count", len(queue.items)))
+	}
+}
+
+// restoreDeletingTasks loads pending tasks from the storage outbox into the queue.
+func (s *service) restoreDeletingTasks(ctx context.Context, queue *deleteQueue) {
+	ctx, cancel := context.WithTimeout(ctx, DeletingFlushTimeout)
+	defer cancel()
+
+	tasks, err := s.shortenerRepo.PendingDeleteTasks(ctx)
+	if err != nil {
+		logger.Log.Info("cannot load pending deletion tasks", zap.String("error", err.Error()))
+		// we will try to load the tasks next time
+		s.deleteResync.Store(true)
+		return
+	}
+
+	for _, task := range tasks {
+		queue.push(*task)
+	}
+}
+
+// flushDeleteQueue sends the ready tasks to the storage in chunks.
+func (s *service) flushDeleteQueue(ctx context.Context, queue *deleteQueue, now time.Time) {
+	// if there is nothing to send, we do not send anything
+	for _, chunk := range queue.chunks(now, DeletingMaxRowsRequest) {
+		if ctx.Err() != nil {
+			return
+		}
+		s.flushDeleteChunk(ctx, queue, chunk, now)
+	}
+}
+
+// flushDeleteChunk deletes the short urls of the chunk and acknowledges its tasks in the outbox.
+func (s *service) flushDeleteChunk(ctx context.Context, queue *deleteQueue, chunk []*deleteItem, now time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, DeletingFlushTimeout)
+	defer cancel()
+
+	var err error
+	ctx, span := tracing.Start(ctx, "shortener.flushDeleteChunk", attribute.Int("tasks", len(chunk)))
+	defer func() { tracing.End(span, err) }()
+
+	ids := make([]int64, 0, len(chunk))
+	shortURLs := make([]string, 0, DeletingMaxRowsRequest)
+	for _, item := range chunk {
+		ids = append(ids, item.task.ID)
+		shortURLs = append(shortURLs, item.task.ShortURLs...)
+	}
+
+	err = s.shortenerRepo.DeleteURLs(ctx, shortURLs...)
+	if err == nil {
+		queue.remove(chunk)
+		metrics.DeletionFlushes.WithLabelValues(metrics.FlushDone).Add(float64(len(chunk)))
+		for _, item := range chunk {
+			for _, shortURL := range item.task.ShortURLs {
+				s.emitLinkEvent(model.LinkEvent{Type: model.EventLinkDeleted, UserID: item.task.UserID, ShortURL: shortURL})
+			}
+		}
+		if err = s.shortenerRepo.CompleteDeleteTasks(ctx, model.DeleteTaskDone, ids...); err != nil {
+			// deleting is idempotent, so the worst case is repeating it after the restart
+			logger.Log.Info("cannot acknowledge deletion tasks",
+				zap.String("error", err.Error()), zap.Int64s("ids", ids))
+		}
+		return
+	}
+
+	logger.Log.Info("cannot delete urls",
+		zap.String("error", err.Error()), zap.String("shortURLs", strings.Join(shortURLs, ", ")))
+
+	// we will try to delete the data later (with backoff) or give up
+	dead := make([]*deleteItem, 0)
+	for _, item := range chunk {
+		if queue.fail(item, now) {
+			dead = append(dead, item)
+		}
+	}
+	metrics.DeletionFlushes.WithLabelValues(metrics.FlushRetry).Add(float64(len(chunk) - len(dead)))
+	if len(dead) == 0 {
+		return
+	}
+	metrics.DeletionFlushes.WithLabelValues(metrics.FlushDead).Add(float64(len(dead)))
+
+	queue.remove(dead)
+	deadIDs := make([]int64, 0, len(dead))
+	for _, item := range dead {
+		deadIDs = append(deadIDs, item.task.ID)
+		logger.Log.Error("dead letter: deletion task attempts are over",
+			zap.Int64("id", item.task.ID),
+			zap.Int64("userID", item.task.UserID),
+			zap.Time("accepted", item.task.Time),
+			zap.Int("attempts", item.attempts),
+			zap.String("shortURLs", strings.Join(item.task.ShortURLs, ", ")),
+			zap.String("lastError", err.Error()))
+	}
+	if err = s.shortenerRepo.CompleteDeleteTasks(ctx, model.DeleteTaskDead, deadIDs...); err != nil {
+		logger.Log.Info("cannot mark deletion tasks as dead",
+			zap.String("error", err.Error()), zap.Int64s("ids", deadIDs))
+	}
+}
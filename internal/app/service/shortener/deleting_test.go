@@ -0,0 +1,137 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+)
+
+// failingRepo is the RAM storage whose deleting always fails.
+type failingRepo struct {
+	*repository.DBMaps
+	calls int
+}
+
+func (r *failingRepo) DeleteURLs(_ context.Context, _ ...string) error {
+	r.calls++
+	return errors.New("storage is unavailable")
+}
+
+func TestDeleteQueue_chunks(t *testing.T) {
+	q := newDeleteQueue()
+	q.push(model.DeleteTask{ID: 1, ShortURLs: []string{"a", "b"}})
+	q.push(model.DeleteTask{ID: 2, ShortURLs: []string{"c", "d"}})
+	q.push(model.DeleteTask{ID: 3, ShortURLs: []string{"e"}})
+	q.push(model.DeleteTask{ID: 3, ShortURLs: []string{"e"}}) // duplicate from the outbox
+
+	chunks := q.chunks(time.Now(), 3)
+	require.Len(t, chunks, 2)
+	assert.Len(t, chunks[0], 1)
+	assert.Len(t, chunks[1], 2)
+	assert.Equal(t, 5, q.readyURLs(time.Now()))
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, DeletingRetryBaseDelay, retryDelay(1))
+	assert.Equal(t, 2*DeletingRetryBaseDelay, retryDelay(2))
+	assert.Equal(t, DeletingRetryMaxDelay, retryDelay(DeletingMaxAttempts))
+}
+
+func TestService_flushDeleteQueue(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run("success", func(t *testing.T) {
+		repo := repository.NewDBMaps()
+		shortURL, _, err := repo.WriteURL(ctx, "", "https://ya.ru", 1)
+		require.NoError(t, err)
+		task := model.DeleteTask{UserID: 1, ShortURLs: []string{shortURL}}
+		require.NoError(t, repo.WriteDeleteTask(ctx, &task))
+
+		s := &service{shortenerRepo: repo}
+		q := newDeleteQueue()
+		s.restoreDeletingTasks(ctx, q)
+		s.flushDeleteQueue(ctx, q, time.Now())
+
+		_, err = repo.ReadURL(ctx, shortURL)
+		assert.ErrorIs(t, err, repository.ErrGone)
+		pending, _ := repo.PendingDeleteTasks(ctx)
+		assert.Empty(t, pending)
+		assert.Empty(t, q.items)
+	})
+
+	t.Run("retry and dead letter", func(t *testing.T) {
+		repo := &failingRepo{DBMaps: repository.NewDBMaps()}
+		task := model.DeleteTask{UserID: 1, ShortURLs: []string{"19xtf1ts"}}
+		require.NoError(t, repo.WriteDeleteTask(ctx, &task))
+
+		s := &service{shortenerRepo: repo}
+		q := newDeleteQueue()
+		q.push(task)
+
+		now := time.Now()
+		s.flushDeleteQueue(ctx, q, now)
+		assert.Equal(t, 1, repo.calls)
+		require.Contains(t, q.items, task.ID)
+		assert.Equal(t, now.Add(DeletingRetryBaseDelay), q.items[task.ID].nextTry)
+
+		// the task is not ready until the backoff passes
+		s.flushDeleteQueue(ctx, q, now)
+		assert.Equal(t, 1, repo.calls)
+
+		for i := 1; i < DeletingMaxAttempts; i++ {
+			now = now.Add(DeletingRetryMaxDelay)
+			s.flushDeleteQueue(ctx, q, now)
+		}
+		assert.Equal(t, DeletingMaxAttempts, repo.calls)
+		assert.Empty(t, q.items)
+		pending, _ := repo.PendingDeleteTasks(ctx)
+		assert.Empty(t, pending)
+	})
+}
+
+func TestService_Stop(t *testing.T) {
+	ctx := context.TODO()
+	repo := repository.NewDBMaps()
+	shortURL, _, err := repo.WriteURL(ctx, "", "https://ya.ru", 1)
+	require.NoError(t, err)
+
+	s := NewService(repo, nil)
+	require.NoError(t, s.DeleteURLs(ctx, []string{shortURL}, 1))
+
+	// the accepted task is flushed without waiting for the ticker
+	require.NoError(t, s.Stop(ctx))
+	_, err = repo.ReadURL(ctx, shortURL)
+	assert.ErrorIs(t, err, repository.ErrGone)
+
+	// repeated stopping is harmless
+	require.NoError(t, s.Stop(ctx))
+}
+
+func TestService_Stop_stuckWorkers(t *testing.T) {
+	repo := repository.NewDBMaps()
+	shortURL, _, err := repo.WriteURL(context.TODO(), "", "https://ya.ru", 1)
+	require.NoError(t, err)
+
+	s := NewService(repo, nil)
+	require.NoError(t, s.DeleteURLs(context.TODO(), []string{shortURL}, 1))
+
+	// the link checker doesn't stop in time
+	release := make(chan struct{})
+	defer close(release)
+	s.checks.workers.run(1, func(context.Context) { <-release })
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Stop(ctx), context.DeadlineExceeded)
+
+	// the deletion queue is drained anyway
+	_, err = repo.ReadURL(context.TODO(), shortURL)
+	assert.ErrorIs(t, err, repository.ErrGone)
+}
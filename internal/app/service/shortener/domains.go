@@ -0,0 +1,59 @@
+package shortener
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/utils/urlfuncs"
+)
+
+// shortURLKey returns the link key of the short URL passed by the client: the short code of the default domain,
+// domain/code or the ready short URL (the empty short URL and the unknown domain are the bad request).
+func shortURLKey(rawShortURL string) (string, error) {
+	key, err := urlfuncs.ShortURLKey(rawShortURL)
+	if err != nil {
+		return "", fmt.Errorf("%w (%w)", err, model.ErrBadRequest)
+	}
+	if _, code := model.SplitLinkKey(key); code == "" {
+		return "", fmt.Errorf("the short link is empty %w", model.ErrBadRequest)
+	}
+	return key, nil
+}
+
+// shortDomain returns the domain of the new links by its name (the unknown domain is the bad request).
+func shortDomain(rawDomain string) (string, error) {
+	domain, err := urlfuncs.ShortDomain(rawDomain)
+	if err != nil {
+		return "", fmt.Errorf("%w (%w)", err, model.ErrBadRequest)
+	}
+	return domain, nil
+}
+
+// requestKey returns the link key of the visitor request: the domain is chosen by the request host,
+// the short URL of the request without the host (gRPC) is passed as the client passes it to the other methods.
+func requestKey(in model.OpenURLIn) (string, error) {
+	if in.Host == "" {
+		return shortURLKey(in.ShortURL)
+	}
+	return model.LinkKey(urlfuncs.HostDomain(in.Host), strings.TrimSpace(in.ShortURL)), nil
+}
+
+// toUserURL returns the link of the user with the ready short URL.
+func toUserURL(row *model.URLRow) model.UserURL {
+	return model.UserURL{
+		Domain:       urlfuncs.DomainHost(row.Domain),
+		ShortURL:     urlfuncs.EnrichURL(row.Key()),
+		OriginalURL:  row.OrigURL,
+		Title:        row.Title,
+		Notes:        row.Notes,
+		Tags:         row.Tags,
+		Preview:      row.Preview,
+		RedirectCode: row.RedirectCode,
+		ExpiresAt:    row.ExpiresAt,
+		ForwardPath:  row.ForwardPath,
+		MergeQuery:   row.MergeQuery,
+		Meta:         row.Meta,
+		Check:        row.Check,
+	}
+}
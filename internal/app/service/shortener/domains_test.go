@@ -0,0 +1,64 @@
+package shortener
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+	"github.com/zasuchilas/shortener/internal/app/secure"
+	"github.com/zasuchilas/shortener/internal/app/utils/urlfuncs"
+)
+
+func TestService_domains(t *testing.T) {
+	config.BaseURL, config.ShortDomains = "http://localhost:8080", "go.example.com"
+	require.NoError(t, urlfuncs.CheckShortDomains())
+	t.Cleanup(func() {
+		config.BaseURL, config.ShortDomains = "", ""
+		_ = urlfuncs.CheckShortDomains()
+	})
+
+	ctx := context.TODO()
+	s := &service{shortenerRepo: repository.NewDBMaps(), secure: secure.New("supersecretkey", "", ""), hooks: newHookPool()}
+
+	readyURL, _, err := s.WriteURL(ctx, "https://ya.ru", "", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/19xtf1ts", readyURL)
+	readyURL, _, err = s.WriteURL(ctx, "https://go.dev", "go.example.com", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "http://go.example.com/19xtf1ts", readyURL)
+	_, _, err = s.WriteURL(ctx, "https://go.dev", "evil.example.com", 1)
+	assert.ErrorIs(t, err, model.ErrBadRequest)
+
+	// the same code is resolved by the request host
+	for host, expected := range map[string]string{
+		"localhost:8080":    "https://ya.ru",
+		"go.example.com":    "https://go.dev",
+		"go.example.com:80": "https://go.dev",
+		"evil.example.com":  "https://ya.ru",
+	} {
+		opened, err := s.OpenURL(ctx, model.OpenURLIn{ShortURL: "19xtf1ts", Host: host, Head: true})
+		require.NoError(t, err, host)
+		assert.Equal(t, expected, opened.OrigURL, host)
+	}
+
+	// the user operations take domain/code or the ready short URL
+	updated, err := s.UpdateURL(ctx, "http://go.example.com/19xtf1ts", "https://go.dev/doc", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "go.example.com", updated.Domain)
+	assert.Equal(t, "http://go.example.com/19xtf1ts", updated.ShortURL)
+
+	page, err := s.UserURLs(ctx, 1, model.UserURLsQuery{LinkDomains: []string{"http://go.example.com"}})
+	require.NoError(t, err)
+	require.Len(t, page.URLs, 1)
+	assert.Equal(t, "https://go.dev/doc", page.URLs[0].OriginalURL)
+
+	stats, err := s.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.URLs)
+	assert.Equal(t, map[string]int{"localhost:8080": 1, "go.example.com": 1}, stats.Domains)
+}
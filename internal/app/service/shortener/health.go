@@ -0,0 +1,114 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+	"github.com/zasuchilas/shortener/internal/app/utils/diskfuncs"
+)
+
+// Readiness settings.
+const (
+	HealthCheckTimeout   = 2 * time.Second
+	MinFreeDiskSpace     = 64 << 20 // bytes
+	DeletingBacklogLimit = DeletingChanBuffer * 9 / 10
+)
+
+// healthCheck is the named readiness check.
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// Health aggregates the readiness checks of the service dependencies.
+//
+// The checks are performed concurrently, each one is limited by HealthCheckTimeout.
+func (s *service) Health(ctx context.Context) *model.HealthReport {
+	checks := []healthCheck{
+		{name: "storage", check: s.shortenerRepo.HealthCheck},
+		{name: "deletion_queue", check: s.checkDeletionQueue},
+	}
+	if s.secure != nil {
+		checks = append(checks, healthCheck{name: "users", check: s.secure.HealthCheck})
+	}
+	if fs, ok := s.shortenerRepo.(repository.IFileStorage); ok && len(fs.FilePaths()) > 0 {
+		checks = append(checks, healthCheck{name: "disk", check: func(_ context.Context) error {
+			return checkDiskSpace(fs.FilePaths())
+		}})
+	}
+
+	report := &model.HealthReport{
+		Status: model.HealthStatusOK,
+		Checks: make([]model.HealthCheck, len(checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, hc := range checks {
+		wg.Add(1)
+		go func(i int, hc healthCheck) {
+			defer wg.Done()
+
+			ctxTm, cancel := context.WithTimeout(ctx, HealthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			result := model.HealthCheck{Name: hc.name, Status: model.HealthStatusOK}
+			if err := hc.check(ctxTm); err != nil {
+				result.Status = model.HealthStatusFail
+				result.Error = err.Error()
+			}
+			result.Duration = time.Since(start)
+			report.Checks[i] = result
+		}(i, hc)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != model.HealthStatusOK {
+			report.Status = model.HealthStatusFail
+			break
+		}
+	}
+
+	return report
+}
+
+// checkDeletionQueue checks that the deletion worker keeps up with the requests.
+func (s *service) checkDeletionQueue(_ context.Context) error {
+	select {
+	case <-s.doneCh:
+		return errors.New("the deletion worker is stopped")
+	default:
+	}
+
+	if backlog := len(s.deleteCh); backlog >= DeletingBacklogLimit {
+		return fmt.Errorf("the deletion backlog is too large (actual: %d, maximum: %d)", backlog, DeletingBacklogLimit)
+	}
+	if s.deleteResync.Load() {
+		return errors.New("the deletion queue is overflowed, the tasks are waiting in the outbox")
+	}
+
+	return nil
+}
+
+// checkDiskSpace checks that there is enough free space for the storage files.
+func checkDiskSpace(paths []string) error {
+	for _, path := range paths {
+		free, err := diskfuncs.FreeSpace(path)
+		if errors.Is(err, errors.ErrUnsupported) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if free < MinFreeDiskSpace {
+			return fmt.Errorf("not enough free disk space for %s (actual: %d, minimum: %d bytes)", path, free, MinFreeDiskSpace)
+		}
+	}
+	return nil
+}
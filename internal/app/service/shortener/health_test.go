@@ -0,0 +1,61 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+)
+
+// unhealthyRepo is the RAM storage that is never ready.
+type unhealthyRepo struct {
+	*repository.DBMaps
+}
+
+func (r *unhealthyRepo) HealthCheck(_ context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestService_Health(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run("ready", func(t *testing.T) {
+		s := NewService(repository.NewDBMaps(), nil)
+		defer s.Stop(ctx)
+
+		report := s.Health(ctx)
+		assert.Equal(t, model.HealthStatusOK, report.Status)
+		require.Len(t, report.Checks, 2)
+	})
+
+	t.Run("storage is unavailable", func(t *testing.T) {
+		s := NewService(&unhealthyRepo{DBMaps: repository.NewDBMaps()}, nil)
+		defer s.Stop(ctx)
+
+		report := s.Health(ctx)
+		assert.Equal(t, model.HealthStatusFail, report.Status)
+		assert.Equal(t, "storage", report.Checks[0].Name)
+		assert.Equal(t, "connection refused", report.Checks[0].Error)
+		assert.Equal(t, model.HealthStatusOK, report.Checks[1].Status)
+	})
+
+	t.Run("deletion worker is stopped", func(t *testing.T) {
+		s := NewService(repository.NewDBMaps(), nil)
+		require.NoError(t, s.Stop(ctx))
+
+		report := s.Health(ctx)
+		assert.Equal(t, model.HealthStatusFail, report.Status)
+		assert.Equal(t, "the deletion worker is stopped", report.Checks[1].Error)
+	})
+}
+
+func Test_checkDiskSpace(t *testing.T) {
+	assert.NoError(t, checkDiskSpace([]string{filepath.Join(t.TempDir(), "storage.db")}))
+	assert.Error(t, checkDiskSpace([]string{"/not/existing/dir/storage.db"}))
+}
@@ -0,0 +1,141 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+)
+
+func TestCheckLinkCheckSettings(t *testing.T) {
+	defer func() { config.LinkCheckInterval, config.LinkCheckRate = "", "" }()
+
+	tests := []struct {
+		interval, rate string
+		wantErr        bool
+	}{
+		{interval: "", rate: ""},
+		{interval: "24h", rate: "1/s"},
+		{interval: "1h", rate: "10/m"},
+		{interval: "day", rate: "1/s", wantErr: true},
+		{interval: "-1h", rate: "1/s", wantErr: true},
+		{interval: "24h", rate: "fast", wantErr: true},
+	}
+	for _, tt := range tests {
+		config.LinkCheckInterval, config.LinkCheckRate = tt.interval, tt.rate
+		err := CheckLinkCheckSettings()
+		assert.Equal(t, tt.wantErr, err != nil, "%s %s: %v", tt.interval, tt.rate, err)
+	}
+}
+
+func TestNextLinkCheck(t *testing.T) {
+	failed := &model.LinkCheck{Status: http.StatusNotFound, Failures: 1}
+	broken := &model.LinkCheck{Status: http.StatusNotFound, Failures: LinkCheckFailures, Broken: true}
+
+	tests := []struct {
+		name     string
+		prev     *model.LinkCheck
+		status   int
+		err      error
+		failures int
+		broken   bool
+		wantErr  bool
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "first failure", status: http.StatusNotFound, failures: 1, wantErr: true},
+		{name: "second failure", prev: failed, status: http.StatusGone, failures: 2, broken: true, wantErr: true},
+		{name: "network error", prev: failed, err: errors.New("connection refused"), failures: 2, broken: true, wantErr: true},
+		{name: "too many requests", prev: failed, status: http.StatusTooManyRequests, failures: 1, wantErr: true},
+		{name: "still broken", prev: broken, status: http.StatusTooManyRequests, failures: LinkCheckFailures, broken: true, wantErr: true},
+		{name: "fixed", prev: broken, status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := nextLinkCheck(tt.prev, tt.status, tt.err)
+			assert.Equal(t, tt.status, check.Status)
+			assert.Equal(t, tt.failures, check.Failures)
+			assert.Equal(t, tt.broken, check.Broken)
+			assert.Equal(t, tt.wantErr, check.Error != "")
+			assert.False(t, check.Checked.IsZero())
+		})
+	}
+}
+
+func TestService_checkDueLinks(t *testing.T) {
+	config.AllowPrivateNetworks = true
+	t.Cleanup(func() { config.AllowPrivateNetworks = false })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(http.ResponseWriter, *http.Request) {})
+	mux.HandleFunc("/no-head", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	ctx := context.TODO()
+	s := &service{shortenerRepo: repository.NewDBMaps(), hooks: newHookPool(), checks: newCheckPool()}
+	for _, path := range []string{"/page", "/no-head", "/missing"} {
+		_, _, err := s.WriteURL(ctx, ts.URL+path, "", 1)
+		require.NoError(t, err)
+	}
+	require.Len(t, s.hooks.events, 3) // created
+	for range 3 {
+		<-s.hooks.events
+	}
+
+	// the link is broken after the failures in a row, the event is emitted once
+	for range LinkCheckFailures + 1 {
+		s.checkDueLinks(ctx)
+	}
+	require.Len(t, s.hooks.events, 1)
+	event := <-s.hooks.events
+	assert.Equal(t, model.EventLinkBroken, event.Type)
+	assert.Equal(t, ts.URL+"/missing", event.OrigURL)
+
+	page, err := s.UserURLs(ctx, 1, model.UserURLsQuery{Broken: true})
+	require.NoError(t, err)
+	require.Len(t, page.URLs, 1)
+	check := page.URLs[0].Check
+	require.NotNil(t, check)
+	assert.Equal(t, http.StatusNotFound, check.Status)
+	assert.Equal(t, LinkCheckFailures+1, check.Failures)
+	assert.True(t, check.Broken)
+
+	page, err = s.UserURLs(ctx, 1, model.UserURLsQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.URLs, 3)
+	for _, u := range page.URLs {
+		require.NotNil(t, u.Check, u.OriginalURL)
+		if u.OriginalURL != ts.URL+"/missing" {
+			assert.Equal(t, http.StatusOK, u.Check.Status, u.OriginalURL)
+			assert.False(t, u.Check.Broken, u.OriginalURL)
+		}
+	}
+}
+
+func TestCheckPool_wait(t *testing.T) {
+	config.LinkCheckRate = "1/h"
+	t.Cleanup(func() { config.LinkCheckRate = "" })
+	p := newCheckPool()
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+
+	// the hosts are limited separately
+	assert.True(t, p.wait(ctx, "ya.ru"))
+	assert.True(t, p.wait(ctx, "go.dev"))
+	assert.False(t, p.wait(ctx, "ya.ru"))
+}
@@ -0,0 +1,274 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/metrics"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/ratelimit"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
+	"github.com/zasuchilas/shortener/internal/app/utils/urlfuncs"
+)
+
+// CheckLinkCheckSettings checks config.LinkCheckInterval and config.LinkCheckRate.
+func CheckLinkCheckSettings() error {
+	if _, err := linkCheckInterval(); err != nil {
+		return err
+	}
+	if _, err := ratelimit.ParseRate(config.LinkCheckRate); err != nil {
+		return fmt.Errorf("wrong link check rate: %w", err)
+	}
+	return nil
+}
+
+// linkCheckInterval returns config.LinkCheckInterval (0 if it is empty, the checker is disabled).
+func linkCheckInterval() (time.Duration, error) {
+	if config.LinkCheckInterval == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(config.LinkCheckInterval)
+	if err != nil {
+		return 0, fmt.Errorf("wrong link check interval %q: %w", config.LinkCheckInterval, err)
+	}
+	if interval < 0 {
+		return 0, fmt.Errorf("wrong link check interval %q", config.LinkCheckInterval)
+	}
+	return interval, nil
+}
+
+// checkPool is the checker of the link destinations (config.LinkCheckInterval).
+//
+// The links that are due are loaded from the storage, so the checks are resumed after the restart.
+// The requests to one destination host are limited by config.LinkCheckRate.
+type checkPool struct {
+	client  *http.Client
+	hosts   *ratelimit.Limiter
+	workers workerGroup
+}
+
+func newCheckPool() *checkPool {
+	// the rate is checked at the start (see CheckLinkCheckSettings)
+	rate, _ := ratelimit.ParseRate(config.LinkCheckRate)
+	return &checkPool{
+		client: urlfuncs.NewSafeClient(LinkCheckTimeout),
+		hosts:  ratelimit.NewLimiter(rate),
+	}
+}
+
+// start starts the checker.
+func (p *checkPool) start(check func(ctx context.Context)) {
+	p.workers.run(1, check)
+}
+
+// stop stops the checker and waits for it.
+func (p *checkPool) stop(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	return p.workers.stop(ctx)
+}
+
+// wait waits for the rate limit of the destination host, returns false if the context is canceled.
+func (p *checkPool) wait(ctx context.Context, host string) bool {
+	for {
+		ok, retryAfter := p.hosts.Allow(host)
+		if ok {
+			return true
+		}
+		timer := time.NewTimer(retryAfter)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+}
+
+// checkLinks checks the links that are due by the ticker until the context is canceled.
+func (s *service) checkLinks(ctx context.Context) {
+	ticker := time.NewTicker(LinkCheckPollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.checkDueLinks(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkDueLinks checks the links whose destinations are not checked for config.LinkCheckInterval.
+//
+// The links of the batch are grouped by the destination host: no more than LinkCheckWorkers hosts
+// are checked at the same time, the links of one host are checked one by one within its rate limit.
+// Every batch is finished before the next one is loaded, so the link is not checked twice at the same time.
+func (s *service) checkDueLinks(ctx context.Context) {
+	interval, _ := linkCheckInterval()
+	for ctx.Err() == nil {
+		loadCtx, cancel := context.WithTimeout(ctx, LinkCheckTimeout)
+		rows, err := s.shortenerRepo.URLsToCheck(loadCtx, time.Now().Add(-interval), LinkCheckBatch)
+		cancel()
+		if err != nil {
+			logger.Log.Info("cannot load links to check", zap.String("error", err.Error()))
+			return
+		}
+
+		byHost := make(map[string][]*model.URLRow)
+		for _, row := range rows {
+			var host string
+			if u, e := destinationURL(row.OrigURL); e == nil {
+				host = strings.ToLower(u.Hostname())
+			}
+			byHost[host] = append(byHost[host], row)
+		}
+
+		var (
+			wg    sync.WaitGroup
+			sem   = make(chan struct{}, LinkCheckWorkers)
+			mutex sync.Mutex
+			saved = true
+		)
+		for host, hostRows := range byHost {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				for _, row := range hostRows {
+					if !s.checks.wait(ctx, host) {
+						return
+					}
+					if !s.checkLink(ctx, row) {
+						mutex.Lock()
+						saved = false
+						mutex.Unlock()
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		// the rest is checked by the next tick if the storage fails
+		if len(rows) < LinkCheckBatch || !saved {
+			return
+		}
+	}
+}
+
+// checkLink checks the destination of the link and saves the result,
+// the link event is emitted when the link becomes broken. Returns false if the result is not saved.
+func (s *service) checkLink(ctx context.Context, row *model.URLRow) (saved bool) {
+	var err error
+	ctx, span := tracing.Start(ctx, "shortener.checkLink", attribute.String("shortURL", row.Key()))
+	defer func() { tracing.End(span, err) }()
+
+	checkCtx, cancel := context.WithTimeout(ctx, LinkCheckTimeout)
+	status, probeErr := s.checks.probe(checkCtx, row.OrigURL)
+	cancel()
+	if ctx.Err() != nil {
+		// the service is stopping, the link is checked after the restart
+		return true
+	}
+
+	check := nextLinkCheck(row.Check, status, probeErr)
+	outcome := metrics.LinkCheckOK
+	if check.Error != "" {
+		outcome = metrics.LinkCheckFailed
+	}
+	metrics.LinkChecks.WithLabelValues(outcome).Inc()
+
+	stored, err := s.shortenerRepo.SaveURLCheck(ctx, row, &check)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return true
+		}
+		logger.Log.Info("cannot save link check", zap.String("shortURL", row.Key()), zap.String("error", err.Error()))
+		return false
+	}
+	if stored && check.Broken && (row.Check == nil || !row.Check.Broken) {
+		logger.Log.Info("the link destination is broken",
+			zap.String("shortURL", row.Key()), zap.String("original", row.OrigURL), zap.String("error", check.Error))
+		s.emitBrokenEvent(ctx, row)
+	}
+	return true
+}
+
+// nextLinkCheck returns the result of the check by the response of the destination and the previous result.
+//
+// The network errors and the error statuses are the failures. 429 Too Many Requests tells nothing
+// about the destination, so the failures are kept as they are.
+func nextLinkCheck(prev *model.LinkCheck, status int, err error) model.LinkCheck {
+	check := model.LinkCheck{Checked: time.Now(), Status: status}
+	if prev != nil {
+		check.Failures = prev.Failures
+	}
+
+	switch {
+	case err != nil:
+		check.Error = err.Error()
+		check.Failures++
+	case status == http.StatusTooManyRequests:
+		check.Error = "the destination has limited the requests"
+	case status >= http.StatusBadRequest:
+		check.Error = fmt.Sprintf("the destination responded with %d %s", status, http.StatusText(status))
+		check.Failures++
+	default:
+		check.Failures = 0
+	}
+	check.Broken = check.Failures >= LinkCheckFailures
+	return check
+}
+
+// probe requests the destination with HEAD and returns the status of the response (the redirects are followed).
+//
+// Some servers don't support HEAD or respond to it with an error, so the failed HEAD is repeated with GET.
+func (p *checkPool) probe(ctx context.Context, origURL string) (status int, err error) {
+	u, err := destinationURL(origURL)
+	if err != nil {
+		return 0, err
+	}
+
+	status, err = p.request(ctx, http.MethodHead, u.String())
+	if err != nil || status < http.StatusBadRequest {
+		return status, err
+	}
+	return p.request(ctx, http.MethodGet, u.String())
+}
+
+// request sends the request and returns the status of the response.
+func (p *checkPool) request(ctx context.Context, method, target string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", LinkCheckUserAgent)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// the connection is reused if the body is read
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	return resp.StatusCode, nil
+}
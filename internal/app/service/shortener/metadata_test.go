@@ -0,0 +1,141 @@
+package shortener
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+)
+
+func newMetadataServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(`<html><head><title>The page</title>` +
+			`<meta name="description" content="About the page"><link rel="icon" href="/icon.png"></head></html>`))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/big", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><head>` + strings.Repeat(" ", MetadataMaxBody) + `<title>Too far</title>`))
+	})
+	mux.HandleFunc("/file.pdf", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	return httptest.NewServer(mux)
+}
+
+func TestService_saveMetadata(t *testing.T) {
+	config.FetchMetadata = true
+	config.AllowPrivateNetworks = true
+	t.Cleanup(func() { config.FetchMetadata, config.AllowPrivateNetworks = false, false })
+
+	ts := newMetadataServer()
+	defer ts.Close()
+
+	ctx := context.TODO()
+	s := &service{shortenerRepo: repository.NewDBMaps(), meta: newMetaPool()}
+
+	tests := []struct {
+		name        string
+		path        string
+		title       string
+		description string
+		favicon     string
+		err         string
+	}{
+		{name: "html page", path: "/page", title: "The page", description: "About the page", favicon: ts.URL + "/icon.png"},
+		{name: "redirect", path: "/moved", title: "The page", description: "About the page", favicon: ts.URL + "/icon.png"},
+		{name: "body limit", path: "/big", favicon: ts.URL + "/favicon.ico"},
+		{name: "not html", path: "/file.pdf", err: "not an HTML page"},
+		{name: "not found", path: "/missing", err: "404"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := s.WriteURL(ctx, ts.URL+tt.path, "", 1)
+			require.NoError(t, err)
+			require.Len(t, s.meta.tasks, 1)
+			s.saveMetadata(ctx, <-s.meta.tasks)
+
+			page, err := s.UserURLs(ctx, 1, model.UserURLsQuery{Text: strings.Trim(tt.path, "/")})
+			require.NoError(t, err)
+			require.Len(t, page.URLs, 1)
+			meta := page.URLs[0].Meta
+			require.NotNil(t, meta)
+			assert.Equal(t, tt.title, meta.Title)
+			assert.Equal(t, tt.description, meta.Description)
+			assert.Equal(t, tt.favicon, meta.Favicon)
+			assert.False(t, meta.Fetched.IsZero())
+			if tt.err == "" {
+				assert.Empty(t, meta.Error)
+			} else {
+				assert.Contains(t, meta.Error, tt.err)
+			}
+		})
+	}
+}
+
+func TestService_saveMetadata_privateNetworks(t *testing.T) {
+	config.FetchMetadata = true
+	t.Cleanup(func() { config.FetchMetadata = false })
+
+	ts := newMetadataServer()
+	defer ts.Close()
+
+	// the link is written without the checks, as if its host was resolved to the private network later
+	ctx := context.TODO()
+	repo := repository.NewDBMaps()
+	s := &service{shortenerRepo: repo, meta: newMetaPool()}
+	shortURL, _, err := repo.WriteURL(ctx, "", ts.URL+"/page", 1)
+	require.NoError(t, err)
+	s.queueMetadata(shortURL, ts.URL+"/page")
+	s.saveMetadata(ctx, <-s.meta.tasks)
+
+	row, err := repo.URLInfo(ctx, shortURL)
+	require.NoError(t, err)
+	require.NotNil(t, row.Meta)
+	assert.Empty(t, row.Meta.Title)
+	assert.Contains(t, row.Meta.Error, "private network")
+}
+
+func TestService_queueMetadata(t *testing.T) {
+	ctx := context.TODO()
+	s := &service{shortenerRepo: repository.NewDBMaps(), meta: newMetaPool()}
+
+	// the pages are not fetched by default
+	_, _, err := s.WriteURL(ctx, "https://ya.ru", "", 1)
+	require.NoError(t, err)
+	assert.Empty(t, s.meta.tasks)
+
+	config.FetchMetadata = true
+	t.Cleanup(func() { config.FetchMetadata = false })
+
+	// the new destinations are fetched, the existing ones are not
+	_, _, err = s.WriteURL(ctx, "https://ya.ru", "", 1)
+	require.NoError(t, err)
+	assert.Empty(t, s.meta.tasks)
+	readyURL, _, err := s.WriteURL(ctx, "https://go.dev", "", 1)
+	require.NoError(t, err)
+	_, err = s.UpdateURL(ctx, readyURL, "https://go.dev/doc", 1)
+	require.NoError(t, err)
+	require.Len(t, s.meta.tasks, 2)
+	<-s.meta.tasks
+	assert.Equal(t, "https://go.dev/doc", (<-s.meta.tasks).origURL)
+
+	// the full queue drops the tasks
+	for range MetadataChanBuffer + 1 {
+		s.queueMetadata("19xtf1ts", "https://ya.ru")
+	}
+	assert.Len(t, s.meta.tasks, MetadataChanBuffer)
+}
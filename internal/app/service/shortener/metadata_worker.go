@@ -0,0 +1,163 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/metrics"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
+	"github.com/zasuchilas/shortener/internal/app/utils/htmlfuncs"
+	"github.com/zasuchilas/shortener/internal/app/utils/urlfuncs"
+)
+
+// metaPool is the queue and the workers fetching the metadata of the link destinations (config.FetchMetadata).
+//
+// The tasks live in memory only: if the queue is full or the service is stopped, the metadata of the link
+// is not fetched until its destination is changed.
+type metaPool struct {
+	tasks   chan metaTask
+	client  *http.Client
+	workers workerGroup
+}
+
+// metaTask is the destination of the link to fetch.
+type metaTask struct {
+	shortURL string // the link key
+	origURL  string
+}
+
+func newMetaPool() *metaPool {
+	return &metaPool{
+		tasks:  make(chan metaTask, MetadataChanBuffer),
+		client: urlfuncs.NewSafeClient(MetadataTimeout),
+	}
+}
+
+// start starts the workers.
+func (p *metaPool) start(fetch func(ctx context.Context)) {
+	p.workers.run(MetadataWorkers, fetch)
+}
+
+// stop stops the workers and waits for them.
+func (p *metaPool) stop(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	return p.workers.stop(ctx)
+}
+
+// queueMetadata queues the fetching of the destination page of the link.
+//
+// The caller never waits: if the queue is full, the task is dropped.
+func (s *service) queueMetadata(shortURL, origURL string) {
+	if s.meta == nil || !config.FetchMetadata {
+		return
+	}
+
+	select {
+	case s.meta.tasks <- metaTask{shortURL: shortURL, origURL: origURL}:
+	default:
+		metrics.MetadataFetches.WithLabelValues(metrics.MetadataDropped).Inc()
+		logger.Log.Info("the metadata queue is full, the page is not fetched", zap.String("shortURL", shortURL))
+	}
+}
+
+// fetchMetadata fetches the queued pages until the context is canceled.
+func (s *service) fetchMetadata(ctx context.Context) {
+	for {
+		select {
+		case task := <-s.meta.tasks:
+			s.saveMetadata(ctx, task)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// saveMetadata fetches the destination page of the link and saves its metadata
+// (the reason is saved if the page can't be fetched, so it is not fetched again).
+func (s *service) saveMetadata(ctx context.Context, task metaTask) {
+	var err error
+	ctx, span := tracing.Start(ctx, "shortener.saveMetadata", attribute.String("shortURL", task.shortURL))
+	defer func() { tracing.End(span, err) }()
+
+	fetchCtx, cancel := context.WithTimeout(ctx, MetadataTimeout)
+	meta, fetchErr := s.meta.fetch(fetchCtx, task.origURL)
+	cancel()
+	if ctx.Err() != nil {
+		// the service is stopping, the page is not fetched
+		return
+	}
+
+	outcome := metrics.MetadataFetched
+	if fetchErr != nil {
+		outcome = metrics.MetadataFailed
+		meta.Error = fetchErr.Error()
+		logger.Log.Debug("fetching destination metadata",
+			zap.String("shortURL", task.shortURL), zap.String("error", fetchErr.Error()))
+	}
+	metrics.MetadataFetches.WithLabelValues(outcome).Inc()
+	meta.Fetched = time.Now()
+
+	if err = s.shortenerRepo.SetURLMetadata(ctx, task.shortURL, task.origURL, &meta); err != nil {
+		logger.Log.Info("cannot save destination metadata",
+			zap.String("shortURL", task.shortURL), zap.String("error", err.Error()))
+	}
+}
+
+// fetch requests the destination page and reads the metadata of its head.
+//
+// Only the HTML pages are read, no more than MetadataMaxBody bytes of them.
+// The favicon is resolved against the page URL after the redirects.
+func (p *metaPool) fetch(ctx context.Context, origURL string) (model.LinkMetadata, error) {
+	pageURL, err := destinationURL(origURL)
+	if err != nil {
+		return model.LinkMetadata{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL.String(), nil)
+	if err != nil {
+		return model.LinkMetadata{}, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	req.Header.Set("User-Agent", MetadataUserAgent)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return model.LinkMetadata{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return model.LinkMetadata{}, fmt.Errorf("the destination responded with %s", resp.Status)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+			return model.LinkMetadata{}, fmt.Errorf("the destination is not an HTML page (%s)", contentType)
+		}
+	}
+
+	return htmlfuncs.PageMetadata(io.LimitReader(resp.Body, MetadataMaxBody), resp.Request.URL), nil
+}
+
+// destinationURL returns the URL the service requests for the destination of the link
+// (the URL without a scheme is shortened as it is: ya.ru/path).
+func destinationURL(origURL string) (*url.URL, error) {
+	u, err := url.Parse(origURL)
+	if err == nil && u.Scheme == "" {
+		u, err = url.Parse("http://" + origURL)
+	}
+	return u, err
+}
@@ -0,0 +1,55 @@
+package shortener
+
+import (
+	"fmt"
+
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/utils/urlfuncs"
+)
+
+// queryMergeModes are the allowed values of the merge query option.
+var queryMergeModes = map[string]struct{}{
+	model.QueryMergeNone:     {},
+	model.QueryMergeIncoming: {},
+	model.QueryMergeStored:   {},
+}
+
+// checkQueryMerge checks the merge query option of the link.
+func checkQueryMerge(mode string) error {
+	if _, ok := queryMergeModes[mode]; !ok {
+		return fmt.Errorf("unknown query merge mode %q (expected %q, %q or empty)",
+			mode, model.QueryMergeIncoming, model.QueryMergeStored)
+	}
+	return nil
+}
+
+// checkPassThrough checks that the request can be resolved by the link options:
+// the extra path is allowed only for the links with the forward path option.
+func checkPassThrough(row *model.URLRow, in model.OpenURLIn) error {
+	if in.Path != "" && !row.ForwardPath {
+		return fmt.Errorf("the short URL does not forward the path %w", model.ErrNotFound)
+	}
+	return nil
+}
+
+// passThrough returns the destination of the request: the extra path and the query are added to the stored
+// destination by the link options (the incoming query is dropped if the link does not merge it).
+func passThrough(row *model.URLRow, in model.OpenURLIn) (dest string, err error) {
+	if err = checkPassThrough(row, in); err != nil {
+		return "", err
+	}
+
+	dest = row.OrigURL
+	if row.ForwardPath {
+		if dest, err = urlfuncs.JoinPath(dest, in.Path); err != nil {
+			return "", fmt.Errorf("%w (%w)", err, model.ErrBadRequest)
+		}
+	}
+	if row.MergeQuery != model.QueryMergeNone {
+		if dest, err = urlfuncs.MergeQuery(dest, in.Query, row.MergeQuery == model.QueryMergeIncoming); err != nil {
+			return "", err
+		}
+	}
+
+	return dest, nil
+}
@@ -4,14 +4,19 @@ import (
 	"context"
 	"fmt"
 	"time"
+
+	"github.com/zasuchilas/shortener/internal/app/tracing"
 )
 
 // Ping _
-func (s *service) Ping(ctx context.Context) error {
+func (s *service) Ping(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "shortener.Ping")
+	defer func() { tracing.End(span, err) }()
+
 	ctx, cancel := context.WithTimeout(ctx, time.Second)
 	defer cancel()
 
-	if err := s.shortenerRepo.Ping(ctx); err != nil {
+	if err = s.shortenerRepo.Ping(ctx); err != nil {
 		return fmt.Errorf("postgresql is unavailable %w", err)
 	}
 
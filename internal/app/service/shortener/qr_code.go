@@ -0,0 +1,94 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
+	"github.com/zasuchilas/shortener/internal/app/utils/urlfuncs"
+	"github.com/zasuchilas/shortener/pkg/qrcode"
+)
+
+// QR code settings.
+const (
+	QRDefaultSize  = 256
+	QRMinSize      = 32
+	QRMaxSize      = 2048
+	QRMaxMargin    = 16
+	QRDefaultLevel = "M"
+)
+
+// QRCode returns the QR code image of the short URL (the short URL must exist and must not be deleted).
+func (s *service) QRCode(ctx context.Context, rawShortURL string, opts model.QROptions) (out *model.QRCode, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.QRCode")
+	defer func() { tracing.End(span, err) }()
+
+	shortURL, err := shortURLKey(rawShortURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// the short URL is checked in the storage without counting the visit
+	if _, err = s.shortenerRepo.URLInfo(ctx, shortURL); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			return nil, fmt.Errorf("%w (%w)", err, model.ErrNotFound)
+		case errors.Is(err, repository.ErrGone):
+			return nil, fmt.Errorf("%w (%w)", err, model.ErrGone)
+		}
+		return nil, err
+	}
+
+	return renderQRCode(urlfuncs.EnrichURL(shortURL), opts)
+}
+
+// ReadyURLQRCode returns the QR code image of the ready short URL (it is not checked in the storage),
+// it is used for the QR codes inlined into the shortening responses.
+func (s *service) ReadyURLQRCode(ctx context.Context, readyURL string, opts model.QROptions) (out *model.QRCode, err error) {
+	_, span := tracing.Start(ctx, "shortener.ReadyURLQRCode")
+	defer func() { tracing.End(span, err) }()
+
+	return renderQRCode(readyURL, opts)
+}
+
+// renderQRCode encodes the ready short URL into the QR code image.
+func renderQRCode(readyURL string, opts model.QROptions) (*model.QRCode, error) {
+	if opts.Size == 0 {
+		opts.Size = QRDefaultSize
+	}
+	if opts.Size < QRMinSize || opts.Size > QRMaxSize {
+		return nil, fmt.Errorf("the QR code size must be from %d to %d pixels %w", QRMinSize, QRMaxSize, model.ErrBadRequest)
+	}
+	if opts.Margin < 0 || opts.Margin > QRMaxMargin {
+		return nil, fmt.Errorf("the QR code margin must be from 0 to %d modules %w", QRMaxMargin, model.ErrBadRequest)
+	}
+	if opts.Level == "" {
+		opts.Level = QRDefaultLevel
+	}
+	level, err := qrcode.ParseLevel(opts.Level)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%w)", err, model.ErrBadRequest)
+	}
+
+	code, err := qrcode.Encode([]byte(readyURL), level)
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.Format {
+	case "", model.QRFormatPNG:
+		data, e := code.PNG(opts.Size, opts.Margin)
+		if e != nil {
+			return nil, e
+		}
+		return &model.QRCode{ContentType: "image/png", Data: data}, nil
+	case model.QRFormatSVG:
+		return &model.QRCode{ContentType: "image/svg+xml", Data: code.SVG(opts.Size, opts.Margin)}, nil
+	default:
+		return nil, fmt.Errorf("unknown QR code format %q (expected %s or %s) %w",
+			opts.Format, model.QRFormatPNG, model.QRFormatSVG, model.ErrBadRequest)
+	}
+}
@@ -1,12 +1,127 @@
 package shortener
 
-import "context"
+import (
+	"context"
+	"errors"
+	"strings"
 
-// ReadURL _
-func (s *service) ReadURL(ctx context.Context, shortURL string) (origURL string, err error) {
-	origURL, err = s.shortenerRepo.ReadURL(ctx, shortURL)
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/metrics"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
+	"github.com/zasuchilas/shortener/internal/app/utils/urlfuncs"
+)
+
+// PreviewSuffix is added to the short URL to get the preview page instead of the redirect (/abc+).
+const PreviewSuffix = "+"
+
+// ReadURL returns the destination of the short URL counting the visit.
+//
+// The extra path and the query of the request are passed through by the link options (see OpenURL).
+func (s *service) ReadURL(ctx context.Context, in model.OpenURLIn) (origURL string, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.ReadURL")
+	defer func() { tracing.End(span, err) }()
+
+	if in.ShortURL, err = requestKey(in); err != nil {
+		return "", err
+	}
+	row, err := s.requestRow(ctx, in, true)
 	if err != nil {
 		return "", err
 	}
-	return origURL, nil
+	return passThrough(row, in)
+}
+
+// OpenURL opens the short URL for the visitor.
+//
+// The short URL is looked up on the domain of the request host (see model.OpenURLIn).
+//
+// The preview page is shown for the short URL with the PreviewSuffix (the visit is not counted)
+// and for the links with the preview option. The "you are leaving" page is shown for the flagged destinations
+// if config.LeavingInterstitial is set. Otherwise the visitor is redirected with the status code of the link.
+// The visits by the HEAD requests are not counted.
+//
+// The extra path of the request (/abc/extra/path) is added to the destination path if the link forwards the path,
+// otherwise the short URL is not found. The query of the request is merged into the destination query
+// by the merge query option of the link.
+func (s *service) OpenURL(ctx context.Context, in model.OpenURLIn) (out *model.OpenedURL, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.OpenURL")
+	defer func() { tracing.End(span, err) }()
+
+	var preview bool
+	in.ShortURL, preview = strings.CutSuffix(in.ShortURL, PreviewSuffix)
+	if in.ShortURL, err = requestKey(in); err != nil {
+		return nil, err
+	}
+	row, err := s.requestRow(ctx, in, !preview && !in.Head)
+	if err != nil {
+		return nil, userURLError(err)
+	}
+	dest, err := passThrough(row, in)
+	if err != nil {
+		return nil, err
+	}
+
+	out = &model.OpenedURL{
+		Mode:     model.OpenRedirect,
+		ShortURL: urlfuncs.EnrichURL(row.Key()),
+		OrigURL:  dest,
+		Created:  row.Created,
+		Title:    row.Title,
+		Clicks:   row.Clicks,
+		Flagged:  urlfuncs.IsFlagged(row.OrigURL),
+	}
+	switch {
+	case preview || row.Preview:
+		out.Mode = model.OpenPreview
+	case out.Flagged && config.LeavingInterstitial:
+		out.Mode = model.OpenInterstitial
+	default:
+		setRedirect(out, row)
+	}
+
+	return out, nil
+}
+
+// requestRow reads the row of the short URL of the request, the visit is counted if count is set.
+//
+// The request with the extra path is checked before the visit is counted.
+func (s *service) requestRow(ctx context.Context, in model.OpenURLIn, count bool) (row *model.URLRow, err error) {
+	if !count || in.Path != "" {
+		if row, err = s.shortenerRepo.URLInfo(ctx, in.ShortURL); err != nil {
+			s.emitExpiredEvent(ctx, err)
+			return nil, err
+		}
+		if err = checkPassThrough(row, in); err != nil {
+			return nil, err
+		}
+		if !count {
+			return row, nil
+		}
+	}
+	return s.readURL(ctx, in.ShortURL)
+}
+
+// readURL reads the row of the short URL counting the visit.
+func (s *service) readURL(ctx context.Context, shortURL string) (*model.URLRow, error) {
+	row, err := s.shortenerRepo.ReadURL(ctx, shortURL)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrGone):
+			metrics.Redirects.WithLabelValues(metrics.RedirectGone).Inc()
+			s.emitExpiredEvent(ctx, err)
+		case errors.Is(err, repository.ErrNotFound):
+			metrics.Redirects.WithLabelValues(metrics.RedirectMiss).Inc()
+		}
+		return nil, err
+	}
+	metrics.Redirects.WithLabelValues(metrics.RedirectHit).Inc()
+	s.emitLinkEvent(model.LinkEvent{
+		Type:     model.EventLinkClicked,
+		UserID:   row.UserID,
+		ShortURL: row.Key(),
+		OrigURL:  row.OrigURL,
+	})
+	return row, nil
 }
@@ -0,0 +1,87 @@
+package shortener
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/model"
+)
+
+// redirectCodes are the redirect status codes allowed for the links.
+var redirectCodes = map[int]struct{}{
+	http.StatusMovedPermanently:  {},
+	http.StatusFound:             {},
+	http.StatusTemporaryRedirect: {},
+	http.StatusPermanentRedirect: {},
+}
+
+// CheckRedirectSettings checks config.RedirectCode and config.RedirectCacheMaxAge.
+func CheckRedirectSettings() error {
+	if _, err := defaultRedirectCode(); err != nil {
+		return err
+	}
+	_, err := redirectCacheMaxAge()
+	return err
+}
+
+// checkRedirectCode checks the redirect status code of the link (0 means the default code).
+func checkRedirectCode(code int) error {
+	if _, ok := redirectCodes[code]; !ok && code != 0 {
+		return fmt.Errorf("unknown redirect status code %d (expected 301, 302, 307 or 308)", code)
+	}
+	return nil
+}
+
+// defaultRedirectCode returns config.RedirectCode (307 if it is empty).
+func defaultRedirectCode() (int, error) {
+	if config.RedirectCode == "" {
+		return http.StatusTemporaryRedirect, nil
+	}
+	code, err := strconv.Atoi(config.RedirectCode)
+	if err != nil {
+		return 0, fmt.Errorf("wrong redirect status code %q: %w", config.RedirectCode, err)
+	}
+	if code == 0 {
+		return 0, fmt.Errorf("wrong redirect status code %q", config.RedirectCode)
+	}
+	return code, checkRedirectCode(code)
+}
+
+// redirectCacheMaxAge returns config.RedirectCacheMaxAge (0 if it is empty).
+func redirectCacheMaxAge() (time.Duration, error) {
+	if config.RedirectCacheMaxAge == "" {
+		return 0, nil
+	}
+	maxAge, err := time.ParseDuration(config.RedirectCacheMaxAge)
+	if err != nil {
+		return 0, fmt.Errorf("wrong redirect cache max age %q: %w", config.RedirectCacheMaxAge, err)
+	}
+	if maxAge < 0 {
+		return 0, fmt.Errorf("wrong redirect cache max age %q", config.RedirectCacheMaxAge)
+	}
+	return maxAge, nil
+}
+
+// setRedirect sets the redirect status code and the cache max age of the opened link.
+//
+// Only the permanent redirects are cached (the temporary ones are counted on every visit),
+// and not longer than until the link expiry.
+func setRedirect(opened *model.OpenedURL, row *model.URLRow) {
+	// the settings are checked at the start
+	opened.Code, _ = defaultRedirectCode()
+	if row.RedirectCode != 0 {
+		opened.Code = row.RedirectCode
+	}
+	opened.ExpiresAt = row.ExpiresAt
+
+	if opened.Code != http.StatusMovedPermanently && opened.Code != http.StatusPermanentRedirect {
+		return
+	}
+	opened.CacheMaxAge, _ = redirectCacheMaxAge()
+	if !row.ExpiresAt.IsZero() {
+		opened.CacheMaxAge = max(0, min(opened.CacheMaxAge, time.Until(row.ExpiresAt).Truncate(time.Second)))
+	}
+}
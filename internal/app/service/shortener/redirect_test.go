@@ -0,0 +1,57 @@
+package shortener
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/model"
+)
+
+func TestCheckRedirectSettings(t *testing.T) {
+	defer func() { config.RedirectCode, config.RedirectCacheMaxAge = "", "" }()
+
+	tests := []struct {
+		code, maxAge string
+		wantErr      bool
+	}{
+		{code: "", maxAge: ""},
+		{code: "301", maxAge: "24h"},
+		{code: "308", maxAge: "0"},
+		{code: "303", maxAge: "24h", wantErr: true},
+		{code: "0", maxAge: "24h", wantErr: true},
+		{code: "temporary", maxAge: "24h", wantErr: true},
+		{code: "307", maxAge: "day", wantErr: true},
+		{code: "307", maxAge: "-1h", wantErr: true},
+	}
+	for _, tt := range tests {
+		config.RedirectCode, config.RedirectCacheMaxAge = tt.code, tt.maxAge
+		err := CheckRedirectSettings()
+		assert.Equal(t, tt.wantErr, err != nil, "%s %s: %v", tt.code, tt.maxAge, err)
+	}
+}
+
+func TestSetRedirect(t *testing.T) {
+	config.RedirectCode, config.RedirectCacheMaxAge = "301", "24h"
+	defer func() { config.RedirectCode, config.RedirectCacheMaxAge = "", "" }()
+
+	// the default permanent redirect is cached
+	opened := &model.OpenedURL{}
+	setRedirect(opened, &model.URLRow{})
+	assert.Equal(t, http.StatusMovedPermanently, opened.Code)
+	assert.Equal(t, 24*time.Hour, opened.CacheMaxAge)
+
+	// not longer than until the link expiry
+	opened = &model.OpenedURL{}
+	setRedirect(opened, &model.URLRow{ExpiresAt: time.Now().Add(time.Hour)})
+	assert.InDelta(t, time.Hour.Seconds(), opened.CacheMaxAge.Seconds(), 2)
+
+	// the temporary redirect of the link is not cached
+	opened = &model.OpenedURL{}
+	setRedirect(opened, &model.URLRow{RedirectCode: http.StatusFound})
+	assert.Equal(t, http.StatusFound, opened.Code)
+	assert.Zero(t, opened.CacheMaxAge)
+}
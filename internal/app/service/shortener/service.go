@@ -2,12 +2,10 @@ package shortener
 
 import (
 	"context"
-	"strings"
+	"errors"
+	"sync/atomic"
 	"time"
 
-	"go.uber.org/zap"
-
-	"github.com/zasuchilas/shortener/internal/app/logger"
 	"github.com/zasuchilas/shortener/internal/app/model"
 	"github.com/zasuchilas/shortener/internal/app/repository"
 	"github.com/zasuchilas/shortener/internal/app/secure"
@@ -19,14 +17,73 @@ var _ def.ShortenerService = (*service)(nil)
 // Group deletion settings.
 const (
 	DeletingChanBuffer     = 1024
-	DeletingMaxRowsRequest = 512
+	DeletingMaxRowsRequest = 512 // also the maximum number of short urls in one flush
 	DeletingFlushInterval  = 10 * time.Second
+	DeletingFlushTimeout   = 5 * time.Second
+	DeletingRetryBaseDelay = 10 * time.Second
+	DeletingRetryMaxDelay  = 10 * time.Minute
+	DeletingMaxAttempts    = 10
+)
+
+// Shortening jobs settings.
+const (
+	ShortenJobWorkers         = 4
+	ShortenJobChanBuffer      = 1024
+	ShortenJobResyncInterval  = 10 * time.Second
+	ShortenJobChunkTimeout    = 10 * time.Second
+	ShortenJobRetryDelay      = 5 * time.Second
+	ShortenJobMaxAttempts     = 5
+	ShortenJobRetention       = 7 * 24 * time.Hour // the finished jobs are removed with their lines after it
+	ShortenJobCleanupInterval = time.Hour
+)
+
+// Webhooks settings.
+const (
+	WebhookMaxPerUser     = 10
+	WebhookChanBuffer     = 1024
+	WebhookWorkers        = 4 // the deliveries sent at the same time
+	WebhookPollInterval   = time.Second
+	WebhookDeliveryBatch  = 100
+	WebhookTimeout        = 5 * time.Second
+	WebhookRetryBaseDelay = 10 * time.Second
+	WebhookRetryMaxDelay  = 10 * time.Minute
+	WebhookMaxAttempts    = 8
+	WebhookExpiredCache   = 100000 // the short URLs whose expiry is reported (the set is reset when it is full)
+	WebhookClicksCache    = 100000 // the link owners whose webhooks are cached by the click router (reset when full)
+	WebhookClicksCacheTTL = 30 * time.Second
+)
+
+// Destination metadata settings.
+const (
+	MetadataWorkers    = 4
+	MetadataChanBuffer = 1024
+	MetadataTimeout    = 5 * time.Second // the fetch of the page with the redirects
+	MetadataMaxBody    = 1 << 20         // the bytes of the page read
+	MetadataUserAgent  = "Mozilla/5.0 (compatible; shortener-metadata/1.0)"
+)
+
+// Link checker settings.
+const (
+	LinkCheckWorkers      = 8 // the destination hosts checked at the same time
+	LinkCheckPollInterval = time.Minute
+	LinkCheckBatch        = 500
+	LinkCheckTimeout      = 10 * time.Second // the check of the destination with the redirects
+	LinkCheckFailures     = 2                // the failed checks in a row after which the link is broken
+	LinkCheckUserAgent    = "Mozilla/5.0 (compatible; shortener-linkcheck/1.0)"
 )
 
 type service struct {
 	shortenerRepo repository.IStorage
 	secure        *secure.Secure
 	deleteCh      chan model.DeleteTask
+	deleteResync  atomic.Bool
+	stopCh        chan context.Context
+	doneCh        chan struct{}
+
+	jobs   *jobPool
+	hooks  *hookPool
+	meta   *metaPool
+	checks *checkPool
 }
 
 // NewService _
@@ -36,47 +93,68 @@ func NewService(shortenerRepo repository.IStorage, secure *secure.Secure) *servi
 		secure:        secure,
 	}
 
+	// the pools are created before the workers start, because the workers use each other's pools
+	s.jobs = newJobPool()
+	s.hooks = newHookPool()
+	s.meta = newMetaPool()
+	s.checks = newCheckPool()
+
 	// batch deleting
 	s.deleteCh = make(chan model.DeleteTask, DeletingChanBuffer)
+	s.stopCh = make(chan context.Context)
+	s.doneCh = make(chan struct{})
 	go s.flushDeletingTasks()
 
+	// shortening jobs
+	s.jobs.start(s.dispatchShortenJobs, s.runShortenJobs)
+
+	// webhooks
+	s.hooks.start(s.routeLinkEvents, s.routeClickEvents, s.deliverWebhooks)
+
+	// destination metadata
+	s.meta.start(s.fetchMetadata)
+
+	// link checker
+	if interval, _ := linkCheckInterval(); interval > 0 {
+		s.checks.start(s.checkLinks)
+	}
+
 	return &s
 }
 
-// flushDeletingTasks start batch deleting urls.
-func (s *service) flushDeletingTasks() {
-
-	// the interval for sending data to the database
-	ticker := time.NewTicker(DeletingFlushInterval)
-
-	var shortURLs []string
-	// TODO: use generator & buffer chan for limit shortURLs slice
-	// channel for closing
-	//doneCh := make(chan struct{})
-	//defer close(doneCh)
-
-	for {
-		select {
-		case task := <-s.deleteCh:
-			shortURLs = append(shortURLs, task.ShortURLs...)
-			//inputCh := deleteGenerator(doneCh, task)
-		case <-ticker.C:
-			// if there is nothing to send, we do not send anything
-			if len(shortURLs) == 0 {
-				continue
-			}
-
-			err := s.shortenerRepo.DeleteURLs(context.TODO(), shortURLs...)
-			if err != nil {
-				logger.Log.Info("cannot delete urls",
-					zap.String("error", err.Error()), zap.String("shortURLs", strings.Join(shortURLs, ", ")))
-
-				// we will try to delete the data next time
-				continue
-			}
-
-			// clearing the deletion queue
-			shortURLs = nil
-		}
+// Stop stops the background workers, all of them are stopped even if some fail to stop in time.
+//
+// The deletion worker drains the queue and flushes it before stopping (the link events of the deletions
+// are routed to the webhooks), the tasks that could not be flushed before the deadline remain in the outbox.
+// The job workers stop after the current chunk, the jobs resume after the restart.
+// The webhook workers stop after the current deliveries, the pending ones are sent after the restart
+// (the link events that are not routed to the webhooks yet are lost).
+// The metadata workers stop after the current pages, the queued pages are not fetched.
+// The link checker stops after the current checks, the rest of the links are checked after the restart.
+func (s *service) Stop(ctx context.Context) error {
+	return errors.Join(
+		s.stopDeleting(ctx),
+		s.jobs.stop(ctx),
+		s.hooks.stop(ctx),
+		s.meta.stop(ctx),
+		s.checks.stop(ctx),
+	)
+}
+
+// stopDeleting stops the deletion worker after it drains and flushes the queue.
+func (s *service) stopDeleting(ctx context.Context) error {
+	select {
+	case s.stopCh <- ctx:
+	case <-s.doneCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-s.doneCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
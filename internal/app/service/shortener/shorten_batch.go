@@ -3,33 +3,43 @@ package shortener
 import (
 	"context"
 	"fmt"
-	"strings"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/zasuchilas/shortener/internal/app/logger"
 	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
 	"github.com/zasuchilas/shortener/internal/app/utils/urlfuncs"
 )
 
-// ShortenBatch _
-func (s *service) ShortenBatch(ctx context.Context, in []model.ShortenBatchIn, userID int64) (out []model.ShortenBatchOut, err error) {
+// ShortenBatch shortens the URLs on the domain (empty is the default domain, the others must be configured).
+func (s *service) ShortenBatch(ctx context.Context, in []model.ShortenBatchIn, rawDomain string, userID int64) (out []model.ShortenBatchOut, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.ShortenBatch")
+	defer func() { tracing.End(span, err) }()
+
+	domain, err := shortDomain(rawDomain)
+	if err != nil {
+		return nil, err
+	}
 
 	// checking request data
-	wrongBatchItems := make([]string, 0)
+	batchErr := &model.BatchError{}
 	for i, item := range in {
 		origURL, e := urlfuncs.CleanURL(item.OriginalURL)
 		if e != nil {
-			rowErr := fmt.Sprintf("Pos: %d, correlation_id: \"%s\", original_url: \"%s\", error: \"%s\"",
-				i, item.CorrelationID, item.OriginalURL, e.Error())
-			wrongBatchItems = append(wrongBatchItems, rowErr)
+			batchErr.Items = append(batchErr.Items, model.BatchItemError{
+				Index:         i,
+				CorrelationID: item.CorrelationID,
+				OriginalURL:   item.OriginalURL,
+				Error:         e.Error(),
+			})
 			continue
 		}
 		in[i].OriginalURL = origURL
 	}
-	if len(wrongBatchItems) > 0 {
-		return nil, fmt.Errorf("wrong batch items: %s", strings.Join(wrongBatchItems, ", "))
+	if len(batchErr.Items) > 0 {
+		return nil, batchErr
 	}
 
 	// getting origURLs for query
@@ -39,23 +49,26 @@ func (s *service) ShortenBatch(ctx context.Context, in []model.ShortenBatchIn, u
 	}
 
 	start := time.Now()
-	logger.Log.Info("batching data starting", zap.Time("start", start))
+	logger.FromContext(ctx).Info("batching data starting", zap.Time("start", start))
 
-	urlRows, err := s.shortenerRepo.WriteURLs(ctx, origURLs, userID)
+	urlRows, err := s.shortenerRepo.WriteURLs(ctx, domain, origURLs, userID)
 	if err != nil {
 		return nil, fmt.Errorf("batching urls %w", err)
 	}
 
+	s.emitCreatedEvents(urlRows, userID, start)
+
 	end := time.Now()
-	logger.Log.Info("batching data ending",
+	logger.FromContext(ctx).Info("batching data ending",
 		zap.Duration("duration", time.Since(start)),
 		zap.Time("end", end))
 
-	out = make([]model.ShortenBatchOut, len(urlRows))
+	// the items with the same canonical URL share one row
+	out = make([]model.ShortenBatchOut, len(in))
 	for i, requestItem := range in {
 		out[i] = model.ShortenBatchOut{
 			CorrelationID: requestItem.CorrelationID,
-			ShortURL:      urlfuncs.EnrichURL(urlRows[requestItem.OriginalURL].ShortURL),
+			ShortURL:      urlfuncs.EnrichURL(urlRows[requestItem.OriginalURL].Key()),
 		}
 	}
 
@@ -0,0 +1,37 @@
+package shortener
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+	"github.com/zasuchilas/shortener/internal/app/utils/urlfuncs"
+)
+
+func TestService_ShortenBatch_sameCanonicalURL(t *testing.T) {
+	config.URLCanonicalization = urlfuncs.CanonicalBasic
+	require.NoError(t, urlfuncs.CheckCanonicalization())
+	t.Cleanup(func() {
+		config.URLCanonicalization = ""
+		_ = urlfuncs.CheckCanonicalization()
+	})
+
+	s := &service{shortenerRepo: repository.NewDBMaps(), hooks: newHookPool()}
+	out, err := s.ShortenBatch(context.TODO(), []model.ShortenBatchIn{
+		{CorrelationID: "a", OriginalURL: "HTTP://Example.com:80/a"},
+		{CorrelationID: "b", OriginalURL: "http://example.com/a"},
+		{CorrelationID: "c", OriginalURL: "https://ya.ru"},
+	}, "", 1)
+	require.NoError(t, err)
+	require.Len(t, out, 3)
+	assert.Equal(t, "a", out[0].CorrelationID)
+	assert.Equal(t, "b", out[1].CorrelationID)
+	assert.Equal(t, out[0].ShortURL, out[1].ShortURL)
+	assert.Equal(t, "c", out[2].CorrelationID)
+	assert.NotEqual(t, out[0].ShortURL, out[2].ShortURL)
+}
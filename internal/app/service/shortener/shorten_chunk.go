@@ -0,0 +1,61 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zasuchilas/shortener/internal/app/model"
+	def "github.com/zasuchilas/shortener/internal/app/service"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
+	"github.com/zasuchilas/shortener/internal/app/utils/urlfuncs"
+)
+
+// ShortenChunk shortens the chunk of URLs in one storage transaction.
+//
+// Unlike ShortenBatch, the wrong URLs get the item errors and do not fail the others.
+// If the storage fails, nothing of the chunk is written and the error is returned.
+// The chunks are shortened on the default domain.
+func (s *service) ShortenChunk(ctx context.Context, in []model.ShortenBatchIn, userID int64) (out []model.ShortenItemOut, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.ShortenChunk")
+	defer func() { tracing.End(span, err) }()
+
+	if len(in) > def.ShortenChunkSize {
+		return nil, fmt.Errorf("the chunk is larger than %d URLs %w", def.ShortenChunkSize, model.ErrBadRequest)
+	}
+
+	// checking request data
+	out = make([]model.ShortenItemOut, len(in))
+	cleaned := make([]string, len(in))
+	origURLs := make([]string, 0, len(in))
+	for i, item := range in {
+		out[i] = model.ShortenItemOut{
+			CorrelationID: item.CorrelationID,
+			OriginalURL:   item.OriginalURL,
+		}
+		origURL, e := urlfuncs.CleanURL(item.OriginalURL)
+		if e != nil {
+			out[i].Error = e.Error()
+			continue
+		}
+		cleaned[i] = origURL
+		origURLs = append(origURLs, origURL)
+	}
+	if len(origURLs) == 0 {
+		return out, nil
+	}
+
+	start := time.Now()
+	urlRows, err := s.shortenerRepo.WriteURLs(ctx, "", origURLs, userID)
+	if err != nil {
+		return nil, fmt.Errorf("writing chunk %w", err)
+	}
+	s.emitCreatedEvents(urlRows, userID, start)
+
+	for i := range out {
+		if out[i].Error == "" {
+			out[i].ShortURL = urlfuncs.EnrichURL(urlRows[cleaned[i]].Key())
+		}
+	}
+	return out, nil
+}
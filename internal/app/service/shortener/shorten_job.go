@@ -0,0 +1,108 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	def "github.com/zasuchilas/shortener/internal/app/service"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
+)
+
+// SubmitShortenJob saves the shortening job of the lines in the storage and queues it for the workers.
+//
+// The lines are not checked here, the wrong ones get the errors when the job is processed.
+func (s *service) SubmitShortenJob(ctx context.Context, lines []model.ShortenJobLine, userID int64) (out *model.ShortenJob, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.SubmitShortenJob")
+	defer func() { tracing.End(span, err) }()
+
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("the job has no lines %w", model.ErrBadRequest)
+	}
+	if len(lines) > def.ShortenJobMaxLines {
+		return nil, fmt.Errorf("the job is too large (actual: %d, maximum: %d lines) %w",
+			len(lines), def.ShortenJobMaxLines, model.ErrBadRequest)
+	}
+
+	now := time.Now()
+	job := model.ShortenJob{
+		UserID:  userID,
+		Total:   len(lines),
+		Created: now,
+		Updated: now,
+		Lines:   make([]model.ShortenJobLine, len(lines)),
+	}
+	for i, line := range lines {
+		line.N = i
+		job.Lines[i] = line
+	}
+	if err = s.shortenerRepo.WriteShortenJob(ctx, &job); err != nil {
+		return nil, fmt.Errorf("saving the shortening job %w", err)
+	}
+	job.Lines = nil
+
+	// the request goroutine must not wait for the workers
+	if !s.jobs.push(job.ID) {
+		// the dispatcher will pick the job up from the storage
+		s.jobs.resync.Store(true)
+		logger.FromContext(ctx).Info("the job queue is full, the job is left in the storage", zap.Int64("id", job.ID))
+	}
+
+	return &job, nil
+}
+
+// ShortenJob returns the progress of the user shortening job.
+func (s *service) ShortenJob(ctx context.Context, id, userID int64) (out *model.ShortenJob, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.ShortenJob")
+	defer func() { tracing.End(span, err) }()
+
+	return s.userShortenJob(ctx, id, userID)
+}
+
+// ShortenJobResults returns no more than limit results of the finished user shortening job from the position.
+//
+// ErrConflict is returned if the job is not finished yet.
+// The lines that the failed job has not processed get the error of the job.
+func (s *service) ShortenJobResults(ctx context.Context, id, userID int64, from, limit int) (out []model.ShortenJobLine, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.ShortenJobResults")
+	defer func() { tracing.End(span, err) }()
+
+	if from < 0 || limit <= 0 {
+		return nil, fmt.Errorf("wrong range of the results (from %d, limit %d) %w", from, limit, model.ErrBadRequest)
+	}
+
+	job, err := s.userShortenJob(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !job.Finished() {
+		return nil, fmt.Errorf("the job is %s, the results are not ready %w", job.Status, model.ErrConflict)
+	}
+
+	out, err = s.shortenerRepo.ShortenJobLines(ctx, id, from, limit)
+	if err != nil {
+		return nil, userURLError(err)
+	}
+	for i := range out {
+		if out[i].N >= job.Processed {
+			out[i].Error = "the line is not processed: " + job.Error
+		}
+	}
+	return out, nil
+}
+
+// userShortenJob returns the shortening job of the user (the jobs of the other users are not found).
+func (s *service) userShortenJob(ctx context.Context, id, userID int64) (*model.ShortenJob, error) {
+	job, err := s.shortenerRepo.ShortenJob(ctx, id)
+	if err != nil {
+		return nil, userURLError(err)
+	}
+	if job.UserID != userID {
+		return nil, fmt.Errorf("the job %d %w", id, model.ErrNotFound)
+	}
+	return job, nil
+}
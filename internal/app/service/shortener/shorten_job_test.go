@@ -0,0 +1,106 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+	def "github.com/zasuchilas/shortener/internal/app/service"
+)
+
+func TestService_runShortenJob(t *testing.T) {
+	config.AllowPrivateNetworks = true
+	t.Cleanup(func() { config.AllowPrivateNetworks = false })
+
+	ctx := context.TODO()
+	repo := repository.NewDBMaps()
+	s := &service{shortenerRepo: repo, jobs: newJobPool()}
+
+	// more than one chunk with the wrong lines
+	lines := make([]model.ShortenJobLine, 0)
+	for i := 0; i < def.ShortenChunkSize+10; i++ {
+		lines = append(lines, model.ShortenJobLine{Line: i + 1, CorrelationID: fmt.Sprint(i),
+			OriginalURL: fmt.Sprintf("https://example.com/%d", i)})
+	}
+	lines[3].OriginalURL = "javascript:alert(1)"
+	lines[5] = model.ShortenJobLine{Line: 6, Error: "invalid character"}
+
+	job, err := s.SubmitShortenJob(ctx, lines, 1)
+	require.NoError(t, err)
+	assert.Equal(t, model.ShortenJobQueued, job.Status)
+
+	_, err = s.ShortenJobResults(ctx, job.ID, 1, 0, 10)
+	assert.ErrorIs(t, err, model.ErrConflict)
+
+	s.runShortenJob(ctx, job.ID)
+	job, err = s.ShortenJob(ctx, job.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, model.ShortenJobDone, job.Status)
+	assert.Equal(t, len(lines), job.Processed)
+	assert.Equal(t, 2, job.Failed)
+
+	results, err := s.ShortenJobResults(ctx, job.ID, 1, 0, len(lines))
+	require.NoError(t, err)
+	require.Len(t, results, len(lines))
+	assert.NotEmpty(t, results[0].ShortURL)
+	assert.Equal(t, "the URL scheme is not allowed: javascript", results[3].Error)
+	assert.Equal(t, "invalid character", results[5].Error)
+	assert.NotEmpty(t, results[len(lines)-1].ShortURL)
+
+	// the job of another user is not found
+	_, err = s.ShortenJob(ctx, job.ID, 2)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+	_, err = s.SubmitShortenJob(ctx, nil, 1)
+	assert.ErrorIs(t, err, model.ErrBadRequest)
+}
+
+func TestService_failShortenJob(t *testing.T) {
+	ctx := context.TODO()
+	repo := repository.NewDBMaps()
+	s := &service{shortenerRepo: repo}
+
+	job := &model.ShortenJob{UserID: 1, Total: 2, Lines: []model.ShortenJobLine{
+		{N: 0, OriginalURL: "https://example.com/a"}, {N: 1, OriginalURL: "https://example.com/b"},
+	}}
+	require.NoError(t, repo.WriteShortenJob(ctx, job))
+	job.Lines = nil
+
+	s.failShortenJob(ctx, job, errors.New("storage is unavailable"))
+	assert.Equal(t, model.ShortenJobFailed, job.Status)
+	ids, _ := repo.PendingShortenJobs(ctx)
+	assert.Empty(t, ids)
+
+	// the lines that are not processed get the job error
+	results, err := s.ShortenJobResults(ctx, job.ID, 1, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "the line is not processed: storage is unavailable", results[1].Error)
+}
+
+func TestService_resumeShortenJobs(t *testing.T) {
+	config.AllowPrivateNetworks = true
+	t.Cleanup(func() { config.AllowPrivateNetworks = false })
+
+	ctx := context.TODO()
+	repo := repository.NewDBMaps()
+
+	// the job accepted before the restart
+	job := &model.ShortenJob{UserID: 1, Total: 1, Lines: []model.ShortenJobLine{{OriginalURL: "https://example.com"}}}
+	require.NoError(t, repo.WriteShortenJob(ctx, job))
+
+	s := NewService(repo, nil)
+	defer s.Stop(ctx)
+
+	require.Eventually(t, func() bool {
+		found, err := repo.ShortenJob(ctx, job.ID)
+		return err == nil && found.Status == model.ShortenJobDone
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,269 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+	def "github.com/zasuchilas/shortener/internal/app/service"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
+)
+
+// jobPool is the worker pool of the shortening jobs.
+type jobPool struct {
+	ch      chan int64
+	resync  atomic.Bool // some jobs did not fit into the channel and are only in the storage
+	mutex   sync.Mutex
+	tracked map[int64]struct{} // the jobs in the channel or in the work
+	workers workerGroup
+}
+
+func newJobPool() *jobPool {
+	return &jobPool{
+		ch:      make(chan int64, ShortenJobChanBuffer),
+		tracked: make(map[int64]struct{}),
+	}
+}
+
+// start starts the dispatcher and the workers.
+func (p *jobPool) start(dispatch, work func(ctx context.Context)) {
+	p.workers.run(1, dispatch)
+	p.workers.run(ShortenJobWorkers, work)
+}
+
+// stop stops the dispatcher and the workers and waits for them.
+func (p *jobPool) stop(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	return p.workers.stop(ctx)
+}
+
+// push queues the job if it is not queued or in the work already.
+//
+// Returns false if the queue is full.
+func (p *jobPool) push(id int64) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, ok := p.tracked[id]; ok {
+		return true
+	}
+	select {
+	case p.ch <- id:
+		p.tracked[id] = struct{}{}
+		return true
+	default:
+		return false
+	}
+}
+
+// done forgets the job processed by the worker.
+func (p *jobPool) done(id int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	delete(p.tracked, id)
+}
+
+// dispatchShortenJobs queues the jobs accepted before the restart
+// and the jobs that did not fit into the queue, and removes the jobs finished before the retention period.
+func (s *service) dispatchShortenJobs(ctx context.Context) {
+	ticker := time.NewTicker(ShortenJobResyncInterval)
+	defer ticker.Stop()
+	cleanup := time.NewTicker(ShortenJobCleanupInterval)
+	defer cleanup.Stop()
+
+	s.restoreShortenJobs(ctx)
+	s.cleanupShortenJobs(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			if s.jobs.resync.Swap(false) {
+				s.restoreShortenJobs(ctx)
+			}
+		case <-cleanup.C:
+			s.cleanupShortenJobs(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// restoreShortenJobs queues the unfinished jobs from the storage.
+func (s *service) restoreShortenJobs(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, ShortenJobChunkTimeout)
+	defer cancel()
+
+	ids, err := s.shortenerRepo.PendingShortenJobs(ctx)
+	if err != nil {
+		logger.Log.Info("cannot load pending shortening jobs", zap.String("error", err.Error()))
+		// we will try to load the jobs next time
+		s.jobs.resync.Store(true)
+		return
+	}
+
+	for _, id := range ids {
+		if !s.jobs.push(id) {
+			s.jobs.resync.Store(true)
+			return
+		}
+	}
+}
+
+// cleanupShortenJobs removes the jobs finished before the retention period with their lines.
+func (s *service) cleanupShortenJobs(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, ShortenJobChunkTimeout)
+	defer cancel()
+
+	deleted, err := s.shortenerRepo.DeleteShortenJobs(ctx, time.Now().Add(-ShortenJobRetention))
+	if err != nil {
+		// we will try to remove the jobs next time
+		logger.Log.Info("cannot remove finished shortening jobs", zap.String("error", err.Error()))
+		return
+	}
+	if deleted > 0 {
+		logger.Log.Debug("finished shortening jobs removed", zap.Int("count", deleted))
+	}
+}
+
+// runShortenJobs processes the queued jobs until the context is canceled.
+func (s *service) runShortenJobs(ctx context.Context) {
+	for {
+		select {
+		case id := <-s.jobs.ch:
+			s.runShortenJob(ctx, id)
+			s.jobs.done(id)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runShortenJob processes the job chunk by chunk from the last saved position.
+//
+// The failed chunk is retried with the growing delay, the job fails when the attempts are over.
+// If the context is canceled, the job stays unfinished in the storage and resumes after the restart.
+func (s *service) runShortenJob(ctx context.Context, id int64) {
+	job, err := s.shortenerRepo.ShortenJob(ctx, id)
+	if err != nil {
+		logger.Log.Info("cannot load shortening job", zap.Int64("id", id), zap.String("error", err.Error()))
+		if !errors.Is(err, repository.ErrNotFound) && s.jobs != nil {
+			s.jobs.resync.Store(true)
+		}
+		return
+	}
+
+	attempts := 0
+	for !job.Finished() && ctx.Err() == nil {
+		if err = s.processShortenJobChunk(ctx, job); err == nil {
+			attempts = 0
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		attempts++
+		logger.Log.Info("cannot process shortening job chunk",
+			zap.Int64("id", id), zap.Int("from", job.Processed), zap.Int("attempts", attempts), zap.String("error", err.Error()))
+		if attempts >= ShortenJobMaxAttempts {
+			s.failShortenJob(ctx, job, err)
+			return
+		}
+
+		select {
+		case <-time.After(time.Duration(attempts) * ShortenJobRetryDelay):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// processShortenJobChunk shortens the next chunk of the job lines and saves the results and the progress.
+//
+// The chunk processed again after the failure gets the same short URLs (the original URLs are deduplicated).
+func (s *service) processShortenJobChunk(ctx context.Context, job *model.ShortenJob) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, ShortenJobChunkTimeout)
+	defer cancel()
+
+	ctx, span := tracing.Start(ctx, "shortener.processShortenJobChunk",
+		attribute.Int64("job", job.ID), attribute.Int("from", job.Processed))
+	defer func() { tracing.End(span, err) }()
+
+	lines, err := s.shortenerRepo.ShortenJobLines(ctx, job.ID, job.Processed, def.ShortenChunkSize)
+	if err != nil {
+		return err
+	}
+	if len(lines) == 0 && job.Processed < job.Total {
+		return fmt.Errorf("the lines of the job from %d are missing", job.Processed)
+	}
+
+	items := make([]model.ShortenBatchIn, 0, len(lines))
+	for _, line := range lines {
+		if line.Error == "" {
+			items = append(items, model.ShortenBatchIn{CorrelationID: line.CorrelationID, OriginalURL: line.OriginalURL})
+		}
+	}
+	out, err := s.ShortenChunk(ctx, items, job.UserID)
+	if err != nil {
+		return err
+	}
+
+	next := *job
+	for i := range lines {
+		if lines[i].Error == "" {
+			lines[i].ShortURL, lines[i].Error = out[0].ShortURL, out[0].Error
+			out = out[1:]
+		}
+		if lines[i].Error != "" {
+			next.Failed++
+		}
+	}
+	next.Lines = lines
+	next.Processed += len(lines)
+	next.Status = model.ShortenJobRunning
+	if next.Processed >= next.Total {
+		next.Status = model.ShortenJobDone
+	}
+	next.Updated = time.Now()
+	if err = s.shortenerRepo.UpdateShortenJob(ctx, &next); err != nil {
+		return err
+	}
+
+	next.Lines = nil
+	*job = next
+	return nil
+}
+
+// failShortenJob saves the job as failed with the last error (the processed lines keep their results).
+func (s *service) failShortenJob(ctx context.Context, job *model.ShortenJob, jobErr error) {
+	ctx, cancel := context.WithTimeout(ctx, ShortenJobChunkTimeout)
+	defer cancel()
+
+	failed := *job
+	failed.Status = model.ShortenJobFailed
+	failed.Error = jobErr.Error()
+	failed.Updated = time.Now()
+	if err := s.shortenerRepo.UpdateShortenJob(ctx, &failed); err != nil {
+		// the job resumes after the restart
+		logger.Log.Info("cannot mark shortening job as failed", zap.Int64("id", job.ID), zap.String("error", err.Error()))
+		return
+	}
+	*job = failed
+
+	logger.Log.Error("shortening job has failed: attempts are over",
+		zap.Int64("id", job.ID),
+		zap.Int64("userID", job.UserID),
+		zap.Int("processed", job.Processed),
+		zap.Int("total", job.Total),
+		zap.String("lastError", jobErr.Error()))
+}
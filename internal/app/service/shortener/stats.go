@@ -4,20 +4,26 @@ import (
 	"context"
 
 	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
+	"github.com/zasuchilas/shortener/internal/app/utils/urlfuncs"
 )
 
 // Stats _
-func (s *service) Stats(ctx context.Context) (*model.Stats, error) {
-	var (
-		out model.Stats
-		err error
-	)
+func (s *service) Stats(ctx context.Context) (_ *model.Stats, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.Stats")
+	defer func() { tracing.End(span, err) }()
 
-	out.URLs, err = s.shortenerRepo.Stats(ctx)
+	domains, err := s.shortenerRepo.Stats(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	out := model.Stats{Domains: make(map[string]int, len(domains))}
+	for domain, count := range domains {
+		out.URLs += count
+		out.Domains[urlfuncs.DomainHost(domain)] += count
+	}
+
 	out.Users = s.secure.UsersCount()
 
 	return &out, nil
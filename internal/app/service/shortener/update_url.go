@@ -0,0 +1,93 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
+	"github.com/zasuchilas/shortener/internal/app/utils/urlfuncs"
+)
+
+// UpdateURL changes the destination of the user short URL (the short URL is kept).
+func (s *service) UpdateURL(ctx context.Context, rawShortURL, rawURL string, userID int64) (out *model.UserURL, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.UpdateURL")
+	defer func() { tracing.End(span, err) }()
+
+	// checking request data
+	shortURL, err := shortURLKey(rawShortURL)
+	if err != nil {
+		return nil, err
+	}
+	origURL, err := urlfuncs.CleanURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%w)", err, model.ErrBadRequest)
+	}
+
+	revision, err := s.shortenerRepo.UpdateURL(ctx, userID, shortURL, origURL)
+	if err != nil {
+		return nil, userURLError(err)
+	}
+	if revision != nil {
+		logger.FromContext(ctx).Info("the link destination is changed",
+			zap.String("shortURL", shortURL),
+			zap.Int64("revision", revision.Revision),
+			zap.String("previous", revision.PrevURL),
+			zap.String("original", revision.OrigURL))
+		s.queueMetadata(shortURL, origURL)
+	}
+
+	domain, _ := model.SplitLinkKey(shortURL)
+	return &model.UserURL{
+		Domain:      urlfuncs.DomainHost(domain),
+		ShortURL:    urlfuncs.EnrichURL(shortURL),
+		OriginalURL: origURL,
+	}, nil
+}
+
+// URLRevisions returns the destination changes of the user short URL (the first revision first).
+func (s *service) URLRevisions(ctx context.Context, rawShortURL string, userID int64) (out []model.URLRevision, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.URLRevisions")
+	defer func() { tracing.End(span, err) }()
+
+	shortURL, err := shortURLKey(rawShortURL)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := s.shortenerRepo.URLRevisions(ctx, userID, shortURL)
+	if err != nil {
+		return nil, userURLError(err)
+	}
+
+	out = make([]model.URLRevision, len(revisions))
+	for i, revision := range revisions {
+		out[i] = *revision
+		out[i].ShortURL = urlfuncs.EnrichURL(shortURL)
+	}
+
+	return out, nil
+}
+
+// userURLError converts the storage errors of the user short URL checks into the service errors.
+func userURLError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return fmt.Errorf("%w (%w)", err, model.ErrNotFound)
+	case errors.Is(err, repository.ErrGone):
+		return fmt.Errorf("%w (%w)", err, model.ErrGone)
+	case errors.Is(err, repository.ErrForbidden):
+		return fmt.Errorf("%w (%w)", err, model.ErrForbidden)
+	case errors.Is(err, repository.ErrConflict):
+		return fmt.Errorf("%w (%w)", err, model.ErrConflict)
+	case errors.Is(err, repository.ErrBadRequest):
+		return fmt.Errorf("%w (%w)", err, model.ErrBadRequest)
+	default:
+		return err
+	}
+}
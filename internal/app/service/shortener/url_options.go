@@ -0,0 +1,106 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
+)
+
+// Limits of the link notes and tags.
+const (
+	TitleMaxLength = 200  // the maximum length of the link title (in characters)
+	NotesMaxLength = 2000 // the maximum length of the link notes (in characters)
+	TagsMaxCount   = 20   // the maximum number of the link tags
+	TagMaxLength   = 50   // the maximum length of the tag (in characters)
+)
+
+// UpdateURLOptions changes the options of the user short URL (nil options are kept as they are).
+func (s *service) UpdateURLOptions(ctx context.Context, rawShortURL string, opts model.URLOptions, userID int64) (out *model.UserURL, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.UpdateURLOptions")
+	defer func() { tracing.End(span, err) }()
+
+	// checking request data
+	shortURL, err := shortURLKey(rawShortURL)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Title == nil && opts.Notes == nil && opts.Tags == nil && opts.Preview == nil && opts.RedirectCode == nil &&
+		opts.ExpiresAt == nil && opts.ForwardPath == nil && opts.MergeQuery == nil {
+		return nil, fmt.Errorf("no link options to change %w", model.ErrBadRequest)
+	}
+	if opts.Title != nil {
+		title := strings.TrimSpace(*opts.Title)
+		if utf8.RuneCountInString(title) > TitleMaxLength {
+			return nil, fmt.Errorf("the link title is longer than %d characters %w", TitleMaxLength, model.ErrBadRequest)
+		}
+		opts.Title = &title
+	}
+	if opts.Notes != nil {
+		notes := strings.TrimSpace(*opts.Notes)
+		if utf8.RuneCountInString(notes) > NotesMaxLength {
+			return nil, fmt.Errorf("the link notes are longer than %d characters %w", NotesMaxLength, model.ErrBadRequest)
+		}
+		opts.Notes = &notes
+	}
+	if opts.Tags != nil {
+		tags, e := normalizeTags(*opts.Tags)
+		if e != nil {
+			return nil, fmt.Errorf("%w (%w)", e, model.ErrBadRequest)
+		}
+		if len(tags) > TagsMaxCount {
+			return nil, fmt.Errorf("the link has more than %d tags %w", TagsMaxCount, model.ErrBadRequest)
+		}
+		opts.Tags = &tags
+	}
+	if opts.RedirectCode != nil {
+		if err = checkRedirectCode(*opts.RedirectCode); err != nil {
+			return nil, fmt.Errorf("%w (%w)", err, model.ErrBadRequest)
+		}
+	}
+	if opts.ExpiresAt != nil && !opts.ExpiresAt.IsZero() && opts.ExpiresAt.Before(time.Now()) {
+		return nil, fmt.Errorf("the link expiry is in the past %w", model.ErrBadRequest)
+	}
+
+	if opts.MergeQuery != nil {
+		if err = checkQueryMerge(*opts.MergeQuery); err != nil {
+			return nil, fmt.Errorf("%w (%w)", err, model.ErrBadRequest)
+		}
+	}
+
+	row, err := s.shortenerRepo.UpdateURLOptions(ctx, userID, shortURL, opts)
+	if err != nil {
+		return nil, userURLError(err)
+	}
+
+	out = new(model.UserURL)
+	*out = toUserURL(row)
+	return out, nil
+}
+
+// normalizeTags returns the lowercase tags without the duplicates in order.
+//
+// The tag is the letters, the digits, '-', '_' and '.' up to TagMaxLength characters.
+func normalizeTags(raw []string) ([]string, error) {
+	tags := make([]string, 0, len(raw))
+	for _, tag := range raw {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || utf8.RuneCountInString(tag) > TagMaxLength {
+			return nil, fmt.Errorf("wrong tag %q (expected 1 to %d characters)", tag, TagMaxLength)
+		}
+		if i := strings.IndexFunc(tag, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_.", r)
+		}); i >= 0 {
+			return nil, fmt.Errorf("wrong tag %q (expected letters, digits, '-', '_' and '.')", tag)
+		}
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+	return slices.Compact(tags), nil
+}
@@ -0,0 +1,58 @@
+package shortener
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := normalizeTags([]string{" Go ", "docs", "go", "v1.22", "to-read"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docs", "go", "to-read", "v1.22"}, tags)
+
+	for _, tag := range []string{"", "two words", "a,b", "#go", strings.Repeat("a", TagMaxLength+1)} {
+		_, err = normalizeTags([]string{tag})
+		assert.Error(t, err, tag)
+	}
+}
+
+func TestService_UpdateURLOptions_tags(t *testing.T) {
+	ctx := context.TODO()
+	s := &service{shortenerRepo: repository.NewDBMaps(), hooks: newHookPool()}
+
+	readyURL, _, err := s.WriteURL(ctx, "https://go.dev/doc", "", 1)
+	require.NoError(t, err)
+
+	notes, tags := "  Read it first ", []string{"Go", "docs", "go"}
+	out, err := s.UpdateURLOptions(ctx, readyURL, model.URLOptions{Notes: &notes, Tags: &tags}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "Read it first", out.Notes)
+	assert.Equal(t, []string{"docs", "go"}, out.Tags)
+
+	tags = make([]string, TagsMaxCount+1)
+	for i := range tags {
+		tags[i] = strings.Repeat("t", i+1)
+	}
+	_, err = s.UpdateURLOptions(ctx, readyURL, model.URLOptions{Tags: &tags}, 1)
+	assert.ErrorIs(t, err, model.ErrBadRequest)
+	notes = strings.Repeat("n", NotesMaxLength+1)
+	_, err = s.UpdateURLOptions(ctx, readyURL, model.URLOptions{Notes: &notes}, 1)
+	assert.ErrorIs(t, err, model.ErrBadRequest)
+
+	// the search by the tag and the words
+	page, err := s.UserURLs(ctx, 1, model.UserURLsQuery{Tags: []string{"GO"}, Text: "read"})
+	require.NoError(t, err)
+	require.Len(t, page.URLs, 1)
+	assert.Equal(t, readyURL, page.URLs[0].ShortURL)
+	_, err = s.UserURLs(ctx, 1, model.UserURLsQuery{Text: "docs"})
+	assert.ErrorIs(t, err, model.ErrNoContent)
+	_, err = s.UserURLs(ctx, 1, model.UserURLsQuery{Text: "!!!"})
+	assert.ErrorIs(t, err, model.ErrBadRequest)
+}
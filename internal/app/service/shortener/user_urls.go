@@ -4,30 +4,97 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/zasuchilas/shortener/internal/app/model"
 	"github.com/zasuchilas/shortener/internal/app/repository"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
 	"github.com/zasuchilas/shortener/internal/app/utils/urlfuncs"
 )
 
-// UserURLs _
-func (s *service) UserURLs(ctx context.Context, userID int64) (out []model.UserURL, err error) {
+// Page sizes of the user URLs.
+const (
+	UserURLsDefaultLimit = 100
+	UserURLsMaxLimit     = 1000
+)
+
+// UserURLs returns the page of the user URLs by the filters and the order of the query.
+//
+// The query without the limit gets the page of UserURLsDefaultLimit rows.
+// model.ErrNoContent is returned if the user has no URLs or nothing passes the filters.
+func (s *service) UserURLs(ctx context.Context, userID int64, q model.UserURLsQuery) (out *model.UserURLsPage, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.UserURLs")
+	defer func() { tracing.End(span, err) }()
 
-	urlRowList, err := s.shortenerRepo.UserURLs(ctx, userID)
+	// checking request data
+	if q, err = checkUserURLsQuery(q); err != nil {
+		return nil, fmt.Errorf("%w (%w)", err, model.ErrBadRequest)
+	}
+
+	urlRowList, nextCursor, err := s.shortenerRepo.UserURLs(ctx, userID, q)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			return nil, fmt.Errorf("%w", model.ErrNoContent)
 		}
-		return nil, err
+		return nil, userURLError(err)
+	}
+	if len(urlRowList) == 0 {
+		return nil, fmt.Errorf("%w", model.ErrNoContent)
 	}
 
-	out = make([]model.UserURL, len(urlRowList))
+	out = &model.UserURLsPage{
+		URLs:       make([]model.UserURL, len(urlRowList)),
+		NextCursor: nextCursor,
+	}
 	for i, row := range urlRowList {
-		out[i] = model.UserURL{
-			ShortURL:    urlfuncs.EnrichURL(row.ShortURL),
-			OriginalURL: row.OrigURL,
-		}
+		out.URLs[i] = toUserURL(row)
 	}
 
 	return out, nil
 }
+
+// checkUserURLsQuery checks the query of the user URLs and sets the default limit.
+func checkUserURLsQuery(q model.UserURLsQuery) (model.UserURLsQuery, error) {
+	switch q.Status {
+	case model.URLStatusAll, model.URLStatusActive, model.URLStatusExpired, model.URLStatusDeleted:
+	default:
+		return q, fmt.Errorf("unknown status %q (expected %q, %q, %q or empty)",
+			q.Status, model.URLStatusActive, model.URLStatusExpired, model.URLStatusDeleted)
+	}
+	switch q.Sort {
+	case "", model.UserURLsSortCreated, model.UserURLsSortClicks:
+	default:
+		return q, fmt.Errorf("unknown sort %q (expected %q or %q)", q.Sort, model.UserURLsSortCreated, model.UserURLsSortClicks)
+	}
+	if !q.CreatedFrom.IsZero() && !q.CreatedTo.IsZero() && !q.CreatedFrom.Before(q.CreatedTo) {
+		return q, fmt.Errorf("the created range is empty")
+	}
+	if q.LinkDomains != nil {
+		domains := make([]string, len(q.LinkDomains))
+		for i, name := range q.LinkDomains {
+			domain, err := urlfuncs.ShortDomain(name)
+			if err != nil {
+				return q, err
+			}
+			domains[i] = domain
+		}
+		q.LinkDomains = domains
+	}
+	if q.Tags != nil {
+		tags, err := normalizeTags(q.Tags)
+		if err != nil {
+			return q, err
+		}
+		q.Tags = tags
+	}
+	if strings.TrimSpace(q.Text) != "" && len(model.SearchWords(q.Text)) == 0 {
+		return q, fmt.Errorf("the search text %q has no words", q.Text)
+	}
+	switch {
+	case q.Limit < 0 || q.Limit > UserURLsMaxLimit:
+		return q, fmt.Errorf("the limit is out of range [1, %d]", UserURLsMaxLimit)
+	case q.Limit == 0:
+		q.Limit = UserURLsDefaultLimit
+	}
+	return q, nil
+}
@@ -0,0 +1,226 @@
+package shortener
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/metrics"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
+	"github.com/zasuchilas/shortener/internal/app/utils/urlfuncs"
+)
+
+// webhookEvents are the event types the webhooks can subscribe to.
+var webhookEvents = map[string]struct{}{
+	model.EventLinkCreated: {},
+	model.EventLinkClicked: {},
+	model.EventLinkExpired: {},
+	model.EventLinkDeleted: {},
+	model.EventLinkBroken:  {},
+}
+
+// CreateWebhook subscribes the URL to the events of the user links (no events means all the events).
+//
+// The returned webhook has the secret of the payload signature, it is not shown later.
+func (s *service) CreateWebhook(ctx context.Context, rawURL string, events []string, userID int64) (out *model.Webhook, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.CreateWebhook")
+	defer func() { tracing.End(span, err) }()
+
+	// checking request data
+	hookURL, err := urlfuncs.CheckWebhookURL(ctx, rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w (%w)", err, model.ErrBadRequest)
+	}
+	var subscribed []string
+	seen := make(map[string]struct{}, len(events))
+	for _, event := range events {
+		if _, ok := webhookEvents[event]; !ok {
+			return nil, fmt.Errorf("unknown event %q %w", event, model.ErrBadRequest)
+		}
+		if _, ok := seen[event]; !ok {
+			seen[event] = struct{}{}
+			subscribed = append(subscribed, event)
+		}
+	}
+
+	hooks, err := s.shortenerRepo.UserWebhooks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(hooks) >= WebhookMaxPerUser {
+		return nil, fmt.Errorf("too many webhooks (maximum: %d) %w", WebhookMaxPerUser, model.ErrBadRequest)
+	}
+
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, err
+	}
+	hook := model.Webhook{
+		UserID:  userID,
+		URL:     hookURL,
+		Events:  subscribed,
+		Secret:  hex.EncodeToString(secret),
+		Created: time.Now(),
+	}
+	if err = s.shortenerRepo.WriteWebhook(ctx, &hook); err != nil {
+		return nil, fmt.Errorf("saving the webhook %w", err)
+	}
+	s.hooks.forgetHooks(userID)
+
+	return &hook, nil
+}
+
+// UserWebhooks returns the webhooks of the user without the secrets.
+func (s *service) UserWebhooks(ctx context.Context, userID int64) (out []model.Webhook, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.UserWebhooks")
+	defer func() { tracing.End(span, err) }()
+
+	hooks, err := s.shortenerRepo.UserWebhooks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	out = make([]model.Webhook, len(hooks))
+	for i, hook := range hooks {
+		out[i] = *hook
+		out[i].Secret = ""
+	}
+	return out, nil
+}
+
+// DeleteWebhook deletes the webhook of the user, the pending deliveries are not sent.
+func (s *service) DeleteWebhook(ctx context.Context, id, userID int64) (err error) {
+	ctx, span := tracing.Start(ctx, "shortener.DeleteWebhook")
+	defer func() { tracing.End(span, err) }()
+
+	if err = s.shortenerRepo.DeleteWebhook(ctx, userID, id); err != nil {
+		return userURLError(err)
+	}
+	s.hooks.forgetHooks(userID)
+	return nil
+}
+
+// WebhookDeliveries returns the delivery log of the user webhook (the newest first).
+func (s *service) WebhookDeliveries(ctx context.Context, id, userID int64) (out []model.WebhookDelivery, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.WebhookDeliveries")
+	defer func() { tracing.End(span, err) }()
+
+	deliveries, err := s.shortenerRepo.WebhookDeliveries(ctx, userID, id, repository.WebhookLogSize)
+	if err != nil {
+		return nil, userURLError(err)
+	}
+
+	out = make([]model.WebhookDelivery, len(deliveries))
+	for i, delivery := range deliveries {
+		out[i] = *delivery
+	}
+	return out, nil
+}
+
+// emitLinkEvent queues the event for the webhooks of the link owner.
+//
+// The caller never waits: if the queue is full, the event is dropped.
+// The click events go to their own queue, unless the cached webhooks of the owner don't receive them.
+func (s *service) emitLinkEvent(event model.LinkEvent) {
+	if s.hooks == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	queue := s.hooks.events
+	if event.Type == model.EventLinkClicked {
+		if hooks, ok := s.hooks.cachedHooks(event.UserID); ok && !subscribed(hooks, event.Type) {
+			return
+		}
+		queue = s.hooks.clicks
+	}
+
+	select {
+	case queue <- event:
+	default:
+		metrics.WebhookEventsDropped.Inc()
+		logger.Log.Info("the webhook queue is full, the event is dropped",
+			zap.String("type", event.Type), zap.String("shortURL", event.ShortURL))
+	}
+}
+
+// emitCreatedEvents emits the created events of the rows written by the user since the start
+// and queues the fetching of their destination pages
+// (the existing rows are returned by the storage too, the clock of the storage is expected to be in sync).
+func (s *service) emitCreatedEvents(urlRows map[string]*model.URLRow, userID int64, start time.Time) {
+	for _, row := range urlRows {
+		if row.UserID == userID && !row.Created.Before(start) {
+			s.emitLinkEvent(model.LinkEvent{
+				Type:     model.EventLinkCreated,
+				UserID:   userID,
+				ShortURL: row.Key(),
+				OrigURL:  row.OrigURL,
+			})
+			s.queueMetadata(row.Key(), row.OrigURL)
+		}
+	}
+}
+
+// emitExpiredEvent emits the expired event if the link is found expired for the first time by this instance.
+//
+// The expiry is not the change of the storage, so the event is saved in the outbox of the event bus here.
+func (s *service) emitExpiredEvent(ctx context.Context, err error) {
+	var expired *repository.ExpiredError
+	if s.hooks == nil || !errors.As(err, &expired) || !s.hooks.firstExpiry(expired.Row.Key()) {
+		return
+	}
+	event := model.LinkEvent{
+		Type:     model.EventLinkExpired,
+		UserID:   expired.Row.UserID,
+		ShortURL: expired.Row.Key(),
+		OrigURL:  expired.Row.OrigURL,
+		Time:     time.Now(),
+	}
+	s.emitLinkEvent(event)
+	s.writeBusEvent(ctx, expired.Row, event)
+}
+
+// emitBrokenEvent emits the broken event of the link whose destination is found broken by the checker.
+//
+// The check result is not the change of the link, so the event is saved in the outbox of the event bus here.
+func (s *service) emitBrokenEvent(ctx context.Context, row *model.URLRow) {
+	event := model.LinkEvent{
+		Type:     model.EventLinkBroken,
+		UserID:   row.UserID,
+		ShortURL: row.Key(),
+		OrigURL:  row.OrigURL,
+		Time:     time.Now(),
+	}
+	s.emitLinkEvent(event)
+	s.writeBusEvent(ctx, row, event)
+}
+
+// writeBusEvent saves the event of the link in the outbox of the event bus (if the bus is enabled).
+func (s *service) writeBusEvent(ctx context.Context, row *model.URLRow, event model.LinkEvent) {
+	if config.EventBus == "" {
+		return
+	}
+	busEvent := model.BusEvent{
+		Type:     event.Type,
+		UserID:   event.UserID,
+		Domain:   row.Domain,
+		ShortURL: row.ShortURL,
+		OrigURL:  event.OrigURL,
+		Time:     event.Time,
+	}
+	if err := s.shortenerRepo.WriteBusEvents(ctx, []*model.BusEvent{&busEvent}); err != nil {
+		logger.FromContext(ctx).Info("cannot save the link event in the outbox",
+			zap.String("event", event.Type), zap.String("shortURL", event.ShortURL), zap.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,241 @@
+package shortener
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+	"github.com/zasuchilas/shortener/pkg/shortenerhttpv1"
+)
+
+// hookReceiver is the webhook receiver that fails the first requests.
+type hookReceiver struct {
+	failures int
+	mutex    sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (h *hookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.requests = append(h.requests, r)
+	h.bodies = append(h.bodies, body)
+	if len(h.requests) <= h.failures {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestService_deliverWebhooks(t *testing.T) {
+	config.AllowPrivateNetworks = true
+	t.Cleanup(func() { config.AllowPrivateNetworks = false })
+
+	receiver := &hookReceiver{failures: 1}
+	ts := httptest.NewServer(receiver)
+	defer ts.Close()
+
+	ctx := context.TODO()
+	repo := repository.NewDBMaps()
+	s := &service{shortenerRepo: repo, hooks: newHookPool()}
+
+	hook, err := s.CreateWebhook(ctx, ts.URL+"/hook", []string{model.EventLinkCreated, model.EventLinkCreated}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{model.EventLinkCreated}, hook.Events)
+	assert.NotEmpty(t, hook.Secret)
+
+	// the event is routed to the subscribed webhooks only
+	_, _, err = s.WriteURL(ctx, "https://ya.ru", "", 1)
+	require.NoError(t, err)
+	_, _, err = s.WriteURL(ctx, "https://ya.ru", "", 1) // conflict
+	require.NoError(t, err)
+	s.emitLinkEvent(model.LinkEvent{Type: model.EventLinkClicked, UserID: 1, ShortURL: "19xtf1ts"})
+	require.Len(t, s.hooks.events, 1)
+	require.Len(t, s.hooks.clicks, 1)
+	s.routeLinkEvent(ctx, <-s.hooks.events)
+	s.routeClickEvent(ctx, <-s.hooks.clicks)
+
+	// the clicks are not queued while the cached webhooks of the owner don't receive them
+	s.emitLinkEvent(model.LinkEvent{Type: model.EventLinkClicked, UserID: 1, ShortURL: "19xtf1ts"})
+	assert.Empty(t, s.hooks.clicks)
+
+	// the first attempt fails and is retried later
+	s.deliverPendingWebhooks(ctx)
+	log, err := s.WebhookDeliveries(ctx, hook.ID, 1)
+	require.NoError(t, err)
+	require.Len(t, log, 1)
+	assert.Equal(t, model.WebhookDeliveryPending, log[0].Status)
+	assert.Equal(t, 1, log[0].Attempts)
+	assert.Equal(t, http.StatusInternalServerError, log[0].ResponseCode)
+	assert.True(t, log[0].NextTry.After(time.Now()))
+
+	pending, err := repo.PendingWebhookDeliveries(ctx, time.Now().Add(WebhookRetryBaseDelay), 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.True(t, s.deliverWebhook(ctx, pending[0]))
+
+	log, err = s.WebhookDeliveries(ctx, hook.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, model.WebhookDeliveryDelivered, log[0].Status)
+	assert.Equal(t, 2, log[0].Attempts)
+	assert.Empty(t, log[0].Error)
+
+	// the receiver checks the signature of the payload
+	require.Len(t, receiver.requests, 2)
+	req, body := receiver.requests[1], receiver.bodies[1]
+	assert.Equal(t, model.EventLinkCreated, req.Header.Get(shortenerhttpv1.WebhookEventHeader))
+	assert.Equal(t, strconv.FormatInt(log[0].ID, 10), req.Header.Get(shortenerhttpv1.WebhookDeliveryHeader))
+	timestamp, err := strconv.ParseInt(req.Header.Get(shortenerhttpv1.WebhookTimestampHeader), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, shortenerhttpv1.WebhookSignature(hook.Secret, timestamp, body),
+		req.Header.Get(shortenerhttpv1.WebhookSignatureHeader))
+
+	var event shortenerhttpv1.WebhookEvent
+	require.NoError(t, json.Unmarshal(body, &event))
+	assert.Equal(t, model.EventLinkCreated, event.Type)
+	assert.Equal(t, "https://ya.ru", event.OriginalURL)
+	assert.Contains(t, event.ShortURL, "19xtf1ts")
+
+	// the other users can't see the webhooks
+	_, err = s.WebhookDeliveries(ctx, hook.ID, 2)
+	assert.ErrorIs(t, err, model.ErrNotFound)
+	assert.ErrorIs(t, s.DeleteWebhook(ctx, hook.ID, 2), model.ErrNotFound)
+	hooks, err := s.UserWebhooks(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, hooks, 1)
+	assert.Empty(t, hooks[0].Secret)
+}
+
+func TestService_deliverWebhook_attemptsAreOver(t *testing.T) {
+	config.AllowPrivateNetworks = true
+	t.Cleanup(func() { config.AllowPrivateNetworks = false })
+
+	receiver := &hookReceiver{failures: WebhookMaxAttempts}
+	ts := httptest.NewServer(receiver)
+	defer ts.Close()
+
+	ctx := context.TODO()
+	repo := repository.NewDBMaps()
+	s := &service{shortenerRepo: repo, hooks: newHookPool()}
+
+	hook, err := s.CreateWebhook(ctx, ts.URL, nil, 1)
+	require.NoError(t, err)
+	s.routeLinkEvent(ctx, model.LinkEvent{Type: model.EventLinkDeleted, UserID: 1, ShortURL: "19xtf1ts", Time: time.Now()})
+
+	for range WebhookMaxAttempts {
+		pending, err := repo.PendingWebhookDeliveries(ctx, time.Now().Add(WebhookRetryMaxDelay), 10)
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+		s.deliverWebhook(ctx, pending[0])
+	}
+
+	log, err := s.WebhookDeliveries(ctx, hook.ID, 1)
+	require.NoError(t, err)
+	require.Len(t, log, 1)
+	assert.Equal(t, model.WebhookDeliveryFailed, log[0].Status)
+	assert.Equal(t, WebhookMaxAttempts, log[0].Attempts)
+	assert.Contains(t, log[0].Error, "500")
+	assert.Len(t, receiver.requests, WebhookMaxAttempts)
+}
+
+func TestService_routeClickEvent(t *testing.T) {
+	ctx := context.TODO()
+	repo := repository.NewDBMaps()
+	s := &service{shortenerRepo: repo, hooks: newHookPool()}
+
+	// the owner without the webhooks
+	s.routeClickEvent(ctx, model.LinkEvent{Type: model.EventLinkClicked, UserID: 1, ShortURL: "19xtf1ts", Time: time.Now()})
+	s.emitLinkEvent(model.LinkEvent{Type: model.EventLinkClicked, UserID: 1, ShortURL: "19xtf1ts"})
+	assert.Empty(t, s.hooks.clicks)
+
+	// the new webhook drops the cache, the clicks are routed by the cached webhooks
+	hook, err := s.CreateWebhook(ctx, "https://93.184.215.14/hook", []string{model.EventLinkClicked}, 1)
+	require.NoError(t, err)
+	for range 3 {
+		s.emitLinkEvent(model.LinkEvent{Type: model.EventLinkClicked, UserID: 1, ShortURL: "19xtf1ts"})
+	}
+	require.Len(t, s.hooks.clicks, 3)
+	for range 3 {
+		s.routeClickEvent(ctx, <-s.hooks.clicks)
+	}
+	assert.Empty(t, s.hooks.events)
+
+	log, err := s.WebhookDeliveries(ctx, hook.ID, 1)
+	require.NoError(t, err)
+	require.Len(t, log, 3)
+	assert.Equal(t, model.EventLinkClicked, log[0].Event)
+
+	// the deleted webhook drops the cache
+	require.NoError(t, s.DeleteWebhook(ctx, hook.ID, 1))
+	s.emitLinkEvent(model.LinkEvent{Type: model.EventLinkClicked, UserID: 1, ShortURL: "19xtf1ts"})
+	require.Len(t, s.hooks.clicks, 1)
+	s.routeClickEvent(ctx, <-s.hooks.clicks)
+	s.emitLinkEvent(model.LinkEvent{Type: model.EventLinkClicked, UserID: 1, ShortURL: "19xtf1ts"})
+	assert.Empty(t, s.hooks.clicks)
+}
+
+func TestService_CreateWebhook(t *testing.T) {
+	ctx := context.TODO()
+	s := &service{shortenerRepo: repository.NewDBMaps()}
+
+	// the private networks are not allowed
+	_, err := s.CreateWebhook(ctx, "http://127.0.0.1:8080/hook", nil, 1)
+	assert.ErrorIs(t, err, model.ErrBadRequest)
+	_, err = s.CreateWebhook(ctx, "https://93.184.215.14/hook", []string{"link.unknown"}, 1)
+	assert.ErrorIs(t, err, model.ErrBadRequest)
+
+	for range WebhookMaxPerUser {
+		_, err = s.CreateWebhook(ctx, "https://93.184.215.14/hook", nil, 1)
+		require.NoError(t, err)
+	}
+	_, err = s.CreateWebhook(ctx, "https://93.184.215.14/hook", nil, 1)
+	assert.ErrorIs(t, err, model.ErrBadRequest)
+}
+
+func TestService_emitExpiredEvent(t *testing.T) {
+	config.EventBus = "kafka"
+	t.Cleanup(func() { config.EventBus = "" })
+
+	ctx := context.TODO()
+	repo := repository.NewDBMaps()
+	s := &service{shortenerRepo: repo, hooks: newHookPool()}
+
+	shortURL, _, err := repo.WriteURL(ctx, "", "https://ya.ru", 1)
+	require.NoError(t, err)
+	expires := time.Now().Add(-time.Minute)
+	_, err = repo.UpdateURLOptions(ctx, 1, shortURL, model.URLOptions{ExpiresAt: &expires})
+	require.NoError(t, err)
+
+	// the expiry is reported once
+	for range 2 {
+		_, err = s.ReadURL(ctx, model.OpenURLIn{ShortURL: shortURL})
+		assert.ErrorIs(t, err, repository.ErrGone)
+	}
+	require.Len(t, s.hooks.events, 1)
+	event := <-s.hooks.events
+	assert.Equal(t, model.EventLinkExpired, event.Type)
+	assert.Equal(t, int64(1), event.UserID)
+	assert.Equal(t, shortURL, event.ShortURL)
+
+	// the expiry goes to the outbox of the event bus after the created event
+	events, err := repo.PendingBusEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, model.EventLinkExpired, events[1].Type)
+	assert.Equal(t, shortURL, events[1].ShortURL)
+}
@@ -0,0 +1,410 @@
+package shortener
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/converter"
+	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/metrics"
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
+	"github.com/zasuchilas/shortener/internal/app/utils/urlfuncs"
+	"github.com/zasuchilas/shortener/pkg/shortenerhttpv1"
+)
+
+// hookPool is the routers of the link events to the webhooks and the delivery worker.
+//
+// The events are queued in memory: the event is lost if the queue is full, if the instance stops
+// before it is routed or if its deliveries can't be saved. The router saves the deliveries of the event
+// in the storage, the saved deliveries are sent at least once (after the restart too).
+// The delivery worker sends the pending deliveries and retries the failed ones with the exponential delay.
+//
+// The click events have their own queue and router, so the redirects don't crowd out the other events.
+// The click router caches the webhooks of the link owners for WebhookClicksCacheTTL,
+// the clicks of the owners without the subscription to them are not queued at all.
+type hookPool struct {
+	events  chan model.LinkEvent
+	clicks  chan model.LinkEvent
+	notify  chan struct{} // the new deliveries are saved
+	client  *http.Client
+	mutex   sync.Mutex
+	expired map[string]struct{} // the short URLs whose expiry is reported
+	owners  map[int64]ownerHooks
+	workers workerGroup
+}
+
+// ownerHooks are the cached webhooks of the link owner.
+type ownerHooks struct {
+	hooks   []*model.Webhook
+	expires time.Time
+}
+
+func newHookPool() *hookPool {
+	return &hookPool{
+		events:  make(chan model.LinkEvent, WebhookChanBuffer),
+		clicks:  make(chan model.LinkEvent, WebhookChanBuffer),
+		notify:  make(chan struct{}, 1),
+		client:  urlfuncs.NewWebhookClient(WebhookTimeout),
+		expired: make(map[string]struct{}),
+		owners:  make(map[int64]ownerHooks),
+	}
+}
+
+// start starts the routers and the delivery worker.
+func (p *hookPool) start(route, routeClicks, deliver func(ctx context.Context)) {
+	p.workers.run(1, route)
+	p.workers.run(1, routeClicks)
+	p.workers.run(1, deliver)
+}
+
+// stop stops the routers and the delivery worker and waits for them.
+func (p *hookPool) stop(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	return p.workers.stop(ctx)
+}
+
+// wake wakes the delivery worker up without waiting.
+func (p *hookPool) wake() {
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+// firstExpiry reports whether the expiry of the short URL is not reported yet and remembers it.
+func (p *hookPool) firstExpiry(shortURL string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, ok := p.expired[shortURL]; ok {
+		return false
+	}
+	if len(p.expired) >= WebhookExpiredCache {
+		p.expired = make(map[string]struct{})
+	}
+	p.expired[shortURL] = struct{}{}
+	return true
+}
+
+// cachedHooks returns the cached webhooks of the link owner, reports false if they are not cached or expired.
+func (p *hookPool) cachedHooks(userID int64) ([]*model.Webhook, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	cached, ok := p.owners[userID]
+	if !ok || time.Now().After(cached.expires) {
+		return nil, false
+	}
+	return cached.hooks, true
+}
+
+// cacheHooks caches the webhooks of the link owner for WebhookClicksCacheTTL.
+func (p *hookPool) cacheHooks(userID int64, hooks []*model.Webhook) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.owners) >= WebhookClicksCache {
+		p.owners = make(map[int64]ownerHooks)
+	}
+	p.owners[userID] = ownerHooks{hooks: hooks, expires: time.Now().Add(WebhookClicksCacheTTL)}
+}
+
+// forgetHooks drops the cached webhooks of the link owner (they are changed).
+func (p *hookPool) forgetHooks(userID int64) {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	delete(p.owners, userID)
+}
+
+// subscribed reports whether any of the webhooks receives the events of the type.
+func subscribed(hooks []*model.Webhook, event string) bool {
+	for _, hook := range hooks {
+		if hook.Subscribed(event) {
+			return true
+		}
+	}
+	return false
+}
+
+// routeLinkEvents saves the deliveries of the queued events until the context is canceled.
+func (s *service) routeLinkEvents(ctx context.Context) {
+	for {
+		select {
+		case event := <-s.hooks.events:
+			s.routeLinkEvent(ctx, event)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// routeLinkEvent saves the deliveries of the event to the subscribed webhooks of the link owner.
+func (s *service) routeLinkEvent(ctx context.Context, event model.LinkEvent) {
+	ctx, cancel := context.WithTimeout(ctx, WebhookTimeout)
+	defer cancel()
+
+	hooks, err := s.shortenerRepo.UserWebhooks(ctx, event.UserID)
+	if err != nil {
+		logger.Log.Info("cannot load webhooks, the event is lost",
+			zap.String("type", event.Type), zap.String("shortURL", event.ShortURL), zap.String("error", err.Error()))
+		return
+	}
+	s.saveLinkEventDeliveries(ctx, event, hooks)
+}
+
+// routeClickEvents saves the deliveries of the queued click events until the context is canceled.
+func (s *service) routeClickEvents(ctx context.Context) {
+	for {
+		select {
+		case event := <-s.hooks.clicks:
+			s.routeClickEvent(ctx, event)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// routeClickEvent saves the deliveries of the click event to the subscribed webhooks of the link owner
+// (the webhooks are loaded from the storage once in WebhookClicksCacheTTL).
+func (s *service) routeClickEvent(ctx context.Context, event model.LinkEvent) {
+	ctx, cancel := context.WithTimeout(ctx, WebhookTimeout)
+	defer cancel()
+
+	hooks, ok := s.hooks.cachedHooks(event.UserID)
+	if !ok {
+		var err error
+		if hooks, err = s.shortenerRepo.UserWebhooks(ctx, event.UserID); err != nil {
+			logger.Log.Info("cannot load webhooks, the event is lost",
+				zap.String("type", event.Type), zap.String("shortURL", event.ShortURL), zap.String("error", err.Error()))
+			return
+		}
+		s.hooks.cacheHooks(event.UserID, hooks)
+	}
+	if !s.saveLinkEventDeliveries(ctx, event, hooks) {
+		// the cached webhook may be deleted by the other instance
+		s.hooks.forgetHooks(event.UserID)
+	}
+}
+
+// saveLinkEventDeliveries saves the deliveries of the event to the subscribed webhooks
+// and wakes the delivery worker up, reports false if the deliveries can't be saved.
+func (s *service) saveLinkEventDeliveries(ctx context.Context, event model.LinkEvent, hooks []*model.Webhook) bool {
+	event.ShortURL = urlfuncs.EnrichURL(event.ShortURL)
+	payload, err := json.Marshal(converter.ToWebhookEventFromLinkEvent(event))
+	if err != nil {
+		logger.Log.Error("encoding webhook event", zap.Error(err))
+		return false
+	}
+
+	now := time.Now()
+	deliveries := make([]*model.WebhookDelivery, 0, len(hooks))
+	for _, hook := range hooks {
+		if !hook.Subscribed(event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, &model.WebhookDelivery{
+			WebhookID: hook.ID,
+			UserID:    hook.UserID,
+			Event:     event.Type,
+			URL:       hook.URL,
+			Payload:   string(payload),
+			Status:    model.WebhookDeliveryPending,
+			Created:   now,
+			Updated:   now,
+			NextTry:   now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return true
+	}
+
+	if err = s.shortenerRepo.WriteWebhookDeliveries(ctx, deliveries); err != nil {
+		logger.Log.Info("cannot save webhook deliveries, the event is lost",
+			zap.String("type", event.Type), zap.String("shortURL", event.ShortURL), zap.String("error", err.Error()))
+		return false
+	}
+	s.hooks.wake()
+	return true
+}
+
+// deliverWebhooks sends the pending deliveries by the ticker and when the new ones are saved.
+func (s *service) deliverWebhooks(ctx context.Context) {
+	ticker := time.NewTicker(WebhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.deliverPendingWebhooks(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-s.hooks.notify:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliverPendingWebhooks sends the pending deliveries that are ready, no more than WebhookWorkers at the same time.
+//
+// Every batch is finished before the next one is loaded, so the delivery is not sent twice at the same time.
+func (s *service) deliverPendingWebhooks(ctx context.Context) {
+	for ctx.Err() == nil {
+		loadCtx, cancel := context.WithTimeout(ctx, WebhookTimeout)
+		deliveries, err := s.shortenerRepo.PendingWebhookDeliveries(loadCtx, time.Now(), WebhookDeliveryBatch)
+		cancel()
+		if err != nil {
+			logger.Log.Info("cannot load pending webhook deliveries", zap.String("error", err.Error()))
+			return
+		}
+
+		var (
+			wg    sync.WaitGroup
+			sem   = make(chan struct{}, WebhookWorkers)
+			mutex sync.Mutex
+			saved = true
+		)
+		for _, delivery := range deliveries {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				if !s.deliverWebhook(ctx, delivery) {
+					mutex.Lock()
+					saved = false
+					mutex.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		// the rest is sent by the next tick if the storage fails
+		if len(deliveries) < WebhookDeliveryBatch || !saved {
+			return
+		}
+	}
+}
+
+// deliverWebhook sends the delivery and saves the result of the attempt.
+//
+// The delivery is delivered if the receiver responds with 2xx, otherwise it is retried with the growing delay
+// and fails when the attempts are over. Returns false if the result is not saved.
+func (s *service) deliverWebhook(ctx context.Context, delivery *model.WebhookDelivery) (saved bool) {
+	var err error
+	ctx, span := tracing.Start(ctx, "shortener.deliverWebhook",
+		attribute.Int64("delivery", delivery.ID), attribute.String("event", delivery.Event))
+	defer func() { tracing.End(span, err) }()
+
+	hooks, err := s.shortenerRepo.UserWebhooks(ctx, delivery.UserID)
+	if err != nil {
+		logger.Log.Info("cannot load webhooks", zap.Int64("delivery", delivery.ID), zap.String("error", err.Error()))
+		return false
+	}
+	var hook *model.Webhook
+	for _, h := range hooks {
+		if h.ID == delivery.WebhookID {
+			hook = h
+		}
+	}
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.Updated = now
+	delivery.ResponseCode = 0
+	delivery.Error = ""
+	if hook == nil {
+		// the webhook is deleted after the delivery was loaded
+		err = errors.New("the webhook is deleted")
+		delivery.Attempts = WebhookMaxAttempts
+	} else {
+		delivery.ResponseCode, err = s.hooks.send(ctx, hook, delivery)
+	}
+
+	outcome := metrics.WebhookDelivered
+	switch {
+	case err == nil:
+		delivery.Status = model.WebhookDeliveryDelivered
+	case delivery.Attempts >= WebhookMaxAttempts:
+		outcome = metrics.WebhookFailed
+		delivery.Status = model.WebhookDeliveryFailed
+		delivery.Error = err.Error()
+		logger.Log.Info("webhook delivery has failed: attempts are over",
+			zap.Int64("delivery", delivery.ID),
+			zap.Int64("webhook", delivery.WebhookID),
+			zap.Int64("userID", delivery.UserID),
+			zap.String("event", delivery.Event),
+			zap.String("lastError", err.Error()))
+	default:
+		outcome = metrics.WebhookRetry
+		delivery.Error = err.Error()
+		delivery.NextTry = now.Add(backoff(WebhookRetryBaseDelay, WebhookRetryMaxDelay, delivery.Attempts))
+	}
+	metrics.WebhookAttempts.WithLabelValues(outcome).Inc()
+
+	// the result is saved even if the service is stopping
+	saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), WebhookTimeout)
+	defer cancel()
+	if e := s.shortenerRepo.UpdateWebhookDelivery(saveCtx, delivery); e != nil {
+		if errors.Is(e, repository.ErrNotFound) {
+			// the webhook is deleted with its deliveries
+			return true
+		}
+		// the delivery is sent again, the receivers deduplicate the deliveries by the ID
+		logger.Log.Info("cannot save webhook delivery", zap.Int64("delivery", delivery.ID), zap.String("error", e.Error()))
+		return false
+	}
+	return true
+}
+
+// send sends the signed payload of the delivery to the webhook URL.
+//
+// The address of the webhook is checked by the client when the connection is dialed,
+// because the host can be resolved to the private network after the webhook is created.
+func (p *hookPool) send(ctx context.Context, hook *model.Webhook, delivery *model.WebhookDelivery) (code int, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(shortenerhttpv1.WebhookEventHeader, delivery.Event)
+	req.Header.Set(shortenerhttpv1.WebhookDeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(shortenerhttpv1.WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(shortenerhttpv1.WebhookSignatureHeader,
+		shortenerhttpv1.WebhookSignature(hook.Secret, timestamp, []byte(delivery.Payload)))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// the connection is reused if the body is read
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("the receiver responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,49 @@
+package shortener
+
+import (
+	"context"
+	"sync"
+)
+
+// workerGroup runs the background goroutines of the service until it is stopped.
+type workerGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// run starts n goroutines of the function (the context is canceled when the group is stopped).
+func (g *workerGroup) run(n int, fn func(ctx context.Context)) {
+	if g.cancel == nil {
+		g.ctx, g.cancel = context.WithCancel(context.Background())
+	}
+
+	g.wg.Add(n)
+	for range n {
+		go func() {
+			defer g.wg.Done()
+			fn(g.ctx)
+		}()
+	}
+}
+
+// stop cancels the goroutines and waits for them.
+func (g *workerGroup) stop(ctx context.Context) error {
+	if g.cancel == nil {
+		return nil
+	}
+	g.cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
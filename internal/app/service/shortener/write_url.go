@@ -2,25 +2,43 @@ package shortener
 
 import (
 	"context"
+	"fmt"
+
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/tracing"
 	"github.com/zasuchilas/shortener/internal/app/utils/urlfuncs"
 )
 
-// WriteURL _
-func (s *service) WriteURL(ctx context.Context, rawURL string, userID int64) (readyURL string, conflict bool, err error) {
+// WriteURL shortens the URL on the domain (empty is the default domain, the others must be configured).
+func (s *service) WriteURL(ctx context.Context, rawURL, rawDomain string, userID int64) (readyURL string, conflict bool, err error) {
+	ctx, span := tracing.Start(ctx, "shortener.WriteURL")
+	defer func() { tracing.End(span, err) }()
 
 	// checking request data
 	origURL, err := urlfuncs.CleanURL(rawURL)
 	if err != nil {
-		// TODO: bad request
+		return "", false, fmt.Errorf("%w (%w)", err, model.ErrBadRequest)
+	}
+	domain, err := shortDomain(rawDomain)
+	if err != nil {
 		return "", false, err
 	}
 
 	// performing the endpoint task
-	shortURL, conflict, err := s.shortenerRepo.WriteURL(ctx, origURL, userID)
+	shortURL, conflict, err := s.shortenerRepo.WriteURL(ctx, domain, origURL, userID)
 	if err != nil {
 		return "", false, err
 	}
 	readyURL = urlfuncs.EnrichURL(shortURL)
+	if !conflict {
+		s.emitLinkEvent(model.LinkEvent{
+			Type:     model.EventLinkCreated,
+			UserID:   userID,
+			ShortURL: shortURL,
+			OrigURL:  origURL,
+		})
+		s.queueMetadata(shortURL, origURL)
+	}
 
 	return readyURL, conflict, err
 }
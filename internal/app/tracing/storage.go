@@ -0,0 +1,299 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/zasuchilas/shortener/internal/app/model"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+)
+
+var (
+	_ repository.IStorage     = (*storage)(nil)
+	_ repository.IFileStorage = (*storage)(nil)
+)
+
+// storage starts the span for each call of the wrapped storage.
+type storage struct {
+	repository.IStorage
+}
+
+// NewStorage wraps the storage with the tracing.
+func NewStorage(repo repository.IStorage) repository.IStorage {
+	return &storage{IStorage: repo}
+}
+
+// start starts the span of the storage method.
+func (s *storage) start(ctx context.Context, method string) (context.Context, trace.Span) {
+	return Start(ctx, "storage."+method, attribute.String("storage.instance", s.InstanceName()))
+}
+
+// FilePaths returns the paths of the wrapped storage files (if any).
+func (s *storage) FilePaths() []string {
+	if fs, ok := s.IStorage.(repository.IFileStorage); ok {
+		return fs.FilePaths()
+	}
+	return nil
+}
+
+// WriteURL _
+func (s *storage) WriteURL(ctx context.Context, domain, origURL string, userID int64) (shortURL string, conflict bool, err error) {
+	ctx, span := s.start(ctx, "WriteURL")
+	defer func() { End(span, err) }()
+	return s.IStorage.WriteURL(ctx, domain, origURL, userID)
+}
+
+// ReadURL _
+func (s *storage) ReadURL(ctx context.Context, shortURL string) (row *model.URLRow, err error) {
+	ctx, span := s.start(ctx, "ReadURL")
+	defer func() { End(span, err) }()
+	return s.IStorage.ReadURL(ctx, shortURL)
+}
+
+// URLInfo _
+func (s *storage) URLInfo(ctx context.Context, shortURL string) (row *model.URLRow, err error) {
+	ctx, span := s.start(ctx, "URLInfo")
+	defer func() { End(span, err) }()
+	return s.IStorage.URLInfo(ctx, shortURL)
+}
+
+// Ping _
+func (s *storage) Ping(ctx context.Context) (err error) {
+	ctx, span := s.start(ctx, "Ping")
+	defer func() { End(span, err) }()
+	return s.IStorage.Ping(ctx)
+}
+
+// HealthCheck _
+func (s *storage) HealthCheck(ctx context.Context) (err error) {
+	ctx, span := s.start(ctx, "HealthCheck")
+	defer func() { End(span, err) }()
+	return s.IStorage.HealthCheck(ctx)
+}
+
+// WriteURLs _
+func (s *storage) WriteURLs(ctx context.Context, domain string, origURLs []string, userID int64) (urlRows map[string]*model.URLRow, err error) {
+	ctx, span := s.start(ctx, "WriteURLs")
+	defer func() { End(span, err) }()
+	return s.IStorage.WriteURLs(ctx, domain, origURLs, userID)
+}
+
+// UserURLs _
+func (s *storage) UserURLs(ctx context.Context, userID int64, q model.UserURLsQuery) (urlRowList []*model.URLRow, nextCursor string, err error) {
+	ctx, span := s.start(ctx, "UserURLs")
+	defer func() { End(span, err) }()
+	return s.IStorage.UserURLs(ctx, userID, q)
+}
+
+// CheckDeletedURLs _
+func (s *storage) CheckDeletedURLs(ctx context.Context, userID int64, shortURLs []string) (err error) {
+	ctx, span := s.start(ctx, "CheckDeletedURLs")
+	defer func() { End(span, err) }()
+	return s.IStorage.CheckDeletedURLs(ctx, userID, shortURLs)
+}
+
+// DeleteURLs _
+func (s *storage) DeleteURLs(ctx context.Context, shortURLs ...string) (err error) {
+	ctx, span := s.start(ctx, "DeleteURLs")
+	defer func() { End(span, err) }()
+	return s.IStorage.DeleteURLs(ctx, shortURLs...)
+}
+
+// UpdateURL _
+func (s *storage) UpdateURL(ctx context.Context, userID int64, shortURL, origURL string) (revision *model.URLRevision, err error) {
+	ctx, span := s.start(ctx, "UpdateURL")
+	defer func() { End(span, err) }()
+	return s.IStorage.UpdateURL(ctx, userID, shortURL, origURL)
+}
+
+// URLRevisions _
+func (s *storage) URLRevisions(ctx context.Context, userID int64, shortURL string) (revisions []*model.URLRevision, err error) {
+	ctx, span := s.start(ctx, "URLRevisions")
+	defer func() { End(span, err) }()
+	return s.IStorage.URLRevisions(ctx, userID, shortURL)
+}
+
+// UpdateURLOptions _
+func (s *storage) UpdateURLOptions(ctx context.Context, userID int64, shortURL string, opts model.URLOptions) (row *model.URLRow, err error) {
+	ctx, span := s.start(ctx, "UpdateURLOptions")
+	defer func() { End(span, err) }()
+	return s.IStorage.UpdateURLOptions(ctx, userID, shortURL, opts)
+}
+
+// SetURLMetadata _
+func (s *storage) SetURLMetadata(ctx context.Context, shortURL, origURL string, meta *model.LinkMetadata) (err error) {
+	ctx, span := s.start(ctx, "SetURLMetadata")
+	defer func() { End(span, err) }()
+	return s.IStorage.SetURLMetadata(ctx, shortURL, origURL, meta)
+}
+
+// URLsToCheck _
+func (s *storage) URLsToCheck(ctx context.Context, before time.Time, limit int) (urlRows []*model.URLRow, err error) {
+	ctx, span := s.start(ctx, "URLsToCheck")
+	defer func() { End(span, err) }()
+	return s.IStorage.URLsToCheck(ctx, before, limit)
+}
+
+// SaveURLCheck _
+func (s *storage) SaveURLCheck(ctx context.Context, row *model.URLRow, check *model.LinkCheck) (saved bool, err error) {
+	ctx, span := s.start(ctx, "SaveURLCheck")
+	defer func() { End(span, err) }()
+	return s.IStorage.SaveURLCheck(ctx, row, check)
+}
+
+// WriteDeleteTask _
+func (s *storage) WriteDeleteTask(ctx context.Context, task *model.DeleteTask) (err error) {
+	ctx, span := s.start(ctx, "WriteDeleteTask")
+	defer func() { End(span, err) }()
+	return s.IStorage.WriteDeleteTask(ctx, task)
+}
+
+// PendingDeleteTasks _
+func (s *storage) PendingDeleteTasks(ctx context.Context) (tasks []*model.DeleteTask, err error) {
+	ctx, span := s.start(ctx, "PendingDeleteTasks")
+	defer func() { End(span, err) }()
+	return s.IStorage.PendingDeleteTasks(ctx)
+}
+
+// CompleteDeleteTasks _
+func (s *storage) CompleteDeleteTasks(ctx context.Context, status string, ids ...int64) (err error) {
+	ctx, span := s.start(ctx, "CompleteDeleteTasks")
+	defer func() { End(span, err) }()
+	return s.IStorage.CompleteDeleteTasks(ctx, status, ids...)
+}
+
+// WriteShortenJob _
+func (s *storage) WriteShortenJob(ctx context.Context, job *model.ShortenJob) (err error) {
+	ctx, span := s.start(ctx, "WriteShortenJob")
+	defer func() { End(span, err) }()
+	return s.IStorage.WriteShortenJob(ctx, job)
+}
+
+// ShortenJob _
+func (s *storage) ShortenJob(ctx context.Context, id int64) (job *model.ShortenJob, err error) {
+	ctx, span := s.start(ctx, "ShortenJob")
+	defer func() { End(span, err) }()
+	return s.IStorage.ShortenJob(ctx, id)
+}
+
+// ShortenJobLines _
+func (s *storage) ShortenJobLines(ctx context.Context, id int64, from, limit int) (lines []model.ShortenJobLine, err error) {
+	ctx, span := s.start(ctx, "ShortenJobLines")
+	defer func() { End(span, err) }()
+	return s.IStorage.ShortenJobLines(ctx, id, from, limit)
+}
+
+// UpdateShortenJob _
+func (s *storage) UpdateShortenJob(ctx context.Context, job *model.ShortenJob) (err error) {
+	ctx, span := s.start(ctx, "UpdateShortenJob")
+	defer func() { End(span, err) }()
+	return s.IStorage.UpdateShortenJob(ctx, job)
+}
+
+// PendingShortenJobs _
+func (s *storage) PendingShortenJobs(ctx context.Context) (ids []int64, err error) {
+	ctx, span := s.start(ctx, "PendingShortenJobs")
+	defer func() { End(span, err) }()
+	return s.IStorage.PendingShortenJobs(ctx)
+}
+
+// DeleteShortenJobs _
+func (s *storage) DeleteShortenJobs(ctx context.Context, before time.Time) (deleted int, err error) {
+	ctx, span := s.start(ctx, "DeleteShortenJobs")
+	defer func() { End(span, err) }()
+	return s.IStorage.DeleteShortenJobs(ctx, before)
+}
+
+// WriteWebhook _
+func (s *storage) WriteWebhook(ctx context.Context, hook *model.Webhook) (err error) {
+	ctx, span := s.start(ctx, "WriteWebhook")
+	defer func() { End(span, err) }()
+	return s.IStorage.WriteWebhook(ctx, hook)
+}
+
+// UserWebhooks _
+func (s *storage) UserWebhooks(ctx context.Context, userID int64) (hooks []*model.Webhook, err error) {
+	ctx, span := s.start(ctx, "UserWebhooks")
+	defer func() { End(span, err) }()
+	return s.IStorage.UserWebhooks(ctx, userID)
+}
+
+// DeleteWebhook _
+func (s *storage) DeleteWebhook(ctx context.Context, userID, id int64) (err error) {
+	ctx, span := s.start(ctx, "DeleteWebhook")
+	defer func() { End(span, err) }()
+	return s.IStorage.DeleteWebhook(ctx, userID, id)
+}
+
+// WriteWebhookDeliveries _
+func (s *storage) WriteWebhookDeliveries(ctx context.Context, deliveries []*model.WebhookDelivery) (err error) {
+	ctx, span := s.start(ctx, "WriteWebhookDeliveries")
+	defer func() { End(span, err) }()
+	return s.IStorage.WriteWebhookDeliveries(ctx, deliveries)
+}
+
+// UpdateWebhookDelivery _
+func (s *storage) UpdateWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) (err error) {
+	ctx, span := s.start(ctx, "UpdateWebhookDelivery")
+	defer func() { End(span, err) }()
+	return s.IStorage.UpdateWebhookDelivery(ctx, delivery)
+}
+
+// PendingWebhookDeliveries _
+func (s *storage) PendingWebhookDeliveries(ctx context.Context, before time.Time, limit int) (deliveries []*model.WebhookDelivery, err error) {
+	ctx, span := s.start(ctx, "PendingWebhookDeliveries")
+	defer func() { End(span, err) }()
+	return s.IStorage.PendingWebhookDeliveries(ctx, before, limit)
+}
+
+// WebhookDeliveries _
+func (s *storage) WebhookDeliveries(ctx context.Context, userID, id int64, limit int) (deliveries []*model.WebhookDelivery, err error) {
+	ctx, span := s.start(ctx, "WebhookDeliveries")
+	defer func() { End(span, err) }()
+	return s.IStorage.WebhookDeliveries(ctx, userID, id, limit)
+}
+
+// WriteBusEvents _
+func (s *storage) WriteBusEvents(ctx context.Context, events []*model.BusEvent) (err error) {
+	ctx, span := s.start(ctx, "WriteBusEvents")
+	defer func() { End(span, err) }()
+	return s.IStorage.WriteBusEvents(ctx, events)
+}
+
+// PendingBusEvents _
+func (s *storage) PendingBusEvents(ctx context.Context, limit int) (events []*model.BusEvent, err error) {
+	ctx, span := s.start(ctx, "PendingBusEvents")
+	defer func() { End(span, err) }()
+	return s.IStorage.PendingBusEvents(ctx, limit)
+}
+
+// CompleteBusEvents _
+func (s *storage) CompleteBusEvents(ctx context.Context, ids ...int64) (err error) {
+	ctx, span := s.start(ctx, "CompleteBusEvents")
+	defer func() { End(span, err) }()
+	return s.IStorage.CompleteBusEvents(ctx, ids...)
+}
+
+// LeaseBusRelay _
+func (s *storage) LeaseBusRelay(ctx context.Context, owner string, ttl time.Duration) (leased bool, err error) {
+	ctx, span := s.start(ctx, "LeaseBusRelay")
+	defer func() { End(span, err) }()
+	return s.IStorage.LeaseBusRelay(ctx, owner, ttl)
+}
+
+// Stats _
+func (s *storage) Stats(ctx context.Context) (domains map[string]int, err error) {
+	ctx, span := s.start(ctx, "Stats")
+	defer func() { End(span, err) }()
+	return s.IStorage.Stats(ctx)
+}
+
+// MigrateOrigURLs _
+func (s *storage) MigrateOrigURLs(ctx context.Context, migrate func(origURL string) (string, error)) (res *model.URLMigration, err error) {
+	ctx, span := s.start(ctx, "MigrateOrigURLs")
+	defer func() { End(span, err) }()
+	return s.IStorage.MigrateOrigURLs(ctx, migrate)
+}
@@ -0,0 +1,118 @@
+// Package tracing sets up the distributed tracing (OpenTelemetry) in the service.
+//
+// The trace context is propagated in the W3C Trace Context format (traceparent, tracestate headers).
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+)
+
+// TracerName is the instrumentation name of the service spans.
+const TracerName = "github.com/zasuchilas/shortener"
+
+// Exporters.
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// Initialize initializes the global tracer provider and the W3C propagator.
+//
+// The exporter is selected by config.TracingExporter, if it is empty the spans are not recorded,
+// but the incoming trace context is still propagated.
+// The returned function flushes the remaining spans and releases the exporter.
+func Initialize(ctx context.Context, serviceName, serviceVersion string) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if config.TracingExporter == "" {
+		return func(_ context.Context) error { return nil }, nil
+	}
+
+	exporter, closer, err := newExporter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(serviceName),
+			semconv.ServiceVersion(serviceVersion),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			err = errors.Join(err, closer.Close())
+		}
+		return err
+	}, nil
+}
+
+// newExporter creates the span exporter by config.TracingExporter.
+//
+// The closer is not nil if the exporter owns a file.
+func newExporter(ctx context.Context) (sdktrace.SpanExporter, io.Closer, error) {
+	switch config.TracingExporter {
+	case ExporterOTLP:
+		exporter, err := otlptracehttp.New(ctx,
+			otlptracehttp.WithEndpoint(config.TracingEndpoint),
+			otlptracehttp.WithInsecure(),
+		)
+		return exporter, nil, err
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		return exporter, nil, err
+	case ExporterFile:
+		file, err := os.OpenFile(config.TracingFilePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return nil, nil, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		return exporter, file, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown tracing exporter: %q", config.TracingExporter)
+	}
+}
+
+// Start starts the internal span as a child of the span from ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records the error (if any) and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
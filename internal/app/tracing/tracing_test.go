@@ -0,0 +1,141 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/repository"
+)
+
+// traceparent is the incoming W3C trace context.
+const (
+	traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	traceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+)
+
+// newRecorder sets the global tracer provider recording the spans in memory.
+func newRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	})
+	return recorder
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	recorder := newRecorder(t)
+
+	r := chi.NewRouter()
+	r.Use(HTTPMiddleware)
+	r.Get("/{shortURL}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "handler")
+		span.End()
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	req.Header.Set("traceparent", traceparent)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	handler, server := spans[0], spans[1]
+
+	// the server span continues the incoming trace and is named by the route
+	assert.Equal(t, "GET /{shortURL}", server.Name())
+	assert.Equal(t, traceID, server.SpanContext().TraceID().String())
+	assert.True(t, server.Parent().IsRemote())
+	assert.Equal(t, codes.Error, server.Status().Code)
+
+	// the spans of the handler are the children of the server span
+	assert.Equal(t, server.SpanContext().SpanID(), handler.Parent().SpanID())
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	recorder := newRecorder(t)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", traceparent))
+	info := &grpc.UnaryServerInfo{FullMethod: "/shortener_v1.ShortenerV1/ReadURL"}
+	_, err := UnaryServerInterceptor(ctx, nil, info, func(ctx context.Context, _ any) (any, error) {
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, info.FullMethod, spans[0].Name())
+	assert.Equal(t, traceID, spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+}
+
+func TestNewStorage(t *testing.T) {
+	recorder := newRecorder(t)
+	repo := NewStorage(repository.NewDBMaps())
+
+	_, err := repo.ReadURL(context.TODO(), "19xtf1ts")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "storage.ReadURL", spans[0].Name())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+
+	// the wrapper doesn't pretend to be a file storage
+	fs, ok := repo.(repository.IFileStorage)
+	require.True(t, ok)
+	assert.Empty(t, fs.FilePaths())
+}
+
+func TestInitialize(t *testing.T) {
+	defer func(exporter, path string) {
+		config.TracingExporter, config.TracingFilePath = exporter, path
+	}(config.TracingExporter, config.TracingFilePath)
+
+	t.Run("disabled", func(t *testing.T) {
+		config.TracingExporter = ""
+		shutdown, err := Initialize(context.Background(), "shortener", "test")
+		require.NoError(t, err)
+		assert.NoError(t, shutdown(context.Background()))
+	})
+
+	t.Run("unknown exporter", func(t *testing.T) {
+		config.TracingExporter = "zipkin"
+		_, err := Initialize(context.Background(), "shortener", "test")
+		assert.Error(t, err)
+	})
+
+	t.Run("file exporter", func(t *testing.T) {
+		config.TracingExporter = ExporterFile
+		config.TracingFilePath = filepath.Join(t.TempDir(), "traces.json")
+		shutdown, err := Initialize(context.Background(), "shortener", "test")
+		require.NoError(t, err)
+		t.Cleanup(func() { otel.SetTracerProvider(sdktrace.NewTracerProvider()) })
+
+		_, span := Start(context.Background(), "offline")
+		span.End()
+		require.NoError(t, shutdown(context.Background()))
+
+		data, err := os.ReadFile(config.TracingFilePath)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"Name":"offline"`)
+		assert.Contains(t, string(data), "shortener")
+	})
+}
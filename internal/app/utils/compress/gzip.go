@@ -14,9 +14,13 @@ var _ http.ResponseWriter = (*gzipWriter)(nil)
 
 // gzipWriter is the special structure for use in the middleware.
 // It implements the ResponseWriter interface.
+//
+// The error responses (status 300 and above) are sent as is, without compressing.
 type gzipWriter struct {
-	w  http.ResponseWriter
-	zw *gzip.Writer
+	w           http.ResponseWriter
+	zw          *gzip.Writer
+	wroteHeader bool
+	plain       bool
 }
 
 // NewGzipWriter is the gzipWriter constructor.
@@ -36,19 +40,47 @@ func (g *gzipWriter) Header() http.Header {
 
 // Write implements the ResponseWriter interface method.
 func (g *gzipWriter) Write(p []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.plain {
+		return g.w.Write(p)
+	}
 	return g.zw.Write(p)
 }
 
 // WriteHeader implements the ResponseWriter interface method.
 func (g *gzipWriter) WriteHeader(statusCode int) {
+	g.wroteHeader = true
 	if statusCode < 300 {
 		g.w.Header().Set("Content-Encoding", "gzip")
+	} else {
+		g.plain = true
 	}
 	g.w.WriteHeader(statusCode)
 }
 
+// Flush sends the data compressed so far to the client (see http.Flusher).
+func (g *gzipWriter) Flush() {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if !g.plain {
+		_ = g.zw.Flush()
+	}
+	_ = http.NewResponseController(g.w).Flush()
+}
+
+// Unwrap returns the original http.ResponseWriter (it is used by http.ResponseController).
+func (g *gzipWriter) Unwrap() http.ResponseWriter {
+	return g.w
+}
+
 // Close closes gzip.Writer and sends all data from the buffer
 func (g *gzipWriter) Close() error {
+	if g.plain || !g.wroteHeader {
+		return nil
+	}
 	return g.zw.Close()
 }
 
@@ -0,0 +1,19 @@
+//go:build !windows
+
+// Package diskfuncs helps to check the local disk state.
+package diskfuncs
+
+import (
+	"path/filepath"
+	"syscall"
+)
+
+// FreeSpace returns the number of bytes available to the process
+// on the disk containing the file (the file itself may not exist yet).
+func FreeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(filepath.Dir(path), &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
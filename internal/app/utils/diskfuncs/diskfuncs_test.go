@@ -0,0 +1,20 @@
+//go:build !windows
+
+package diskfuncs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreeSpace(t *testing.T) {
+	free, err := FreeSpace(filepath.Join(t.TempDir(), "storage.db"))
+	require.NoError(t, err)
+	assert.Greater(t, free, uint64(0))
+
+	_, err = FreeSpace("/not/existing/dir/storage.db")
+	assert.Error(t, err)
+}
@@ -0,0 +1,8 @@
+package diskfuncs
+
+import "errors"
+
+// FreeSpace is not implemented for windows.
+func FreeSpace(_ string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -53,3 +53,57 @@ func (c *FileReader) ReadUserRow() (*model.UserRow, error) {
 	}
 	return ur, nil
 }
+
+// ReadDeleteTask reads the deletion task string from the outbox file.
+func (c *FileReader) ReadDeleteTask() (*model.DeleteTask, error) {
+	task := &model.DeleteTask{}
+	if err := c.decoder.Decode(task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// ReadURLRevision reads the link revision string from the revisions journal file.
+func (c *FileReader) ReadURLRevision() (*model.URLRevision, error) {
+	revision := &model.URLRevision{}
+	if err := c.decoder.Decode(revision); err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+// ReadShortenJob reads the shortening job string from the jobs journal file.
+func (c *FileReader) ReadShortenJob() (*model.ShortenJob, error) {
+	job := &model.ShortenJob{}
+	if err := c.decoder.Decode(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// ReadWebhook reads the webhook string from the webhooks journal file.
+func (c *FileReader) ReadWebhook() (*model.Webhook, error) {
+	hook := &model.Webhook{}
+	if err := c.decoder.Decode(hook); err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+// ReadWebhookDelivery reads the webhook delivery string from the deliveries journal file.
+func (c *FileReader) ReadWebhookDelivery() (*model.WebhookDelivery, error) {
+	delivery := &model.WebhookDelivery{}
+	if err := c.decoder.Decode(delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// ReadBusEvent reads the link event string from the event bus outbox journal file.
+func (c *FileReader) ReadBusEvent() (*model.BusEvent, error) {
+	event := &model.BusEvent{}
+	if err := c.decoder.Decode(event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
@@ -40,6 +40,36 @@ func (p *FileWriter) WriteUserRow(user *model.UserRow) error {
 	return p.encoder.Encode(user)
 }
 
+// WriteDeleteTask writes the deletion task string in the outbox file.
+func (p *FileWriter) WriteDeleteTask(task *model.DeleteTask) error {
+	return p.encoder.Encode(task)
+}
+
+// WriteURLRevision writes the link revision string in the revisions journal file.
+func (p *FileWriter) WriteURLRevision(revision *model.URLRevision) error {
+	return p.encoder.Encode(revision)
+}
+
+// WriteShortenJob writes the shortening job string in the jobs journal file.
+func (p *FileWriter) WriteShortenJob(job *model.ShortenJob) error {
+	return p.encoder.Encode(job)
+}
+
+// WriteWebhook writes the webhook string in the webhooks journal file.
+func (p *FileWriter) WriteWebhook(hook *model.Webhook) error {
+	return p.encoder.Encode(hook)
+}
+
+// WriteWebhookDelivery writes the webhook delivery string in the deliveries journal file.
+func (p *FileWriter) WriteWebhookDelivery(delivery *model.WebhookDelivery) error {
+	return p.encoder.Encode(delivery)
+}
+
+// WriteBusEvent writes the link event string in the event bus outbox journal file.
+func (p *FileWriter) WriteBusEvent(event *model.BusEvent) error {
+	return p.encoder.Encode(event)
+}
+
 func newFileWriter(filename string, flag int, perm os.FileMode) (*FileWriter, error) {
 	logger.Log.Debug("opening file storage as file writer")
 	file, err := os.OpenFile(filename, flag, perm)
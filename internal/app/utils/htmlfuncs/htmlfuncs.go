@@ -0,0 +1,161 @@
+// Package htmlfuncs helps to read the metadata of the HTML pages.
+package htmlfuncs
+
+import (
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+
+	"github.com/zasuchilas/shortener/internal/app/model"
+)
+
+// The lengths of the metadata, the longer texts are cut.
+const (
+	MaxTitleLength       = 300
+	MaxDescriptionLength = 1000
+	MaxFaviconLength     = 2048
+)
+
+// PageMetadata reads the title, the description and the favicon of the HTML page.
+//
+// Only the head of the page is read, the parsing stops at the body. The Open Graph title and description are used
+// if the page has no own ones. The favicon is resolved against the page URL (or the base of the page),
+// /favicon.ico is used if the page has no icon link. The page is expected in UTF-8, the invalid bytes are dropped.
+func PageMetadata(r io.Reader, pageURL *url.URL) model.LinkMetadata {
+	var (
+		p       pageHead
+		inTitle bool
+		z       = html.NewTokenizer(r)
+	)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		tok := z.Token()
+		if tt == html.TextToken {
+			if inTitle {
+				p.title += tok.Data
+			}
+			continue
+		}
+		if tt == html.EndTagToken {
+			if tok.Data == "title" {
+				inTitle = false
+			}
+			continue
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		if tok.Data == "body" {
+			break
+		}
+		p.read(tok)
+		inTitle = tok.Data == "title" && tt == html.StartTagToken && !p.titleDone
+		if inTitle {
+			p.titleDone = true
+		}
+	}
+
+	base := pageURL
+	if p.base != "" {
+		if u, err := pageURL.Parse(p.base); err == nil {
+			base = u
+		}
+	}
+	return model.LinkMetadata{
+		Title:       clip(firstText(p.title, p.ogTitle), MaxTitleLength),
+		Description: clip(firstText(p.description, p.ogDescription), MaxDescriptionLength),
+		Favicon:     favicon(base, firstText(p.icon, p.touchIcon)),
+	}
+}
+
+// pageHead is the metadata found in the head of the page.
+type pageHead struct {
+	title, ogTitle             string
+	titleDone                  bool // only the first title is read
+	description, ogDescription string
+	icon, touchIcon            string
+	base                       string
+}
+
+// read reads the metadata of the tag (the first tag of every kind wins).
+func (p *pageHead) read(tok html.Token) {
+	attr := func(name string) string {
+		for _, a := range tok.Attr {
+			if a.Key == name {
+				return strings.TrimSpace(a.Val)
+			}
+		}
+		return ""
+	}
+	setOnce := func(dst *string, val string) {
+		if *dst == "" {
+			*dst = val
+		}
+	}
+
+	switch tok.Data {
+	case "meta":
+		content := attr("content")
+		switch {
+		case strings.EqualFold(attr("name"), "description"):
+			setOnce(&p.description, content)
+		case strings.EqualFold(attr("property"), "og:description"):
+			setOnce(&p.ogDescription, content)
+		case strings.EqualFold(attr("property"), "og:title"):
+			setOnce(&p.ogTitle, content)
+		}
+	case "link":
+		for _, rel := range strings.Fields(strings.ToLower(attr("rel"))) {
+			switch rel {
+			case "icon":
+				setOnce(&p.icon, attr("href"))
+			case "apple-touch-icon":
+				setOnce(&p.touchIcon, attr("href"))
+			}
+		}
+	case "base":
+		setOnce(&p.base, attr("href"))
+	}
+}
+
+// favicon returns the absolute http(s) URL of the icon (empty if the reference is wrong).
+func favicon(base *url.URL, href string) string {
+	if href == "" {
+		href = "/favicon.ico"
+	}
+	u, err := base.Parse(href)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	res := u.String()
+	if len(res) > MaxFaviconLength {
+		return ""
+	}
+	return res
+}
+
+// firstText returns the first of the texts that is not empty.
+func firstText(texts ...string) string {
+	for _, text := range texts {
+		if strings.TrimSpace(text) != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// clip collapses the spaces of the text and cuts it to the limit of runes.
+func clip(text string, limit int) string {
+	text = strings.Join(strings.Fields(strings.ToValidUTF8(text, "")), " ")
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:limit]))
+}
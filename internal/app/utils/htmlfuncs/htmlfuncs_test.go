@@ -0,0 +1,84 @@
+package htmlfuncs
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPageMetadata(t *testing.T) {
+	pageURL, err := url.Parse("https://example.com/blog/post.html")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		page        string
+		title       string
+		description string
+		favicon     string
+	}{
+		{
+			name: "full head",
+			page: `<!DOCTYPE html><html><head>
+				<title>  The   post &amp; news </title>
+				<meta name="Description" content="About the post">
+				<meta property="og:description" content="Open Graph">
+				<link rel="shortcut icon" href="../img/icon.png">
+				</head><body><title>Not a title</title></body></html>`,
+			title:       "The post & news",
+			description: "About the post",
+			favicon:     "https://example.com/img/icon.png",
+		},
+		{
+			name: "open graph",
+			page: `<html><head>
+				<meta property="og:title" content="OG title">
+				<meta property="og:description" content="OG description">
+				<link rel="apple-touch-icon" href="//cdn.example.com/touch.png">
+				</head></html>`,
+			title:       "OG title",
+			description: "OG description",
+			favicon:     "https://cdn.example.com/touch.png",
+		},
+		{
+			name:    "base and default favicon",
+			page:    `<html><head><base href="https://static.example.org/app/"><title>Page</title></head>`,
+			title:   "Page",
+			favicon: "https://static.example.org/favicon.ico",
+		},
+		{
+			name:    "data favicon is skipped",
+			page:    `<link rel="icon" href="data:image/png;base64,AAAA"><body><meta name="description" content="late">`,
+			favicon: "",
+		},
+		{
+			name:    "not html",
+			page:    "just a text",
+			favicon: "https://example.com/favicon.ico",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta := PageMetadata(strings.NewReader(tt.page), pageURL)
+			assert.Equal(t, tt.title, meta.Title)
+			assert.Equal(t, tt.description, meta.Description)
+			assert.Equal(t, tt.favicon, meta.Favicon)
+		})
+	}
+}
+
+func TestPageMetadata_limits(t *testing.T) {
+	pageURL, err := url.Parse("https://example.com/")
+	require.NoError(t, err)
+
+	page := "<title>" + strings.Repeat("я", MaxTitleLength+10) + "</title>" +
+		`<meta name="description" content="` + strings.Repeat("a ", MaxDescriptionLength) + `">` +
+		`<link rel="icon" href="/` + strings.Repeat("i", MaxFaviconLength) + `">`
+	meta := PageMetadata(strings.NewReader(page), pageURL)
+	assert.Equal(t, strings.Repeat("я", MaxTitleLength), meta.Title)
+	assert.LessOrEqual(t, len(meta.Description), MaxDescriptionLength)
+	assert.Empty(t, meta.Favicon)
+}
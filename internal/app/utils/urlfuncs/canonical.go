@@ -0,0 +1,227 @@
+package urlfuncs
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+)
+
+// Canonicalization options (config.URLCanonicalization is a comma-separated list of them).
+const (
+	CanonicalNone          = "none"           // the URLs are stored as they are received
+	CanonicalBasic         = "basic"          // scheme, host, port, path and percent-encoding normalization
+	CanonicalSortQuery     = "sort_query"     // basic + sorting the query parameters by name
+	CanonicalStripTracking = "strip_tracking" // basic + removing the utm_* query parameters
+)
+
+// trackingParamPrefix is the prefix of the tracking query parameters.
+const trackingParamPrefix = "utm_"
+
+// defaultPorts are removed from the host.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// canonicalOptions are the parsed config.URLCanonicalization options.
+type canonicalOptions struct {
+	basic         bool
+	sortQuery     bool
+	stripTracking bool
+}
+
+// canonical are the options of config.URLCanonicalization, they are parsed once by CheckCanonicalization at the start.
+var canonical canonicalOptions
+
+// CheckCanonicalization checks config.URLCanonicalization and keeps the parsed options for CanonicalURL.
+func CheckCanonicalization() error {
+	opts, err := parseCanonicalOptions(config.URLCanonicalization)
+	if err != nil {
+		return err
+	}
+	canonical = opts
+	return nil
+}
+
+// parseCanonicalOptions parses the comma-separated options (empty means none).
+func parseCanonicalOptions(spec string) (opts canonicalOptions, err error) {
+	for _, o := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(o) {
+		case "", CanonicalNone:
+		case CanonicalBasic:
+			opts.basic = true
+		case CanonicalSortQuery:
+			opts.basic, opts.sortQuery = true, true
+		case CanonicalStripTracking:
+			opts.basic, opts.stripTracking = true, true
+		default:
+			return opts, fmt.Errorf("unknown URL canonicalization option %q", o)
+		}
+	}
+	return opts, nil
+}
+
+// CanonicalURL returns the canonical form of the URL by config.URLCanonicalization (see CheckCanonicalization),
+// so the same destination written differently gets the same short URL.
+//
+// The URL without a scheme stays without a scheme.
+func CanonicalURL(raw string) (string, error) {
+	opts := canonical
+	if !opts.basic {
+		return raw, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	schemeless := u.Scheme == ""
+	if schemeless {
+		if u, err = url.Parse("http://" + raw); err != nil {
+			return "", err
+		}
+	}
+
+	if err = canonicalize(u, opts); err != nil {
+		return "", err
+	}
+
+	res := u.String()
+	if schemeless {
+		res = strings.TrimPrefix(res, "http://")
+	}
+	return res, nil
+}
+
+// canonicalize normalizes the parsed URL in place.
+func canonicalize(u *url.URL, opts canonicalOptions) error {
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	// host: lowercase, punycode, without the default port and the trailing dot
+	if u.Host != "" {
+		host, port := u.Hostname(), u.Port()
+		host = strings.TrimSuffix(strings.ToLower(host), ".")
+		if net.ParseIP(host) == nil {
+			ascii, err := idna.Lookup.ToASCII(host)
+			if err != nil {
+				return fmt.Errorf("wrong URL host %q: %w", host, err)
+			}
+			host = ascii
+		}
+		if port == defaultPorts[u.Scheme] {
+			port = ""
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if port != "" {
+			host += ":" + port
+		}
+		u.Host = host
+	}
+
+	// path: the percent-encoding is normalized, the empty path of the hierarchical URL is /
+	path := normalizePercentEncoding(u.EscapedPath())
+	if path == "" && u.Host != "" && u.Opaque == "" {
+		path = "/"
+	}
+	unescaped, err := url.PathUnescape(path)
+	if err != nil {
+		return err
+	}
+	u.Path, u.RawPath = unescaped, path
+
+	// query
+	if u.RawQuery != "" {
+		u.RawQuery = canonicalQuery(u.RawQuery, opts)
+		u.ForceQuery = false
+	}
+
+	return nil
+}
+
+// canonicalQuery normalizes the raw query, the parameters are kept encoded as they are,
+// so the values like a+b or a%2Bb keep their meaning.
+func canonicalQuery(rawQuery string, opts canonicalOptions) string {
+	params := strings.Split(rawQuery, "&")
+	kept := params[:0]
+	for _, p := range params {
+		if p == "" {
+			continue
+		}
+		p = normalizePercentEncoding(p)
+		if opts.stripTracking && strings.HasPrefix(strings.ToLower(queryParamName(p)), trackingParamPrefix) {
+			continue
+		}
+		kept = append(kept, p)
+	}
+
+	if opts.sortQuery {
+		sort.SliceStable(kept, func(i, j int) bool {
+			return queryParamName(kept[i]) < queryParamName(kept[j])
+		})
+	}
+
+	return strings.Join(kept, "&")
+}
+
+// queryParamName returns the unescaped name of the query parameter.
+func queryParamName(param string) string {
+	name, _, _ := strings.Cut(param, "=")
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
+
+// normalizePercentEncoding decodes the percent-encoded unreserved characters (RFC 3986, 6.2.2.2)
+// and uppercases the hex digits of the other escapes.
+func normalizePercentEncoding(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			c := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(c) {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('%')
+				b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+			}
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,125 @@
+package urlfuncs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+)
+
+func setCanonicalization(t *testing.T, spec string) {
+	config.URLCanonicalization = spec
+	require.NoError(t, CheckCanonicalization())
+	t.Cleanup(func() {
+		config.URLCanonicalization = ""
+		_ = CheckCanonicalization()
+	})
+}
+
+func TestCanonicalURL(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		options string
+		raw     string
+		want    string
+	}{
+		{
+			name:    "disabled",
+			options: "",
+			raw:     "HTTP://Example.com:80/a?b=1&a=2",
+			want:    "HTTP://Example.com:80/a?b=1&a=2",
+		},
+		{
+			name:    "scheme, host and default port",
+			options: CanonicalBasic,
+			raw:     "HTTP://Example.COM:80/a?b=1&a=2",
+			want:    "http://example.com/a?b=1&a=2",
+		},
+		{
+			name:    "https default port",
+			options: CanonicalBasic,
+			raw:     "https://example.com:443",
+			want:    "https://example.com/",
+		},
+		{
+			name:    "custom port",
+			options: CanonicalBasic,
+			raw:     "https://example.com:8443/",
+			want:    "https://example.com:8443/",
+		},
+		{
+			name:    "punycode",
+			options: CanonicalBasic,
+			raw:     "http://Спорт.рф/",
+			want:    "http://xn--n1abebi.xn--p1ai/",
+		},
+		{
+			name:    "percent-encoding",
+			options: CanonicalBasic,
+			raw:     "http://example.com/%7euser/%2fa%2Fb?q=%61%2b",
+			want:    "http://example.com/~user/%2Fa%2Fb?q=a%2B",
+		},
+		{
+			name:    "unicode path",
+			options: CanonicalBasic,
+			raw:     "http://example.com/引き",
+			want:    "http://example.com/%E5%BC%95%E3%81%8D",
+		},
+		{
+			name:    "without scheme",
+			options: CanonicalBasic,
+			raw:     "YA.ru/Path",
+			want:    "ya.ru/Path",
+		},
+		{
+			name:    "sorting query",
+			options: CanonicalSortQuery,
+			raw:     "http://example.com/a?b=1&a=2&a=1",
+			want:    "http://example.com/a?a=2&a=1&b=1",
+		},
+		{
+			name:    "stripping tracking",
+			options: CanonicalStripTracking,
+			raw:     "http://example.com/a?utm_source=x&id=1&UTM_Medium=y",
+			want:    "http://example.com/a?id=1",
+		},
+		{
+			name:    "stripping all the query",
+			options: "sort_query, strip_tracking",
+			raw:     "http://example.com/a?utm_source=x",
+			want:    "http://example.com/a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setCanonicalization(t, tt.options)
+			got, err := CanonicalURL(tt.raw)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCanonicalURL_deduplication(t *testing.T) {
+	setCanonicalization(t, CanonicalSortQuery)
+
+	a, err := CanonicalURL("HTTP://Example.com:80/a?b=1&a=2")
+	require.NoError(t, err)
+	b, err := CanonicalURL("http://example.com/a?a=2&b=1")
+	require.NoError(t, err)
+	assert.Equal(t, a, b)
+}
+
+func TestCheckCanonicalization(t *testing.T) {
+	setCanonicalization(t, "basic, strip_tracking")
+
+	// the wrong options are rejected at the start, the previous ones are kept
+	config.URLCanonicalization = "lowercase_path"
+	assert.Error(t, CheckCanonicalization())
+	got, err := CanonicalURL("HTTP://Example.com/a?utm_source=x")
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/a", got)
+}
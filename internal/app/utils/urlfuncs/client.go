@@ -0,0 +1,88 @@
+package urlfuncs
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+)
+
+// SafeClientMaxRedirects is the number of the redirects the safe client follows.
+const SafeClientMaxRedirects = 5
+
+// NewSafeClient returns the HTTP client of the requests the service sends to the link destinations.
+//
+// Every request and redirect must be http or https and its domain must not be blocked.
+// The private networks are checked when the connection is dialed, after the host is resolved,
+// so the host can't be resolved to another address between the check and the request.
+func NewSafeClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: checkDialAddress}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &safeTransport{base: &http.Transport{
+			// the proxy would dial the private networks instead of the client
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConnsPerHost:   2,
+			IdleConnTimeout:       time.Minute,
+		}},
+		CheckRedirect: func(_ *http.Request, via []*http.Request) error {
+			if len(via) >= SafeClientMaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", len(via))
+			}
+			return nil
+		},
+	}
+}
+
+// NewWebhookClient returns the safe client (see NewSafeClient) of the requests to the webhooks of the users.
+//
+// The redirects are not followed, the redirect is the response of the webhook.
+func NewWebhookClient(timeout time.Duration) *http.Client {
+	client := NewSafeClient(timeout)
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return client
+}
+
+// safeTransport checks the URL of every request before it is sent (the redirects too).
+type safeTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip _
+func (t *safeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if scheme := strings.ToLower(req.URL.Scheme); scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("%w: %q", ErrScheme, req.URL.Scheme)
+	}
+	host := req.URL.Hostname()
+	if host == "" {
+		return nil, ErrEmptyHost
+	}
+	if domainBlocklist.contains(host) {
+		return nil, fmt.Errorf("%w: %s", ErrBlockedDomain, host)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// checkDialAddress checks the resolved address of the connection.
+func checkDialAddress(_, address string, _ syscall.RawConn) error {
+	if config.AllowPrivateNetworks {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateHost, host)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package urlfuncs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+)
+
+func TestNewSafeClient(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/blocked", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://evil.example/", http.StatusFound)
+	})
+	mux.HandleFunc("/ftp", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "ftp://ya.ru/file", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	client := NewSafeClient(time.Second)
+
+	// the test server is in the private network
+	_, err := client.Get(ts.URL + "/ok")
+	assert.ErrorIs(t, err, ErrPrivateHost)
+	_, err = client.Get("http://localhost:1/ok")
+	assert.ErrorIs(t, err, ErrPrivateHost)
+
+	config.AllowPrivateNetworks = true
+	t.Cleanup(func() { config.AllowPrivateNetworks = false })
+
+	resp, err := client.Get(ts.URL + "/ok")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// the redirects are checked like the requests
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("evil.example\n"), 0600))
+	config.DomainBlocklistPath = path
+	defer func() { config.DomainBlocklistPath = "" }()
+
+	_, err = client.Get(ts.URL + "/blocked")
+	assert.ErrorIs(t, err, ErrBlockedDomain)
+	_, err = client.Get(ts.URL + "/ftp")
+	assert.ErrorIs(t, err, ErrScheme)
+	_, err = client.Get(ts.URL + "/loop")
+	assert.ErrorContains(t, err, "redirects")
+}
+
+func TestNewWebhookClient(t *testing.T) {
+	ts := httptest.NewServer(http.RedirectHandler("http://127.0.0.1:1/", http.StatusFound))
+	defer ts.Close()
+
+	client := NewWebhookClient(time.Second)
+
+	// the address is checked when the connection is dialed
+	_, err := client.Post(ts.URL, "application/json", nil)
+	assert.ErrorIs(t, err, ErrPrivateHost)
+
+	config.AllowPrivateNetworks = true
+	t.Cleanup(func() { config.AllowPrivateNetworks = false })
+
+	// the redirect is the response of the webhook
+	resp, err := client.Post(ts.URL, "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+}
@@ -0,0 +1,167 @@
+package urlfuncs
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/model"
+)
+
+// ErrUnknownDomain is returned if the domain of the short link is not configured.
+var ErrUnknownDomain = errors.New("the domain of the short links is not configured")
+
+// shortDomain is the additional domain of the short links (config.ShortDomains).
+type shortDomain struct {
+	host   string // host[:port] in lower case, the domain of the links in the storage
+	scheme string // empty means the scheme of config.BaseURL
+}
+
+// shortDomains are the domains of config.ShortDomains, they are parsed once by CheckShortDomains at the start.
+var shortDomains []shortDomain
+
+// CheckShortDomains checks config.ShortDomains and keeps the parsed domains.
+func CheckShortDomains() error {
+	domains, err := parseShortDomains(config.ShortDomains)
+	if err != nil {
+		return err
+	}
+	shortDomains = domains
+	return nil
+}
+
+// parseShortDomains parses the comma-separated list of the domains (host[:port] or scheme://host[:port]).
+func parseShortDomains(list string) ([]shortDomain, error) {
+	var res []shortDomain
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		var d shortDomain
+		if scheme, rest, found := strings.Cut(item, "://"); found {
+			d.scheme = strings.ToLower(scheme)
+			item = strings.TrimSuffix(rest, "/")
+		}
+		if d.scheme != "" && d.scheme != "http" && d.scheme != "https" {
+			return nil, fmt.Errorf("wrong short domain %q: %w", item, ErrScheme)
+		}
+		u, err := url.Parse("http://" + item)
+		if err != nil || u.Hostname() == "" || u.Path != "" || u.RawQuery != "" || u.User != nil {
+			return nil, fmt.Errorf("wrong short domain %q (expected host[:port] or scheme://host[:port])", item)
+		}
+		d.host = strings.ToLower(u.Host)
+		if d.host == defaultDomainHost() {
+			return nil, fmt.Errorf("the short domain %q is the domain of the base URL", item)
+		}
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+// findShortDomain returns the configured domain by the host[:port], the host without the port matches
+// the domain with any port.
+func findShortDomain(host string) (shortDomain, bool) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, d := range shortDomains {
+		if d.host == host {
+			return d, true
+		}
+	}
+	hostname := stripPort(host)
+	for _, d := range shortDomains {
+		if stripPort(d.host) == hostname {
+			return d, true
+		}
+	}
+	return shortDomain{}, false
+}
+
+// defaultDomainHost returns the host[:port] of config.BaseURL in lower case.
+func defaultDomainHost() string {
+	base := config.BaseURL
+	if _, rest, found := strings.Cut(base, "://"); found {
+		base = rest
+	}
+	host, _, _ := strings.Cut(base, "/")
+	return strings.ToLower(host)
+}
+
+// stripPort returns the host without the port.
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// ShortDomain returns the domain of the new short links by its name: the empty name and the host of config.BaseURL
+// are the default domain (empty), the other names must be in config.ShortDomains (ErrUnknownDomain).
+func ShortDomain(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if _, rest, found := strings.Cut(name, "://"); found {
+		name = strings.TrimSuffix(rest, "/")
+	}
+	name = strings.ToLower(name)
+	if name == "" || name == defaultDomainHost() {
+		return "", nil
+	}
+
+	d, ok := findShortDomain(name)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownDomain, name)
+	}
+	return d.host, nil
+}
+
+// HostDomain returns the domain of the request host, the unknown hosts are the default domain.
+func HostDomain(host string) string {
+	if d, ok := findShortDomain(host); ok {
+		return d.host
+	}
+	return ""
+}
+
+// DomainHost returns the host of the domain for the clients (the host of config.BaseURL for the default domain).
+func DomainHost(domain string) string {
+	if domain == "" {
+		return defaultDomainHost()
+	}
+	return domain
+}
+
+// domainBaseURL returns scheme://host of the domain, the scheme is the scheme of the domain, of config.BaseURL or http.
+func domainBaseURL(domain string) string {
+	scheme := "http"
+	if d, ok := findShortDomain(domain); ok && d.scheme != "" {
+		scheme = d.scheme
+	} else if s, _, found := strings.Cut(config.BaseURL, "://"); found {
+		scheme = s
+	}
+	return scheme + "://" + domain
+}
+
+// ShortURLKey returns the link key (see model.LinkKey) of the short URL passed by the client:
+// the short code of the default domain, domain/code or the ready short URL (scheme://domain/code).
+//
+// The error wraps ErrUnknownDomain if the domain is not configured.
+func ShortURLKey(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if _, rest, found := strings.Cut(raw, "://"); found {
+		raw = rest
+	}
+	name, code, found := strings.Cut(raw, "/")
+	if !found {
+		return raw, nil
+	}
+
+	domain, err := ShortDomain(name)
+	if err != nil {
+		return "", err
+	}
+	return model.LinkKey(domain, code), nil
+}
@@ -0,0 +1,85 @@
+package urlfuncs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+)
+
+func setShortDomains(t *testing.T, baseURL, domains string) {
+	config.BaseURL, config.ShortDomains = baseURL, domains
+	_ = CheckShortDomains()
+	t.Cleanup(func() {
+		config.BaseURL, config.ShortDomains = "", ""
+		_ = CheckShortDomains()
+	})
+}
+
+func TestCheckShortDomains(t *testing.T) {
+	tests := []struct {
+		domains string
+		wantErr bool
+	}{
+		{domains: ""},
+		{domains: "go.example.com, https://links.example.org:8443/"},
+		{domains: "ftp://go.example.com", wantErr: true},
+		{domains: "go.example.com/path", wantErr: true},
+		{domains: "localhost:8080", wantErr: true}, // the domain of the base URL
+	}
+	for _, tt := range tests {
+		setShortDomains(t, "http://localhost:8080", tt.domains)
+		err := CheckShortDomains()
+		assert.Equal(t, tt.wantErr, err != nil, "%s: %v", tt.domains, err)
+	}
+}
+
+func TestShortDomain(t *testing.T) {
+	setShortDomains(t, "http://localhost:8080", "go.example.com,https://links.example.org:8443")
+
+	for name, expected := range map[string]string{
+		"":                               "",
+		"localhost:8080":                 "",
+		"http://LOCALHOST:8080":          "",
+		"Go.Example.com":                 "go.example.com",
+		"https://links.example.org:8443": "links.example.org:8443",
+		"links.example.org":              "links.example.org:8443",
+	} {
+		domain, err := ShortDomain(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, expected, domain, name)
+	}
+	_, err := ShortDomain("evil.example.com")
+	assert.ErrorIs(t, err, ErrUnknownDomain)
+
+	// the unknown request hosts are the default domain
+	assert.Equal(t, "go.example.com", HostDomain("go.example.com:80"))
+	assert.Equal(t, "", HostDomain("localhost:8080"))
+	assert.Equal(t, "", HostDomain("evil.example.com"))
+	assert.Equal(t, "localhost:8080", DomainHost(""))
+}
+
+func TestShortURLKey(t *testing.T) {
+	setShortDomains(t, "http://localhost:8080", "go.example.com,https://links.example.org:8443")
+
+	for raw, expected := range map[string]string{
+		"19xtf1ts":                                "19xtf1ts",
+		"http://localhost:8080/19xtf1ts":          "19xtf1ts",
+		"go.example.com/19xtf1ts":                 "go.example.com/19xtf1ts",
+		"https://links.example.org:8443/19xtf1ts": "links.example.org:8443/19xtf1ts",
+		" http://go.example.com/19xtf1ts ":        "go.example.com/19xtf1ts",
+	} {
+		key, err := ShortURLKey(raw)
+		require.NoError(t, err, raw)
+		assert.Equal(t, expected, key, raw)
+	}
+	_, err := ShortURLKey("https://evil.example.com/19xtf1ts")
+	assert.ErrorIs(t, err, ErrUnknownDomain)
+
+	// the ready short URLs of the domains
+	assert.Equal(t, "http://go.example.com/19xtf1ts", EnrichURL("go.example.com/19xtf1ts"))
+	assert.Equal(t, "https://links.example.org:8443/19xtf1ts", EnrichURL("links.example.org:8443/19xtf1ts"))
+	assert.Equal(t, "http://localhost:8080/19xtf1ts", EnrichURL("19xtf1ts"))
+}
@@ -0,0 +1,120 @@
+package urlfuncs
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrPassThroughPath is returned if the forwarded path can't be added to the destination.
+var ErrPassThroughPath = errors.New("the forwarded path is not allowed")
+
+// JoinPath adds the escaped path (/extra/path) to the destination path.
+//
+// The path with the dot segments (/../admin) is not allowed, so the visitor can't leave the stored path.
+// The destination without a scheme stays without a scheme.
+func JoinPath(dest, path string) (string, error) {
+	if path == "" {
+		return dest, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("%w: %q does not start with /", ErrPassThroughPath, path)
+	}
+	unescaped, err := url.PathUnescape(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrPassThroughPath, err)
+	}
+	for _, segment := range strings.Split(unescaped, "/") {
+		if segment == "." || segment == ".." {
+			return "", fmt.Errorf("%w: %q contains dot segments", ErrPassThroughPath, path)
+		}
+	}
+
+	u, schemeless, err := parseDestination(dest)
+	if err != nil {
+		return "", err
+	}
+	escaped := strings.TrimSuffix(u.EscapedPath(), "/") + path
+	if u.Path, err = url.PathUnescape(escaped); err != nil {
+		return "", err
+	}
+	u.RawPath = escaped
+
+	return formatDestination(u, schemeless), nil
+}
+
+// MergeQuery merges the raw query of the visitor request into the destination query.
+//
+// If incomingWins is set, the incoming parameters replace the stored ones with the same name,
+// otherwise only the incoming parameters with the other names are added.
+// The parameters are kept encoded as they are.
+func MergeQuery(dest, rawQuery string, incomingWins bool) (string, error) {
+	incoming := splitQuery(rawQuery)
+	if len(incoming) == 0 {
+		return dest, nil
+	}
+
+	u, schemeless, err := parseDestination(dest)
+	if err != nil {
+		return "", err
+	}
+	stored := splitQuery(u.RawQuery)
+
+	loser, winner := incoming, stored
+	if incomingWins {
+		loser, winner = stored, incoming
+	}
+	names := make(map[string]struct{}, len(winner))
+	for _, p := range winner {
+		names[queryParamName(p)] = struct{}{}
+	}
+	merged := make([]string, 0, len(stored)+len(incoming))
+	for _, p := range loser {
+		if _, ok := names[queryParamName(p)]; !ok {
+			merged = append(merged, p)
+		}
+	}
+	if incomingWins {
+		merged = append(merged, winner...)
+	} else {
+		// the stored parameters go first
+		merged = append(winner, merged...)
+	}
+
+	u.RawQuery = strings.Join(merged, "&")
+	u.ForceQuery = false
+	return formatDestination(u, schemeless), nil
+}
+
+// splitQuery returns the non-empty parameters of the raw query.
+func splitQuery(rawQuery string) []string {
+	res := make([]string, 0)
+	for _, p := range strings.Split(rawQuery, "&") {
+		if p != "" {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// parseDestination parses the destination URL (the URL without a scheme is parsed as http).
+func parseDestination(dest string) (u *url.URL, schemeless bool, err error) {
+	if u, err = url.Parse(dest); err != nil {
+		return nil, false, err
+	}
+	if u.Scheme != "" {
+		return u, false, nil
+	}
+	u, err = url.Parse("http://" + dest)
+	return u, true, err
+}
+
+// formatDestination formats the URL parsed by parseDestination.
+func formatDestination(u *url.URL, schemeless bool) string {
+	res := u.String()
+	if schemeless {
+		res = strings.TrimPrefix(res, "http://")
+	}
+	return res
+}
@@ -0,0 +1,54 @@
+package urlfuncs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinPath(t *testing.T) {
+	tests := []struct {
+		dest, path string
+		want       string
+		wantErr    bool
+	}{
+		{dest: "https://ya.ru/docs", path: "", want: "https://ya.ru/docs"},
+		{dest: "https://ya.ru/docs", path: "/a/b", want: "https://ya.ru/docs/a/b"},
+		{dest: "https://ya.ru/docs/", path: "/a", want: "https://ya.ru/docs/a"},
+		{dest: "https://ya.ru", path: "/a", want: "https://ya.ru/a"},
+		{dest: "https://ya.ru/docs?x=1#top", path: "/a%2Fb", want: "https://ya.ru/docs/a%2Fb?x=1#top"},
+		{dest: "ya.ru/docs", path: "/a", want: "ya.ru/docs/a"},
+		{dest: "https://ya.ru/docs", path: "/../admin", wantErr: true},
+		{dest: "https://ya.ru/docs", path: "/a/%2e%2e/admin", wantErr: true},
+		{dest: "https://ya.ru/docs", path: "a", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := JoinPath(tt.dest, tt.path)
+		if tt.wantErr {
+			assert.ErrorIs(t, err, ErrPassThroughPath, tt.path)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, got)
+	}
+}
+
+func TestMergeQuery(t *testing.T) {
+	tests := []struct {
+		dest, query  string
+		incomingWins bool
+		want         string
+	}{
+		{dest: "https://ya.ru/?a=1", query: "", want: "https://ya.ru/?a=1"},
+		{dest: "https://ya.ru/", query: "a=1&&b=2", want: "https://ya.ru/?a=1&b=2"},
+		{dest: "https://ya.ru/?a=1&b=2", query: "b=3&c=4", want: "https://ya.ru/?a=1&b=2&c=4"},
+		{dest: "https://ya.ru/?a=1&b=2&b=5", query: "b=3&c=4", incomingWins: true, want: "https://ya.ru/?a=1&b=3&c=4"},
+		{dest: "https://ya.ru/?q=a%2Bb#top", query: "x=a+b", want: "https://ya.ru/?q=a%2Bb&x=a+b#top"},
+		{dest: "ya.ru?a=1", query: "a=2", incomingWins: true, want: "ya.ru?a=2"},
+	}
+	for _, tt := range tests {
+		got, err := MergeQuery(tt.dest, tt.query, tt.incomingWins)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, got, "%s + %s", tt.dest, tt.query)
+	}
+}
@@ -0,0 +1,282 @@
+package urlfuncs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+	"github.com/zasuchilas/shortener/internal/app/logger"
+)
+
+// URL safety settings.
+const (
+	DefaultSchemes         = "http,https"
+	ResolveTimeout         = 2 * time.Second
+	BlocklistCheckInterval = time.Second
+)
+
+// Errors of the URL checks.
+var (
+	ErrEmptyURL      = errors.New("empty URL received")
+	ErrScheme        = errors.New("the URL scheme is not allowed")
+	ErrEmptyHost     = errors.New("the URL host is empty")
+	ErrPrivateHost   = errors.New("the URL host is in a private network")
+	ErrUnresolved    = errors.New("the URL host can't be resolved")
+	ErrBlockedDomain = errors.New("the URL domain is blocked")
+)
+
+// forbiddenSchemes are never allowed, even if they are in config.AllowedSchemes.
+var forbiddenSchemes = map[string]struct{}{
+	"javascript": {},
+	"data":       {},
+	"vbscript":   {},
+	"file":       {},
+}
+
+// resolver looks up the host addresses (replaced in tests).
+var resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+} = net.DefaultResolver
+
+// checkScheme checks the scheme against the allow-list.
+//
+// The URLs without a scheme (ya.ru/path) are allowed, the clients have always sent them.
+func checkScheme(scheme string) error {
+	scheme = strings.ToLower(scheme)
+	if scheme == "" {
+		return nil
+	}
+	if _, ok := forbiddenSchemes[scheme]; ok {
+		return fmt.Errorf("%w: %s", ErrScheme, scheme)
+	}
+
+	allowed := config.AllowedSchemes
+	if allowed == "" {
+		allowed = DefaultSchemes
+	}
+	for _, s := range strings.Split(allowed, ",") {
+		if strings.EqualFold(strings.TrimSpace(s), scheme) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrScheme, scheme)
+}
+
+// checkPrivateName checks that the host is not a localhost name or an IP address
+// in loopback, private, link-local or unspecified ranges.
+//
+// The domain names are not resolved: the links are only stored, the requests the service sends
+// to the destinations are checked when the connection is dialed (see NewSafeClient).
+func checkPrivateName(host string) error {
+	if config.AllowPrivateNetworks {
+		return nil
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrPrivateHost, host)
+	}
+	if ip := net.ParseIP(host); ip != nil && isPrivateIP(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateHost, host)
+	}
+	return nil
+}
+
+// checkPrivateHost checks the host like checkPrivateName and resolves the domain names,
+// the host that can't be resolved is not allowed.
+func checkPrivateHost(ctx context.Context, host string) error {
+	if err := checkPrivateName(host); err != nil || config.AllowPrivateNetworks {
+		return err
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ResolveTimeout)
+	defer cancel()
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		logger.Log.Debug("resolving URL host", zap.String("host", host), zap.Error(err))
+		return fmt.Errorf("%w: %s", ErrUnresolved, host)
+	}
+	for _, addr := range addrs {
+		if isPrivateIP(addr.IP) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrPrivateHost, host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// specialNets are the networks that are not public and not covered by the net.IP methods.
+var specialNets = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),     // "this network"
+	mustParseCIDR("100.64.0.0/10"), // carrier-grade NAT
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// isPrivateIP reports whether the ip is not a public unicast address.
+func isPrivateIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() {
+		return true
+	}
+	for _, n := range specialNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckWebhookURL checks the URL the service sends the requests to (the webhook of the user).
+//
+// Unlike the links, the URL must be absolute with the http or https scheme and its host must be resolved.
+// The host can be resolved to another address later, so the requests are sent by NewWebhookClient
+// that checks the address when the connection is dialed.
+func CheckWebhookURL(ctx context.Context, rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return "", ErrEmptyURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if scheme := strings.ToLower(u.Scheme); scheme != "http" && scheme != "https" {
+		return "", fmt.Errorf("%w: %q", ErrScheme, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return "", ErrEmptyHost
+	}
+	if err = checkPrivateHost(ctx, u.Hostname()); err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// blocklist is the set of domains loaded from the file (config.DomainBlocklistPath or config.DomainWarnlistPath).
+//
+// The file is checked for changes not more often than BlocklistCheckInterval and reloaded if it is modified.
+type blocklist struct {
+	name       string        // for logging
+	configPath func() string // the actual path of the file (empty means no list)
+
+	path      string
+	modTime   time.Time
+	checkedAt time.Time
+	domains   map[string]struct{}
+	mutex     sync.Mutex
+}
+
+var (
+	domainBlocklist = &blocklist{
+		name:       "domain blocklist",
+		configPath: func() string { return config.DomainBlocklistPath },
+	}
+	domainWarnlist = &blocklist{
+		name:       "domain warnlist",
+		configPath: func() string { return config.DomainWarnlistPath },
+	}
+)
+
+// contains reports whether the host or one of its parent domains is in the list.
+func (b *blocklist) contains(host string) bool {
+	domains := b.current()
+	if len(domains) == 0 {
+		return false
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for {
+		if _, ok := domains[host]; ok {
+			return true
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return false
+		}
+		host = host[i+1:]
+	}
+}
+
+// current returns the actual set of domains (reloading the file if needed).
+func (b *blocklist) current() map[string]struct{} {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	path := b.configPath()
+	if path == "" {
+		b.path, b.domains = "", nil
+		return nil
+	}
+
+	now := time.Now()
+	if path == b.path && now.Sub(b.checkedAt) < BlocklistCheckInterval {
+		return b.domains
+	}
+	b.checkedAt = now
+
+	info, err := os.Stat(path)
+	if err != nil {
+		// the previous version of the list is used until the file is back
+		logger.Log.Error("checking "+b.name+" file", zap.String("path", path), zap.Error(err))
+		return b.domains
+	}
+	if path == b.path && info.ModTime().Equal(b.modTime) {
+		return b.domains
+	}
+
+	domains, err := loadBlocklist(path)
+	if err != nil {
+		logger.Log.Error("loading "+b.name+" file", zap.String("path", path), zap.Error(err))
+		return b.domains
+	}
+	b.path, b.modTime, b.domains = path, info.ModTime(), domains
+	logger.Log.Info(b.name+" is loaded", zap.String("path", path), zap.Int("domains", len(domains)))
+
+	return b.domains
+}
+
+// loadBlocklist reads the domains, one per line (empty lines and # comments are skipped).
+func loadBlocklist(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	domains := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+		domains[strings.TrimSuffix(strings.ToLower(line), ".")] = struct{}{}
+	}
+
+	return domains, scanner.Err()
+}
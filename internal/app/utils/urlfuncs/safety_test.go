@@ -0,0 +1,198 @@
+package urlfuncs
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zasuchilas/shortener/internal/app/config"
+)
+
+// staticResolver resolves all the hosts to the addresses.
+type staticResolver map[string][]string
+
+func (r staticResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	addrs := make([]net.IPAddr, len(ips))
+	for i, ip := range ips {
+		addrs[i] = net.IPAddr{IP: net.ParseIP(ip)}
+	}
+	return addrs, nil
+}
+
+func TestCleanURL_privateHosts(t *testing.T) {
+	defer func(prev interface {
+		LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	}) {
+		resolver = prev
+	}(resolver)
+	resolver = staticResolver{"internal.example": {"10.0.0.5"}}
+
+	for _, raw := range []string{"http://localhost:8080/", "https://api.localhost/", "http://127.0.0.1/",
+		"http://[::1]/", "10.0.0.5/page", "http://169.254.169.254/latest/meta-data", "http://100.64.0.1/"} {
+		_, err := CleanURL(raw)
+		assert.ErrorIs(t, err, ErrPrivateHost, raw)
+	}
+
+	// the domain names are not resolved, the requests to them are checked when the connection is dialed
+	_, err := CleanURL("https://internal.example/page")
+	assert.NoError(t, err)
+	_, err = CleanURL("https://unknown.example/page")
+	assert.NoError(t, err)
+
+	t.Run("allowed private networks", func(t *testing.T) {
+		config.AllowPrivateNetworks = true
+		defer func() { config.AllowPrivateNetworks = false }()
+
+		_, err := CleanURL("http://10.0.0.5/page")
+		assert.NoError(t, err)
+	})
+}
+
+func TestCheckWebhookURL_resolving(t *testing.T) {
+	defer func(prev interface {
+		LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	}) {
+		resolver = prev
+	}(resolver)
+	resolver = staticResolver{
+		"public.example":   {"93.184.215.14"},
+		"internal.example": {"93.184.215.14", "10.0.0.5"},
+	}
+
+	_, err := CheckWebhookURL(context.Background(), "https://public.example/hook")
+	assert.NoError(t, err)
+
+	// one private address is enough (DNS rebinding)
+	_, err = CheckWebhookURL(context.Background(), "https://internal.example/hook")
+	assert.ErrorIs(t, err, ErrPrivateHost)
+
+	t.Run("allowed private networks", func(t *testing.T) {
+		config.AllowPrivateNetworks = true
+		defer func() { config.AllowPrivateNetworks = false }()
+
+		_, err := CheckWebhookURL(context.Background(), "https://internal.example/hook")
+		assert.NoError(t, err)
+	})
+}
+
+func TestCleanURL_allowedSchemes(t *testing.T) {
+	defer func() { config.AllowedSchemes = "" }()
+
+	config.AllowedSchemes = "https, ftp"
+	_, err := CleanURL("ftp://ya.ru/file")
+	assert.NoError(t, err)
+	_, err = CleanURL("http://ya.ru/")
+	assert.ErrorIs(t, err, ErrScheme)
+
+	// the dangerous schemes can't be allowed
+	config.AllowedSchemes = "https,javascript"
+	_, err = CleanURL("javascript:alert(1)")
+	assert.ErrorIs(t, err, ErrScheme)
+}
+
+func TestCheckWebhookURL(t *testing.T) {
+	ctx := context.Background()
+
+	u, err := CheckWebhookURL(ctx, " https://93.184.215.14/hook ")
+	require.NoError(t, err)
+	assert.Equal(t, "https://93.184.215.14/hook", u)
+
+	_, err = CheckWebhookURL(ctx, "ya.ru/hook")
+	assert.ErrorIs(t, err, ErrScheme)
+	_, err = CheckWebhookURL(ctx, "ftp://ya.ru/hook")
+	assert.ErrorIs(t, err, ErrScheme)
+	_, err = CheckWebhookURL(ctx, "http:///hook")
+	assert.ErrorIs(t, err, ErrEmptyHost)
+	_, err = CheckWebhookURL(ctx, "http://127.0.0.1:8080/hook")
+	assert.ErrorIs(t, err, ErrPrivateHost)
+	_, err = CheckWebhookURL(ctx, "http://localhost/hook")
+	assert.ErrorIs(t, err, ErrPrivateHost)
+
+	// unlike the links, the webhook host that can't be resolved is rejected
+	defer func(prev interface {
+		LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	}) {
+		resolver = prev
+	}(resolver)
+	resolver = staticResolver{"hooks.example": {"93.184.215.14"}}
+	_, err = CheckWebhookURL(ctx, "https://hooks.example/hook")
+	assert.NoError(t, err)
+	_, err = CheckWebhookURL(ctx, "https://unknown.example/hook")
+	assert.ErrorIs(t, err, ErrUnresolved)
+}
+
+func TestCleanURL_blocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# phishing\nevil.example\n\nBAD.example. # trailing dot\n"), 0600))
+	config.DomainBlocklistPath = path
+	defer func() { config.DomainBlocklistPath = "" }()
+
+	for _, raw := range []string{"https://evil.example/", "https://login.evil.example/", "bad.example/path"} {
+		_, err := CleanURL(raw)
+		assert.ErrorIs(t, err, ErrBlockedDomain, raw)
+	}
+	_, err := CleanURL("https://notevil.example/")
+	assert.NoError(t, err)
+
+	// the changed file is reloaded
+	require.NoError(t, os.WriteFile(path, []byte("notevil.example\n"), 0600))
+	modTime := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+	domainBlocklist.mutex.Lock()
+	domainBlocklist.checkedAt = time.Time{}
+	domainBlocklist.mutex.Unlock()
+
+	_, err = CleanURL("https://evil.example/")
+	assert.NoError(t, err)
+	_, err = CleanURL("https://notevil.example/")
+	assert.ErrorIs(t, err, ErrBlockedDomain)
+}
+
+func TestIsFlagged(t *testing.T) {
+	dir := t.TempDir()
+	warnlist := filepath.Join(dir, "warnlist.txt")
+	blocklist := filepath.Join(dir, "blocklist.txt")
+	require.NoError(t, os.WriteFile(warnlist, []byte("casino.example\n"), 0600))
+	require.NoError(t, os.WriteFile(blocklist, []byte("evil.example\n"), 0600))
+	config.DomainWarnlistPath = warnlist
+	config.DomainBlocklistPath = blocklist
+	defer func() { config.DomainWarnlistPath, config.DomainBlocklistPath = "", "" }()
+
+	// the warnlisted domains are allowed, but flagged
+	origURL, err := CleanURL("https://www.casino.example/bonus")
+	require.NoError(t, err)
+	assert.True(t, IsFlagged(origURL))
+	assert.True(t, IsFlagged("casino.example/bonus"))
+
+	// the domain blocklisted after shortening is flagged
+	assert.True(t, IsFlagged("https://evil.example/"))
+
+	assert.False(t, IsFlagged("https://practicum.yandex.ru/"))
+}
+
+func TestIsPrivateIP(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.215.14":     false,
+		"100.63.255.255":    false,
+		"100.64.0.1":        true,
+		"100.127.255.254":   true,
+		"0.1.2.3":           true,
+		"10.0.0.5":          true,
+		"169.254.169.254":   true,
+		"::ffff:100.64.0.1": true,
+		"2a00:1450:4001::":  false,
+	}
+	for ip, private := range tests {
+		assert.Equal(t, private, isPrivateIP(net.ParseIP(ip)), ip)
+	}
+}
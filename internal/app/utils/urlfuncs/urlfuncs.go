@@ -2,7 +2,6 @@
 package urlfuncs
 
 import (
-	"errors"
 	"fmt"
 	"net/url"
 	"strings"
@@ -11,65 +10,89 @@ import (
 
 	"github.com/zasuchilas/shortener/internal/app/config"
 	"github.com/zasuchilas/shortener/internal/app/logger"
+	"github.com/zasuchilas/shortener/internal/app/model"
 )
 
 // CleanURL checks the URL.
+//
+// The checks are: the scheme allow-list (URLs without a scheme are allowed),
+// the domain blocklist, the localhost names and the IP addresses in loopback and private networks
+// (the domain names are not resolved, see checkPrivateName).
+// The URL is returned in the canonical form (see CanonicalURL).
+// The errors of the checks wrap ErrEmptyURL, ErrScheme, ErrEmptyHost, ErrBlockedDomain or ErrPrivateHost.
 func CleanURL(raw string) (string, error) {
-	// TODO: now this method is useless
-
 	// ru.спорт1abc.рф ru.спорт-1abc.рф ru.спорт.1abc.рф
 	// ru.спорт..1abc.рф ru.спорт.-1abc.рф
 
 	// the request body may contain spaces, unlike the query string
 	raw = strings.TrimSpace(raw)
 	if len(raw) == 0 {
-		return "", errors.New("empty URL received")
+		return "", ErrEmptyURL
 	}
 
 	// checking the validity of the received url
 	// basic conditions
-	_, err := url.Parse(raw)
+	u, err := url.Parse(raw)
 	if err != nil {
-		logger.Log.Error("url.Parse", zap.String("raw", raw), zap.Error(err))
-		//return raw, err
+		logger.Log.Debug("url.Parse", zap.String("raw", raw), zap.Error(err))
 		return "", err
 	}
 
 	// checking scheme
-	// http2://спорт.рф/ (mailto, ws/wss, tcp, mqtt ...)
-	//if u.Scheme != "http" && u.Scheme != "https" {
-	//	return raw, errors.New("wrong raw URL (unexpected scheme)")
-	//}
+	// http2://спорт.рф/ (mailto, ws/wss, tcp, mqtt ...), javascript:alert(1)
+	if err = checkScheme(u.Scheme); err != nil {
+		return "", err
+	}
 
 	// checking host
-	// https://спорт/
-	// port
-	//if !hostRegex.MatchString(u.Host) {
-	//	return raw, errors.New("wrong raw URL (unexpected host)")
-	//}
-
-	// checking path
-	// https://спорт.рф/ 1/
-
-	// checking query
-	// / ? & ;
-
-	// checking fragment
-	// #
-
-	// TODO: Chinese URL http://例子.卷筒纸 becomes http://xn--fsqu00a.xn--3lr804guic/.
-	//  The xn-- indicates that the character was not originally ASCII
+	// the URL without a scheme is parsed as a path (ya.ru/path)
+	if u.Scheme == "" {
+		if u, err = url.Parse("http://" + raw); err != nil {
+			return "", err
+		}
+	}
+	host := u.Hostname()
+	if host == "" {
+		return "", ErrEmptyHost
+	}
+	if domainBlocklist.contains(host) {
+		return "", fmt.Errorf("%w: %s", ErrBlockedDomain, host)
+	}
+	if err = checkPrivateName(host); err != nil {
+		return "", err
+	}
 
-	// TODO: Japanese URL http://example.com/引き割り.html becomes http://example.com/%E5%BC%95%E3%81%8D%E5%89%B2%E3%82%8A.html
+	// the same destination written differently gets the same short URL
+	// Chinese URL http://例子.卷筒纸 becomes http://xn--fsqu00a.xn--3lr804guic/
+	// Japanese URL http://example.com/引き割り.html becomes http://example.com/%E5%BC%95%E3%81%8D%E5%89%B2%E3%82%8A.html
+	return CanonicalURL(raw)
+}
 
-	// TODO: omit the scheme or not ? (http/https)
+// IsFlagged reports whether the destination is flagged by the safety checks: its domain is in the warnlist
+// or it has been added to the blocklist after the URL was shortened.
+func IsFlagged(origURL string) bool {
+	u, err := url.Parse(origURL)
+	if err == nil && u.Scheme == "" {
+		u, err = url.Parse("http://" + origURL)
+	}
+	if err != nil {
+		logger.Log.Debug("url.Parse", zap.String("origURL", origURL), zap.Error(err))
+		return false
+	}
 
-	// TODO: raw or u.String() ?
-	return raw, nil
+	host := u.Hostname()
+	return domainWarnlist.contains(host) || domainBlocklist.contains(host)
 }
 
 // EnrichURL enriches the URL by adding a server, port and schema.
+//
+// The short URL is the link key (see model.LinkKey): the link of the additional domain gets the scheme
+// of the domain (or of config.BaseURL) and the domain host.
 func EnrichURL(shortURL string) string {
+	if domain, code := model.SplitLinkKey(shortURL); domain != "" {
+		return domainBaseURL(domain) + "/" + code
+	}
+
 	res := fmt.Sprintf("%s/%s", config.BaseURL, shortURL)
 	if !strings.HasPrefix(res, "http") {
 		res = fmt.Sprintf("http://%s", res)
@@ -1,7 +1,6 @@
 package urlfuncs
 
 import (
-	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -33,14 +32,50 @@ func TestCleanURL(t *testing.T) {
 		{
 			name:        "httpss://ya.ru",
 			raw:         "httpss://ya.ru",
-			expected:    "httpss://ya.ru",
-			expectedErr: nil,
+			expected:    "",
+			expectedErr: ErrScheme,
+		},
+		{
+			name:        "javascript",
+			raw:         "javascript:alert(1)",
+			expected:    "",
+			expectedErr: ErrScheme,
+		},
+		{
+			name:        "data",
+			raw:         "data:text/html;base64,PHNjcmlwdD4=",
+			expected:    "",
+			expectedErr: ErrScheme,
+		},
+		{
+			name:        "loopback",
+			raw:         "http://127.0.0.1:8080/admin",
+			expected:    "",
+			expectedErr: ErrPrivateHost,
+		},
+		{
+			name:        "localhost",
+			raw:         "http://localhost/",
+			expected:    "",
+			expectedErr: ErrPrivateHost,
+		},
+		{
+			name:        "private without scheme",
+			raw:         "192.168.1.1/router",
+			expected:    "",
+			expectedErr: ErrPrivateHost,
+		},
+		{
+			name:        "empty host",
+			raw:         "http:///path",
+			expected:    "",
+			expectedErr: ErrEmptyHost,
 		},
 		{
 			name:        "empty",
 			raw:         " ",
 			expected:    "",
-			expectedErr: errors.New("empty URL received"),
+			expectedErr: ErrEmptyURL,
 		},
 	}
 
@@ -49,7 +84,7 @@ func TestCleanURL(t *testing.T) {
 			actual, err := CleanURL(tt.raw)
 
 			if tt.expectedErr != nil {
-				assert.Error(t, err)
+				assert.ErrorIs(t, err, tt.expectedErr)
 			} else {
 				assert.NoError(t, err)
 			}
@@ -0,0 +1,297 @@
+package qrcode
+
+// Penalty weights of the mask evaluation.
+const (
+	penaltyRun     = 3  // a run of 5 modules of the same color (+1 for every next module)
+	penaltyBlock   = 3  // a 2x2 block of the same color
+	penaltyFinder  = 40 // a finder-like pattern 1:1:3:1:1 with 4 light modules on a side
+	penaltyBalance = 10 // every 5% of the dark modules deviation from 50%
+)
+
+// setFunction sets the module of the function pattern.
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.isFunction[y][x] = true
+}
+
+// drawFunctionPatterns draws the finder, timing and alignment patterns and reserves
+// the format and version areas.
+func (c *Code) drawFunctionPatterns() {
+	// timing patterns
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	// finder patterns with the separators
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	// alignment patterns (except the corners with the finder patterns)
+	positions := alignmentPositions(c.Version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			c.drawAlignment(x, y)
+		}
+	}
+
+	// the areas are reserved with a dummy mask, the real format bits are drawn after masking
+	c.drawFormatBits(0)
+	c.drawVersionBits()
+}
+
+// drawFinder draws the finder pattern with the separator around the center.
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= c.Size || yy < 0 || yy >= c.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawAlignment draws the alignment pattern around the center.
+func (c *Code) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// alignmentPositions returns the coordinates of the alignment pattern centers (the same for x and y).
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	numAlign := version/7 + 2
+	step := 26
+	if version != 32 {
+		step = (version*4 + numAlign*2 + 1) / (numAlign*2 - 2) * 2
+	}
+
+	res := make([]int, numAlign)
+	res[0] = 6
+	for i, pos := numAlign-1, version*4+10; i > 0; i, pos = i-1, pos-step {
+		res[i] = pos
+	}
+	return res
+}
+
+// drawFormatBits draws both copies of the format information (the level and the mask) and the dark module.
+func (c *Code) drawFormatBits(mask int) {
+	data := c.Level.formatBits()<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	// the first copy around the top left finder
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(bits, i))
+	}
+	c.setFunction(8, 7, bit(bits, 6))
+	c.setFunction(8, 8, bit(bits, 7))
+	c.setFunction(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(bits, i))
+	}
+
+	// the second copy under the top right and beside the bottom left finders
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(bits, i))
+	}
+	c.setFunction(8, c.Size-8, true)
+}
+
+// drawVersionBits draws both copies of the version information (version 7 and larger).
+func (c *Code) drawVersionBits() {
+	if c.Version < 7 {
+		return
+	}
+
+	rem := c.Version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := c.Version<<12 | rem
+
+	for i := 0; i < 18; i++ {
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, bit(bits, i))
+		c.setFunction(b, a, bit(bits, i))
+	}
+}
+
+// drawCodewords draws the codewords in the zigzag order (from the bottom right corner by the 2-module columns).
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			// the vertical timing pattern column is skipped
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if c.isFunction[y][x] || i >= len(data)*8 {
+					continue
+				}
+				c.modules[y][x] = (data[i/8]>>(7-i%8))&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+// applyBestMask applies the mask with the lowest penalty score and draws its format bits.
+func (c *Code) applyBestMask() {
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		// the mask is XOR, so applying it again removes it
+		c.applyMask(mask)
+	}
+
+	c.applyMask(best)
+	c.drawFormatBits(best)
+}
+
+// applyMask inverts the data modules by the mask pattern.
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.isFunction[y][x] && maskInverts(mask, x, y) {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// maskInverts reports whether the mask inverts the module.
+func maskInverts(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// penalty returns the penalty score of the symbol.
+func (c *Code) penalty() int {
+	res := 0
+	dark := 0
+
+	for i := 0; i < c.Size; i++ {
+		res += linePenalty(c.Size, func(j int) bool { return c.modules[i][j] })
+		res += linePenalty(c.Size, func(j int) bool { return c.modules[j][i] })
+	}
+
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x+1 < c.Size && y+1 < c.Size {
+				v := c.modules[y][x]
+				if c.modules[y][x+1] == v && c.modules[y+1][x] == v && c.modules[y+1][x+1] == v {
+					res += penaltyBlock
+				}
+			}
+		}
+	}
+
+	total := c.Size * c.Size
+	deviation := abs(dark*20-total*10) / total // in 5% steps
+	res += deviation * penaltyBalance
+
+	return res
+}
+
+// finderLike are the finder-like patterns with 4 light modules before or after.
+var finderLike = [2][11]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// linePenalty returns the penalty of the runs and the finder-like patterns in the row or the column.
+func linePenalty(size int, module func(int) bool) int {
+	res := 0
+
+	run := 1
+	for j := 1; j <= size; j++ {
+		if j < size && module(j) == module(j-1) {
+			run++
+			continue
+		}
+		if run >= 5 {
+			res += penaltyRun + run - 5
+		}
+		run = 1
+	}
+
+	for j := 0; j+11 <= size; j++ {
+		for _, pattern := range finderLike {
+			matched := true
+			for k, v := range pattern {
+				if module(j+k) != v {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				res += penaltyFinder
+			}
+		}
+	}
+
+	return res
+}
+
+// bit returns the i-th bit of the value.
+func bit(value, i int) bool {
+	return (value>>i)&1 != 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
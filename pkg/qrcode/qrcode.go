@@ -0,0 +1,243 @@
+// Package qrcode encodes data into QR codes (ISO/IEC 18004) and renders them as PNG or SVG.
+//
+// Only the byte mode is used: the short links are ASCII, so the other modes would not make the codes
+// noticeably smaller. The smallest version (1-40) that fits the data at the error correction level is chosen,
+// the mask with the lowest penalty score is applied.
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Level is the error correction level.
+type Level int
+
+// Error correction levels (the share of the codewords that can be restored).
+const (
+	Low      Level = iota // ~7%
+	Medium                // ~15%
+	Quartile              // ~25%
+	High                  // ~30%
+)
+
+// Version limits.
+const (
+	MinVersion = 1
+	MaxVersion = 40
+)
+
+// ErrTooLong is returned if the data does not fit into the largest version.
+var ErrTooLong = errors.New("the data is too long for a QR code")
+
+// ParseLevel parses the error correction level (L, M, Q or H).
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "L":
+		return Low, nil
+	case "M":
+		return Medium, nil
+	case "Q":
+		return Quartile, nil
+	case "H":
+		return High, nil
+	default:
+		return 0, fmt.Errorf("unknown error correction level %q (expected L, M, Q or H)", s)
+	}
+}
+
+// String returns the level letter.
+func (l Level) String() string {
+	return [...]string{"L", "M", "Q", "H"}[l]
+}
+
+// formatBits returns the level bits of the format information.
+func (l Level) formatBits() int {
+	return [...]int{1, 0, 3, 2}[l]
+}
+
+// Code is the QR code symbol.
+type Code struct {
+	Version int
+	Level   Level
+	Size    int // number of modules on a side
+
+	modules    [][]bool // dark modules by [y][x]
+	isFunction [][]bool // modules of the function patterns (they are not masked)
+}
+
+// Encode encodes the data into the QR code of the smallest version that fits the data.
+func Encode(data []byte, level Level) (*Code, error) {
+	if level < Low || level > High {
+		return nil, fmt.Errorf("unknown error correction level %d", level)
+	}
+
+	version := MinVersion
+	for ; version <= MaxVersion; version++ {
+		if dataBitsUsed(version, len(data)) <= numDataCodewords(version, level)*8 {
+			break
+		}
+	}
+	if version > MaxVersion {
+		return nil, fmt.Errorf("%w (%d bytes)", ErrTooLong, len(data))
+	}
+
+	c := newCode(version, level)
+	c.drawFunctionPatterns()
+	c.drawCodewords(c.addECCAndInterleave(encodeData(data, version, level)))
+	c.applyBestMask()
+
+	return c, nil
+}
+
+// Dark reports whether the module is dark (the coordinates outside the symbol are light).
+func (c *Code) Dark(x, y int) bool {
+	return x >= 0 && x < c.Size && y >= 0 && y < c.Size && c.modules[y][x]
+}
+
+func newCode(version int, level Level) *Code {
+	size := version*4 + 17
+	c := &Code{
+		Version:    version,
+		Level:      level,
+		Size:       size,
+		modules:    make([][]bool, size),
+		isFunction: make([][]bool, size),
+	}
+	for i := range c.modules {
+		c.modules[i] = make([]bool, size)
+		c.isFunction[i] = make([]bool, size)
+	}
+	return c
+}
+
+// dataBitsUsed returns the number of the data bits in the byte mode.
+func dataBitsUsed(version, n int) int {
+	return 4 + charCountBits(version) + n*8
+}
+
+// charCountBits returns the length of the character count indicator in the byte mode.
+func charCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// encodeData returns the data codewords: the mode, the count, the data, the terminator and the padding.
+func encodeData(data []byte, version int, level Level) []byte {
+	capacity := numDataCodewords(version, level) * 8
+
+	var bb bitBuffer
+	bb.append(0x4, 4) // byte mode
+	bb.append(len(data), charCountBits(version))
+	for _, b := range data {
+		bb.append(int(b), 8)
+	}
+	bb.append(0, min(4, capacity-len(bb)))
+	bb.append(0, (8-len(bb)%8)%8)
+	for pad := 0xEC; len(bb) < capacity; pad ^= 0xEC ^ 0x11 {
+		bb.append(pad, 8)
+	}
+
+	return bb.bytes()
+}
+
+// bitBuffer is the sequence of bits.
+type bitBuffer []bool
+
+// append appends the n low bits of the value (the high bit first).
+func (bb *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*bb = append(*bb, (value>>i)&1 != 0)
+	}
+}
+
+// bytes packs the bits into bytes (the length is a multiple of 8).
+func (bb bitBuffer) bytes() []byte {
+	res := make([]byte, len(bb)/8)
+	for i, bit := range bb {
+		if bit {
+			res[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return res
+}
+
+// addECCAndInterleave splits the data into blocks, adds the error correction codewords to every block
+// and interleaves the codewords of the blocks.
+func (c *Code) addECCAndInterleave(data []byte) []byte {
+	numBlocks := numErrorCorrectionBlocks[c.Level][c.Version]
+	blockECCLen := eccCodewordsPerBlock[c.Level][c.Version]
+	rawCodewords := numRawDataModules(c.Version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := reedSolomonDivisor(blockECCLen)
+	blocks := make([][]byte, 0, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		datLen := shortBlockLen - blockECCLen
+		if i >= numShortBlocks {
+			datLen++
+		}
+		dat := data[k : k+datLen]
+		k += datLen
+
+		block := make([]byte, 0, shortBlockLen+1)
+		block = append(block, dat...)
+		if i < numShortBlocks {
+			// the place of the missing data codeword (skipped at the interleaving)
+			block = append(block, 0)
+		}
+		block = append(block, reedSolomonRemainder(dat, divisor)...)
+		blocks = append(blocks, block)
+	}
+
+	res := make([]byte, 0, rawCodewords)
+	for i := 0; i < len(blocks[0]); i++ {
+		for j, block := range blocks {
+			if i != shortBlockLen-blockECCLen || j >= numShortBlocks {
+				res = append(res, block[i])
+			}
+		}
+	}
+
+	return res
+}
+
+// numRawDataModules returns the number of the modules for the data and error correction codewords
+// (including the remainder bits).
+func numRawDataModules(version int) int {
+	res := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		res -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			res -= 36
+		}
+	}
+	return res
+}
+
+// numDataCodewords returns the number of the data codewords.
+func numDataCodewords(version int, level Level) int {
+	return numRawDataModules(version)/8 -
+		eccCodewordsPerBlock[level][version]*numErrorCorrectionBlocks[level][version]
+}
+
+// eccCodewordsPerBlock is the number of the error correction codewords in a block by level and version.
+var eccCodewordsPerBlock = [4][MaxVersion + 1]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// numErrorCorrectionBlocks is the number of the blocks by level and version.
+var numErrorCorrectionBlocks = [4][MaxVersion + 1]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
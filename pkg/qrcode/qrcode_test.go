@@ -0,0 +1,151 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]Level{"L": Low, "m": Medium, " Q ": Quartile, "H": High} {
+		level, err := ParseLevel(s)
+		assert.NoError(t, err)
+		assert.Equal(t, want, level)
+	}
+	_, err := ParseLevel("X")
+	assert.Error(t, err)
+}
+
+func TestReedSolomonRemainder(t *testing.T) {
+	// "HELLO WORLD" in the alphanumeric mode, version 1-M (the example from ISO/IEC 18004)
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	assert.Equal(t, want, reedSolomonRemainder(data, reedSolomonDivisor(len(want))))
+}
+
+func TestEncode_version(t *testing.T) {
+	tests := []struct {
+		level   Level
+		length  int
+		version int
+	}{
+		{level: Low, length: 17, version: 1},
+		{level: Low, length: 18, version: 2},
+		{level: Medium, length: 14, version: 1},
+		{level: Medium, length: 15, version: 2},
+		{level: Quartile, length: 11, version: 1},
+		{level: High, length: 7, version: 1},
+		{level: High, length: 8, version: 2},
+		{level: Medium, length: 213, version: 10},
+		{level: Low, length: 2953, version: 40},
+	}
+	for _, tt := range tests {
+		c, err := Encode(bytes.Repeat([]byte{'a'}, tt.length), tt.level)
+		require.NoError(t, err)
+		assert.Equal(t, tt.version, c.Version, "level %s, length %d", tt.level, tt.length)
+		assert.Equal(t, tt.version*4+17, c.Size)
+	}
+
+	_, err := Encode(bytes.Repeat([]byte{'a'}, 2954), Low)
+	assert.ErrorIs(t, err, ErrTooLong)
+}
+
+func TestEncode_patterns(t *testing.T) {
+	c, err := Encode([]byte("http://localhost:8080/19xtf1ts"), Medium)
+	require.NoError(t, err)
+
+	// finder patterns: the dark center and border, the light ring and separator
+	for _, corner := range [][2]int{{3, 3}, {c.Size - 4, 3}, {3, c.Size - 4}} {
+		x, y := corner[0], corner[1]
+		assert.True(t, c.Dark(x, y))
+		assert.True(t, c.Dark(x-3, y-3))
+		assert.False(t, c.Dark(x-2, y-2))
+		assert.False(t, c.Dark(x+4, y))
+		assert.False(t, c.Dark(x-4, y))
+	}
+
+	// timing patterns
+	for i := 8; i < c.Size-8; i++ {
+		assert.Equal(t, i%2 == 0, c.Dark(6, i))
+		assert.Equal(t, i%2 == 0, c.Dark(i, 6))
+	}
+
+	// the dark module
+	assert.True(t, c.Dark(8, c.Size-8))
+
+	// both copies of the format information are the same valid BCH code
+	first, second := 0, 0
+	for i := 0; i <= 5; i++ {
+		first |= b2i(c.Dark(8, i)) << i
+	}
+	first |= b2i(c.Dark(8, 7))<<6 | b2i(c.Dark(8, 8))<<7 | b2i(c.Dark(7, 8))<<8
+	for i := 9; i < 15; i++ {
+		first |= b2i(c.Dark(14-i, 8)) << i
+	}
+	for i := 0; i < 8; i++ {
+		second |= b2i(c.Dark(c.Size-1-i, 8)) << i
+	}
+	for i := 8; i < 15; i++ {
+		second |= b2i(c.Dark(8, c.Size-15+i)) << i
+	}
+	assert.Equal(t, first, second)
+
+	format := first ^ 0x5412
+	assert.Equal(t, Medium.formatBits(), format>>13)
+	rem := format >> 10
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	assert.Equal(t, format&0x3FF, rem)
+}
+
+func TestCode_PNG(t *testing.T) {
+	c, err := Encode([]byte("http://localhost:8080/19xtf1ts"), Quartile)
+	require.NoError(t, err)
+
+	data, err := c.PNG(256, DefaultMargin)
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 256, img.Bounds().Dx())
+	assert.Equal(t, 256, img.Bounds().Dy())
+
+	// the corner is in the margin, the top left finder is dark
+	scale := 256 / c.Width(DefaultMargin)
+	offset := (256-c.Width(DefaultMargin)*scale)/2 + DefaultMargin*scale
+	r, _, _, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0xFFFF), r)
+	r, _, _, _ = img.At(offset, offset).RGBA()
+	assert.Equal(t, uint32(0), r)
+
+	// the size less than the width of the code
+	data, err = c.PNG(10, 0)
+	require.NoError(t, err)
+	img, err = png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, c.Size, img.Bounds().Dx())
+}
+
+func TestCode_SVG(t *testing.T) {
+	c, err := Encode([]byte("http://localhost:8080/19xtf1ts"), Low)
+	require.NoError(t, err)
+
+	svg := string(c.SVG(300, 2))
+	assert.True(t, strings.HasPrefix(svg, "<?xml"))
+	assert.Contains(t, svg, `width="300" height="300"`)
+	assert.Contains(t, svg, `viewBox="0 0 29 29"`)
+	// the top left finder starts with the run of 7 dark modules
+	assert.Contains(t, svg, `d="M2,2h7v1h-7z`)
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
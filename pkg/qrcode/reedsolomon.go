@@ -0,0 +1,46 @@
+package qrcode
+
+// reedSolomonDivisor returns the generator polynomial of the degree
+// (the coefficients from the highest power, the leading 1 is omitted).
+func reedSolomonDivisor(degree int) []byte {
+	res := make([]byte, degree)
+	res[degree-1] = 1
+
+	// the product (x - r^0)(x - r^1)...(x - r^{degree-1}), r = 0x02
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range res {
+			res[j] = gfMultiply(res[j], root)
+			if j+1 < len(res) {
+				res[j] ^= res[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+
+	return res
+}
+
+// reedSolomonRemainder returns the error correction codewords of the data.
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	res := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ res[0]
+		copy(res, res[1:])
+		res[len(res)-1] = 0
+		for i, d := range divisor {
+			res[i] ^= gfMultiply(d, factor)
+		}
+	}
+	return res
+}
+
+// gfMultiply multiplies the elements of GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
@@ -0,0 +1,84 @@
+package qrcode
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// DefaultMargin is the quiet zone width required by the standard (in modules).
+const DefaultMargin = 4
+
+// Width returns the width of the symbol with the margin (in modules).
+func (c *Code) Width(margin int) int {
+	return c.Size + 2*margin
+}
+
+// PNG renders the code as the grayscale PNG image of size x size pixels.
+//
+// The modules are scaled by an integer factor (so they are sharp), the rest of the size is added to the margin.
+// If the size is less than the width of the code, every module is one pixel.
+func (c *Code) PNG(size, margin int) ([]byte, error) {
+	width := c.Width(margin)
+	scale := max(1, size/width)
+	size = max(size, width)
+	offset := (size-width*scale)/2 + margin*scale
+
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			for py := 0; py < scale; py++ {
+				for px := 0; px < scale; px++ {
+					img.SetGray(offset+x*scale+px, offset+y*scale+py, color.Gray{})
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders the code as the SVG image of size x size pixels (one path of the dark modules).
+func (c *Code) SVG(size, margin int) []byte {
+	width := c.Width(margin)
+
+	var path strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			// the horizontal runs of the dark modules are joined
+			run := 1
+			for x+run < c.Size && c.modules[y][x+run] {
+				run++
+			}
+			fmt.Fprintf(&path, "M%d,%dh%dv1h-%dz", x+margin, y+margin, run, run)
+			x += run - 1
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n",
+		size, size, width, width)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="#FFFFFF"/>`+"\n")
+	fmt.Fprintf(&buf, `<path d="%s" fill="#000000"/>`+"\n", path.String())
+	fmt.Fprintf(&buf, "</svg>\n")
+
+	return buf.Bytes()
+}
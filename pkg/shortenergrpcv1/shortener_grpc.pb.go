@@ -22,11 +22,17 @@ const _ = grpc.SupportPackageIsVersion9
 const (
 	ShortenerV1_ReadURL_FullMethodName        = "/shortenergrpcv1.ShortenerV1/ReadURL"
 	ShortenerV1_Ping_FullMethodName           = "/shortenergrpcv1.ShortenerV1/Ping"
+	ShortenerV1_QRCode_FullMethodName         = "/shortenergrpcv1.ShortenerV1/QRCode"
 	ShortenerV1_UserURLs_FullMethodName       = "/shortenergrpcv1.ShortenerV1/UserURLs"
+	ShortenerV1_StreamUserURLs_FullMethodName = "/shortenergrpcv1.ShortenerV1/StreamUserURLs"
 	ShortenerV1_DeleteUserURLs_FullMethodName = "/shortenergrpcv1.ShortenerV1/DeleteUserURLs"
+	ShortenerV1_UpdateURL_FullMethodName      = "/shortenergrpcv1.ShortenerV1/UpdateURL"
+	ShortenerV1_URLRevisions_FullMethodName   = "/shortenergrpcv1.ShortenerV1/URLRevisions"
+	ShortenerV1_URLOptions_FullMethodName     = "/shortenergrpcv1.ShortenerV1/URLOptions"
 	ShortenerV1_WriteURL_FullMethodName       = "/shortenergrpcv1.ShortenerV1/WriteURL"
 	ShortenerV1_Shorten_FullMethodName        = "/shortenergrpcv1.ShortenerV1/Shorten"
 	ShortenerV1_ShortenBatch_FullMethodName   = "/shortenergrpcv1.ShortenerV1/ShortenBatch"
+	ShortenerV1_ShortenStream_FullMethodName  = "/shortenergrpcv1.ShortenerV1/ShortenStream"
 	ShortenerV1_Stats_FullMethodName          = "/shortenergrpcv1.ShortenerV1/Stats"
 )
 
@@ -37,13 +43,19 @@ type ShortenerV1Client interface {
 	// public
 	ReadURL(ctx context.Context, in *ReadURLRequest, opts ...grpc.CallOption) (*ReadURLResponse, error)
 	Ping(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*empty.Empty, error)
+	QRCode(ctx context.Context, in *QRCodeRequest, opts ...grpc.CallOption) (*QRCodeResponse, error)
 	// with guard (if there is no valid token returns error 401 Unauthorized)
-	UserURLs(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*UserURLsResponse, error)
+	UserURLs(ctx context.Context, in *UserURLsRequest, opts ...grpc.CallOption) (*UserURLsResponse, error)
+	StreamUserURLs(ctx context.Context, in *UserURLsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[UserURLsResponse], error)
 	DeleteUserURLs(ctx context.Context, in *DeleteUserURLsRequest, opts ...grpc.CallOption) (*empty.Empty, error)
+	UpdateURL(ctx context.Context, in *UpdateURLRequest, opts ...grpc.CallOption) (*UpdateURLResponse, error)
+	URLRevisions(ctx context.Context, in *URLRevisionsRequest, opts ...grpc.CallOption) (*URLRevisionsResponse, error)
+	URLOptions(ctx context.Context, in *URLOptionsRequest, opts ...grpc.CallOption) (*URLOptionsResponse, error)
 	// with secure cookie (if there is no valid token assigns a new token)
 	WriteURL(ctx context.Context, in *WriteURLRequest, opts ...grpc.CallOption) (*WriteURLResponse, error)
 	Shorten(ctx context.Context, in *ShortenRequest, opts ...grpc.CallOption) (*ShortenResponse, error)
 	ShortenBatch(ctx context.Context, in *ShortenBatchRequest, opts ...grpc.CallOption) (*ShortenBatchResponse, error)
+	ShortenStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ShortenStreamRequest, ShortenStreamResponse], error)
 	// trusted subnet
 	Stats(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*StatsResponse, error)
 }
@@ -76,7 +88,17 @@ func (c *shortenerV1Client) Ping(ctx context.Context, in *empty.Empty, opts ...g
 	return out, nil
 }
 
-func (c *shortenerV1Client) UserURLs(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*UserURLsResponse, error) {
+func (c *shortenerV1Client) QRCode(ctx context.Context, in *QRCodeRequest, opts ...grpc.CallOption) (*QRCodeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QRCodeResponse)
+	err := c.cc.Invoke(ctx, ShortenerV1_QRCode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerV1Client) UserURLs(ctx context.Context, in *UserURLsRequest, opts ...grpc.CallOption) (*UserURLsResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(UserURLsResponse)
 	err := c.cc.Invoke(ctx, ShortenerV1_UserURLs_FullMethodName, in, out, cOpts...)
@@ -86,6 +108,25 @@ func (c *shortenerV1Client) UserURLs(ctx context.Context, in *empty.Empty, opts
 	return out, nil
 }
 
+func (c *shortenerV1Client) StreamUserURLs(ctx context.Context, in *UserURLsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[UserURLsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ShortenerV1_ServiceDesc.Streams[0], ShortenerV1_StreamUserURLs_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[UserURLsRequest, UserURLsResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ShortenerV1_StreamUserURLsClient = grpc.ServerStreamingClient[UserURLsResponse]
+
 func (c *shortenerV1Client) DeleteUserURLs(ctx context.Context, in *DeleteUserURLsRequest, opts ...grpc.CallOption) (*empty.Empty, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(empty.Empty)
@@ -96,6 +137,36 @@ func (c *shortenerV1Client) DeleteUserURLs(ctx context.Context, in *DeleteUserUR
 	return out, nil
 }
 
+func (c *shortenerV1Client) UpdateURL(ctx context.Context, in *UpdateURLRequest, opts ...grpc.CallOption) (*UpdateURLResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UpdateURLResponse)
+	err := c.cc.Invoke(ctx, ShortenerV1_UpdateURL_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerV1Client) URLRevisions(ctx context.Context, in *URLRevisionsRequest, opts ...grpc.CallOption) (*URLRevisionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(URLRevisionsResponse)
+	err := c.cc.Invoke(ctx, ShortenerV1_URLRevisions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerV1Client) URLOptions(ctx context.Context, in *URLOptionsRequest, opts ...grpc.CallOption) (*URLOptionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(URLOptionsResponse)
+	err := c.cc.Invoke(ctx, ShortenerV1_URLOptions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *shortenerV1Client) WriteURL(ctx context.Context, in *WriteURLRequest, opts ...grpc.CallOption) (*WriteURLResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(WriteURLResponse)
@@ -126,6 +197,19 @@ func (c *shortenerV1Client) ShortenBatch(ctx context.Context, in *ShortenBatchRe
 	return out, nil
 }
 
+func (c *shortenerV1Client) ShortenStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ShortenStreamRequest, ShortenStreamResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ShortenerV1_ServiceDesc.Streams[1], ShortenerV1_ShortenStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ShortenStreamRequest, ShortenStreamResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ShortenerV1_ShortenStreamClient = grpc.ClientStreamingClient[ShortenStreamRequest, ShortenStreamResponse]
+
 func (c *shortenerV1Client) Stats(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*StatsResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(StatsResponse)
@@ -143,13 +227,19 @@ type ShortenerV1Server interface {
 	// public
 	ReadURL(context.Context, *ReadURLRequest) (*ReadURLResponse, error)
 	Ping(context.Context, *empty.Empty) (*empty.Empty, error)
+	QRCode(context.Context, *QRCodeRequest) (*QRCodeResponse, error)
 	// with guard (if there is no valid token returns error 401 Unauthorized)
-	UserURLs(context.Context, *empty.Empty) (*UserURLsResponse, error)
+	UserURLs(context.Context, *UserURLsRequest) (*UserURLsResponse, error)
+	StreamUserURLs(*UserURLsRequest, grpc.ServerStreamingServer[UserURLsResponse]) error
 	DeleteUserURLs(context.Context, *DeleteUserURLsRequest) (*empty.Empty, error)
+	UpdateURL(context.Context, *UpdateURLRequest) (*UpdateURLResponse, error)
+	URLRevisions(context.Context, *URLRevisionsRequest) (*URLRevisionsResponse, error)
+	URLOptions(context.Context, *URLOptionsRequest) (*URLOptionsResponse, error)
 	// with secure cookie (if there is no valid token assigns a new token)
 	WriteURL(context.Context, *WriteURLRequest) (*WriteURLResponse, error)
 	Shorten(context.Context, *ShortenRequest) (*ShortenResponse, error)
 	ShortenBatch(context.Context, *ShortenBatchRequest) (*ShortenBatchResponse, error)
+	ShortenStream(grpc.ClientStreamingServer[ShortenStreamRequest, ShortenStreamResponse]) error
 	// trusted subnet
 	Stats(context.Context, *empty.Empty) (*StatsResponse, error)
 	mustEmbedUnimplementedShortenerV1Server()
@@ -168,12 +258,27 @@ func (UnimplementedShortenerV1Server) ReadURL(context.Context, *ReadURLRequest)
 func (UnimplementedShortenerV1Server) Ping(context.Context, *empty.Empty) (*empty.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
 }
-func (UnimplementedShortenerV1Server) UserURLs(context.Context, *empty.Empty) (*UserURLsResponse, error) {
+func (UnimplementedShortenerV1Server) QRCode(context.Context, *QRCodeRequest) (*QRCodeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QRCode not implemented")
+}
+func (UnimplementedShortenerV1Server) UserURLs(context.Context, *UserURLsRequest) (*UserURLsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UserURLs not implemented")
 }
+func (UnimplementedShortenerV1Server) StreamUserURLs(*UserURLsRequest, grpc.ServerStreamingServer[UserURLsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamUserURLs not implemented")
+}
 func (UnimplementedShortenerV1Server) DeleteUserURLs(context.Context, *DeleteUserURLsRequest) (*empty.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteUserURLs not implemented")
 }
+func (UnimplementedShortenerV1Server) UpdateURL(context.Context, *UpdateURLRequest) (*UpdateURLResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateURL not implemented")
+}
+func (UnimplementedShortenerV1Server) URLRevisions(context.Context, *URLRevisionsRequest) (*URLRevisionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method URLRevisions not implemented")
+}
+func (UnimplementedShortenerV1Server) URLOptions(context.Context, *URLOptionsRequest) (*URLOptionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method URLOptions not implemented")
+}
 func (UnimplementedShortenerV1Server) WriteURL(context.Context, *WriteURLRequest) (*WriteURLResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method WriteURL not implemented")
 }
@@ -183,6 +288,9 @@ func (UnimplementedShortenerV1Server) Shorten(context.Context, *ShortenRequest)
 func (UnimplementedShortenerV1Server) ShortenBatch(context.Context, *ShortenBatchRequest) (*ShortenBatchResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ShortenBatch not implemented")
 }
+func (UnimplementedShortenerV1Server) ShortenStream(grpc.ClientStreamingServer[ShortenStreamRequest, ShortenStreamResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ShortenStream not implemented")
+}
 func (UnimplementedShortenerV1Server) Stats(context.Context, *empty.Empty) (*StatsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Stats not implemented")
 }
@@ -243,8 +351,26 @@ func _ShortenerV1_Ping_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ShortenerV1_QRCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QRCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerV1Server).QRCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShortenerV1_QRCode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerV1Server).QRCode(ctx, req.(*QRCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _ShortenerV1_UserURLs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(empty.Empty)
+	in := new(UserURLsRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
@@ -256,11 +382,22 @@ func _ShortenerV1_UserURLs_Handler(srv interface{}, ctx context.Context, dec fun
 		FullMethod: ShortenerV1_UserURLs_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(ShortenerV1Server).UserURLs(ctx, req.(*empty.Empty))
+		return srv.(ShortenerV1Server).UserURLs(ctx, req.(*UserURLsRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ShortenerV1_StreamUserURLs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(UserURLsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ShortenerV1Server).StreamUserURLs(m, &grpc.GenericServerStream[UserURLsRequest, UserURLsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ShortenerV1_StreamUserURLsServer = grpc.ServerStreamingServer[UserURLsResponse]
+
 func _ShortenerV1_DeleteUserURLs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(DeleteUserURLsRequest)
 	if err := dec(in); err != nil {
@@ -279,6 +416,60 @@ func _ShortenerV1_DeleteUserURLs_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ShortenerV1_UpdateURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateURLRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerV1Server).UpdateURL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShortenerV1_UpdateURL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerV1Server).UpdateURL(ctx, req.(*UpdateURLRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShortenerV1_URLRevisions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(URLRevisionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerV1Server).URLRevisions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShortenerV1_URLRevisions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerV1Server).URLRevisions(ctx, req.(*URLRevisionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShortenerV1_URLOptions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(URLOptionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerV1Server).URLOptions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShortenerV1_URLOptions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerV1Server).URLOptions(ctx, req.(*URLOptionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _ShortenerV1_WriteURL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(WriteURLRequest)
 	if err := dec(in); err != nil {
@@ -333,6 +524,13 @@ func _ShortenerV1_ShortenBatch_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ShortenerV1_ShortenStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ShortenerV1Server).ShortenStream(&grpc.GenericServerStream[ShortenStreamRequest, ShortenStreamResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ShortenerV1_ShortenStreamServer = grpc.ClientStreamingServer[ShortenStreamRequest, ShortenStreamResponse]
+
 func _ShortenerV1_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(empty.Empty)
 	if err := dec(in); err != nil {
@@ -366,6 +564,10 @@ var ShortenerV1_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Ping",
 			Handler:    _ShortenerV1_Ping_Handler,
 		},
+		{
+			MethodName: "QRCode",
+			Handler:    _ShortenerV1_QRCode_Handler,
+		},
 		{
 			MethodName: "UserURLs",
 			Handler:    _ShortenerV1_UserURLs_Handler,
@@ -374,6 +576,18 @@ var ShortenerV1_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteUserURLs",
 			Handler:    _ShortenerV1_DeleteUserURLs_Handler,
 		},
+		{
+			MethodName: "UpdateURL",
+			Handler:    _ShortenerV1_UpdateURL_Handler,
+		},
+		{
+			MethodName: "URLRevisions",
+			Handler:    _ShortenerV1_URLRevisions_Handler,
+		},
+		{
+			MethodName: "URLOptions",
+			Handler:    _ShortenerV1_URLOptions_Handler,
+		},
 		{
 			MethodName: "WriteURL",
 			Handler:    _ShortenerV1_WriteURL_Handler,
@@ -391,6 +605,17 @@ var ShortenerV1_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _ShortenerV1_Stats_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamUserURLs",
+			Handler:       _ShortenerV1_StreamUserURLs_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ShortenStream",
+			Handler:       _ShortenerV1_ShortenStream_Handler,
+			ClientStreams: true,
+		},
+	},
 	Metadata: "shortener.proto",
 }
@@ -8,23 +8,40 @@ import (
 // ShortenerHTTPApiV1 _
 type ShortenerHTTPApiV1 interface {
 	PingHandler(http.ResponseWriter, *http.Request)
+	HealthzHandler(http.ResponseWriter, *http.Request)
+	ReadyzHandler(http.ResponseWriter, *http.Request)
 	ReadURLHandler(http.ResponseWriter, *http.Request)
 	WriteURLHandler(http.ResponseWriter, *http.Request)
 	ShortenHandler(http.ResponseWriter, *http.Request)
 	ShortenBatchHandler(http.ResponseWriter, *http.Request)
+	ShortenJobHandler(http.ResponseWriter, *http.Request)
+	ShortenJobStatusHandler(http.ResponseWriter, *http.Request)
+	ShortenJobResultHandler(http.ResponseWriter, *http.Request)
+	CreateWebhookHandler(http.ResponseWriter, *http.Request)
+	UserWebhooksHandler(http.ResponseWriter, *http.Request)
+	DeleteWebhookHandler(http.ResponseWriter, *http.Request)
+	WebhookDeliveriesHandler(http.ResponseWriter, *http.Request)
 	DeleteURLsHandler(http.ResponseWriter, *http.Request)
 	UserURLsHandler(http.ResponseWriter, *http.Request)
+	BrokenURLsHandler(http.ResponseWriter, *http.Request)
+	UpdateURLHandler(http.ResponseWriter, *http.Request)
+	URLRevisionsHandler(http.ResponseWriter, *http.Request)
+	URLOptionsHandler(http.ResponseWriter, *http.Request)
+	QRCodeHandler(http.ResponseWriter, *http.Request)
 	StatsHandler(http.ResponseWriter, *http.Request)
 }
 
 // POST api/shorten
 type (
 	ShortenRequest struct {
-		URL string `json:"url"`
+		URL    string `json:"url"`
+		QR     bool   `json:"qr,omitempty"`     // the QR code of the short URL is added to the response
+		Domain string `json:"domain,omitempty"` // the domain of the short URL (empty means the domain of the base URL)
 	}
 
 	ShortenResponse struct {
 		Result string `json:"result"`
+		QR     string `json:"qr,omitempty"` // the base64-encoded PNG image of the QR code
 	}
 )
 
@@ -41,17 +58,181 @@ type (
 		CorrelationID string `json:"correlation_id"`
 		ShortURL      string `json:"short_url"`
 	}
+
+	// ShortenBatchErrorItem is the wrong batch item (the response is 400 Bad Request).
+	ShortenBatchErrorItem struct {
+		Index         int    `json:"index"`
+		CorrelationID string `json:"correlation_id"`
+		OriginalURL   string `json:"original_url"`
+		Error         string `json:"error"`
+	}
+)
+
+// POST /api/shorten/batch with the streamed upload
+//
+// The NDJSON upload has a ShortenBatchRequestItem on every line, the CSV upload has the correlation_id
+// and original_url columns (the header row is optional). The results are streamed in the same format
+// as the lines are processed, the valid items are stored even if some lines are invalid.
+const (
+	ContentTypeNDJSON = "application/x-ndjson"
+	ContentTypeCSV    = "text/csv"
+)
+
+type (
+	// ShortenUploadResultItem is the result of the upload line (NDJSON line or CSV row).
+	//
+	// The result without the line is the error that has stopped the upload.
+	ShortenUploadResultItem struct {
+		Line          int    `json:"line,omitempty"`
+		CorrelationID string `json:"correlation_id,omitempty"`
+		ShortURL      string `json:"short_url,omitempty"`
+		Error         string `json:"error,omitempty"`
+	}
 )
 
-// GET /api/user/urls
+// POST /api/jobs/shorten, GET /api/jobs/{id}
+//
+// The job is the upload of POST /api/shorten/batch (JSON array, NDJSON or CSV) processed in the background.
+// The results of the finished job are the ShortenUploadResultItem lines of GET /api/jobs/{id}/result
+// (NDJSON, or CSV if it is accepted).
+type (
+	// ShortenJobResponse _
+	ShortenJobResponse struct {
+		ID        int64     `json:"id"`
+		Status    string    `json:"status"` // queued, running, done or failed
+		Total     int       `json:"total"`
+		Processed int       `json:"processed"`
+		Failed    int       `json:"failed"`
+		Error     string    `json:"error,omitempty"`
+		Created   time.Time `json:"created"`
+		Updated   time.Time `json:"updated"`
+	}
+)
+
+// GET /api/user/urls, GET /api/user/urls/broken
 type (
 	// UserURLsResponseItem _
 	UserURLsResponseItem struct {
+		Domain      string   `json:"domain,omitempty"`
+		ShortURL    string   `json:"short_url"`
+		OriginalURL string   `json:"original_url"`
+		Title       string   `json:"title,omitempty"`
+		Notes       string   `json:"notes,omitempty"`
+		Tags        []string `json:"tags,omitempty"`
+
+		Page  *PageMetadata `json:"page,omitempty"`  // missing if the destination page is not fetched yet
+		Check *LinkCheck    `json:"check,omitempty"` // missing if the destination is not checked yet
+	}
+
+	// PageMetadata is the metadata of the destination page (the error is set if the page can't be fetched).
+	PageMetadata struct {
+		Title       string    `json:"title,omitempty"`
+		Description string    `json:"description,omitempty"`
+		Favicon     string    `json:"favicon,omitempty"`
+		Fetched     time.Time `json:"fetched"`
+		Error       string    `json:"error,omitempty"`
+	}
+
+	// LinkCheck is the last check of the destination (the link is broken if the destination fails the checks in a row).
+	LinkCheck struct {
+		Status   int       `json:"status,omitempty"` // missing if the destination is not reached
+		Error    string    `json:"error,omitempty"`
+		Failures int       `json:"failures,omitempty"` // the failed checks in a row
+		Broken   bool      `json:"broken"`
+		Checked  time.Time `json:"checked"`
+	}
+)
+
+// PATCH /api/user/urls/{shortURL}
+type (
+	// UpdateURLRequest _
+	UpdateURLRequest struct {
+		URL string `json:"url"`
+	}
+
+	// UpdateURLResponse _
+	UpdateURLResponse struct {
+		Domain      string `json:"domain,omitempty"`
 		ShortURL    string `json:"short_url"`
 		OriginalURL string `json:"original_url"`
 	}
 )
 
+// PATCH /api/user/urls/{shortURL}/options
+type (
+	// URLOptionsRequest _ (the missing options are kept as they are)
+	URLOptionsRequest struct {
+		Title        *string   `json:"title,omitempty"`
+		Notes        *string   `json:"notes,omitempty"`
+		Tags         *[]string `json:"tags,omitempty"` // the empty list removes the tags
+		Preview      *bool     `json:"preview,omitempty"`
+		RedirectCode *int      `json:"redirect_code,omitempty"` // 301, 302, 307 or 308 (0 resets the default)
+		ExpiresAt    *string   `json:"expires_at,omitempty"`    // RFC 3339 (empty removes the expiry)
+		ForwardPath  *bool     `json:"forward_path,omitempty"`  // the path after the short URL is added to the destination
+		MergeQuery   *string   `json:"merge_query,omitempty"`   // incoming, stored or empty (the query is dropped)
+	}
+
+	// URLOptionsResponse _
+	URLOptionsResponse struct {
+		Domain       string     `json:"domain,omitempty"`
+		ShortURL     string     `json:"short_url"`
+		OriginalURL  string     `json:"original_url"`
+		Title        string     `json:"title"`
+		Notes        string     `json:"notes,omitempty"`
+		Tags         []string   `json:"tags,omitempty"`
+		Preview      bool       `json:"preview"`
+		RedirectCode int        `json:"redirect_code,omitempty"`
+		ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+		ForwardPath  bool       `json:"forward_path"`
+		MergeQuery   string     `json:"merge_query,omitempty"`
+	}
+)
+
+// GET /api/user/urls/{shortURL}/revisions
+type (
+	// URLRevisionsResponseItem _
+	URLRevisionsResponseItem struct {
+		Revision    int64     `json:"revision"`
+		OriginalURL string    `json:"original_url"`
+		PreviousURL string    `json:"previous_url"`
+		Time        time.Time `json:"time"`
+	}
+)
+
+// POST /api/user/webhooks, GET /api/user/webhooks
+type (
+	// WebhookRequest _ (no events means all the events)
+	WebhookRequest struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events,omitempty"` // link.created, link.clicked, link.expired, link.deleted, link.broken
+	}
+
+	// WebhookResponse _
+	WebhookResponse struct {
+		ID      int64     `json:"id"`
+		URL     string    `json:"url"`
+		Events  []string  `json:"events,omitempty"`
+		Secret  string    `json:"secret,omitempty"` // the signature key is shown only when the webhook is created
+		Created time.Time `json:"created"`
+	}
+)
+
+// GET /api/user/webhooks/{id}/deliveries
+type (
+	// WebhookDeliveryResponseItem _
+	WebhookDeliveryResponseItem struct {
+		ID           int64      `json:"id"`
+		Event        string     `json:"event"`
+		Status       string     `json:"status"` // pending, delivered or failed
+		Attempts     int        `json:"attempts"`
+		ResponseCode int        `json:"response_code,omitempty"`
+		Error        string     `json:"error,omitempty"`
+		Created      time.Time  `json:"created"`
+		Updated      time.Time  `json:"updated"`
+		NextTry      *time.Time `json:"next_try,omitempty"` // for the pending deliveries
+	}
+)
+
 // DeleteTask is element for batch deleting chan
 type (
 	DeleteTask struct {
@@ -65,7 +246,25 @@ type (
 type (
 	// StatsResponse _
 	StatsResponse struct {
-		URLs  int `json:"urls"`
-		Users int `json:"users"`
+		URLs    int            `json:"urls"`
+		Users   int            `json:"users"`
+		Domains map[string]int `json:"domains,omitempty"` // the number of the URLs by the domain
+	}
+)
+
+// GET /healthz, GET /readyz
+type (
+	// HealthResponse _
+	HealthResponse struct {
+		Status string            `json:"status"`
+		Checks []HealthCheckItem `json:"checks,omitempty"`
+	}
+
+	// HealthCheckItem _
+	HealthCheckItem struct {
+		Name     string `json:"name"`
+		Status   string `json:"status"`
+		Error    string `json:"error,omitempty"`
+		Duration string `json:"duration"`
 	}
 )
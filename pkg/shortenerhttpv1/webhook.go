@@ -0,0 +1,41 @@
+package shortenerhttpv1
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// The headers of the webhook request.
+const (
+	WebhookEventHeader     = "X-Shortener-Event"
+	WebhookDeliveryHeader  = "X-Shortener-Delivery" // the delivery ID is the same for all the attempts
+	WebhookTimestampHeader = "X-Shortener-Timestamp"
+	WebhookSignatureHeader = "X-Shortener-Signature" // sha256=<hex>
+)
+
+// WebhookSignaturePrefix is the prefix of the signature header value.
+const WebhookSignaturePrefix = "sha256="
+
+// WebhookEvent is the JSON body of the webhook request (POST to the webhook URL).
+type WebhookEvent struct {
+	Type        string    `json:"type"`
+	Time        time.Time `json:"time"`
+	ShortURL    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url,omitempty"`
+}
+
+// WebhookSignature returns the value of the signature header of the webhook request:
+// HMAC-SHA256 of the timestamp header value, the dot and the body with the webhook secret.
+//
+// The receiver computes the signature in the same way and compares it with hmac.Equal,
+// the old timestamp means the request is replayed.
+func WebhookSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return WebhookSignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}